@@ -0,0 +1,371 @@
+package apigatewayd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+// types of Lambda authorizers.
+const (
+	AuthorizerToken   = "TOKEN"
+	AuthorizerRequest = "REQUEST"
+)
+
+// DefaultAuthorizerResultTTL is duration for which results of authorizers are cached unless route table gives it.
+const DefaultAuthorizerResultTTL = 300 * time.Second
+
+// gateway responses of authorizers.
+var (
+	responseUnauthorized      = &gatewayResponse{http.StatusUnauthorized, "UnauthorizedException", "Unauthorized"}
+	responseAccessDenied      = &gatewayResponse{http.StatusForbidden, "AccessDeniedException", "User is not authorized to access this resource"}
+	responseExplicitDeny      = &gatewayResponse{http.StatusForbidden, "AccessDeniedException", "User is not authorized to access this resource with an explicit deny"}
+	responseAuthorizerFailure = &gatewayResponse{http.StatusInternalServerError, "AuthorizerConfigurationException", "Internal server error"}
+)
+
+var (
+	errUnauthorized = errors.New("unauthorized")
+	errContextValue = errors.New("context values must be string, number or boolean")
+)
+
+// Authorizer is Lambda authorizer which is invoked before integrations of routes referring to its name.
+type Authorizer struct {
+	Name string
+	// Type is TOKEN or REQUEST for REST APIs, while HTTP APIs have REQUEST authorizers only.
+	Type string
+	// Function is name or arn of function, which may refer to stage variables such as ${stageVariables.alias}.
+	Function string
+	// IdentitySource are values of requests which identify callers, such as method.request.header.Authorization
+	// for REST APIs or $request.header.Authorization for HTTP APIs.
+	// Requests missing any of them are rejected without invoking function.
+	IdentitySource []string
+	// IdentityValidationExpression is regular expression which tokens of TOKEN authorizers must match.
+	IdentityValidationExpression string
+	// ResultTTL is duration for which results are cached by identity sources, and zero disables caching.
+	ResultTTL time.Duration
+	// EnableSimpleResponses lets functions of HTTP APIs respond with isAuthorized instead of IAM policy.
+	EnableSimpleResponses bool
+}
+
+// identitySource is value of request in identity source of authorizer.
+type identitySource struct {
+	// kind is header, querystring or stageVariables.
+	kind string
+	name string
+}
+
+// prefixes of identity sources and their kinds.
+var (
+	restIdentitySources = [][2]string{{"method.request.header.", "header"}, {"method.request.querystring.", "querystring"}, {"stageVariables.", "stageVariables"}}
+	httpIdentitySources = [][2]string{{"$request.header.", "header"}, {"$request.querystring.", "querystring"}, {"$stageVariables.", "stageVariables"}}
+)
+
+// parseIdentitySource parses identity source of REST APIs, or of HTTP APIs which starts with $.
+func parseIdentitySource(source string, httpAPI bool) (identitySource, error) {
+	s, prefixes := strings.TrimSpace(source), restIdentitySources
+	if httpAPI {
+		prefixes = httpIdentitySources
+	}
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p[0]) && len(s) > len(p[0]) {
+			return identitySource{kind: p[1], name: s[len(p[0]):]}, nil
+		}
+	}
+	return identitySource{}, fmt.Errorf("unsupported identity source: %s", source)
+}
+
+func (s identitySource) value(r *http.Request, vars map[string]string) string {
+	switch s.kind {
+	case "header":
+		return strings.Join(r.Header[http.CanonicalHeaderKey(s.name)], ",")
+	case "querystring":
+		return strings.Join(r.URL.Query()[s.name], ",")
+	}
+	return vars[s.name]
+}
+
+// authorizerResponse is response of authorizer in IAM policy, or simple response of HTTP APIs.
+type authorizerResponse struct {
+	PrincipalID    string                 `json:"principalId"`
+	PolicyDocument *policyDocument        `json:"policyDocument"`
+	IsAuthorized   *bool                  `json:"isAuthorized"`
+	Context        map[string]interface{} `json:"context"`
+}
+
+type policyDocument struct {
+	Version   string
+	Statement policyStatements
+}
+
+type policyStatement struct {
+	Effect   string
+	Action   stringList
+	Resource stringList
+}
+
+// policyStatements is list of statements, which policies may give as single statement.
+type policyStatements []policyStatement
+
+func (l *policyStatements) UnmarshalJSON(b []byte) error {
+	var st policyStatement
+	if err := json.Unmarshal(b, &st); err == nil {
+		*l = policyStatements{st}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]policyStatement)(l))
+}
+
+// stringList is list of strings, which policies may give as single string.
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*l = stringList{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(l))
+}
+
+// evaluate returns whether policy allows to invoke resource, and whether it is denied explicitly.
+// Explicit denies are preferred over allows, and resource is denied implicitly unless any statement allows it.
+func (doc *policyDocument) evaluate(resource string) (allowed, denied bool) {
+	for _, st := range doc.Statement {
+		if !wildcardMatchAny(st.Action, "execute-api:Invoke", true) || !wildcardMatchAny(st.Resource, resource, false) {
+			continue
+		}
+		switch {
+		case strings.EqualFold(st.Effect, "Deny"):
+			return false, true
+		case strings.EqualFold(st.Effect, "Allow"):
+			allowed = true
+		}
+	}
+	return allowed, false
+}
+
+// wildcardMatchAny reports whether s matches any of patterns, where * matches any characters and ? matches a character.
+func wildcardMatchAny(patterns []string, s string, ignoreCase bool) bool {
+	for _, p := range patterns {
+		expr := strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(p))
+		if ignoreCase {
+			expr = "(?i)" + expr
+		}
+		if regexp.MustCompile("^" + expr + "$").MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// stringContext returns context as values of strings, as REST APIs give to integrations.
+func stringContext(c map[string]interface{}) (map[string]string, error) {
+	m := make(map[string]string, len(c))
+	for k, v := range c {
+		switch v := v.(type) {
+		case string:
+			m[k] = v
+		case float64:
+			m[k] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			m[k] = strconv.FormatBool(v)
+		case nil:
+		default:
+			return nil, errContextValue
+		}
+	}
+	return m, nil
+}
+
+type authorizerResult struct {
+	response *authorizerResponse
+	expires  time.Time
+}
+
+type authorizer struct {
+	conf       *Authorizer
+	sources    []identitySource
+	validation *regexp.Regexp
+	httpAPI    bool
+
+	mu    sync.Mutex
+	cache map[string]*authorizerResult
+}
+
+// newAuthorizers returns authorizers by their names.
+// TOKEN authorizers read method.request.header.Authorization unless identity source is given.
+func newAuthorizers(list []*Authorizer, httpAPI bool) (map[string]*authorizer, error) {
+	m := map[string]*authorizer{}
+	for _, conf := range list {
+		if conf.Name == "" || conf.Function == "" {
+			return nil, errors.New("name and function of authorizer are required")
+		}
+		if _, ok := m[conf.Name]; ok {
+			return nil, fmt.Errorf("duplicate authorizer: %s", conf.Name)
+		}
+		a := &authorizer{conf: conf, httpAPI: httpAPI, cache: map[string]*authorizerResult{}}
+		sources := conf.IdentitySource
+		switch {
+		case conf.Type == AuthorizerRequest:
+		case conf.Type == AuthorizerToken && !httpAPI:
+			if len(sources) == 0 {
+				sources = []string{"method.request.header.Authorization"}
+			}
+			if len(sources) != 1 || !strings.HasPrefix(strings.TrimSpace(sources[0]), "method.request.header.") {
+				return nil, fmt.Errorf("identity source of TOKEN authorizer %s must be a header", conf.Name)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported type of authorizer %s: %s", conf.Name, conf.Type)
+		}
+		if conf.EnableSimpleResponses && !httpAPI {
+			return nil, fmt.Errorf("simple responses of authorizer %s are supported by HTTP API only", conf.Name)
+		}
+		if conf.ResultTTL > 0 && len(sources) == 0 {
+			return nil, fmt.Errorf("identity source of authorizer %s is required for caching", conf.Name)
+		}
+		for _, s := range sources {
+			src, err := parseIdentitySource(s, httpAPI)
+			if err != nil {
+				return nil, fmt.Errorf("authorizer %s: %v", conf.Name, err)
+			}
+			a.sources = append(a.sources, src)
+		}
+		if conf.IdentityValidationExpression != "" {
+			if conf.Type != AuthorizerToken {
+				return nil, fmt.Errorf("identity validation expression of authorizer %s is supported by TOKEN type only", conf.Name)
+			}
+			re, err := regexp.Compile("^(?:" + conf.IdentityValidationExpression + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("authorizer %s: %v", conf.Name, err)
+			}
+			a.validation = re
+		}
+		m[conf.Name] = a
+	}
+	return m, nil
+}
+
+// identity returns values of identity sources, and false when any of them is missing or token is invalid.
+func (a *authorizer) identity(r *http.Request, vars map[string]string) ([]string, bool) {
+	values := make([]string, 0, len(a.sources))
+	for _, s := range a.sources {
+		v := s.value(r, vars)
+		if v == "" {
+			return nil, false
+		}
+		values = append(values, v)
+	}
+	if a.validation != nil && !a.validation.MatchString(values[0]) {
+		return nil, false
+	}
+	return values, true
+}
+
+// authorize returns response of function for identity, which is cached for TTL of authorizer.
+// Responses are evaluated by caller for each request, so that cached policies apply to other resources.
+func (g *Gateway) authorize(ctx context.Context, a *authorizer, identity []string, vars map[string]string, event interface{}) (*authorizerResponse, *gatewayResponse) {
+	key := strings.Join(identity, "\x00")
+	if a.conf.ResultTTL > 0 {
+		a.mu.Lock()
+		res, ok := a.cache[key]
+		a.mu.Unlock()
+		if ok && time.Now().Before(res.expires) {
+			return res.response, nil
+		}
+	}
+
+	function := functionName(a.conf.Function, vars)
+	payload, _ := json.Marshal(event)
+	out, err := g.lambda.InvokeSync(ctx, &lambda.InvokeInput{
+		FunctionName: aws.String(function),
+		Payload:      payload,
+	})
+	if err != nil {
+		log.Printf("failed to invoke authorizer %s: %v", function, err)
+		return nil, responseAuthorizerFailure
+	}
+	res, err := a.parseResponse(out)
+	switch {
+	case err == errUnauthorized:
+		return nil, responseUnauthorized
+	case err != nil:
+		log.Printf("authorizer %s failed: %v: %s", function, err, out.Payload)
+		return nil, responseAuthorizerFailure
+	}
+	if a.conf.ResultTTL > 0 {
+		a.mu.Lock()
+		a.cache[key] = &authorizerResult{response: res, expires: time.Now().Add(a.conf.ResultTTL)}
+		a.mu.Unlock()
+	}
+	return res, nil
+}
+
+// parseResponse validates response of function, which is errUnauthorized when function fails with Unauthorized.
+func (a *authorizer) parseResponse(out *lambda.InvokeOutput) (*authorizerResponse, error) {
+	if out.FunctionError != nil {
+		var fe struct {
+			ErrorMessage string `json:"errorMessage"`
+		}
+		if err := json.Unmarshal(out.Payload, &fe); err == nil && fe.ErrorMessage == "Unauthorized" {
+			return nil, errUnauthorized
+		}
+		return nil, fmt.Errorf("function returned %s", *out.FunctionError)
+	}
+	var res authorizerResponse
+	if err := json.Unmarshal(out.Payload, &res); err != nil {
+		return nil, fmt.Errorf("malformed response: %v", err)
+	}
+	if a.conf.EnableSimpleResponses {
+		if res.IsAuthorized == nil {
+			return nil, errors.New("isAuthorized is required")
+		}
+		return &res, nil
+	}
+	if res.PrincipalID == "" || res.PolicyDocument == nil {
+		return nil, errors.New("principalId and policyDocument are required")
+	}
+	if !a.httpAPI {
+		if _, err := stringContext(res.Context); err != nil {
+			return nil, err
+		}
+	}
+	return &res, nil
+}
+
+// allows returns gateway response when response of authorizer does not allow to invoke resource.
+// HTTP APIs tell clients Forbidden without reasons.
+func (a *authorizer) allows(res *authorizerResponse, resource string) *gatewayResponse {
+	if a.conf.EnableSimpleResponses {
+		if !*res.IsAuthorized {
+			return responseForbidden
+		}
+		return nil
+	}
+	allowed, denied := res.PolicyDocument.evaluate(resource)
+	switch {
+	case allowed:
+		return nil
+	case a.httpAPI:
+		return responseForbidden
+	case denied:
+		return responseExplicitDeny
+	}
+	return responseAccessDenied
+}
+
+// executeAPIArn returns arn of method or route invoked by request, such as
+// arn:aws:execute-api:us-east-1:123456789012:abcdef123/prod/GET/pets/1.
+func (g *Gateway) executeAPIArn(apiID, stage, method, path string) string {
+	return fmt.Sprintf("arn:aws:execute-api:%s:%s:%s/%s/%s/%s", g.region, g.accountID, apiID, stage, method, strings.TrimPrefix(path, "/"))
+}
@@ -0,0 +1,212 @@
+package apigatewayd
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPolicyDocumentEvaluate(t *testing.T) {
+	const resource = "arn:aws:execute-api:us-east-1:000000000000:petstore/prod/GET/pets/1"
+	for _, tt := range []struct {
+		label   string
+		policy  string
+		allowed bool
+		denied  bool
+	}{
+		{"single statement", `{"Version":"2012-10-17","Statement":{"Action":"execute-api:Invoke","Effect":"Allow","Resource":"` + resource + `"}}`, true, false},
+		{"wildcard resource", `{"Statement":[{"Action":"execute-api:Invoke","Effect":"Allow","Resource":["arn:aws:execute-api:us-east-1:000000000000:petstore/prod/GET/*"]}]}`, true, false},
+		{"wildcard action", `{"Statement":[{"Action":["execute-api:*"],"Effect":"Allow","Resource":["*"]}]}`, true, false},
+		{"case of action", `{"Statement":[{"Action":"Execute-API:invoke","Effect":"Allow","Resource":"*"}]}`, true, false},
+		{"other method", `{"Statement":[{"Action":"execute-api:Invoke","Effect":"Allow","Resource":"arn:aws:execute-api:us-east-1:000000000000:petstore/prod/POST/*"}]}`, false, false},
+		{"single character", `{"Statement":[{"Action":"execute-api:Invoke","Effect":"Allow","Resource":"arn:aws:execute-api:us-east-1:000000000000:petstore/prod/GET/pets/?"}]}`, true, false},
+		{"other action", `{"Statement":[{"Action":"execute-api:ManageConnections","Effect":"Allow","Resource":"*"}]}`, false, false},
+		{"explicit deny", `{"Statement":[{"Action":"*","Effect":"Allow","Resource":"*"},{"Action":"*","Effect":"Deny","Resource":"*/GET/pets/*"}]}`, false, true},
+		{"empty", `{"Statement":[]}`, false, false},
+	} {
+		var doc policyDocument
+		if err := json.Unmarshal([]byte(tt.policy), &doc); err != nil {
+			t.Errorf("%s: unexpected error captured: %v", tt.label, err)
+			continue
+		}
+		if allowed, denied := doc.evaluate(resource); allowed != tt.allowed || denied != tt.denied {
+			t.Errorf("%s: unexpected result: allowed=%v denied=%v", tt.label, allowed, denied)
+		}
+	}
+}
+
+func TestRESTAuthorizers(t *testing.T) {
+	inv := &invokerMock{responses: map[string]string{
+		"pets": `{"statusCode":200,"body":"pet"}`,
+		"token": `{"principalId":"user-1","context":{"user":"tama","admin":true,"level":3},` +
+			`"policyDocument":{"Version":"2012-10-17","Statement":[{"Action":"execute-api:Invoke","Effect":"Allow","Resource":"arn:aws:execute-api:us-east-1:000000000000:petstore/prod/GET/pets/*"}]}}`,
+		"deny":   `{"principalId":"user-2","policyDocument":{"Statement":[{"Action":"*","Effect":"Allow","Resource":"*"},{"Action":"*","Effect":"Deny","Resource":"*/owners"}]}}`,
+		"reject": `{"errorMessage":"Unauthorized","errorType":"Error"}`,
+		"broken": `{"principalId":"user-3","context":{"roles":["admin"]},"policyDocument":{"Statement":[{"Action":"*","Effect":"Allow","Resource":"*"}]}}`,
+	}}
+	gw := New("us-east-1", "000000000000", inv)
+	for _, api := range []*RESTAPI{
+		{Stage: "prod", Authorizers: []*Authorizer{{Name: "a", Type: "JWT", Function: "token"}}},
+		{Stage: "prod", Authorizers: []*Authorizer{{Name: "a", Type: AuthorizerToken, Function: "token", IdentitySource: []string{"method.request.querystring.token"}}}},
+		{Stage: "prod", Authorizers: []*Authorizer{{Name: "a", Type: AuthorizerRequest, Function: "deny", ResultTTL: time.Minute}}},
+		{Stage: "prod", Authorizers: []*Authorizer{{Name: "a", Type: AuthorizerRequest, Function: "deny", IdentitySource: []string{"$request.header.X-User"}}}},
+		{Stage: "prod", Authorizers: []*Authorizer{{Name: "a", Type: AuthorizerRequest, Function: "deny", IdentityValidationExpression: ".*"}}},
+		{Stage: "prod", Authorizers: []*Authorizer{{Name: "a", Type: AuthorizerToken, Function: "token"}, {Name: "a", Type: AuthorizerToken, Function: "token"}}},
+		{Stage: "prod", Routes: []*Route{{Method: "GET", Path: "/pets", Function: "pets", Authorizer: "missing"}}},
+	} {
+		if _, err := gw.RESTHandler(api); err == nil {
+			t.Errorf("error should exist for %#v", api)
+		}
+	}
+
+	h, err := gw.RESTHandler(&RESTAPI{
+		ID:    "petstore",
+		Stage: "prod",
+		Authorizers: []*Authorizer{
+			{Name: "token", Type: AuthorizerToken, Function: "token", IdentityValidationExpression: "Bearer .+", ResultTTL: time.Minute},
+			{Name: "deny", Type: AuthorizerRequest, Function: "deny", IdentitySource: []string{"method.request.header.X-User", "method.request.querystring.tenant"}},
+			{Name: "reject", Type: AuthorizerToken, Function: "reject"},
+			{Name: "broken", Type: AuthorizerToken, Function: "broken"},
+		},
+		Routes: []*Route{
+			{Method: MethodAny, Path: "/pets/{id}", Function: "pets", Authorizer: "token"},
+			{Method: "GET", Path: "/owners", Function: "pets", Authorizer: "deny"},
+			{Method: "GET", Path: "/reject", Function: "pets", Authorizer: "reject"},
+			{Method: "GET", Path: "/broken", Function: "pets", Authorizer: "broken"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		label     string
+		method    string
+		path      string
+		header    map[string]string
+		status    int
+		errorType string
+	}{
+		{"missing token", "GET", "/prod/pets/1", nil, 401, "UnauthorizedException"},
+		{"invalid token", "GET", "/prod/pets/1", map[string]string{"Authorization": "Basic dGFtYQ=="}, 401, "UnauthorizedException"},
+		{"allowed", "GET", "/prod/pets/1", map[string]string{"Authorization": "Bearer abc"}, 200, ""},
+		{"cached", "GET", "/prod/pets/2", map[string]string{"Authorization": "Bearer abc"}, 200, ""},
+		{"cached policy of other method", "DELETE", "/prod/pets/1", map[string]string{"Authorization": "Bearer abc"}, 403, "AccessDeniedException"},
+		{"missing query", "GET", "/prod/owners", map[string]string{"X-User": "tama"}, 401, "UnauthorizedException"},
+		{"explicit deny", "GET", "/prod/owners?tenant=a", map[string]string{"X-User": "tama"}, 403, "AccessDeniedException"},
+		{"unauthorized", "GET", "/prod/reject", map[string]string{"Authorization": "abc"}, 401, "UnauthorizedException"},
+		{"object in context", "GET", "/prod/broken", map[string]string{"Authorization": "abc"}, 500, "AuthorizerConfigurationException"},
+	} {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status || rec.Header().Get("x-amzn-ErrorType") != tt.errorType {
+			t.Errorf("%s: unexpected response: %d %v %s", tt.label, rec.Code, rec.Header(), rec.Body)
+		}
+	}
+	if n := inv.count("token"); n != 1 {
+		t.Errorf("results of authorizer should be cached, but invoked %d times", n)
+	}
+	var token restTokenAuthorizerEvent
+	inv.last("token", &token)
+	if token.Type != AuthorizerToken || token.AuthorizationToken != "Bearer abc" ||
+		token.MethodArn != "arn:aws:execute-api:us-east-1:000000000000:petstore/prod/GET/pets/1" {
+		t.Errorf("unexpected event: %#v", token)
+	}
+	if n := inv.count("pets"); n != 2 {
+		t.Errorf("unexpected invocations: %d", n)
+	}
+	var ev restEvent
+	inv.last("pets", &ev)
+	if a := ev.RequestContext.Authorizer; a["principalId"] != "user-1" || a["user"] != "tama" || a["admin"] != "true" || a["level"] != "3" {
+		t.Errorf("unexpected authorizer in request context: %v", a)
+	}
+	var request restRequestAuthorizerEvent
+	inv.last("deny", &request)
+	if request.Type != AuthorizerRequest || request.MethodArn != "arn:aws:execute-api:us-east-1:000000000000:petstore/prod/GET/owners" ||
+		request.Resource != "/owners" || request.Headers["X-User"] != "tama" || request.QueryStringParameters["tenant"] != "a" {
+		t.Errorf("unexpected event: %#v", request)
+	}
+}
+
+func TestHTTPAuthorizers(t *testing.T) {
+	inv := &invokerMock{responses: map[string]string{
+		"pets":   `{"statusCode":200,"body":"pet"}`,
+		"simple": `{"isAuthorized":true,"context":{"user":"tama","roles":["admin"]}}`,
+		"closed": `{"isAuthorized":false}`,
+		"policy": `{"principalId":"user-1","policyDocument":{"Statement":[{"Action":"execute-api:Invoke","Effect":"Allow","Resource":"arn:aws:execute-api:us-east-1:000000000000:xyz789/$default/GET/*"}]}}`,
+	}}
+	gw := New("us-east-1", "000000000000", inv)
+	for _, api := range []*HTTPAPI{
+		{Stage: DefaultHTTPStage, Authorizers: []*Authorizer{{Name: "a", Type: AuthorizerToken, Function: "simple"}}},
+		{Stage: DefaultHTTPStage, Authorizers: []*Authorizer{{Name: "a", Type: AuthorizerRequest, Function: "simple", IdentitySource: []string{"method.request.header.Authorization"}}}},
+	} {
+		if _, err := gw.HTTPHandler(api); err == nil {
+			t.Errorf("error should exist for %#v", api)
+		}
+	}
+
+	h, err := gw.HTTPHandler(&HTTPAPI{
+		ID:    "xyz789",
+		Stage: DefaultHTTPStage,
+		Authorizers: []*Authorizer{
+			{Name: "simple", Type: AuthorizerRequest, Function: "simple", IdentitySource: []string{"$request.header.Authorization"}, EnableSimpleResponses: true},
+			{Name: "closed", Type: AuthorizerRequest, Function: "closed", EnableSimpleResponses: true},
+			{Name: "policy", Type: AuthorizerRequest, Function: "policy", IdentitySource: []string{"$request.header.Authorization"}, ResultTTL: time.Minute},
+		},
+		Routes: []*Route{
+			{Method: "GET", Path: "/pets/{id}", Function: "pets", Authorizer: "simple"},
+			{Method: "GET", Path: "/closed", Function: "pets", Authorizer: "closed"},
+			{Method: MethodAny, Path: "/owners", Function: "pets", Authorizer: "policy"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		label  string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{"missing identity", "GET", "/pets/1", "", 401},
+		{"simple response", "GET", "/pets/1", "abc", 200},
+		{"not authorized", "GET", "/closed", "", 403},
+		{"allowed by policy", "GET", "/owners", "abc", 200},
+		{"denied by cached policy", "POST", "/owners", "abc", 403},
+	} {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", tt.token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: unexpected response: %d %s", tt.label, rec.Code, rec.Body)
+		}
+	}
+	if n := inv.count("policy"); n != 1 {
+		t.Errorf("results of authorizer should be cached, but invoked %d times", n)
+	}
+	var aev httpAuthorizerEvent
+	inv.last("simple", &aev)
+	if aev.Version != "2.0" || aev.Type != AuthorizerRequest || aev.RouteArn != "arn:aws:execute-api:us-east-1:000000000000:xyz789/$default/GET/pets/1" ||
+		len(aev.IdentitySource) != 1 || aev.IdentitySource[0] != "abc" || aev.RouteKey != "GET /pets/{id}" || aev.PathParameters["id"] != "1" {
+		t.Errorf("unexpected event: %#v", aev)
+	}
+	var ev httpEvent
+	inv.last("pets", &ev)
+	if ev.RequestContext.Authorizer == nil || len(ev.RequestContext.Authorizer.Lambda) != 0 {
+		t.Errorf("unexpected authorizer in request context: %#v", ev.RequestContext.Authorizer)
+	}
+	inv.mu.Lock()
+	json.Unmarshal(inv.payloads["pets"][0], &ev)
+	inv.mu.Unlock()
+	if a := ev.RequestContext.Authorizer; a == nil || a.Lambda["user"] != "tama" || a.Lambda["roles"].([]interface{})[0] != "admin" {
+		t.Errorf("unexpected authorizer in request context: %#v", a)
+	}
+}
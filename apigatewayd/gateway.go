@@ -0,0 +1,242 @@
+// Package apigatewayd provides HTTP front ends emulating API Gateway and function URLs,
+// which translate requests into events of proxy integrations and invoke functions.
+package apigatewayd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+// MethodAny is method of routes which match any method.
+const MethodAny = "ANY"
+
+// Invoker invokes lambda function with waiting response, as LambdaService of wheelamb does.
+type Invoker interface {
+	InvokeSync(context.Context, *lambda.InvokeInput) (*lambda.InvokeOutput, error)
+}
+
+// Gateway builds HTTP handlers of APIs, whose integrations invoke functions by Invoker.
+type Gateway struct {
+	region    string
+	accountID string
+	lambda    Invoker
+}
+
+// New returns Gateway object. Request contexts of events have given region and accountID.
+func New(region, accountID string, inv Invoker) *Gateway {
+	return &Gateway{region: region, accountID: accountID, lambda: inv}
+}
+
+// gatewayResponse is response which API Gateway returns without integration, such as errors.
+type gatewayResponse struct {
+	status    int
+	errorType string
+	message   string
+}
+
+// gateway responses in API Gateway.
+// via https://docs.aws.amazon.com/apigateway/latest/developerguide/supported-gateway-response-types.html
+var (
+	responseMissingToken       = &gatewayResponse{http.StatusForbidden, "MissingAuthenticationTokenException", "Missing Authentication Token"}
+	responseForbidden          = &gatewayResponse{http.StatusForbidden, "ForbiddenException", "Forbidden"}
+	responseNotFound           = &gatewayResponse{http.StatusNotFound, "NotFoundException", "Not Found"}
+	responseBadRequest         = &gatewayResponse{http.StatusBadRequest, "BadRequestException", "Bad Request"}
+	responseIntegrationFailure = &gatewayResponse{http.StatusInternalServerError, "InternalServerErrorException", "Internal server error"}
+	responseBadGateway         = &gatewayResponse{http.StatusBadGateway, "InternalServerErrorException", "Internal server error"}
+)
+
+func (res *gatewayResponse) write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("x-amzn-ErrorType", res.errorType)
+	w.WriteHeader(res.status)
+	json.NewEncoder(w).Encode(map[string]string{"message": res.message})
+}
+
+// invoke invokes function with payload, and returns payload of response.
+// Errors are gateway responses, as API Gateway hides details of failures from clients.
+func (g *Gateway) invoke(ctx context.Context, function string, payload []byte) ([]byte, *gatewayResponse) {
+	out, err := g.lambda.InvokeSync(ctx, &lambda.InvokeInput{
+		FunctionName: aws.String(function),
+		Payload:      payload,
+	})
+	if err != nil {
+		log.Printf("failed to invoke %s: %v", function, err)
+		return nil, responseIntegrationFailure
+	}
+	if out.FunctionError != nil {
+		log.Printf("%s returned %s: %s", function, *out.FunctionError, out.Payload)
+		return nil, responseBadGateway
+	}
+	return out.Payload, nil
+}
+
+// segment kinds in order of priority, where literal segments are preferred over variables.
+const (
+	segmentLiteral = iota
+	segmentVariable
+	segmentGreedy
+)
+
+type templateSegment struct {
+	kind  int
+	value string
+}
+
+// pathTemplate is resource path such as /pets/{id} or /files/{proxy+}.
+type pathTemplate struct {
+	path     string
+	segments []templateSegment
+}
+
+func compilePathTemplate(path string) (*pathTemplate, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("path must start with /: %s", path)
+	}
+	t := &pathTemplate{path: path}
+	if path == "/" {
+		return t, nil
+	}
+	parts := strings.Split(path[1:], "/")
+	for i, p := range parts {
+		switch {
+		case p == "":
+			return nil, fmt.Errorf("path must not have empty segment: %s", path)
+		case strings.HasPrefix(p, "{") && strings.HasSuffix(p, "+}"):
+			if i != len(parts)-1 {
+				return nil, fmt.Errorf("greedy variable must be the last segment: %s", path)
+			}
+			t.segments = append(t.segments, templateSegment{segmentGreedy, p[1 : len(p)-2]})
+		case strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}"):
+			t.segments = append(t.segments, templateSegment{segmentVariable, p[1 : len(p)-1]})
+		default:
+			t.segments = append(t.segments, templateSegment{segmentLiteral, p})
+		}
+	}
+	return t, nil
+}
+
+// match returns path parameters when template matches segments of path, which are escaped.
+func (t *pathTemplate) match(segments []string) (map[string]string, bool) {
+	params := map[string]string{}
+	for i, s := range t.segments {
+		if i >= len(segments) {
+			return nil, false
+		}
+		if s.kind == segmentGreedy {
+			rest := make([]string, 0, len(segments)-i)
+			for _, seg := range segments[i:] {
+				rest = append(rest, unescapeSegment(seg))
+			}
+			params[s.value] = strings.Join(rest, "/")
+			return params, true
+		}
+		v := unescapeSegment(segments[i])
+		if s.kind == segmentLiteral && s.value != v {
+			return nil, false
+		}
+		if s.kind == segmentVariable {
+			params[s.value] = v
+		}
+	}
+	return params, len(segments) == len(t.segments)
+}
+
+// moreSpecific reports whether t is preferred over o when both match.
+func (t *pathTemplate) moreSpecific(o *pathTemplate) bool {
+	for i := 0; i < len(t.segments) && i < len(o.segments); i++ {
+		if a, b := t.segments[i].kind, o.segments[i].kind; a != b {
+			return a < b
+		}
+	}
+	return len(t.segments) > len(o.segments)
+}
+
+// splitPath returns escaped segments of path, which is empty for /.
+func splitPath(escaped string) []string {
+	p := strings.TrimPrefix(escaped, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+func unescapeSegment(s string) string {
+	if v, err := url.PathUnescape(s); err == nil {
+		return v
+	}
+	return s
+}
+
+// mediaTypeMatches reports whether content type matches any of media types such as image/png, image/* or */*.
+func mediaTypeMatches(contentType string, mediaTypes []string) bool {
+	if contentType == "" {
+		return false
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mt = contentType
+	}
+	for _, t := range mediaTypes {
+		switch {
+		case t == "*/*", t == mt:
+			return true
+		case strings.HasSuffix(t, "/*") && strings.HasPrefix(mt, strings.TrimSuffix(t, "*")):
+			return true
+		}
+	}
+	return false
+}
+
+// routeTable selects route of request by method and path.
+type routeTable struct {
+	methods   []string
+	templates []*pathTemplate
+}
+
+// add adds route, and returns error when route of the same method and path exists.
+func (t *routeTable) add(method, path string) error {
+	tmpl, err := compilePathTemplate(path)
+	if err != nil {
+		return err
+	}
+	for i, m := range t.methods {
+		if m == method && t.templates[i].path == path {
+			return fmt.Errorf("duplicate route: %s %s", method, path)
+		}
+	}
+	t.methods = append(t.methods, method)
+	t.templates = append(t.templates, tmpl)
+	return nil
+}
+
+// lookup returns index and path parameters of the most specific route, whose method is preferred over ANY.
+// Index is -1 when no route matches.
+func (t *routeTable) lookup(method string, segments []string) (int, map[string]string) {
+	index, params := -1, map[string]string(nil)
+	for i, tmpl := range t.templates {
+		if t.methods[i] != method && t.methods[i] != MethodAny {
+			continue
+		}
+		p, ok := tmpl.match(segments)
+		if !ok {
+			continue
+		}
+		if index >= 0 {
+			best := t.templates[index]
+			if !tmpl.moreSpecific(best) && (best.moreSpecific(tmpl) || t.methods[index] != MethodAny || t.methods[i] == MethodAny) {
+				continue
+			}
+		}
+		index, params = i, p
+	}
+	return index, params
+}
@@ -0,0 +1,361 @@
+package apigatewayd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/taiyoh/wheelamb"
+)
+
+// DefaultHTTPStage is stage of HTTP APIs which is served without stage in path.
+const DefaultHTTPStage = "$default"
+
+// RouteDefault is path of route which handles requests no other routes match.
+const RouteDefault = "$default"
+
+// HTTPAPI is HTTP API whose routes invoke functions by lambda proxy integration in payload format 2.0.
+type HTTPAPI struct {
+	// ID is id of API in request context.
+	ID string
+	// Stage is $default, or the first segment of URL path.
+	Stage          string
+	StageVariables map[string]string
+	// Routes are matched by method and path, and the route of RouteDefault handles the others.
+	Routes []*Route
+	// Authorizers are REQUEST authorizers whose events are in payload format 2.0.
+	Authorizers []*Authorizer
+}
+
+type httpDescription struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Protocol  string `json:"protocol"`
+	SourceIP  string `json:"sourceIp"`
+	UserAgent string `json:"userAgent"`
+}
+
+type httpRequestContext struct {
+	AccountID    string          `json:"accountId"`
+	APIID        string          `json:"apiId"`
+	DomainName   string          `json:"domainName"`
+	DomainPrefix string          `json:"domainPrefix"`
+	HTTP         httpDescription `json:"http"`
+	RequestID    string          `json:"requestId"`
+	RouteKey     string          `json:"routeKey"`
+	Stage        string          `json:"stage"`
+	Time         string          `json:"time"`
+	TimeEpoch    int64           `json:"timeEpoch"`
+	Authorizer   *httpAuthorizer `json:"authorizer,omitempty"`
+}
+
+// httpAuthorizer is context given by Lambda authorizer.
+type httpAuthorizer struct {
+	Lambda map[string]interface{} `json:"lambda"`
+}
+
+// httpEvent is event of lambda proxy integration in payload format 2.0, which function URLs also send.
+// via https://docs.aws.amazon.com/apigateway/latest/developerguide/http-api-develop-integrations-lambda.html
+type httpEvent struct {
+	Version               string             `json:"version"`
+	RouteKey              string             `json:"routeKey"`
+	RawPath               string             `json:"rawPath"`
+	RawQueryString        string             `json:"rawQueryString"`
+	Cookies               []string           `json:"cookies,omitempty"`
+	Headers               map[string]string  `json:"headers"`
+	QueryStringParameters map[string]string  `json:"queryStringParameters,omitempty"`
+	PathParameters        map[string]string  `json:"pathParameters,omitempty"`
+	StageVariables        map[string]string  `json:"stageVariables,omitempty"`
+	RequestContext        httpRequestContext `json:"requestContext"`
+	Body                  string             `json:"body,omitempty"`
+	IsBase64Encoded       bool               `json:"isBase64Encoded"`
+}
+
+// httpAuthorizerEvent is event of authorizers in payload format 2.0, which has request without body.
+type httpAuthorizerEvent struct {
+	Type           string   `json:"type"`
+	RouteArn       string   `json:"routeArn"`
+	IdentitySource []string `json:"identitySource"`
+	httpEvent
+}
+
+// newHTTPEvent builds event of payload format 2.0 from request, whose route and API are set by caller.
+// Headers of the same name are joined by comma, and cookies are given separately from headers.
+func (g *Gateway) newHTTPEvent(r *http.Request, requestID string) (*httpEvent, error) {
+	now := time.Now()
+	ev := &httpEvent{
+		Version:        "2.0",
+		RawPath:        r.URL.EscapedPath(),
+		RawQueryString: r.URL.RawQuery,
+		Headers:        map[string]string{},
+		RequestContext: httpRequestContext{
+			AccountID:    g.accountID,
+			DomainName:   r.Host,
+			DomainPrefix: strings.SplitN(r.Host, ".", 2)[0],
+			HTTP: httpDescription{
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Protocol:  r.Proto,
+				SourceIP:  sourceIP(r),
+				UserAgent: r.UserAgent(),
+			},
+			RequestID: requestID,
+			Time:      now.UTC().Format("02/Jan/2006:15:04:05 -0700"),
+			TimeEpoch: now.UnixNano() / int64(time.Millisecond),
+		},
+	}
+	for k, vs := range r.Header {
+		if k == "Cookie" {
+			for _, v := range vs {
+				for _, c := range strings.Split(v, ";") {
+					if c = strings.TrimSpace(c); c != "" {
+						ev.Cookies = append(ev.Cookies, c)
+					}
+				}
+			}
+			continue
+		}
+		ev.Headers[strings.ToLower(k)] = strings.Join(vs, ",")
+	}
+	if r.Host != "" {
+		ev.Headers["host"] = r.Host
+	}
+	if q := r.URL.Query(); len(q) > 0 {
+		ev.QueryStringParameters = map[string]string{}
+		for k, vs := range q {
+			ev.QueryStringParameters[k] = strings.Join(vs, ",")
+		}
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read request body: %v", err)
+	}
+	if len(body) > 0 {
+		ev.Body = string(body)
+		if !isTextMediaType(r.Header.Get("Content-Type")) {
+			ev.Body, ev.IsBase64Encoded = base64.StdEncoding.EncodeToString(body), true
+		}
+	}
+	return ev, nil
+}
+
+// isTextMediaType reports whether body of content type is sent to functions as it is, instead of base64.
+func isTextMediaType(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mt, "text/"), strings.HasSuffix(mt, "+json"), strings.HasSuffix(mt, "+xml"):
+		return true
+	}
+	switch mt {
+	case "application/json", "application/javascript", "application/xml":
+		return true
+	}
+	return false
+}
+
+// httpResponse is response of function in payload format 2.0.
+type httpResponse struct {
+	StatusCode      *int              `json:"statusCode"`
+	Headers         map[string]string `json:"headers"`
+	Cookies         []string          `json:"cookies"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+}
+
+// parseHTTPResponse returns response of payload format 2.0 as proxyResponse.
+// Valid JSON without statusCode is the body of 200 response, as API Gateway infers.
+func parseHTTPResponse(out []byte) (*proxyResponse, error) {
+	if !json.Valid(out) {
+		return nil, errors.New("response is not valid JSON")
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(out, &fields); err != nil || fields["statusCode"] == nil {
+		status := http.StatusOK
+		return &proxyResponse{StatusCode: &status, Body: string(out)}, nil
+	}
+	var res httpResponse
+	if err := json.Unmarshal(out, &res); err != nil {
+		return nil, err
+	}
+	pres := &proxyResponse{
+		StatusCode:      res.StatusCode,
+		Headers:         res.Headers,
+		Body:            res.Body,
+		IsBase64Encoded: res.IsBase64Encoded,
+	}
+	if len(res.Cookies) > 0 {
+		pres.MultiValueHeaders = map[string][]string{"Set-Cookie": res.Cookies}
+	}
+	return pres, nil
+}
+
+type httpHandler struct {
+	gateway     *Gateway
+	api         *HTTPAPI
+	routes      routeTable
+	authorizers map[string]*authorizer
+	// indexes are those of routes in api, in order of routes in table.
+	indexes []int
+	// fallback is index of route of RouteDefault, or -1.
+	fallback int
+}
+
+// HTTPHandler returns http.Handler which serves api, under path of its stage unless it is $default.
+func (g *Gateway) HTTPHandler(api *HTTPAPI) (http.Handler, error) {
+	if api.Stage != DefaultHTTPStage && !stagePattern.MatchString(api.Stage) {
+		return nil, fmt.Errorf("invalid stage name: %q", api.Stage)
+	}
+	authorizers, err := newAuthorizers(api.Authorizers, true)
+	if err != nil {
+		return nil, err
+	}
+	h := &httpHandler{gateway: g, api: api, authorizers: authorizers, fallback: -1}
+	for i, rt := range api.Routes {
+		if rt.Function == "" {
+			return nil, fmt.Errorf("function of %s %s is required", rt.Method, rt.Path)
+		}
+		if _, ok := authorizers[rt.Authorizer]; rt.Authorizer != "" && !ok {
+			return nil, fmt.Errorf("authorizer of %s %s is not found: %s", rt.Method, rt.Path, rt.Authorizer)
+		}
+		if rt.Path == RouteDefault {
+			if h.fallback >= 0 {
+				return nil, errors.New("duplicate route: $default")
+			}
+			h.fallback = i
+			continue
+		}
+		if !restMethods[rt.Method] {
+			return nil, fmt.Errorf("invalid method of %s: %s", rt.Path, rt.Method)
+		}
+		if err := h.routes.add(rt.Method, rt.Path); err != nil {
+			return nil, err
+		}
+		h.indexes = append(h.indexes, i)
+	}
+	return h, nil
+}
+
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	w.Header().Set("Apigw-Requestid", requestID)
+
+	segments := splitPath(r.URL.EscapedPath())
+	if h.api.Stage != DefaultHTTPStage {
+		if len(segments) == 0 || unescapeSegment(segments[0]) != h.api.Stage {
+			responseNotFound.write(w)
+			return
+		}
+		segments = segments[1:]
+	}
+	i, params := h.routes.lookup(r.Method, segments)
+	if i >= 0 {
+		i = h.indexes[i]
+	} else {
+		i = h.fallback
+	}
+	if i < 0 {
+		responseNotFound.write(w)
+		return
+	}
+	rt := h.api.Routes[i]
+	ev, err := h.gateway.newHTTPEvent(r, requestID)
+	if err != nil {
+		responseBadRequest.write(w)
+		return
+	}
+	ev.RouteKey = rt.Method + " " + rt.Path
+	if rt.Path == RouteDefault {
+		ev.RouteKey = RouteDefault
+	}
+	if len(params) > 0 {
+		ev.PathParameters = params
+	}
+	ev.StageVariables = h.api.StageVariables
+	ev.RequestContext.APIID = h.api.ID
+	ev.RequestContext.RouteKey = ev.RouteKey
+	ev.RequestContext.Stage = h.api.Stage
+	if rt.Authorizer != "" {
+		if gres := h.authorize(r, rt, ev); gres != nil {
+			gres.write(w)
+			return
+		}
+	}
+	h.gateway.serveHTTPEvent(w, r, functionName(rt.Function, h.api.StageVariables), ev, nil)
+}
+
+// authorize invokes authorizer of route, and gives its context to request context of event.
+func (h *httpHandler) authorize(r *http.Request, rt *Route, ev *httpEvent) *gatewayResponse {
+	a := h.authorizers[rt.Authorizer]
+	identity, ok := a.identity(r, h.api.StageVariables)
+	if !ok {
+		return responseUnauthorized
+	}
+	path := r.URL.Path
+	if h.api.Stage != DefaultHTTPStage {
+		path = strings.TrimPrefix(path, "/"+h.api.Stage)
+	}
+	routeArn := h.gateway.executeAPIArn(h.api.ID, h.api.Stage, r.Method, path)
+	event := &httpAuthorizerEvent{Type: AuthorizerRequest, RouteArn: routeArn, IdentitySource: identity, httpEvent: *ev}
+	event.Body, event.IsBase64Encoded = "", false
+	res, gres := h.gateway.authorize(r.Context(), a, identity, h.api.StageVariables, event)
+	if gres != nil {
+		return gres
+	}
+	if gres := a.allows(res, routeArn); gres != nil {
+		return gres
+	}
+	ev.RequestContext.Authorizer = &httpAuthorizer{Lambda: res.Context}
+	if res.Context == nil {
+		ev.RequestContext.Authorizer.Lambda = map[string]interface{}{}
+	}
+	return nil
+}
+
+// serveHTTPEvent invokes function with event of payload format 2.0, and writes its response.
+// When cors is given, headers of CORS in the response are replaced with those for origin of request.
+func (g *Gateway) serveHTTPEvent(w http.ResponseWriter, r *http.Request, function string, ev *httpEvent, cors *wheelamb.FunctionURLCors) {
+	payload, _ := json.Marshal(ev)
+	out, gres := g.invoke(r.Context(), function, payload)
+	if gres != nil {
+		gres.write(w)
+		return
+	}
+	res, err := parseHTTPResponse(out)
+	if err != nil {
+		log.Printf("malformed response of %s: %v: %s", function, err, out)
+		responseBadGateway.write(w)
+		return
+	}
+	if cors != nil {
+		for k := range res.Headers {
+			if strings.HasPrefix(http.CanonicalHeaderKey(k), "Access-Control-") {
+				delete(res.Headers, k)
+			}
+		}
+		h := http.Header{}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			corsHeaders(h, cors, origin)
+		}
+		if len(h) > 0 && res.MultiValueHeaders == nil {
+			res.MultiValueHeaders = map[string][]string{}
+		}
+		for k, vs := range h {
+			res.MultiValueHeaders[k] = vs
+		}
+	}
+	if err := res.write(w, r); err != nil {
+		log.Printf("malformed response of %s: %v", function, err)
+		responseBadGateway.write(w)
+	}
+}
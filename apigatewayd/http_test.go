@@ -0,0 +1,139 @@
+package apigatewayd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseHTTPResponse(t *testing.T) {
+	for _, tt := range []struct {
+		label   string
+		out     string
+		status  int
+		body    string
+		cookies string
+	}{
+		{"structured", `{"statusCode":201,"body":"created","cookies":["a=1","b=2"]}`, 201, "created", "a=1,b=2"},
+		{"object without statusCode", `{"message":"hello"}`, 200, `{"message":"hello"}`, ""},
+		{"string", `"hello"`, 200, `"hello"`, ""},
+		{"null", `null`, 200, `null`, ""},
+	} {
+		res, err := parseHTTPResponse([]byte(tt.out))
+		if err != nil {
+			t.Errorf("%s: unexpected error captured: %v", tt.label, err)
+			continue
+		}
+		if *res.StatusCode != tt.status || res.Body != tt.body || strings.Join(res.MultiValueHeaders["Set-Cookie"], ",") != tt.cookies {
+			t.Errorf("%s: unexpected response: %#v", tt.label, res)
+		}
+	}
+	if _, err := parseHTTPResponse([]byte(`hello`)); err == nil {
+		t.Error("error should exist for invalid JSON")
+	}
+}
+
+func TestHTTPHandler(t *testing.T) {
+	inv := &invokerMock{responses: map[string]string{
+		"pets":     `{"statusCode":200,"headers":{"content-type":"text/plain"},"cookies":["session=abc; HttpOnly"],"body":"pet"}`,
+		"fallback": `{"message":"fallback"}`,
+	}}
+	gw := New("us-east-1", "000000000000", inv)
+	for _, api := range []*HTTPAPI{
+		{Stage: "$latest"},
+		{Stage: DefaultHTTPStage, Routes: []*Route{{Path: RouteDefault, Function: "a"}, {Path: RouteDefault, Function: "b"}}},
+		{Stage: DefaultHTTPStage, Routes: []*Route{{Method: "FETCH", Path: "/pets", Function: "a"}}},
+	} {
+		if _, err := gw.HTTPHandler(api); err == nil {
+			t.Errorf("error should exist for %#v", api)
+		}
+	}
+
+	h, err := gw.HTTPHandler(&HTTPAPI{
+		ID:    "xyz789",
+		Stage: DefaultHTTPStage,
+		Routes: []*Route{
+			{Method: "GET", Path: "/pets/{id}", Function: "pets"},
+			{Path: RouteDefault, Function: "fallback"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"/pets/my%20cat?tag=a&tag=b&q=1", nil)
+	req.Header.Add("X-Trace", "1")
+	req.Header.Add("X-Trace", "2")
+	req.Header.Set("Cookie", "theme=dark; lang=ja")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != 200 || string(body) != "pet" || res.Header.Get("Content-Type") != "text/plain" || res.Header.Get("Set-Cookie") != "session=abc; HttpOnly" {
+		t.Errorf("unexpected response: %d %v %s", res.StatusCode, res.Header, body)
+	}
+	var ev httpEvent
+	inv.last("pets", &ev)
+	if ev.Version != "2.0" || ev.RouteKey != "GET /pets/{id}" || ev.RawPath != "/pets/my%20cat" || ev.RawQueryString != "tag=a&tag=b&q=1" ||
+		strings.Join(ev.Cookies, ",") != "theme=dark,lang=ja" || ev.Headers["x-trace"] != "1,2" || ev.Headers["cookie"] != "" ||
+		ev.QueryStringParameters["tag"] != "a,b" || ev.PathParameters["id"] != "my cat" || ev.Body != "" {
+		t.Errorf("unexpected event: %#v", ev)
+	}
+	if rc := ev.RequestContext; rc.APIID != "xyz789" || rc.Stage != "$default" || rc.RouteKey != "GET /pets/{id}" ||
+		rc.HTTP.Method != "GET" || rc.HTTP.Path != "/pets/my cat" || rc.HTTP.SourceIP != "127.0.0.1" || rc.TimeEpoch == 0 {
+		t.Errorf("unexpected request context: %#v", rc)
+	}
+
+	for _, tt := range []struct {
+		contentType string
+		body        string
+		expected    string
+		encoded     bool
+	}{
+		{"application/json", `{"name":"tama"}`, `{"name":"tama"}`, false},
+		{"application/x-www-form-urlencoded", "name=tama", "bmFtZT10YW1h", true},
+	} {
+		res, err := http.Post(srv.URL+"/pets", tt.contentType, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != 200 || string(body) != `{"message":"fallback"}` || res.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected response: %d %v %s", res.StatusCode, res.Header, body)
+		}
+		inv.last("fallback", &ev)
+		if ev.RouteKey != RouteDefault || ev.Body != tt.expected || ev.IsBase64Encoded != tt.encoded {
+			t.Errorf("unexpected event: %#v", ev)
+		}
+	}
+
+	staged, err := gw.HTTPHandler(&HTTPAPI{Stage: "dev", Routes: []*Route{{Method: "GET", Path: "/pets/{id}", Function: "pets"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		path   string
+		status int
+	}{
+		{"/dev/pets/1", 200},
+		{"/pets/1", 404},
+		{"/dev/owners/1", 404},
+	} {
+		rec := httptest.NewRecorder()
+		staged.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s: unexpected status: %d", tt.path, rec.Code)
+		}
+	}
+	inv.last("pets", &ev)
+	if ev.RawPath != "/dev/pets/1" || ev.RequestContext.Stage != "dev" {
+		t.Errorf("unexpected event: %#v", ev)
+	}
+}
@@ -0,0 +1,311 @@
+package apigatewayd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultStage is stage of APIs whose route table does not give it.
+const DefaultStage = "local"
+
+// routeTableFile is route table file of API.
+// Routes can also be read from OpenAPI document given by openapi_file, whose path is relative to the route table.
+type routeTableFile struct {
+	ID               string            `yaml:"id"`
+	Stage            string            `yaml:"stage"`
+	StageVariables   map[string]string `yaml:"stage_variables"`
+	BinaryMediaTypes []string          `yaml:"binary_media_types"`
+	OpenAPIFile      string            `yaml:"openapi_file"`
+	Routes           []struct {
+		Method     string `yaml:"method"`
+		Path       string `yaml:"path"`
+		Function   string `yaml:"function"`
+		Authorizer string `yaml:"authorizer"`
+	} `yaml:"routes"`
+	Authorizers []struct {
+		Name                         string   `yaml:"name"`
+		Type                         string   `yaml:"type"`
+		Function                     string   `yaml:"function"`
+		IdentitySource               []string `yaml:"identity_source"`
+		IdentityValidationExpression string   `yaml:"identity_validation_expression"`
+		// ResultTTL is in seconds, which is 300 when omitted.
+		ResultTTL             *int `yaml:"result_ttl"`
+		EnableSimpleResponses bool `yaml:"enable_simple_responses"`
+	} `yaml:"authorizers"`
+}
+
+// openAPIDocument is OpenAPI or Swagger document exported from API Gateway, in YAML or JSON.
+type openAPIDocument struct {
+	OpenAPI          string                                 `yaml:"openapi"`
+	Swagger          string                                 `yaml:"swagger"`
+	BinaryMediaTypes []string                               `yaml:"x-amazon-apigateway-binary-media-types"`
+	Paths            map[string]map[string]openAPIOperation `yaml:"paths"`
+	// Security is default security requirements of operations.
+	Security   []map[string][]string `yaml:"security"`
+	Components struct {
+		SecuritySchemes map[string]openAPISecurityScheme `yaml:"securitySchemes"`
+	} `yaml:"components"`
+	// SecurityDefinitions are security schemes of Swagger.
+	SecurityDefinitions map[string]openAPISecurityScheme `yaml:"securityDefinitions"`
+}
+
+// openAPISecurityScheme is security scheme, which may be Lambda authorizer of API Gateway.
+type openAPISecurityScheme struct {
+	Authorizer *struct {
+		Type                         string    `yaml:"type"`
+		AuthorizerURI                string    `yaml:"authorizerUri"`
+		IdentitySource               commaList `yaml:"identitySource"`
+		IdentityValidationExpression string    `yaml:"identityValidationExpression"`
+		ResultTTL                    *int      `yaml:"authorizerResultTtlInSeconds"`
+		PayloadFormatVersion         string    `yaml:"authorizerPayloadFormatVersion"`
+		EnableSimpleResponses        bool      `yaml:"enableSimpleResponses"`
+	} `yaml:"x-amazon-apigateway-authorizer"`
+}
+
+// commaList is list given by sequence or by string separated by comma.
+type commaList []string
+
+func (l *commaList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		*l = nil
+		for _, v := range strings.Split(s, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				*l = append(*l, v)
+			}
+		}
+		return nil
+	}
+	return unmarshal((*[]string)(l))
+}
+
+// openAPIOperation is operation of path, which may have integration of API Gateway.
+type openAPIOperation struct {
+	Integration *struct {
+		Type string `yaml:"type"`
+		URI  string `yaml:"uri"`
+	}
+	// Security is nil when operation follows default security requirements.
+	Security []map[string][]string
+}
+
+// UnmarshalYAML reads integration of operation, ignoring other items of path such as parameters.
+func (o *openAPIOperation) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var op struct {
+		Integration *struct {
+			Type string `yaml:"type"`
+			URI  string `yaml:"uri"`
+		} `yaml:"x-amazon-apigateway-integration"`
+		Security []map[string][]string `yaml:"security"`
+	}
+	if err := unmarshal(&op); err == nil {
+		o.Integration, o.Security = op.Integration, op.Security
+	}
+	return nil
+}
+
+// LoadRESTAPI reads REST API from route table file, or from OpenAPI document with x-amazon-apigateway-integration.
+// Operations of OpenAPI document are routed when their integrations are aws_proxy to lambda functions.
+func LoadRESTAPI(path string) (*RESTAPI, error) {
+	api, err := loadAPI(path)
+	if err != nil {
+		return nil, err
+	}
+	if api.Stage == "" {
+		api.Stage = DefaultStage
+	}
+	return api, nil
+}
+
+// LoadHTTPAPI reads HTTP API from route table file or OpenAPI document, as LoadRESTAPI does.
+// Stage is $default unless route table gives it.
+func LoadHTTPAPI(path string) (*HTTPAPI, error) {
+	api, err := loadAPI(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(api.BinaryMediaTypes) > 0 {
+		return nil, fmt.Errorf("%s: binary media types are not supported by HTTP API", path)
+	}
+	if api.Stage == "" {
+		api.Stage = DefaultHTTPStage
+	}
+	for _, a := range api.Authorizers {
+		if a.Type == "" {
+			a.Type = AuthorizerRequest
+		}
+	}
+	return &HTTPAPI{ID: api.ID, Stage: api.Stage, StageVariables: api.StageVariables, Routes: api.Routes, Authorizers: api.Authorizers}, nil
+}
+
+// loadAPI reads API from route table file or OpenAPI document, whose stage is empty unless route table gives it.
+func loadAPI(path string) (*RESTAPI, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc openAPIDocument
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if doc.OpenAPI != "" || doc.Swagger != "" {
+		api := &RESTAPI{}
+		if err := api.addOpenAPIRoutes(&doc); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return api, nil
+	}
+
+	var table routeTableFile
+	if err := yaml.UnmarshalStrict(b, &table); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	api := &RESTAPI{
+		ID:               table.ID,
+		Stage:            table.Stage,
+		StageVariables:   table.StageVariables,
+		BinaryMediaTypes: table.BinaryMediaTypes,
+	}
+	for _, rt := range table.Routes {
+		api.Routes = append(api.Routes, &Route{Method: strings.ToUpper(rt.Method), Path: rt.Path, Function: rt.Function, Authorizer: rt.Authorizer})
+	}
+	for _, a := range table.Authorizers {
+		api.Authorizers = append(api.Authorizers, &Authorizer{
+			Name:                         a.Name,
+			Type:                         strings.ToUpper(a.Type),
+			Function:                     a.Function,
+			IdentitySource:               a.IdentitySource,
+			IdentityValidationExpression: a.IdentityValidationExpression,
+			ResultTTL:                    resultTTL(a.ResultTTL),
+			EnableSimpleResponses:        a.EnableSimpleResponses,
+		})
+	}
+	if table.OpenAPIFile != "" {
+		docPath := table.OpenAPIFile
+		if !filepath.IsAbs(docPath) {
+			docPath = filepath.Join(filepath.Dir(path), docPath)
+		}
+		b, err := ioutil.ReadFile(docPath)
+		if err != nil {
+			return nil, err
+		}
+		var doc openAPIDocument
+		if err := yaml.Unmarshal(b, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %v", docPath, err)
+		}
+		if err := api.addOpenAPIRoutes(&doc); err != nil {
+			return nil, fmt.Errorf("%s: %v", docPath, err)
+		}
+	}
+	return api, nil
+}
+
+// resultTTL returns TTL of authorizer results from seconds, which is DefaultAuthorizerResultTTL when omitted.
+func resultTTL(seconds *int) time.Duration {
+	if seconds == nil {
+		return DefaultAuthorizerResultTTL
+	}
+	return time.Duration(*seconds) * time.Second
+}
+
+// addOpenAPIRoutes adds routes of lambda proxy integrations in doc, in order of path and method.
+// Security schemes of Lambda authorizers are added as authorizers, which authorize operations requiring them.
+func (api *RESTAPI) addOpenAPIRoutes(doc *openAPIDocument) error {
+	api.BinaryMediaTypes = append(api.BinaryMediaTypes, doc.BinaryMediaTypes...)
+	schemes := doc.SecurityDefinitions
+	if len(doc.Components.SecuritySchemes) > 0 {
+		schemes = doc.Components.SecuritySchemes
+	}
+	names := make([]string, 0, len(schemes))
+	for name, sc := range schemes {
+		if sc.Authorizer != nil && (strings.EqualFold(sc.Authorizer.Type, AuthorizerToken) || strings.EqualFold(sc.Authorizer.Type, AuthorizerRequest)) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	authorizers := map[string]bool{}
+	for _, name := range names {
+		in := schemes[name].Authorizer
+		if in.PayloadFormatVersion != "" && in.PayloadFormatVersion != "2.0" {
+			return fmt.Errorf("payload format %s of authorizer %s is not supported", in.PayloadFormatVersion, name)
+		}
+		function, err := integrationFunction(in.AuthorizerURI)
+		if err != nil {
+			return fmt.Errorf("authorizer %s: %v", name, err)
+		}
+		api.Authorizers = append(api.Authorizers, &Authorizer{
+			Name:                         name,
+			Type:                         strings.ToUpper(in.Type),
+			Function:                     function,
+			IdentitySource:               in.IdentitySource,
+			IdentityValidationExpression: in.IdentityValidationExpression,
+			ResultTTL:                    resultTTL(in.ResultTTL),
+			EnableSimpleResponses:        in.EnableSimpleResponses,
+		})
+		authorizers[name] = true
+	}
+
+	paths := make([]string, 0, len(doc.Paths))
+	for p := range doc.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		methods := make([]string, 0, len(doc.Paths[p]))
+		for m := range doc.Paths[p] {
+			methods = append(methods, m)
+		}
+		sort.Strings(methods)
+		for _, m := range methods {
+			in := doc.Paths[p][m].Integration
+			if in == nil || !strings.EqualFold(in.Type, "aws_proxy") {
+				continue
+			}
+			function, err := integrationFunction(in.URI)
+			if err != nil {
+				return fmt.Errorf("%s %s: %v", m, p, err)
+			}
+			rt := &Route{Method: strings.ToUpper(m), Path: p, Function: function}
+			security := doc.Paths[p][m].Security
+			if security == nil {
+				security = doc.Security
+			}
+			for _, req := range security {
+				for name := range req {
+					if authorizers[name] {
+						rt.Authorizer = name
+					}
+				}
+			}
+			if m == "x-amazon-apigateway-any-method" {
+				rt.Method = MethodAny
+			}
+			// HTTP APIs export the default route as path of /$default.
+			if p == "/"+RouteDefault {
+				rt.Path = RouteDefault
+			}
+			api.Routes = append(api.Routes, rt)
+		}
+	}
+	return nil
+}
+
+// integrationFunction returns function arn in integration uri,
+// such as arn:aws:apigateway:us-east-1:lambda:path/2015-03-31/functions/arn:aws:lambda:us-east-1:123456789012:function:myfunc/invocations.
+// Integrations of HTTP APIs may give function arn itself.
+func integrationFunction(uri string) (string, error) {
+	if strings.HasPrefix(uri, "arn:aws:lambda:") {
+		return uri, nil
+	}
+	i := strings.Index(uri, "/functions/")
+	if i < 0 || !strings.HasSuffix(uri, "/invocations") {
+		return "", fmt.Errorf("integration uri is not lambda function: %s", uri)
+	}
+	return strings.TrimSuffix(uri[i+len("/functions/"):], "/invocations"), nil
+}
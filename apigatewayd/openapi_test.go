@@ -0,0 +1,205 @@
+package apigatewayd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadRESTAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apigatewayd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	write := func(name, content string) string {
+		t.Helper()
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	write("openapi.yml", `
+openapi: 3.0.1
+x-amazon-apigateway-binary-media-types: [image/png]
+security:
+  - token: []
+components:
+  securitySchemes:
+    token:
+      type: apiKey
+      name: Authorization
+      in: header
+      x-amazon-apigateway-authtype: custom
+      x-amazon-apigateway-authorizer:
+        type: token
+        authorizerUri: arn:aws:apigateway:us-east-1:lambda:path/2015-03-31/functions/arn:aws:lambda:us-east-1:000000000000:function:auth/invocations
+        authorizerResultTtlInSeconds: 60
+        identityValidationExpression: Bearer .+
+    sigv4:
+      type: apiKey
+      name: Authorization
+      in: header
+      x-amazon-apigateway-authtype: awsSigv4
+paths:
+  /pets/{id}:
+    parameters:
+      - name: id
+        in: path
+    get:
+      security:
+        - sigv4: []
+      x-amazon-apigateway-integration:
+        type: aws_proxy
+        httpMethod: POST
+        uri: arn:aws:apigateway:us-east-1:lambda:path/2015-03-31/functions/arn:aws:lambda:us-east-1:000000000000:function:pets/invocations
+    delete:
+      x-amazon-apigateway-integration:
+        type: mock
+  /{proxy+}:
+    x-amazon-apigateway-any-method:
+      x-amazon-apigateway-integration:
+        type: AWS_PROXY
+        uri: arn:aws:apigateway:us-east-1:lambda:path/2015-03-31/functions/arn:aws:lambda:us-east-1:000000000000:function:proxy:${stageVariables.alias}/invocations
+`)
+	routes := func(api *RESTAPI) string {
+		list := []string{}
+		for _, rt := range api.Routes {
+			list = append(list, rt.Method+" "+rt.Path+" "+rt.Function)
+		}
+		return strings.Join(list, ",")
+	}
+
+	api, err := LoadRESTAPI(filepath.Join(dir, "openapi.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "GET /pets/{id} arn:aws:lambda:us-east-1:000000000000:function:pets," +
+		"ANY /{proxy+} arn:aws:lambda:us-east-1:000000000000:function:proxy:${stageVariables.alias}"; routes(api) != expected {
+		t.Errorf("unexpected routes: %s", routes(api))
+	}
+	if api.Stage != DefaultStage || strings.Join(api.BinaryMediaTypes, ",") != "image/png" {
+		t.Errorf("unexpected api: %#v", api)
+	}
+	if len(api.Authorizers) != 1 || !reflect.DeepEqual(api.Authorizers[0], &Authorizer{
+		Name:                         "token",
+		Type:                         AuthorizerToken,
+		Function:                     "arn:aws:lambda:us-east-1:000000000000:function:auth",
+		IdentityValidationExpression: "Bearer .+",
+		ResultTTL:                    time.Minute,
+	}) {
+		t.Errorf("unexpected authorizers: %v", api.Authorizers)
+	}
+	if api.Routes[0].Authorizer != "" || api.Routes[1].Authorizer != "token" {
+		t.Errorf("unexpected authorizers of routes: %q %q", api.Routes[0].Authorizer, api.Routes[1].Authorizer)
+	}
+
+	api, err = LoadRESTAPI(write("routes.yml", `
+id: petstore
+stage: prod
+stage_variables:
+  alias: live
+openapi_file: openapi.yml
+routes:
+  - method: post
+    path: /pets
+    function: create
+    authorizer: request
+authorizers:
+  - name: request
+    type: request
+    function: auth
+    identity_source: [method.request.header.X-User]
+    result_ttl: 0
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "POST /pets create,GET /pets/{id} arn:aws:lambda:us-east-1:000000000000:function:pets," +
+		"ANY /{proxy+} arn:aws:lambda:us-east-1:000000000000:function:proxy:${stageVariables.alias}"; routes(api) != expected {
+		t.Errorf("unexpected routes: %s", routes(api))
+	}
+	if api.ID != "petstore" || api.Stage != "prod" || api.StageVariables["alias"] != "live" {
+		t.Errorf("unexpected api: %#v", api)
+	}
+	if len(api.Authorizers) != 2 || api.Authorizers[0].Name != "request" || api.Authorizers[0].Type != AuthorizerRequest ||
+		api.Authorizers[0].ResultTTL != 0 || api.Routes[0].Authorizer != "request" {
+		t.Errorf("unexpected authorizers: %v", api.Authorizers)
+	}
+
+	httpAPI, err := LoadHTTPAPI(write("httpapi.yml", `
+openapi: 3.0.1
+components:
+  securitySchemes:
+    simple:
+      type: apiKey
+      name: Authorization
+      in: header
+      x-amazon-apigateway-authorizer:
+        type: request
+        identitySource: $request.header.Authorization, $request.querystring.tenant
+        authorizerUri: arn:aws:apigateway:us-east-1:lambda:path/2015-03-31/functions/arn:aws:lambda:us-east-1:000000000000:function:auth/invocations
+        authorizerPayloadFormatVersion: "2.0"
+        enableSimpleResponses: true
+paths:
+  /$default:
+    x-amazon-apigateway-any-method:
+      security:
+        - simple: []
+      x-amazon-apigateway-integration:
+        type: aws_proxy
+        payloadFormatVersion: "2.0"
+        uri: arn:aws:lambda:us-east-1:000000000000:function:app
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(httpAPI.Routes) != 1 || httpAPI.Routes[0].Path != RouteDefault || httpAPI.Routes[0].Function != "arn:aws:lambda:us-east-1:000000000000:function:app" ||
+		httpAPI.Stage != DefaultHTTPStage || httpAPI.Routes[0].Authorizer != "simple" {
+		t.Errorf("unexpected api: %#v", httpAPI)
+	}
+	if len(httpAPI.Authorizers) != 1 || strings.Join(httpAPI.Authorizers[0].IdentitySource, ",") != "$request.header.Authorization,$request.querystring.tenant" ||
+		httpAPI.Authorizers[0].ResultTTL != DefaultAuthorizerResultTTL || !httpAPI.Authorizers[0].EnableSimpleResponses {
+		t.Errorf("unexpected authorizers: %v", httpAPI.Authorizers)
+	}
+	if _, err := LoadHTTPAPI(filepath.Join(dir, "openapi.yml")); err == nil {
+		t.Error("error should exist for binary media types of HTTP API")
+	}
+
+	for _, tt := range []struct {
+		label   string
+		content string
+	}{
+		{"unknown key", "stages: prod\n"},
+		{"missing openapi file", "openapi_file: missing.yml\n"},
+		{"not lambda integration", `
+swagger: "2.0"
+paths:
+  /pets:
+    get:
+      x-amazon-apigateway-integration:
+        type: aws_proxy
+        uri: arn:aws:apigateway:us-east-1:dynamodb:action/PutItem
+`},
+		{"authorizer payload format 1.0", `
+openapi: 3.0.1
+components:
+  securitySchemes:
+    auth:
+      x-amazon-apigateway-authorizer:
+        type: request
+        authorizerUri: arn:aws:lambda:us-east-1:000000000000:function:auth
+        authorizerPayloadFormatVersion: "1.0"
+paths: {}
+`},
+	} {
+		if _, err := LoadRESTAPI(write("invalid.yml", tt.content)); err == nil {
+			t.Errorf("%s: error should exist", tt.label)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package apigatewayd
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	stagePattern         = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	stageVariablePattern = regexp.MustCompile(`\$\{stageVariables\.([a-zA-Z0-9_]+)\}`)
+	restMethods          = map[string]bool{
+		http.MethodGet:     true,
+		http.MethodPost:    true,
+		http.MethodPut:     true,
+		http.MethodPatch:   true,
+		http.MethodDelete:  true,
+		http.MethodHead:    true,
+		http.MethodOptions: true,
+		MethodAny:          true,
+	}
+)
+
+// RESTAPI is REST API whose resources invoke functions by lambda proxy integration.
+type RESTAPI struct {
+	// ID is id of API in request context.
+	ID string
+	// Stage is the first segment of URL path, as in endpoints of API Gateway.
+	Stage          string
+	StageVariables map[string]string
+	// BinaryMediaTypes are content types such as image/png or image/*, whose request body is encoded in base64.
+	BinaryMediaTypes []string
+	Routes           []*Route
+	Authorizers      []*Authorizer
+}
+
+// Route invokes function for requests to resource path by method.
+type Route struct {
+	// Method is http method or ANY.
+	Method string
+	// Path is resource path such as /pets/{id} or /{proxy+}.
+	Path string
+	// Function is name or arn of function, which may refer to stage variables such as ${stageVariables.alias}.
+	Function string
+	// Authorizer is name of authorizer of API which authorizes requests before function is invoked, or empty.
+	Authorizer string
+}
+
+// restIdentity is identity of caller in request context.
+type restIdentity struct {
+	CognitoIdentityPoolID         *string `json:"cognitoIdentityPoolId"`
+	AccountID                     *string `json:"accountId"`
+	CognitoIdentityID             *string `json:"cognitoIdentityId"`
+	Caller                        *string `json:"caller"`
+	SourceIP                      string  `json:"sourceIp"`
+	PrincipalOrgID                *string `json:"principalOrgId"`
+	AccessKey                     *string `json:"accessKey"`
+	CognitoAuthenticationType     *string `json:"cognitoAuthenticationType"`
+	CognitoAuthenticationProvider *string `json:"cognitoAuthenticationProvider"`
+	UserArn                       *string `json:"userArn"`
+	UserAgent                     string  `json:"userAgent"`
+	User                          *string `json:"user"`
+}
+
+type restRequestContext struct {
+	ResourceID        string       `json:"resourceId"`
+	ResourcePath      string       `json:"resourcePath"`
+	HTTPMethod        string       `json:"httpMethod"`
+	ExtendedRequestID string       `json:"extendedRequestId"`
+	RequestTime       string       `json:"requestTime"`
+	Path              string       `json:"path"`
+	AccountID         string       `json:"accountId"`
+	Protocol          string       `json:"protocol"`
+	Stage             string       `json:"stage"`
+	DomainPrefix      string       `json:"domainPrefix"`
+	RequestTimeEpoch  int64        `json:"requestTimeEpoch"`
+	RequestID         string       `json:"requestId"`
+	Identity          restIdentity `json:"identity"`
+	DomainName        string       `json:"domainName"`
+	APIID             string       `json:"apiId"`
+	// Authorizer is principalId and context given by authorizer.
+	Authorizer map[string]string `json:"authorizer,omitempty"`
+}
+
+// restEvent is event of lambda proxy integration in payload format 1.0.
+// via https://docs.aws.amazon.com/apigateway/latest/developerguide/set-up-lambda-proxy-integrations.html
+type restEvent struct {
+	Resource                        string              `json:"resource"`
+	Path                            string              `json:"path"`
+	HTTPMethod                      string              `json:"httpMethod"`
+	Headers                         map[string]string   `json:"headers"`
+	MultiValueHeaders               map[string][]string `json:"multiValueHeaders"`
+	QueryStringParameters           map[string]string   `json:"queryStringParameters"`
+	MultiValueQueryStringParameters map[string][]string `json:"multiValueQueryStringParameters"`
+	PathParameters                  map[string]string   `json:"pathParameters"`
+	StageVariables                  map[string]string   `json:"stageVariables"`
+	RequestContext                  restRequestContext  `json:"requestContext"`
+	Body                            *string             `json:"body"`
+	IsBase64Encoded                 bool                `json:"isBase64Encoded"`
+}
+
+// restTokenAuthorizerEvent is event of TOKEN authorizers.
+type restTokenAuthorizerEvent struct {
+	Type               string `json:"type"`
+	AuthorizationToken string `json:"authorizationToken"`
+	MethodArn          string `json:"methodArn"`
+}
+
+// restRequestAuthorizerEvent is event of REQUEST authorizers, which has request without body.
+type restRequestAuthorizerEvent struct {
+	Type      string `json:"type"`
+	MethodArn string `json:"methodArn"`
+	restEvent
+}
+
+// proxyResponse is response of function for lambda proxy integration.
+type proxyResponse struct {
+	StatusCode        *int                `json:"statusCode"`
+	Headers           map[string]string   `json:"headers"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders"`
+	Body              string              `json:"body"`
+	IsBase64Encoded   bool                `json:"isBase64Encoded"`
+}
+
+// write writes response to client. Content-Type is application/json unless function gives it.
+func (res *proxyResponse) write(w http.ResponseWriter, r *http.Request) error {
+	body := []byte(res.Body)
+	if res.IsBase64Encoded {
+		b, err := base64.StdEncoding.DecodeString(res.Body)
+		if err != nil {
+			return err
+		}
+		body = b
+	}
+	h := w.Header()
+	for k, v := range res.Headers {
+		h.Set(k, v)
+	}
+	for k, vs := range res.MultiValueHeaders {
+		h.Del(k)
+		for _, v := range vs {
+			h.Add(k, v)
+		}
+	}
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(*res.StatusCode)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+	return nil
+}
+
+type restHandler struct {
+	gateway     *Gateway
+	api         *RESTAPI
+	routes      routeTable
+	authorizers map[string]*authorizer
+}
+
+// RESTHandler returns http.Handler which serves api under path of its stage, such as /prod/pets/1.
+func (g *Gateway) RESTHandler(api *RESTAPI) (http.Handler, error) {
+	if !stagePattern.MatchString(api.Stage) {
+		return nil, fmt.Errorf("invalid stage name: %q", api.Stage)
+	}
+	authorizers, err := newAuthorizers(api.Authorizers, false)
+	if err != nil {
+		return nil, err
+	}
+	h := &restHandler{gateway: g, api: api, authorizers: authorizers}
+	for _, rt := range api.Routes {
+		if !restMethods[rt.Method] {
+			return nil, fmt.Errorf("invalid method of %s: %s", rt.Path, rt.Method)
+		}
+		if rt.Function == "" {
+			return nil, fmt.Errorf("function of %s %s is required", rt.Method, rt.Path)
+		}
+		if _, ok := authorizers[rt.Authorizer]; rt.Authorizer != "" && !ok {
+			return nil, fmt.Errorf("authorizer of %s %s is not found: %s", rt.Method, rt.Path, rt.Authorizer)
+		}
+		if err := h.routes.add(rt.Method, rt.Path); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// resourceID returns id of resource, which is stable for path.
+func resourceID(path string) string {
+	sum := sha1.Sum([]byte(path))
+	return hex.EncodeToString(sum[:3])
+}
+
+// functionName returns function of route, whose references to stage variables are replaced.
+func functionName(function string, vars map[string]string) string {
+	return stageVariablePattern.ReplaceAllStringFunc(function, func(ref string) string {
+		return vars[stageVariablePattern.FindStringSubmatch(ref)[1]]
+	})
+}
+
+func (h *restHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	w.Header().Set("x-amzn-RequestId", requestID)
+
+	segments := splitPath(r.URL.EscapedPath())
+	if len(segments) == 0 || unescapeSegment(segments[0]) != h.api.Stage {
+		responseForbidden.write(w)
+		return
+	}
+	i, params := h.routes.lookup(r.Method, segments[1:])
+	if i < 0 {
+		responseMissingToken.write(w)
+		return
+	}
+	rt := h.api.Routes[i]
+	event, err := h.event(r, requestID, rt, params)
+	if err != nil {
+		responseBadRequest.write(w)
+		return
+	}
+	if rt.Authorizer != "" {
+		if gres := h.authorize(r, rt, event); gres != nil {
+			gres.write(w)
+			return
+		}
+	}
+	payload, _ := json.Marshal(event)
+	out, gres := h.gateway.invoke(r.Context(), functionName(rt.Function, h.api.StageVariables), payload)
+	if gres != nil {
+		gres.write(w)
+		return
+	}
+	var res proxyResponse
+	if err := json.Unmarshal(out, &res); err != nil || res.StatusCode == nil {
+		log.Printf("malformed lambda proxy response of %s: %s", rt.Function, out)
+		responseBadGateway.write(w)
+		return
+	}
+	if err := res.write(w, r); err != nil {
+		log.Printf("malformed lambda proxy response of %s: %v", rt.Function, err)
+		responseBadGateway.write(w)
+	}
+}
+
+// authorize invokes authorizer of route, and gives its principal and context to request context of event.
+func (h *restHandler) authorize(r *http.Request, rt *Route, ev *restEvent) *gatewayResponse {
+	a := h.authorizers[rt.Authorizer]
+	identity, ok := a.identity(r, h.api.StageVariables)
+	if !ok {
+		return responseUnauthorized
+	}
+	methodArn := h.gateway.executeAPIArn(h.api.ID, h.api.Stage, r.Method, ev.Path)
+	var event interface{}
+	if a.conf.Type == AuthorizerToken {
+		event = &restTokenAuthorizerEvent{Type: AuthorizerToken, AuthorizationToken: identity[0], MethodArn: methodArn}
+	} else {
+		rev := &restRequestAuthorizerEvent{Type: AuthorizerRequest, MethodArn: methodArn, restEvent: *ev}
+		rev.Body, rev.IsBase64Encoded = nil, false
+		event = rev
+	}
+	res, gres := h.gateway.authorize(r.Context(), a, identity, h.api.StageVariables, event)
+	if gres != nil {
+		return gres
+	}
+	if gres := a.allows(res, methodArn); gres != nil {
+		return gres
+	}
+	// context is validated when response is parsed.
+	ev.RequestContext.Authorizer, _ = stringContext(res.Context)
+	ev.RequestContext.Authorizer["principalId"] = res.PrincipalID
+	return nil
+}
+
+// event builds event of payload format 1.0 from request.
+func (h *restHandler) event(r *http.Request, requestID string, rt *Route, params map[string]string) (*restEvent, error) {
+	now := time.Now()
+	path := strings.TrimPrefix(r.URL.Path, "/"+h.api.Stage)
+	if path == "" {
+		path = "/"
+	}
+	ev := &restEvent{
+		Resource:       rt.Path,
+		Path:           path,
+		HTTPMethod:     r.Method,
+		StageVariables: h.api.StageVariables,
+		RequestContext: restRequestContext{
+			ResourceID:        resourceID(rt.Method + " " + rt.Path),
+			ResourcePath:      rt.Path,
+			HTTPMethod:        r.Method,
+			ExtendedRequestID: uuid.New().String(),
+			RequestTime:       now.UTC().Format("02/Jan/2006:15:04:05 -0700"),
+			Path:              r.URL.Path,
+			AccountID:         h.gateway.accountID,
+			Protocol:          r.Proto,
+			Stage:             h.api.Stage,
+			DomainPrefix:      strings.SplitN(r.Host, ".", 2)[0],
+			RequestTimeEpoch:  now.UnixNano() / int64(time.Millisecond),
+			RequestID:         requestID,
+			Identity:          restIdentity{SourceIP: sourceIP(r), UserAgent: r.UserAgent()},
+			DomainName:        r.Host,
+			APIID:             h.api.ID,
+		},
+	}
+	if len(params) > 0 {
+		ev.PathParameters = params
+	}
+	if len(r.Header) > 0 {
+		ev.Headers, ev.MultiValueHeaders = map[string]string{}, map[string][]string{}
+		for k, vs := range r.Header {
+			ev.Headers[k] = vs[len(vs)-1]
+			ev.MultiValueHeaders[k] = vs
+		}
+	}
+	if q := r.URL.Query(); len(q) > 0 {
+		ev.QueryStringParameters, ev.MultiValueQueryStringParameters = map[string]string{}, map[string][]string{}
+		for k, vs := range q {
+			ev.QueryStringParameters[k] = vs[len(vs)-1]
+			ev.MultiValueQueryStringParameters[k] = vs
+		}
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read request body: %v", err)
+	}
+	if len(body) > 0 {
+		s := string(body)
+		if mediaTypeMatches(r.Header.Get("Content-Type"), h.api.BinaryMediaTypes) {
+			s, ev.IsBase64Encoded = base64.StdEncoding.EncodeToString(body), true
+		}
+		ev.Body = &s
+	}
+	return ev, nil
+}
+
+// sourceIP returns address of client.
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
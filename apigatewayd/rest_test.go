@@ -0,0 +1,178 @@
+package apigatewayd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+type invokerMock struct {
+	mu sync.Mutex
+	// responses are payloads of responses keyed by function name, which fails to invoke when missing.
+	responses map[string]string
+	// payloads are keyed by function name.
+	payloads map[string][][]byte
+}
+
+func (m *invokerMock) InvokeSync(_ context.Context, input *lambda.InvokeInput) (*lambda.InvokeOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.payloads == nil {
+		m.payloads = map[string][][]byte{}
+	}
+	m.payloads[*input.FunctionName] = append(m.payloads[*input.FunctionName], input.Payload)
+	res, ok := m.responses[*input.FunctionName]
+	if !ok {
+		return nil, errors.New("function not found")
+	}
+	out := &lambda.InvokeOutput{StatusCode: aws.Int64(200), Payload: []byte(res)}
+	if strings.Contains(res, "errorMessage") {
+		out.FunctionError = aws.String("Unhandled")
+	}
+	return out, nil
+}
+
+func (m *invokerMock) count(function string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.payloads[function])
+}
+
+func (m *invokerMock) last(function string, v interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := m.payloads[function]
+	if len(list) == 0 {
+		panic("no payloads for " + function)
+	}
+	if err := json.Unmarshal(list[len(list)-1], v); err != nil {
+		panic(err)
+	}
+}
+
+func TestRESTHandler(t *testing.T) {
+	inv := &invokerMock{responses: map[string]string{
+		"pets:live":  `{"statusCode":200,"body":"pet"}`,
+		"create":     `{"statusCode":201,"headers":{"Location":"/pets/2"},"multiValueHeaders":{"Set-Cookie":["a=1","b=2"]},"body":"{}"}`,
+		"proxy":      `{"statusCode":200,"headers":{"Content-Type":"image/png"},"body":"iVBORw==","isBase64Encoded":true}`,
+		"broken":     `{"body":"no status"}`,
+		"panic":      `{"errorMessage":"boom","errorType":"Error"}`,
+		"pets-owner": `{"statusCode":204}`,
+	}}
+	gw := New("us-east-1", "000000000000", inv)
+	for _, api := range []*RESTAPI{
+		{Stage: "prod/v1"},
+		{Stage: "prod", Routes: []*Route{{Method: "FETCH", Path: "/pets", Function: "pets"}}},
+		{Stage: "prod", Routes: []*Route{{Method: "GET", Path: "/pets", Function: ""}}},
+		{Stage: "prod", Routes: []*Route{{Method: "GET", Path: "/{proxy+}/pets", Function: "proxy"}}},
+		{Stage: "prod", Routes: []*Route{{Method: "GET", Path: "/pets", Function: "a"}, {Method: "GET", Path: "/pets", Function: "b"}}},
+	} {
+		if _, err := gw.RESTHandler(api); err == nil {
+			t.Errorf("error should exist for %v", api.Routes)
+		}
+	}
+
+	h, err := gw.RESTHandler(&RESTAPI{
+		ID:               "abc123",
+		Stage:            "prod",
+		StageVariables:   map[string]string{"alias": "live"},
+		BinaryMediaTypes: []string{"image/*"},
+		Routes: []*Route{
+			{Method: "GET", Path: "/pets/{id}", Function: "pets:${stageVariables.alias}"},
+			{Method: "GET", Path: "/pets/{id}/owner", Function: "pets-owner"},
+			{Method: "POST", Path: "/pets", Function: "create"},
+			{Method: MethodAny, Path: "/{proxy+}", Function: "proxy"},
+			{Method: "GET", Path: "/broken", Function: "broken"},
+			{Method: "GET", Path: "/panic", Function: "panic"},
+			{Method: "GET", Path: "/missing", Function: "missing"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	do := func(method, path, contentType, body string) (*http.Response, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		b, _ := ioutil.ReadAll(res.Body)
+		return res, string(b)
+	}
+
+	for _, tt := range []struct {
+		label     string
+		method    string
+		path      string
+		status    int
+		errorType string
+	}{
+		{"other stage", "GET", "/dev/pets/1", 403, "ForbiddenException"},
+		{"no route", "DELETE", "/prod", 403, "MissingAuthenticationTokenException"},
+		{"malformed response", "GET", "/prod/broken", 502, "InternalServerErrorException"},
+		{"function error", "GET", "/prod/panic", 502, "InternalServerErrorException"},
+		{"invocation failure", "GET", "/prod/missing", 500, "InternalServerErrorException"},
+		{"more specific template", "GET", "/prod/pets/1/owner", 204, ""},
+	} {
+		res, _ := do(tt.method, tt.path, "", "")
+		if res.StatusCode != tt.status || res.Header.Get("x-amzn-ErrorType") != tt.errorType {
+			t.Errorf("%s: unexpected response: %d %s", tt.label, res.StatusCode, res.Header.Get("x-amzn-ErrorType"))
+		}
+	}
+
+	res, body := do("GET", "/prod/pets/my%20cat?tag=a&tag=b", "", "")
+	if res.StatusCode != 200 || body != "pet" || res.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected response: %d %v %s", res.StatusCode, res.Header, body)
+	}
+	var ev restEvent
+	inv.last("pets:live", &ev)
+	if ev.Resource != "/pets/{id}" || ev.Path != "/pets/my cat" || ev.HTTPMethod != "GET" || ev.PathParameters["id"] != "my cat" ||
+		ev.QueryStringParameters["tag"] != "b" || strings.Join(ev.MultiValueQueryStringParameters["tag"], ",") != "a,b" ||
+		ev.StageVariables["alias"] != "live" || ev.Body != nil || ev.IsBase64Encoded {
+		t.Errorf("unexpected event: %#v", ev)
+	}
+	if rc := ev.RequestContext; rc.Stage != "prod" || rc.Path != "/prod/pets/my cat" || rc.ResourcePath != "/pets/{id}" ||
+		rc.APIID != "abc123" || rc.AccountID != "000000000000" || rc.RequestID != res.Header.Get("x-amzn-RequestId") ||
+		rc.Identity.SourceIP != "127.0.0.1" || rc.RequestTimeEpoch == 0 {
+		t.Errorf("unexpected request context: %#v", rc)
+	}
+
+	res, _ = do("POST", "/prod/pets", "application/json", `{"name":"tama"}`)
+	if res.StatusCode != 201 || res.Header.Get("Location") != "/pets/2" || strings.Join(res.Header["Set-Cookie"], ",") != "a=1,b=2" {
+		t.Errorf("unexpected response: %d %v", res.StatusCode, res.Header)
+	}
+	inv.last("create", &ev)
+	if ev.PathParameters != nil || ev.Body == nil || *ev.Body != `{"name":"tama"}` || ev.IsBase64Encoded ||
+		ev.Headers["Content-Type"] != "application/json" || ev.MultiValueHeaders["Content-Type"][0] != "application/json" {
+		t.Errorf("unexpected event: %#v", ev)
+	}
+
+	res, body = do("PUT", "/prod/images/a/b.png", "image/png", "\x89PNG")
+	if res.StatusCode != 200 || res.Header.Get("Content-Type") != "image/png" || body != "\x89PNG" {
+		t.Errorf("unexpected response: %d %v %q", res.StatusCode, res.Header, body)
+	}
+	inv.last("proxy", &ev)
+	if ev.Resource != "/{proxy+}" || ev.PathParameters["proxy"] != "images/a/b.png" || !ev.IsBase64Encoded || *ev.Body != "iVBORw==" {
+		t.Errorf("unexpected event: %#v", ev)
+	}
+}
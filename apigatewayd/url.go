@@ -0,0 +1,122 @@
+package apigatewayd
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/taiyoh/wheelamb"
+)
+
+// FunctionURLs resolves function URLs by their ids, as LambdaService of wheelamb does.
+type FunctionURLs interface {
+	FunctionURLConfigByID(id string) *wheelamb.FunctionURLConfig
+}
+
+type functionURLHandler struct {
+	gateway *Gateway
+	urls    FunctionURLs
+}
+
+// FunctionURLHandler returns http.Handler which serves function URLs, whose ids are the first label of host
+// such as http://<url-id>.lambda-url.us-east-1.localhost:9003/.
+// Requests to URLs of AWS_IAM must be signed by Signature Version 4, while signatures are not verified.
+func (g *Gateway) FunctionURLHandler(urls FunctionURLs) http.Handler {
+	return &functionURLHandler{gateway: g, urls: urls}
+}
+
+func (h *functionURLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	w.Header().Set("x-amzn-RequestId", requestID)
+
+	host := strings.ToLower(r.Host)
+	var conf *wheelamb.FunctionURLConfig
+	if i := strings.Index(host, ".lambda-url."); i > 0 {
+		conf = h.urls.FunctionURLConfigByID(host[:i])
+	}
+	if conf == nil {
+		responseForbidden.write(w)
+		return
+	}
+	origin := r.Header.Get("Origin")
+	if conf.Cors != nil && r.Method == http.MethodOptions && origin != "" && r.Header.Get("Access-Control-Request-Method") != "" {
+		writePreflight(w, conf.Cors, origin)
+		return
+	}
+	if conf.AuthType == wheelamb.FunctionURLAuthTypeAWSIAM && !signed(r) {
+		responseForbidden.write(w)
+		return
+	}
+
+	ev, err := h.gateway.newHTTPEvent(r, requestID)
+	if err != nil {
+		responseBadRequest.write(w)
+		return
+	}
+	ev.RouteKey = RouteDefault
+	ev.RequestContext.APIID = conf.URLID
+	ev.RequestContext.RouteKey = RouteDefault
+	ev.RequestContext.Stage = DefaultHTTPStage
+	h.gateway.serveHTTPEvent(w, r, conf.FunctionArn(), ev, conf.Cors)
+}
+
+// signed reports whether request has signature of Signature Version 4 in header or query.
+func signed(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") || r.URL.Query().Get("X-Amz-Signature") != ""
+}
+
+// allowedOrigin returns value of Access-Control-Allow-Origin for origin, which is empty when origin is not allowed.
+func allowedOrigin(cors *wheelamb.FunctionURLCors, origin string) string {
+	for _, o := range cors.AllowOrigins {
+		if o == "*" {
+			// browsers reject wildcard origin with credentials.
+			if cors.AllowCredentials {
+				return origin
+			}
+			return "*"
+		}
+		if strings.EqualFold(o, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// corsHeaders sets headers of CORS for actual request from origin.
+func corsHeaders(h http.Header, cors *wheelamb.FunctionURLCors, origin string) {
+	allowed := allowedOrigin(cors, origin)
+	if allowed == "" {
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", allowed)
+	if allowed != "*" {
+		h.Set("Vary", "Origin")
+	}
+	if cors.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if len(cors.ExposeHeaders) > 0 {
+		h.Set("Access-Control-Expose-Headers", strings.Join(cors.ExposeHeaders, ","))
+	}
+}
+
+// writePreflight responds to preflight request without invoking function.
+// Headers of CORS are omitted when origin is not allowed, so that browsers reject the actual request.
+func writePreflight(w http.ResponseWriter, cors *wheelamb.FunctionURLCors, origin string) {
+	h := w.Header()
+	if allowed := allowedOrigin(cors, origin); allowed != "" {
+		corsHeaders(h, cors, origin)
+		h.Del("Access-Control-Expose-Headers")
+		if len(cors.AllowMethods) > 0 {
+			h.Set("Access-Control-Allow-Methods", strings.Join(cors.AllowMethods, ","))
+		}
+		if len(cors.AllowHeaders) > 0 {
+			h.Set("Access-Control-Allow-Headers", strings.Join(cors.AllowHeaders, ","))
+		}
+		if cors.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.FormatInt(cors.MaxAge, 10))
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
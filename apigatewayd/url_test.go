@@ -0,0 +1,94 @@
+package apigatewayd
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/taiyoh/wheelamb"
+)
+
+type functionURLsMock map[string]*wheelamb.FunctionURLConfig
+
+func (m functionURLsMock) FunctionURLConfigByID(id string) *wheelamb.FunctionURLConfig {
+	return m[id]
+}
+
+func TestFunctionURLHandler(t *testing.T) {
+	inv := &invokerMock{responses: map[string]string{
+		"arn:aws:lambda:us-east-1:000000000000:function:public":       `{"statusCode":200,"headers":{"Access-Control-Allow-Origin":"https://evil.example.com"},"body":"ok"}`,
+		"arn:aws:lambda:us-east-1:000000000000:function:private:live": `{"ok":true}`,
+	}}
+	urls := functionURLsMock{
+		"abc": {
+			FunctionURLConfigInput: wheelamb.FunctionURLConfigInput{
+				FunctionName: "public",
+				AuthType:     wheelamb.FunctionURLAuthTypeNone,
+				Cors: &wheelamb.FunctionURLCors{
+					AllowOrigins:  []string{"https://example.com"},
+					AllowMethods:  []string{"GET", "POST"},
+					AllowHeaders:  []string{"content-type"},
+					ExposeHeaders: []string{"x-total"},
+					MaxAge:        300,
+				},
+			},
+			URLID: "abc",
+		},
+		"def": {
+			FunctionURLConfigInput: wheelamb.FunctionURLConfigInput{FunctionName: "private", Qualifier: "live", AuthType: wheelamb.FunctionURLAuthTypeAWSIAM},
+			URLID:                  "def",
+		},
+	}
+	h := New("us-east-1", "000000000000", inv).FunctionURLHandler(urls)
+	serve := func(method, host string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/items?id=1", nil)
+		req.Host = host
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, tt := range []struct {
+		label  string
+		host   string
+		header map[string]string
+		status int
+	}{
+		{"not function URL", "localhost:9003", nil, 403},
+		{"unknown id", "xyz.lambda-url.us-east-1.localhost:9003", nil, 403},
+		{"unsigned", "def.lambda-url.us-east-1.localhost:9003", nil, 403},
+		{"signed", "def.lambda-url.us-east-1.localhost:9003", map[string]string{"Authorization": "AWS4-HMAC-SHA256 Credential=AKID/20240101/us-east-1/lambda/aws4_request, SignedHeaders=host, Signature=abc"}, 200},
+	} {
+		if rec := serve("GET", tt.host, tt.header); rec.Code != tt.status {
+			t.Errorf("%s: unexpected status: %d %s", tt.label, rec.Code, rec.Body)
+		}
+	}
+	var ev httpEvent
+	inv.last("arn:aws:lambda:us-east-1:000000000000:function:private:live", &ev)
+	if ev.RouteKey != RouteDefault || ev.RawPath != "/items" || ev.RawQueryString != "id=1" || ev.RequestContext.APIID != "def" ||
+		ev.RequestContext.DomainPrefix != "def" || ev.RequestContext.Stage != DefaultHTTPStage {
+		t.Errorf("unexpected event: %#v", ev)
+	}
+
+	rec := serve("OPTIONS", "abc.lambda-url.us-east-1.localhost:9003", map[string]string{"Origin": "https://example.com", "Access-Control-Request-Method": "POST"})
+	if rec.Code != 200 || rec.Header().Get("Access-Control-Allow-Origin") != "https://example.com" || rec.Header().Get("Access-Control-Allow-Methods") != "GET,POST" ||
+		rec.Header().Get("Access-Control-Allow-Headers") != "content-type" || rec.Header().Get("Access-Control-Max-Age") != "300" {
+		t.Errorf("unexpected preflight response: %d %v", rec.Code, rec.Header())
+	}
+	rec = serve("OPTIONS", "abc.lambda-url.us-east-1.localhost:9003", map[string]string{"Origin": "https://evil.example.com", "Access-Control-Request-Method": "POST"})
+	if rec.Code != 200 || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("unexpected preflight response: %d %v", rec.Code, rec.Header())
+	}
+
+	rec = serve("GET", "abc.lambda-url.us-east-1.localhost:9003", map[string]string{"Origin": "https://example.com"})
+	if rec.Code != 200 || rec.Body.String() != "ok" || rec.Header().Get("Access-Control-Allow-Origin") != "https://example.com" ||
+		rec.Header().Get("Access-Control-Expose-Headers") != "x-total" {
+		t.Errorf("unexpected response: %d %v", rec.Code, rec.Header())
+	}
+	rec = serve("GET", "ABC.lambda-url.us-east-1.localhost:9003", map[string]string{"Origin": "https://other.example.com"})
+	if rec.Code != 200 || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("unexpected response: %d %v", rec.Code, rec.Header())
+	}
+}
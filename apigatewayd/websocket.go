@@ -0,0 +1,497 @@
+package apigatewayd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/websocket"
+	"gopkg.in/yaml.v2"
+)
+
+// routes of WebSocket APIs which are invoked on connection and disconnection.
+const (
+	RouteConnect    = "$connect"
+	RouteDisconnect = "$disconnect"
+)
+
+// DefaultRouteSelectionExpression selects route by action of JSON message, such as {"action":"sendmessage"}.
+const DefaultRouteSelectionExpression = "$request.body.action"
+
+// maxMessageBytes is max size of messages which clients and @connections API send.
+const maxMessageBytes = 128 * 1024
+
+var routeSelectionPattern = regexp.MustCompile(`^\$request\.body\.([a-zA-Z0-9_-]+(\.[a-zA-Z0-9_-]+)*)$`)
+
+// gateway responses of @connections API.
+var (
+	responseGone            = &gatewayResponse{http.StatusGone, "GoneException", "Gone"}
+	responsePayloadTooLarge = &gatewayResponse{http.StatusRequestEntityTooLarge, "PayloadTooLargeException", "Payload too large"}
+)
+
+// WebSocketAPI is WebSocket API whose routes invoke functions by lambda proxy integration.
+type WebSocketAPI struct {
+	// ID is id of API in request context.
+	ID string
+	// Stage is the path which clients connect to, under which @connections API is also served.
+	Stage          string
+	StageVariables map[string]string
+	// RouteSelectionExpression selects route key from JSON message, such as $request.body.action.
+	RouteSelectionExpression string
+	Routes                   []*WebSocketRoute
+}
+
+// WebSocketRoute invokes function for route key.
+type WebSocketRoute struct {
+	// Key is $connect, $disconnect, $default or key selected from messages.
+	Key string
+	// Function is name or arn of function, which may refer to stage variables such as ${stageVariables.alias}.
+	Function string
+	// ReturnResponse sends body of function response back to client, as two-way routes do.
+	ReturnResponse bool
+}
+
+// webSocketRouteTableFile is route table file of WebSocket API.
+type webSocketRouteTableFile struct {
+	ID                       string            `yaml:"id"`
+	Stage                    string            `yaml:"stage"`
+	StageVariables           map[string]string `yaml:"stage_variables"`
+	RouteSelectionExpression string            `yaml:"route_selection_expression"`
+	Routes                   []struct {
+		Route          string `yaml:"route"`
+		Function       string `yaml:"function"`
+		ReturnResponse bool   `yaml:"return_response"`
+	} `yaml:"routes"`
+}
+
+// LoadWebSocketAPI reads WebSocket API from route table file.
+// Stage is local and route selection expression is $request.body.action unless route table gives them.
+func LoadWebSocketAPI(path string) (*WebSocketAPI, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var table webSocketRouteTableFile
+	if err := yaml.UnmarshalStrict(b, &table); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	api := &WebSocketAPI{
+		ID:                       table.ID,
+		Stage:                    table.Stage,
+		StageVariables:           table.StageVariables,
+		RouteSelectionExpression: table.RouteSelectionExpression,
+	}
+	if api.Stage == "" {
+		api.Stage = DefaultStage
+	}
+	if api.RouteSelectionExpression == "" {
+		api.RouteSelectionExpression = DefaultRouteSelectionExpression
+	}
+	for _, rt := range table.Routes {
+		api.Routes = append(api.Routes, &WebSocketRoute{Key: rt.Route, Function: rt.Function, ReturnResponse: rt.ReturnResponse})
+	}
+	return api, nil
+}
+
+type webSocketIdentity struct {
+	SourceIP  string `json:"sourceIp"`
+	UserAgent string `json:"userAgent"`
+}
+
+type webSocketRequestContext struct {
+	RouteKey          string            `json:"routeKey"`
+	MessageID         string            `json:"messageId,omitempty"`
+	EventType         string            `json:"eventType"`
+	ExtendedRequestID string            `json:"extendedRequestId"`
+	RequestTime       string            `json:"requestTime"`
+	MessageDirection  string            `json:"messageDirection"`
+	Stage             string            `json:"stage"`
+	ConnectedAt       int64             `json:"connectedAt"`
+	RequestTimeEpoch  int64             `json:"requestTimeEpoch"`
+	Identity          webSocketIdentity `json:"identity"`
+	RequestID         string            `json:"requestId"`
+	DomainName        string            `json:"domainName"`
+	ConnectionID      string            `json:"connectionId"`
+	APIID             string            `json:"apiId"`
+}
+
+// webSocketEvent is event of lambda proxy integration of WebSocket API.
+// Headers and query strings are given only on $connect, and body only on messages.
+// via https://docs.aws.amazon.com/apigateway/latest/developerguide/apigateway-websocket-api-mapping-template-reference.html
+type webSocketEvent struct {
+	Headers                         map[string]string       `json:"headers,omitempty"`
+	MultiValueHeaders               map[string][]string     `json:"multiValueHeaders,omitempty"`
+	QueryStringParameters           map[string]string       `json:"queryStringParameters,omitempty"`
+	MultiValueQueryStringParameters map[string][]string     `json:"multiValueQueryStringParameters,omitempty"`
+	StageVariables                  map[string]string       `json:"stageVariables,omitempty"`
+	RequestContext                  webSocketRequestContext `json:"requestContext"`
+	Body                            string                  `json:"body,omitempty"`
+	IsBase64Encoded                 bool                    `json:"isBase64Encoded"`
+}
+
+// webSocketMessage is data frame of WebSocket.
+type webSocketMessage struct {
+	data   []byte
+	binary bool
+}
+
+// messageCodec sends and receives webSocketMessage, keeping whether frames are binary.
+var messageCodec = websocket.Codec{
+	Marshal: func(v interface{}) ([]byte, byte, error) {
+		msg := v.(*webSocketMessage)
+		if msg.binary {
+			return msg.data, websocket.BinaryFrame, nil
+		}
+		return msg.data, websocket.TextFrame, nil
+	},
+	Unmarshal: func(data []byte, payloadType byte, v interface{}) error {
+		msg := v.(*webSocketMessage)
+		msg.data, msg.binary = data, payloadType == websocket.BinaryFrame
+		return nil
+	},
+}
+
+type webSocketConn struct {
+	id          string
+	ws          *websocket.Conn
+	domainName  string
+	identity    webSocketIdentity
+	connectedAt time.Time
+
+	mu           sync.Mutex
+	lastActiveAt time.Time
+}
+
+func (c *webSocketConn) send(msg *webSocketMessage) error {
+	if err := messageCodec.Send(c.ws, msg); err != nil {
+		return err
+	}
+	c.touch()
+	return nil
+}
+
+// sendError sends message of failure in the form API Gateway does.
+func (c *webSocketConn) sendError(message, requestID string) {
+	b, _ := json.Marshal(map[string]string{"message": message, "connectionId": c.id, "requestId": requestID})
+	if err := c.send(&webSocketMessage{data: b}); err != nil {
+		log.Printf("failed to send message to %s: %v", c.id, err)
+	}
+}
+
+func (c *webSocketConn) touch() {
+	c.mu.Lock()
+	c.lastActiveAt = time.Now()
+	c.mu.Unlock()
+}
+
+type webSocketHandler struct {
+	gateway *Gateway
+	api     *WebSocketAPI
+	routes  map[string]*WebSocketRoute
+	// selection is path of JSON message to route key.
+	selection []string
+
+	mu    sync.Mutex
+	conns map[string]*webSocketConn
+}
+
+// WebSocketHandler returns http.Handler which accepts WebSocket connections on path of stage of api,
+// and serves @connections API under the stage, such as POST /local/@connections/{connectionId}.
+// Connections are rejected when function of $connect returns status other than 2xx.
+func (g *Gateway) WebSocketHandler(api *WebSocketAPI) (http.Handler, error) {
+	if !stagePattern.MatchString(api.Stage) {
+		return nil, fmt.Errorf("invalid stage name: %q", api.Stage)
+	}
+	expr := api.RouteSelectionExpression
+	if expr == "" {
+		expr = DefaultRouteSelectionExpression
+	}
+	m := routeSelectionPattern.FindStringSubmatch(expr)
+	if m == nil {
+		return nil, fmt.Errorf("unsupported route selection expression: %s", expr)
+	}
+	h := &webSocketHandler{
+		gateway:   g,
+		api:       api,
+		routes:    map[string]*WebSocketRoute{},
+		selection: strings.Split(m[1], "."),
+		conns:     map[string]*webSocketConn{},
+	}
+	for _, rt := range api.Routes {
+		if rt.Key == "" || rt.Function == "" {
+			return nil, errors.New("route key and function are required")
+		}
+		if strings.HasPrefix(rt.Key, "$") && rt.Key != RouteConnect && rt.Key != RouteDisconnect && rt.Key != RouteDefault {
+			return nil, fmt.Errorf("invalid route key: %s", rt.Key)
+		}
+		if _, ok := h.routes[rt.Key]; ok {
+			return nil, fmt.Errorf("duplicate route: %s", rt.Key)
+		}
+		h.routes[rt.Key] = rt
+	}
+	return h, nil
+}
+
+func (h *webSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	w.Header().Set("x-amzn-RequestId", requestID)
+
+	segments := splitPath(r.URL.EscapedPath())
+	if len(segments) == 0 || unescapeSegment(segments[0]) != h.api.Stage {
+		responseForbidden.write(w)
+		return
+	}
+	switch {
+	case len(segments) == 3 && unescapeSegment(segments[1]) == "@connections":
+		h.serveConnection(w, r, unescapeSegment(segments[2]))
+	case len(segments) == 1 && strings.EqualFold(r.Header.Get("Upgrade"), "websocket") && r.Header.Get("Sec-WebSocket-Key") != "":
+		h.connect(w, r, requestID)
+	default:
+		responseForbidden.write(w)
+	}
+}
+
+// connect invokes function of $connect, and upgrades connection when it succeeds.
+func (h *webSocketHandler) connect(w http.ResponseWriter, r *http.Request, requestID string) {
+	now := time.Now()
+	id := uuid.New()
+	c := &webSocketConn{
+		// ids of connections are 16 characters such as those of API Gateway.
+		id:           base64.URLEncoding.EncodeToString(id[:11]),
+		domainName:   r.Host,
+		identity:     webSocketIdentity{SourceIP: sourceIP(r), UserAgent: r.UserAgent()},
+		connectedAt:  now,
+		lastActiveAt: now,
+	}
+	if rt := h.routes[RouteConnect]; rt != nil {
+		ev := h.event(c, rt, "CONNECT", requestID, now)
+		ev.Headers, ev.MultiValueHeaders = map[string]string{}, map[string][]string{}
+		for k, vs := range r.Header {
+			ev.Headers[k] = vs[len(vs)-1]
+			ev.MultiValueHeaders[k] = vs
+		}
+		if q := r.URL.Query(); len(q) > 0 {
+			ev.QueryStringParameters, ev.MultiValueQueryStringParameters = map[string]string{}, map[string][]string{}
+			for k, vs := range q {
+				ev.QueryStringParameters[k] = vs[len(vs)-1]
+				ev.MultiValueQueryStringParameters[k] = vs
+			}
+		}
+		out, gres := h.invoke(r.Context(), rt, ev)
+		if gres != nil {
+			gres.write(w)
+			return
+		}
+		res, err := parseHTTPResponse(out)
+		if err != nil {
+			log.Printf("malformed response of %s: %v: %s", rt.Function, err, out)
+			responseBadGateway.write(w)
+			return
+		}
+		if *res.StatusCode < 200 || *res.StatusCode >= 300 {
+			if err := res.write(w, r); err != nil {
+				responseBadGateway.write(w)
+			}
+			return
+		}
+	}
+	websocket.Server{Handler: func(ws *websocket.Conn) {
+		c.ws = ws
+		h.serve(c)
+	}}.ServeHTTP(w, r)
+}
+
+// serve routes messages of connection until it is closed, and invokes function of $disconnect.
+func (h *webSocketHandler) serve(c *webSocketConn) {
+	c.ws.MaxPayloadBytes = maxMessageBytes
+	h.mu.Lock()
+	h.conns[c.id] = c
+	h.mu.Unlock()
+	for {
+		var msg webSocketMessage
+		if err := messageCodec.Receive(c.ws, &msg); err != nil {
+			if err != io.EOF {
+				log.Printf("connection %s is closed: %v", c.id, err)
+			}
+			break
+		}
+		c.touch()
+		h.receive(c, &msg)
+	}
+	h.mu.Lock()
+	delete(h.conns, c.id)
+	h.mu.Unlock()
+	c.ws.Close()
+
+	if rt := h.routes[RouteDisconnect]; rt != nil {
+		ev := h.event(c, rt, "DISCONNECT", uuid.New().String(), time.Now())
+		h.invoke(context.Background(), rt, ev)
+	}
+}
+
+// receive invokes function of route selected for message.
+// Messages which select no route are sent to $default, and clients are told when it does not exist.
+func (h *webSocketHandler) receive(c *webSocketConn, msg *webSocketMessage) {
+	requestID := uuid.New().String()
+	rt := h.routes[h.routeKey(msg)]
+	if rt == nil {
+		rt = h.routes[RouteDefault]
+	}
+	if rt == nil {
+		c.sendError(responseForbidden.message, requestID)
+		return
+	}
+	ev := h.event(c, rt, "MESSAGE", requestID, time.Now())
+	ev.RequestContext.MessageID = uuid.New().String()
+	ev.Body = string(msg.data)
+	if msg.binary {
+		ev.Body, ev.IsBase64Encoded = base64.StdEncoding.EncodeToString(msg.data), true
+	}
+	out, gres := h.invoke(context.Background(), rt, ev)
+	if gres != nil {
+		c.sendError(gres.message, requestID)
+		return
+	}
+	if !rt.ReturnResponse {
+		return
+	}
+	res, err := parseHTTPResponse(out)
+	if err != nil {
+		log.Printf("malformed response of %s: %v: %s", rt.Function, err, out)
+		c.sendError(responseBadGateway.message, requestID)
+		return
+	}
+	reply := &webSocketMessage{data: []byte(res.Body)}
+	if res.IsBase64Encoded {
+		if reply.data, err = base64.StdEncoding.DecodeString(res.Body); err != nil {
+			log.Printf("malformed response of %s: %v", rt.Function, err)
+			c.sendError(responseBadGateway.message, requestID)
+			return
+		}
+		reply.binary = true
+	}
+	if len(reply.data) > 0 {
+		if err := c.send(reply); err != nil {
+			log.Printf("failed to send message to %s: %v", c.id, err)
+		}
+	}
+}
+
+// routeKey returns value of route selection expression in JSON message, which is $default otherwise.
+// Keys starting with $ are not selected, as they are reserved.
+func (h *webSocketHandler) routeKey(msg *webSocketMessage) string {
+	if msg.binary {
+		return RouteDefault
+	}
+	var v interface{}
+	if err := json.Unmarshal(msg.data, &v); err != nil {
+		return RouteDefault
+	}
+	for _, name := range h.selection {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return RouteDefault
+		}
+		v = obj[name]
+	}
+	key, ok := v.(string)
+	if !ok || key == "" || strings.HasPrefix(key, "$") {
+		return RouteDefault
+	}
+	return key
+}
+
+func (h *webSocketHandler) event(c *webSocketConn, rt *WebSocketRoute, eventType, requestID string, now time.Time) *webSocketEvent {
+	return &webSocketEvent{
+		StageVariables: h.api.StageVariables,
+		RequestContext: webSocketRequestContext{
+			RouteKey:          rt.Key,
+			EventType:         eventType,
+			ExtendedRequestID: uuid.New().String(),
+			RequestTime:       now.UTC().Format("02/Jan/2006:15:04:05 -0700"),
+			MessageDirection:  "IN",
+			Stage:             h.api.Stage,
+			ConnectedAt:       c.connectedAt.UnixNano() / int64(time.Millisecond),
+			RequestTimeEpoch:  now.UnixNano() / int64(time.Millisecond),
+			Identity:          c.identity,
+			RequestID:         requestID,
+			DomainName:        c.domainName,
+			ConnectionID:      c.id,
+			APIID:             h.api.ID,
+		},
+	}
+}
+
+func (h *webSocketHandler) invoke(ctx context.Context, rt *WebSocketRoute, ev *webSocketEvent) ([]byte, *gatewayResponse) {
+	payload, _ := json.Marshal(ev)
+	return h.gateway.invoke(ctx, functionName(rt.Function, h.api.StageVariables), payload)
+}
+
+// connectionJSON is output of GetConnection.
+type connectionJSON struct {
+	ConnectedAt  string            `json:"connectedAt"`
+	Identity     webSocketIdentity `json:"identity"`
+	LastActiveAt string            `json:"lastActiveAt"`
+}
+
+// serveConnection serves PostToConnection, GetConnection and DeleteConnection of @connections API.
+// Requests may be signed by Signature Version 4, while signatures are not verified.
+func (h *webSocketHandler) serveConnection(w http.ResponseWriter, r *http.Request, id string) {
+	switch r.Method {
+	case http.MethodPost, http.MethodGet, http.MethodDelete:
+	default:
+		responseMissingToken.write(w)
+		return
+	}
+	h.mu.Lock()
+	c := h.conns[id]
+	h.mu.Unlock()
+	if c == nil {
+		responseGone.write(w)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		data, err := ioutil.ReadAll(io.LimitReader(r.Body, maxMessageBytes+1))
+		if err != nil {
+			responseBadRequest.write(w)
+			return
+		}
+		if len(data) > maxMessageBytes {
+			responsePayloadTooLarge.write(w)
+			return
+		}
+		if err := c.send(&webSocketMessage{data: data, binary: !utf8.Valid(data)}); err != nil {
+			responseGone.write(w)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		c.mu.Lock()
+		out := &connectionJSON{
+			ConnectedAt:  c.connectedAt.UTC().Format(time.RFC3339Nano),
+			Identity:     c.identity,
+			LastActiveAt: c.lastActiveAt.UTC().Format(time.RFC3339Nano),
+		}
+		c.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	case http.MethodDelete:
+		// serve ends by closing, and invokes function of $disconnect.
+		c.ws.Close()
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,234 @@
+package apigatewayd
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/apigatewaymanagementapi"
+	"golang.org/x/net/websocket"
+)
+
+func TestLoadWebSocketAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apigatewayd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "websocket.yml")
+	if err := ioutil.WriteFile(path, []byte(`
+id: chat
+stage_variables:
+  alias: live
+routes:
+  - route: $connect
+    function: connect
+  - route: sendmessage
+    function: send:${stageVariables.alias}
+    return_response: true
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	api, err := LoadWebSocketAPI(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if api.ID != "chat" || api.Stage != DefaultStage || api.RouteSelectionExpression != DefaultRouteSelectionExpression || api.StageVariables["alias"] != "live" {
+		t.Errorf("unexpected api: %#v", api)
+	}
+	if len(api.Routes) != 2 || *api.Routes[0] != (WebSocketRoute{Key: RouteConnect, Function: "connect"}) ||
+		*api.Routes[1] != (WebSocketRoute{Key: "sendmessage", Function: "send:${stageVariables.alias}", ReturnResponse: true}) {
+		t.Errorf("unexpected routes: %v", api.Routes)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("routes:\n  - path: /\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadWebSocketAPI(path); err == nil {
+		t.Error("error should exist for unknown key")
+	}
+}
+
+func TestWebSocketHandler(t *testing.T) {
+	inv := &invokerMock{responses: map[string]string{
+		"connect":    `{"statusCode":200}`,
+		"reject":     `{"statusCode":401,"body":"Unauthorized"}`,
+		"disconnect": `null`,
+		"echo:live":  `{"statusCode":200,"body":"pong"}`,
+		"fallback":   `{"statusCode":200,"body":"ignored"}`,
+	}}
+	gw := New("us-east-1", "000000000000", inv)
+	for _, api := range []*WebSocketAPI{
+		{Stage: "prod/v1"},
+		{Stage: "local", RouteSelectionExpression: "$request.header.action"},
+		{Stage: "local", Routes: []*WebSocketRoute{{Key: "$message", Function: "a"}}},
+		{Stage: "local", Routes: []*WebSocketRoute{{Key: "send", Function: "a"}, {Key: "send", Function: "b"}}},
+		{Stage: "local", Routes: []*WebSocketRoute{{Key: "send"}}},
+	} {
+		if _, err := gw.WebSocketHandler(api); err == nil {
+			t.Errorf("error should exist for %#v", api)
+		}
+	}
+
+	h, err := gw.WebSocketHandler(&WebSocketAPI{Stage: "local", Routes: []*WebSocketRoute{{Key: RouteConnect, Function: "reject"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/local", nil)
+	for k, v := range map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": "dGhlIHNhbXBsZSBub25jZQ=="} {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != 401 || rec.Body.String() != "Unauthorized" {
+		t.Errorf("unexpected response: %d %s", rec.Code, rec.Body)
+	}
+
+	h, err = gw.WebSocketHandler(&WebSocketAPI{
+		ID:             "chat",
+		Stage:          "local",
+		StageVariables: map[string]string{"alias": "live"},
+		Routes: []*WebSocketRoute{
+			{Key: RouteConnect, Function: "connect"},
+			{Key: RouteDisconnect, Function: "disconnect"},
+			{Key: RouteDefault, Function: "fallback"},
+			{Key: "echo", Function: "echo:${stageVariables.alias}", ReturnResponse: true},
+			{Key: "fail", Function: "missing"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/local"
+	if _, err := websocket.Dial(wsURL+"/other", "", "http://localhost/"); err == nil {
+		t.Error("error should exist for path other than stage")
+	}
+	ws, err := websocket.Dial(wsURL+"?room=1", "", "http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	var connect webSocketEvent
+	inv.last("connect", &connect)
+	rc := connect.RequestContext
+	if rc.EventType != "CONNECT" || rc.RouteKey != RouteConnect || rc.APIID != "chat" || rc.Stage != "local" || len(rc.ConnectionID) != 16 ||
+		rc.Identity.SourceIP != "127.0.0.1" || connect.QueryStringParameters["room"] != "1" || connect.Headers["Upgrade"] != "websocket" {
+		t.Errorf("unexpected event: %#v", connect)
+	}
+	id := rc.ConnectionID
+
+	receive := func() string {
+		t.Helper()
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var msg string
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+	for _, msg := range []string{`{"action":"unknown"}`, `{"action":"$connect"}`, `hello`, `{"action":"echo","text":"ping"}`} {
+		if err := websocket.Message.Send(ws, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// messages are routed in order, and only two-way routes respond.
+	if msg := receive(); msg != "pong" {
+		t.Errorf("unexpected message: %s", msg)
+	}
+	var ev webSocketEvent
+	inv.last("echo:live", &ev)
+	if ev.RequestContext.EventType != "MESSAGE" || ev.RequestContext.RouteKey != "echo" || ev.RequestContext.ConnectionID != id ||
+		ev.RequestContext.MessageID == "" || ev.Body != `{"action":"echo","text":"ping"}` || ev.Headers != nil {
+		t.Errorf("unexpected event: %#v", ev)
+	}
+	inv.mu.Lock()
+	fallbacks := len(inv.payloads["fallback"])
+	inv.mu.Unlock()
+	if fallbacks != 3 {
+		t.Errorf("unexpected invocations of $default: %d", fallbacks)
+	}
+	inv.last("fallback", &ev)
+	if ev.RequestContext.RouteKey != RouteDefault || ev.Body != "hello" {
+		t.Errorf("unexpected event: %#v", ev)
+	}
+
+	if err := websocket.Message.Send(ws, []byte{0xff, 0x00}); err != nil {
+		t.Fatal(err)
+	}
+	if err := websocket.Message.Send(ws, `{"action":"fail"}`); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receive(); !strings.Contains(msg, `"message":"Internal server error"`) || !strings.Contains(msg, id) {
+		t.Errorf("unexpected message: %s", msg)
+	}
+	inv.last("fallback", &ev)
+	if ev.Body != "/wA=" || !ev.IsBase64Encoded {
+		t.Errorf("unexpected event: %#v", ev)
+	}
+
+	sess := session.Must(session.NewSession(aws.NewConfig().
+		WithRegion("us-east-1").
+		WithEndpoint(srv.URL + "/local").
+		WithCredentials(credentials.NewStaticCredentials("dummy", "dummy", ""))))
+	cli := apigatewaymanagementapi.New(sess)
+	if _, err := cli.PostToConnection(&apigatewaymanagementapi.PostToConnectionInput{ConnectionId: aws.String(id), Data: []byte("pushed")}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receive(); msg != "pushed" {
+		t.Errorf("unexpected message: %s", msg)
+	}
+	conn, err := cli.GetConnection(&apigatewaymanagementapi.GetConnectionInput{ConnectionId: aws.String(id)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.ConnectedAt == nil || conn.LastActiveAt.Before(*conn.ConnectedAt) || *conn.Identity.SourceIp != "127.0.0.1" {
+		t.Errorf("unexpected connection: %v", conn)
+	}
+	if _, err := cli.PostToConnection(&apigatewaymanagementapi.PostToConnectionInput{ConnectionId: aws.String(id), Data: make([]byte, maxMessageBytes+1)}); err == nil {
+		t.Error("error should exist for too large payload")
+	} else if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "PayloadTooLargeException" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := cli.DeleteConnection(&apigatewaymanagementapi.DeleteConnectionInput{ConnectionId: aws.String(id)}); err != nil {
+		t.Fatal(err)
+	}
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg string
+	if err := websocket.Message.Receive(ws, &msg); err == nil {
+		t.Errorf("connection should be closed, but received %s", msg)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		inv.mu.Lock()
+		n := len(inv.payloads["disconnect"])
+		inv.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("$disconnect should be invoked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	inv.last("disconnect", &ev)
+	if ev.RequestContext.EventType != "DISCONNECT" || ev.RequestContext.ConnectionID != id {
+		t.Errorf("unexpected event: %#v", ev)
+	}
+	if _, err := cli.PostToConnection(&apigatewaymanagementapi.PostToConnectionInput{ConnectionId: aws.String(id), Data: []byte("late")}); err == nil {
+		t.Error("error should exist for closed connection")
+	} else if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "GoneException" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
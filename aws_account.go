@@ -1,13 +1,93 @@
 package wheelamb
 
 import (
+	"fmt"
+	"net/url"
 	"os"
 
 	"github.com/aws/aws-sdk-go/aws"
 )
 
-var awsConf *aws.Config
+const (
+	defaultRegion    = "us-east-1"
+	defaultAccountID = "000000000000"
+)
+
+var (
+	awsConf   *aws.Config
+	accountID = defaultAccountID
+	endpoints = map[string]string{}
+	// urlEndpoint is address of function URL front end, whose URLs are those of AWS when nil.
+	urlEndpoint *url.URL
+)
 
 func init() {
-	awsConf = aws.NewConfig().WithRegion(os.Getenv("AWS_REGION"))
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = defaultRegion
+	}
+	awsConf = aws.NewConfig().WithRegion(region)
+}
+
+// SetAWSAccount overrides region and account id used for building arn.
+// This should be called before any service is initialized.
+func SetAWSAccount(region, id string) {
+	if region != "" {
+		awsConf = awsConf.Copy().WithRegion(region)
+	}
+	if id != "" {
+		accountID = id
+	}
+}
+
+// Region returns region name which wheelamb behaves as.
+func Region() string {
+	return *awsConf.Region
+}
+
+// AccountID returns account id which wheelamb behaves as.
+func AccountID() string {
+	return accountID
+}
+
+// SetEndpoint overrides endpoint of AWS compatible service (e.g. "s3", "sqs") which wheelamb connects to.
+// This should be called before any service is initialized.
+func SetEndpoint(service, url string) {
+	endpoints[service] = url
+}
+
+// SetFunctionURLEndpoint sets endpoint of function URL front end such as http://localhost:9003,
+// whose host is prefixed by url id and region in URLs of functions.
+// This should be called before any service is initialized.
+func SetFunctionURLEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid function URL endpoint: %s", endpoint)
+	}
+	urlEndpoint = u
+	return nil
+}
+
+// functionURL returns URL of function URL with given id.
+func functionURL(id string) string {
+	if urlEndpoint == nil {
+		return fmt.Sprintf("https://%s.lambda-url.%s.on.aws/", id, Region())
+	}
+	return fmt.Sprintf("%s://%s.lambda-url.%s.%s/", urlEndpoint.Scheme, id, Region(), urlEndpoint.Host)
+}
+
+// serviceConfig returns config for connecting to given service.
+func serviceConfig(service string) *aws.Config {
+	conf := awsConf.Copy()
+	if ep, ok := endpoints[service]; ok {
+		conf = conf.WithEndpoint(ep)
+	}
+	return conf
+}
+
+func functionARN(name string) string {
+	return fmt.Sprintf("arn:aws:lambda:%s:%s:function:%s", Region(), accountID, name)
 }
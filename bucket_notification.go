@@ -0,0 +1,356 @@
+package wheelamb
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/google/uuid"
+)
+
+// errCodeInvalidArgument is the error code of S3 for invalid notification configuration.
+const errCodeInvalidArgument = "InvalidArgument"
+
+// bucketEventTypes are event types which notifications can be configured for.
+var bucketEventTypes = map[string]bool{
+	"s3:ObjectCreated:*":                       true,
+	"s3:ObjectCreated:Put":                     true,
+	"s3:ObjectCreated:Post":                    true,
+	"s3:ObjectCreated:Copy":                    true,
+	"s3:ObjectCreated:CompleteMultipartUpload": true,
+	"s3:ObjectRemoved:*":                       true,
+	"s3:ObjectRemoved:Delete":                  true,
+	"s3:ObjectRemoved:DeleteMarkerCreated":     true,
+	"s3:ObjectRestore:*":                       true,
+	"s3:ObjectRestore:Post":                    true,
+	"s3:ObjectRestore:Completed":               true,
+}
+
+// S3Identity is principal in S3 event record.
+type S3Identity struct {
+	PrincipalID string `json:"principalId"`
+}
+
+// S3Bucket is bucket in S3 event record.
+type S3Bucket struct {
+	Name          string     `json:"name"`
+	OwnerIdentity S3Identity `json:"ownerIdentity"`
+	Arn           string     `json:"arn"`
+}
+
+// S3Object is object in S3 event record. Key is URL encoded, and Size and ETag are absent for removal.
+type S3Object struct {
+	Key       string `json:"key"`
+	Size      *int64 `json:"size,omitempty"`
+	ETag      string `json:"eTag,omitempty"`
+	VersionID string `json:"versionId,omitempty"`
+	Sequencer string `json:"sequencer"`
+}
+
+// S3Entity is the s3 field of S3 event record.
+type S3Entity struct {
+	S3SchemaVersion string   `json:"s3SchemaVersion"`
+	ConfigurationID string   `json:"configurationId"`
+	Bucket          S3Bucket `json:"bucket"`
+	Object          S3Object `json:"object"`
+}
+
+// S3EventRecord is record of S3 event notification, which functions receive one by one in Records.
+// via https://docs.aws.amazon.com/AmazonS3/latest/userguide/notification-content-structure.html
+type S3EventRecord struct {
+	EventVersion      string            `json:"eventVersion"`
+	EventSource       string            `json:"eventSource"`
+	AWSRegion         string            `json:"awsRegion"`
+	EventTime         string            `json:"eventTime"`
+	EventName         string            `json:"eventName"`
+	UserIdentity      S3Identity        `json:"userIdentity"`
+	RequestParameters map[string]string `json:"requestParameters"`
+	ResponseElements  map[string]string `json:"responseElements"`
+	S3                S3Entity          `json:"s3"`
+}
+
+// newS3EventRecord returns record of event on object, as S3 sends it.
+func newS3EventRecord(eventName, bucket, key string, obj S3Object, now time.Time) *S3EventRecord {
+	segments := strings.Split(key, "/")
+	for i, seg := range segments {
+		segments[i] = url.QueryEscape(seg)
+	}
+	obj.Key = strings.Join(segments, "/")
+	return &S3EventRecord{
+		EventVersion:      "2.1",
+		EventSource:       "aws:s3",
+		AWSRegion:         Region(),
+		EventTime:         now.UTC().Format("2006-01-02T15:04:05.000Z"),
+		EventName:         eventName,
+		UserIdentity:      S3Identity{PrincipalID: accountID},
+		RequestParameters: map[string]string{"sourceIPAddress": "127.0.0.1"},
+		ResponseElements: map[string]string{
+			"x-amz-request-id": uuid.New().String(),
+			"x-amz-id-2":       uuid.New().String(),
+		},
+		S3: S3Entity{
+			S3SchemaVersion: "1.0",
+			Bucket:          S3Bucket{Name: bucket, OwnerIdentity: S3Identity{PrincipalID: accountID}, Arn: "arn:aws:s3:::" + bucket},
+			Object:          obj,
+		},
+	}
+}
+
+// bucketNotification is function configuration of bucket, with its key filter.
+type bucketNotification struct {
+	conf   *s3.LambdaFunctionConfiguration
+	prefix string
+	suffix string
+}
+
+// matches reports whether event on key of object triggers notification.
+func (n *bucketNotification) matches(eventName, key string) bool {
+	if !strings.HasPrefix(key, n.prefix) || !strings.HasSuffix(key, n.suffix) {
+		return false
+	}
+	for _, e := range n.conf.Events {
+		if eventTypeMatches(*e, "s3:"+eventName) {
+			return true
+		}
+	}
+	return false
+}
+
+// overlaps reports whether n and o can be triggered by the same event, which S3 rejects.
+func (n *bucketNotification) overlaps(o *bucketNotification) bool {
+	if !strings.HasPrefix(n.prefix, o.prefix) && !strings.HasPrefix(o.prefix, n.prefix) {
+		return false
+	}
+	if !strings.HasSuffix(n.suffix, o.suffix) && !strings.HasSuffix(o.suffix, n.suffix) {
+		return false
+	}
+	for _, a := range n.conf.Events {
+		for _, b := range o.conf.Events {
+			if eventTypeMatches(*a, *b) || eventTypeMatches(*b, *a) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// eventTypeMatches reports whether event type, which may end with wildcard, covers name.
+func eventTypeMatches(eventType, name string) bool {
+	if strings.HasSuffix(eventType, "*") {
+		return strings.HasPrefix(name, strings.TrimSuffix(eventType, "*"))
+	}
+	return eventType == name
+}
+
+// BucketNotificationService invokes functions by event notifications of buckets,
+// whose events come from webhook of S3 compatible store or from directories watched as buckets.
+type BucketNotificationService struct {
+	registry      *LambdaRegistry
+	lambda        invoker
+	mu            sync.Mutex
+	notifications map[string][]*bucketNotification
+	// done stops watchers of directories.
+	done     chan struct{}
+	watching sync.WaitGroup
+	// running tracks invocations in progress.
+	running sync.WaitGroup
+}
+
+// NewBucketNotificationService returns BucketNotificationService object.
+func NewBucketNotificationService(svc *LambdaService) *BucketNotificationService {
+	return newBucketNotificationService(svc.registry, svc)
+}
+
+func newBucketNotificationService(registry *LambdaRegistry, inv invoker) *BucketNotificationService {
+	return &BucketNotificationService{
+		registry:      registry,
+		lambda:        inv,
+		notifications: make(map[string][]*bucketNotification),
+		done:          make(chan struct{}),
+	}
+}
+
+// Close stops watchers of directories, and waits for invocations in progress.
+func (s *BucketNotificationService) Close() error {
+	close(s.done)
+	s.watching.Wait()
+	s.running.Wait()
+	return nil
+}
+
+func newBucketNotification(conf *s3.LambdaFunctionConfiguration) (*bucketNotification, error) {
+	// function name is resolved to arn, so that configurations always show arn.
+	name, qualifier := resolveName(aws.StringValue(conf.LambdaFunctionArn), nil)
+	if name == "" {
+		return nil, awserr.New(errCodeInvalidArgument, "Unable to validate the following destination configurations: "+aws.StringValue(conf.LambdaFunctionArn), nil)
+	}
+	n := &bucketNotification{conf: &s3.LambdaFunctionConfiguration{
+		Id:                conf.Id,
+		LambdaFunctionArn: aws.String(functionARN(name)),
+		Events:            conf.Events,
+		Filter:            conf.Filter,
+	}}
+	if qualifier != "" {
+		n.conf.LambdaFunctionArn = aws.String(*n.conf.LambdaFunctionArn + ":" + qualifier)
+	}
+	if n.conf.Id == nil {
+		n.conf.Id = aws.String(uuid.New().String())
+	}
+	if len(conf.Events) == 0 {
+		return nil, awserr.New(errCodeInvalidArgument, "Events must not be empty", nil)
+	}
+	for _, e := range conf.Events {
+		if !bucketEventTypes[aws.StringValue(e)] {
+			return nil, awserr.New(errCodeInvalidArgument, "The event is not supported for notifications: "+aws.StringValue(e), nil)
+		}
+	}
+	if conf.Filter == nil || conf.Filter.Key == nil {
+		return n, nil
+	}
+	seen := map[string]bool{}
+	for _, rule := range conf.Filter.Key.FilterRules {
+		name := strings.ToLower(aws.StringValue(rule.Name))
+		if (name != "prefix" && name != "suffix") || seen[name] {
+			return nil, awserr.New(errCodeInvalidArgument, "FilterRule name must be either prefix or suffix, and can be given once", nil)
+		}
+		seen[name] = true
+		if name == "prefix" {
+			n.prefix = aws.StringValue(rule.Value)
+		} else {
+			n.suffix = aws.StringValue(rule.Value)
+		}
+	}
+	return n, nil
+}
+
+// PutBucketNotificationConfiguration replaces notification configuration of bucket.
+// Only function destinations are supported. Functions are not required to exist until events happen,
+// so that configurations can be given before functions are created.
+func (s *BucketNotificationService) PutBucketNotificationConfiguration(_ context.Context, input *s3.PutBucketNotificationConfigurationInput) (*s3.PutBucketNotificationConfigurationOutput, error) {
+	bucket := aws.StringValue(input.Bucket)
+	if bucket == "" {
+		return nil, awserr.New(errCodeInvalidArgument, "Bucket is required", nil)
+	}
+	conf := input.NotificationConfiguration
+	if conf == nil {
+		return nil, awserr.New(errCodeInvalidArgument, "NotificationConfiguration is required", nil)
+	}
+	if len(conf.QueueConfigurations) > 0 || len(conf.TopicConfigurations) > 0 {
+		return nil, awserr.New(errCodeInvalidArgument, "Only lambda function destinations are supported", nil)
+	}
+	list := make([]*bucketNotification, 0, len(conf.LambdaFunctionConfigurations))
+	ids := map[string]bool{}
+	for _, c := range conf.LambdaFunctionConfigurations {
+		n, err := newBucketNotification(c)
+		if err != nil {
+			return nil, err
+		}
+		if ids[*n.conf.Id] {
+			return nil, awserr.New(errCodeInvalidArgument, "Configuration Id must be unique: "+*n.conf.Id, nil)
+		}
+		ids[*n.conf.Id] = true
+		for _, o := range list {
+			if n.overlaps(o) {
+				return nil, awserr.New(errCodeInvalidArgument, "Configurations overlap. Configurations on the same bucket cannot share a common event type.", nil)
+			}
+		}
+		list = append(list, n)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(list) == 0 {
+		delete(s.notifications, bucket)
+	} else {
+		s.notifications[bucket] = list
+	}
+	return &s3.PutBucketNotificationConfigurationOutput{}, nil
+}
+
+// GetBucketNotificationConfiguration returns notification configuration of bucket.
+func (s *BucketNotificationService) GetBucketNotificationConfiguration(_ context.Context, input *s3.GetBucketNotificationConfigurationRequest) (*s3.NotificationConfiguration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := &s3.NotificationConfiguration{}
+	for _, n := range s.notifications[aws.StringValue(input.Bucket)] {
+		out.LambdaFunctionConfigurations = append(out.LambdaFunctionConfigurations, n.conf)
+	}
+	return out, nil
+}
+
+// Notify invokes functions of configurations matching records in background, each with a single record.
+// Event names with or without the s3: prefix are accepted, as S3 compatible stores differ.
+func (s *BucketNotificationService) Notify(records []*S3EventRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rec := range records {
+		eventName := strings.TrimPrefix(rec.EventName, "s3:")
+		key, err := url.QueryUnescape(rec.S3.Object.Key)
+		if err != nil {
+			key = rec.S3.Object.Key
+		}
+		for _, n := range s.notifications[rec.S3.Bucket.Name] {
+			if !n.matches(eventName, key) {
+				continue
+			}
+			r := *rec
+			r.EventName = eventName
+			r.S3.ConfigurationID = *n.conf.Id
+			payload, _ := json.Marshal(struct {
+				Records []*S3EventRecord
+			}{[]*S3EventRecord{&r}})
+			s.running.Add(1)
+			go func(arn, object string) {
+				defer s.running.Done()
+				s.invoke(arn, object, payload)
+			}(*n.conf.LambdaFunctionArn, rec.S3.Bucket.Name+"/"+key)
+		}
+	}
+}
+
+// invoke invokes function of notification, as asynchronous invocation does.
+func (s *BucketNotificationService) invoke(arn, object string, payload []byte) {
+	if s.registry.GetFromARN(arn) == nil {
+		log.Printf("notification of %s: function %s does not exist", object, arn)
+		return
+	}
+	invokeAsync(s.lambda, "notification of "+object, arn, payload)
+}
+
+// WatchDirectory watches files under dir, whose subdirectories are treated as buckets, every interval.
+// Files written or removed since the last scan are notified as ObjectCreated:Put or ObjectRemoved:Delete,
+// after their size and modification time have been stable for an interval so that partial writes are not notified.
+// Files existing when watch starts are not notified.
+func (s *BucketNotificationService) WatchDirectory(dir string, interval time.Duration) error {
+	w, err := newBucketWatcher(dir)
+	if err != nil {
+		return err
+	}
+	s.watching.Add(1)
+	go func() {
+		defer s.watching.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case now := <-ticker.C:
+				records, err := w.scan(now)
+				if err != nil {
+					log.Printf("failed to watch %s: %v", dir, err)
+					continue
+				}
+				s.Notify(records)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,110 @@
+package wheelamb
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func lambdaConfiguration(id, function string, events []string, prefix, suffix string) *s3.LambdaFunctionConfiguration {
+	return &s3.LambdaFunctionConfiguration{
+		Id:                aws.String(id),
+		LambdaFunctionArn: aws.String(function),
+		Events:            aws.StringSlice(events),
+		Filter: &s3.NotificationConfigurationFilter{Key: &s3.KeyFilter{FilterRules: []*s3.FilterRule{
+			{Name: aws.String("Prefix"), Value: aws.String(prefix)},
+			{Name: aws.String("Suffix"), Value: aws.String(suffix)},
+		}}},
+	}
+}
+
+func TestBucketNotificationService(t *testing.T) {
+	reg := NewLambdaRegistry()
+	reg.Register(&LambdaFunction{FunctionName: "resize", FunctionArn: functionARN("resize"), Version: latestVersion})
+	reg.Register(&LambdaFunction{FunctionName: "cleanup", FunctionArn: functionARN("cleanup"), Version: latestVersion})
+	inv := &invokerMock{}
+	s := newBucketNotificationService(reg, inv)
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		label   string
+		configs []*s3.LambdaFunctionConfiguration
+	}{
+		{"invalid destination", []*s3.LambdaFunctionConfiguration{lambdaConfiguration("a", "arn:aws:sqs:us-east-1:000000000000:q", []string{"s3:ObjectCreated:*"}, "", "")}},
+		{"unknown event", []*s3.LambdaFunctionConfiguration{lambdaConfiguration("a", "resize", []string{"s3:ObjectCreated:Upload"}, "", "")}},
+		{"no events", []*s3.LambdaFunctionConfiguration{lambdaConfiguration("a", "resize", nil, "", "")}},
+		{"overlap", []*s3.LambdaFunctionConfiguration{
+			lambdaConfiguration("a", "resize", []string{"s3:ObjectCreated:*"}, "images/", ""),
+			lambdaConfiguration("b", "cleanup", []string{"s3:ObjectCreated:Put"}, "images/raw/", ".jpg"),
+		}},
+		{"duplicate id", []*s3.LambdaFunctionConfiguration{
+			lambdaConfiguration("a", "resize", []string{"s3:ObjectCreated:*"}, "", ""),
+			lambdaConfiguration("a", "cleanup", []string{"s3:ObjectRemoved:*"}, "", ""),
+		}},
+	} {
+		_, err := s.PutBucketNotificationConfiguration(ctx, &s3.PutBucketNotificationConfigurationInput{
+			Bucket:                    aws.String("photos"),
+			NotificationConfiguration: &s3.NotificationConfiguration{LambdaFunctionConfigurations: tt.configs},
+		})
+		if e, ok := err.(awserr.Error); !ok || e.Code() != errCodeInvalidArgument {
+			t.Errorf("%s: unexpected error captured: %#v", tt.label, err)
+		}
+	}
+
+	if _, err := s.PutBucketNotificationConfiguration(ctx, &s3.PutBucketNotificationConfigurationInput{
+		Bucket: aws.String("photos"),
+		NotificationConfiguration: &s3.NotificationConfiguration{LambdaFunctionConfigurations: []*s3.LambdaFunctionConfiguration{
+			lambdaConfiguration("resize-jpg", "resize", []string{"s3:ObjectCreated:*"}, "uploads/", ".jpg"),
+			lambdaConfiguration("cleanup", functionARN("cleanup"), []string{"s3:ObjectRemoved:Delete"}, "uploads/", ""),
+			lambdaConfiguration("missing", "missing", []string{"s3:ObjectCreated:*"}, "tmp/", ""),
+		}},
+	}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	conf, err := s.GetBucketNotificationConfiguration(ctx, &s3.GetBucketNotificationConfigurationRequest{Bucket: aws.String("photos")})
+	if err != nil || len(conf.LambdaFunctionConfigurations) != 3 || *conf.LambdaFunctionConfigurations[0].LambdaFunctionArn != functionARN("resize") {
+		t.Errorf("unexpected configuration: %v, %v", conf, err)
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	size := int64(1024)
+	s.Notify([]*S3EventRecord{
+		newS3EventRecord("ObjectCreated:Put", "photos", "uploads/my cat.jpg", S3Object{Size: &size, ETag: "abc", Sequencer: "01"}, now),
+		newS3EventRecord("s3:ObjectCreated:Copy", "photos", "uploads/cat.png", S3Object{Size: &size, ETag: "def", Sequencer: "02"}, now),
+		newS3EventRecord("ObjectRemoved:Delete", "photos", "uploads/dog.jpg", S3Object{Sequencer: "03"}, now),
+		newS3EventRecord("ObjectCreated:Put", "photos", "tmp/a.jpg", S3Object{Size: &size, Sequencer: "04"}, now),
+		newS3EventRecord("ObjectCreated:Put", "videos", "uploads/a.jpg", S3Object{Size: &size, Sequencer: "05"}, now),
+	})
+	s.Close()
+
+	var records []S3EventRecord
+	for _, p := range inv.payloads {
+		var ev struct{ Records []S3EventRecord }
+		if err := json.Unmarshal(p, &ev); err != nil {
+			t.Fatal(err)
+		}
+		if len(ev.Records) != 1 {
+			t.Errorf("unexpected payload: %s", p)
+		}
+		records = append(records, ev.Records...)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].S3.Object.Sequencer < records[j].S3.Object.Sequencer })
+	if len(records) != 2 {
+		t.Fatalf("unexpected records: %v", records)
+	}
+	created, removed := records[0], records[1]
+	if created.EventName != "ObjectCreated:Put" || created.EventSource != "aws:s3" || created.EventTime != "2024-01-01T00:00:00.000Z" ||
+		created.S3.ConfigurationID != "resize-jpg" || created.S3.Bucket.Arn != "arn:aws:s3:::photos" ||
+		created.S3.Object.Key != "uploads/my+cat.jpg" || *created.S3.Object.Size != 1024 || created.S3.Object.ETag != "abc" {
+		t.Errorf("unexpected record: %#v", created)
+	}
+	if removed.EventName != "ObjectRemoved:Delete" || removed.S3.ConfigurationID != "cleanup" || removed.S3.Object.Size != nil {
+		t.Errorf("unexpected record: %#v", removed)
+	}
+}
@@ -0,0 +1,148 @@
+package wheelamb
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// objectState is state of file, which changes when file is written.
+type objectState struct {
+	size    int64
+	modTime time.Time
+}
+
+// bucketWatcher detects files written or removed under dir, whose subdirectories are buckets.
+// Objects are keyed by bucket and key joined by slash.
+type bucketWatcher struct {
+	dir string
+	// observed holds states at the last scan, and notified holds the ones which have been notified.
+	observed map[string]objectState
+	notified map[string]objectState
+	// sequence orders events, as sequencer of S3 does.
+	sequence uint64
+}
+
+// newBucketWatcher returns bucketWatcher, which regards existing files as notified.
+func newBucketWatcher(dir string) (*bucketWatcher, error) {
+	states, err := scanBuckets(dir)
+	if err != nil {
+		return nil, err
+	}
+	w := &bucketWatcher{dir: dir, observed: states, notified: make(map[string]objectState, len(states))}
+	for k, st := range states {
+		w.notified[k] = st
+	}
+	return w, nil
+}
+
+// scanBuckets returns states of files under subdirectories of dir. Hidden directories are not buckets.
+func scanBuckets(dir string) (map[string]objectState, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	states := map[string]objectState{}
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		root := filepath.Join(dir, e.Name())
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				// files can be removed while walking.
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			states[e.Name()+"/"+filepath.ToSlash(rel)] = objectState{size: info.Size(), modTime: info.ModTime()}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return states, nil
+}
+
+// scan returns records of files whose state has changed since notified and has not changed since the last scan,
+// and of files which have been removed.
+func (w *bucketWatcher) scan(now time.Time) ([]*S3EventRecord, error) {
+	states, err := scanBuckets(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(states)+len(w.notified))
+	for k := range states {
+		keys = append(keys, k)
+	}
+	for k := range w.notified {
+		if _, ok := states[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var records []*S3EventRecord
+	for _, k := range keys {
+		bucket, key := splitObjectKey(k)
+		st, exists := states[k]
+		if !exists {
+			delete(w.notified, k)
+			records = append(records, newS3EventRecord("ObjectRemoved:Delete", bucket, key, S3Object{Sequencer: w.nextSequencer()}, now))
+			continue
+		}
+		if last, ok := w.notified[k]; (ok && last == st) || w.observed[k] != st {
+			continue
+		}
+		etag, err := fileETag(filepath.Join(w.dir, filepath.FromSlash(k)))
+		if err != nil {
+			// the file is notified at the next scan, when it has been written again.
+			continue
+		}
+		w.notified[k] = st
+		size := st.size
+		records = append(records, newS3EventRecord("ObjectCreated:Put", bucket, key, S3Object{Size: &size, ETag: etag, Sequencer: w.nextSequencer()}, now))
+	}
+	w.observed = states
+	return records, nil
+}
+
+func (w *bucketWatcher) nextSequencer() string {
+	w.sequence++
+	return fmt.Sprintf("%016X", w.sequence)
+}
+
+func splitObjectKey(k string) (string, string) {
+	i := strings.IndexByte(k, '/')
+	return k[:i], k[i+1:]
+}
+
+// fileETag returns MD5 of file in hex, which is ETag of object uploaded in single part.
+func fileETag(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,73 @@
+package wheelamb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBucketWatcher(t *testing.T) {
+	dir := tempDir(t)
+	write := func(path, content string, modTime time.Time) {
+		t.Helper()
+		p := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	write("photos/existing.jpg", "old", base)
+	write(".minio.sys/format.json", "{}", base)
+	if err := ioutil.WriteFile(filepath.Join(dir, "readme.txt"), []byte("not a bucket"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := newBucketWatcher(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := base.Add(time.Hour)
+	scan := func() []string {
+		t.Helper()
+		records, err := w.scan(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list := []string{}
+		for _, r := range records {
+			list = append(list, r.EventName+" "+r.S3.Bucket.Name+" "+r.S3.Object.Key+" "+r.S3.Object.ETag)
+		}
+		return list
+	}
+	for _, tt := range []struct {
+		label    string
+		change   func()
+		expected []string
+	}{
+		{"no changes", func() {}, []string{}},
+		{"written file waits for a scan", func() { write("photos/uploads/new cat.jpg", "meow", base.Add(time.Minute)) }, []string{}},
+		{"stable file", func() {}, []string{"ObjectCreated:Put photos uploads/new+cat.jpg 4a4be40c96ac6314e91d93f38043a634"}},
+		{"notified once", func() {}, []string{}},
+		{"overwritten and removed", func() {
+			write("photos/existing.jpg", "new", base.Add(2*time.Minute))
+			if err := os.Remove(filepath.Join(dir, "photos", "uploads", "new cat.jpg")); err != nil {
+				t.Fatal(err)
+			}
+		}, []string{"ObjectRemoved:Delete photos uploads/new+cat.jpg "}},
+		{"overwritten file", func() {}, []string{"ObjectCreated:Put photos existing.jpg 22af645d1859cb5ca6da0c484f1f37ea"}},
+	} {
+		tt.change()
+		if actual := scan(); strings.Join(actual, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("%s: %v != %v", tt.label, actual, tt.expected)
+		}
+	}
+}
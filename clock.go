@@ -0,0 +1,129 @@
+package wheelamb
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock provides current time and timers, so that tests can control time of schedules and retries.
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls f after duration d, and returns function which cancels the call.
+	// The returned function reports whether the call was cancelled before f was called.
+	AfterFunc(d time.Duration, f func()) (stop func() bool)
+}
+
+// systemClock is Clock of wall clock time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) func() bool {
+	return time.AfterFunc(d, f).Stop
+}
+
+type virtualTimer struct {
+	at time.Time
+	// seq keeps timers of the same time in order of registration.
+	seq int
+	f   func()
+}
+
+// VirtualClock is Clock whose time moves only by Advance.
+type VirtualClock struct {
+	// advancing serializes Advance, so that timers fire in order.
+	advancing sync.Mutex
+	mu        sync.Mutex
+	now       time.Time
+	seq       int
+	timers    []*virtualTimer
+}
+
+// NewVirtualClock returns VirtualClock object starting from given time.
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{now: start}
+}
+
+// Now returns current virtual time.
+func (c *VirtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AfterFunc registers f which is called by Advance when virtual time reaches d after now.
+// f is called in its own goroutine when d is not positive, as Advance may not be called again.
+func (c *VirtualClock) AfterFunc(d time.Duration, f func()) func() bool {
+	if d <= 0 {
+		go f()
+		return func() bool { return false }
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	t := &virtualTimer{at: c.now.Add(d), seq: c.seq, f: f}
+	c.timers = append(c.timers, t)
+	return func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, e := range c.timers {
+			if e == t {
+				c.timers = append(c.timers[:i], c.timers[i+1:]...)
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Advance moves virtual time forward by d, and returns the new time.
+// Timers due until then are called one by one in order of their time, in the goroutine of caller.
+// Timers registered by them are also called when they are due, so that Advance returns
+// after every scheduled invocation in the period has been done.
+func (c *VirtualClock) Advance(d time.Duration) time.Time {
+	c.advancing.Lock()
+	defer c.advancing.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	target := c.now.Add(d)
+	for {
+		sort.Slice(c.timers, func(i, j int) bool {
+			if a, b := c.timers[i], c.timers[j]; !a.at.Equal(b.at) {
+				return a.at.Before(b.at)
+			}
+			return c.timers[i].seq < c.timers[j].seq
+		})
+		if len(c.timers) == 0 || c.timers[0].at.After(target) {
+			break
+		}
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		if t.at.After(c.now) {
+			c.now = t.at
+		}
+		c.mu.Unlock()
+		t.f()
+		c.mu.Lock()
+	}
+	if target.After(c.now) {
+		c.now = target
+	}
+	return c.now
+}
+
+// sleepContext waits for given duration of clock, and returns false when ctx is done.
+func sleepContext(ctx context.Context, c Clock, d time.Duration) bool {
+	done := make(chan struct{})
+	stop := c.AfterFunc(d, func() { close(done) })
+	defer stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-done:
+		return true
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"gopkg.in/yaml.v2"
+)
+
+// config holds settings for serve command.
+// Values are resolved in order of flags, environment variables, config file and defaults.
+type config struct {
+	DockerHost string `yaml:"docker_host" toml:"docker_host"`
+	LogLevel   string `yaml:"log_level" toml:"log_level"`
+	CodeDir    string `yaml:"code_dir" toml:"code_dir"`
+	Addr       string `yaml:"listen_addr" toml:"listen_addr"`
+	Region     string `yaml:"region" toml:"region"`
+	AccountID  string `yaml:"account_id" toml:"account_id"`
+	// SQSAddr is address of embedded SQS API, which is disabled when empty.
+	SQSAddr string `yaml:"sqs_addr" toml:"sqs_addr"`
+	// KinesisAddr is address of embedded Kinesis API, which is disabled when empty.
+	KinesisAddr string `yaml:"kinesis_addr" toml:"kinesis_addr"`
+	// SNSAddr is address of embedded SNS API, which is disabled when empty.
+	SNSAddr string `yaml:"sns_addr" toml:"sns_addr"`
+	// APIGatewayAddr is address of API Gateway REST front end, which is disabled when empty.
+	APIGatewayAddr string `yaml:"apigateway_addr" toml:"apigateway_addr"`
+	// APIGatewayRoutes is route table or OpenAPI document of REST API served on APIGatewayAddr.
+	APIGatewayRoutes string `yaml:"apigateway_routes" toml:"apigateway_routes"`
+	// HTTPAPIAddr is address of API Gateway HTTP API front end, which is disabled when empty.
+	HTTPAPIAddr string `yaml:"http_api_addr" toml:"http_api_addr"`
+	// HTTPAPIRoutes is route table or OpenAPI document of HTTP API served on HTTPAPIAddr.
+	HTTPAPIRoutes string `yaml:"http_api_routes" toml:"http_api_routes"`
+	// FunctionURLAddr is address of function URLs, which is disabled when empty.
+	FunctionURLAddr string `yaml:"function_url_addr" toml:"function_url_addr"`
+	// WebSocketAddr is address of API Gateway WebSocket API front end, which is disabled when empty.
+	WebSocketAddr string `yaml:"websocket_addr" toml:"websocket_addr"`
+	// WebSocketRoutes is route table of WebSocket API served on WebSocketAddr.
+	WebSocketRoutes string `yaml:"websocket_routes" toml:"websocket_routes"`
+	// S3WatchDir is directory whose subdirectories are watched as buckets for notifications, which is disabled when empty.
+	S3WatchDir string `yaml:"s3_watch_dir" toml:"s3_watch_dir"`
+	// VirtualClock enables virtual clock starting from the time, which is "now" or RFC3339 time.
+	// Schedules and retries follow the clock, which is advanced only by admin API.
+	VirtualClock string `yaml:"virtual_clock" toml:"virtual_clock"`
+	// Endpoints maps service name (e.g. "s3", "sqs") to endpoint of AWS compatible service.
+	Endpoints map[string]string `yaml:"endpoints" toml:"endpoints"`
+	// Schedules are created on start, which are given only by config file.
+	Schedules []scheduleConfig `yaml:"schedules" toml:"schedules"`
+	// S3Notifications are functions invoked by events of buckets, which are given only by config file.
+	S3Notifications []s3NotificationConfig `yaml:"s3_notifications" toml:"s3_notifications"`
+}
+
+// scheduleConfig describes schedule which invokes function periodically.
+type scheduleConfig struct {
+	Name string `yaml:"name" toml:"name"`
+	// Expression is rate(value unit) or cron(minutes hours day-of-month month day-of-week year).
+	Expression string `yaml:"expression" toml:"expression"`
+	Timezone   string `yaml:"timezone" toml:"timezone"`
+	// Target is function name or arn.
+	Target string `yaml:"target" toml:"target"`
+	// Input is JSON payload of invocation, Scheduled Event is sent when empty.
+	Input string `yaml:"input" toml:"input"`
+}
+
+// s3NotificationConfig describes function which events of bucket invoke.
+type s3NotificationConfig struct {
+	Bucket string `yaml:"bucket" toml:"bucket"`
+	// Events are event types such as s3:ObjectCreated:Put, which are s3:ObjectCreated:* when empty.
+	Events []string `yaml:"events" toml:"events"`
+	Prefix string   `yaml:"prefix" toml:"prefix"`
+	Suffix string   `yaml:"suffix" toml:"suffix"`
+	// Target is function name or arn.
+	Target string `yaml:"target" toml:"target"`
+}
+
+// bucketNotifications returns notification configurations of S3Notifications grouped by bucket.
+func (c *config) bucketNotifications() []*s3.PutBucketNotificationConfigurationInput {
+	var list []*s3.PutBucketNotificationConfigurationInput
+	byBucket := map[string]*s3.PutBucketNotificationConfigurationInput{}
+	for _, n := range c.S3Notifications {
+		input := byBucket[n.Bucket]
+		if input == nil {
+			input = &s3.PutBucketNotificationConfigurationInput{
+				Bucket:                    aws.String(n.Bucket),
+				NotificationConfiguration: &s3.NotificationConfiguration{},
+			}
+			byBucket[n.Bucket] = input
+			list = append(list, input)
+		}
+		events := n.Events
+		if len(events) == 0 {
+			events = []string{"s3:ObjectCreated:*"}
+		}
+		var rules []*s3.FilterRule
+		if n.Prefix != "" {
+			rules = append(rules, &s3.FilterRule{Name: aws.String("prefix"), Value: aws.String(n.Prefix)})
+		}
+		if n.Suffix != "" {
+			rules = append(rules, &s3.FilterRule{Name: aws.String("suffix"), Value: aws.String(n.Suffix)})
+		}
+		conf := input.NotificationConfiguration
+		conf.LambdaFunctionConfigurations = append(conf.LambdaFunctionConfigurations, &s3.LambdaFunctionConfiguration{
+			Id:                aws.String(fmt.Sprintf("%s-%d", n.Bucket, len(conf.LambdaFunctionConfigurations)+1)),
+			LambdaFunctionArn: aws.String(n.Target),
+			Events:            aws.StringSlice(events),
+			Filter:            &s3.NotificationConfigurationFilter{Key: &s3.KeyFilter{FilterRules: rules}},
+		})
+	}
+	return list
+}
+
+func defaultConfig() *config {
+	return &config{
+		DockerHost: "unix:///var/run/docker.sock",
+		LogLevel:   "info",
+		CodeDir:    "/var/task",
+		Addr:       ":9001",
+		Region:     "us-east-1",
+		AccountID:  "000000000000",
+		Endpoints:  map[string]string{},
+	}
+}
+
+type configField struct {
+	flag  string
+	env   string
+	usage string
+	ptr   func(*config) *string
+}
+
+var configFields = []configField{
+	{"docker-host", "DOCKER_HOST", "docker daemon socket", func(c *config) *string { return &c.DockerHost }},
+	{"log-level", "WHEELAMB_LOG_LEVEL", "log level (debug, info)", func(c *config) *string { return &c.LogLevel }},
+	{"dir", "WHEELAMB_CODE_DIR", "directory for extracting function code", func(c *config) *string { return &c.CodeDir }},
+	{"addr", "WHEELAMB_LISTEN_ADDR", "address for lambda API", func(c *config) *string { return &c.Addr }},
+	{"region", "AWS_REGION", "region name which wheelamb behaves as", func(c *config) *string { return &c.Region }},
+	{"account-id", "WHEELAMB_ACCOUNT_ID", "account id which wheelamb behaves as", func(c *config) *string { return &c.AccountID }},
+	{"sqs-addr", "WHEELAMB_SQS_ADDR", "address for embedded SQS API, disabled when empty", func(c *config) *string { return &c.SQSAddr }},
+	{"kinesis-addr", "WHEELAMB_KINESIS_ADDR", "address for embedded Kinesis API, disabled when empty", func(c *config) *string { return &c.KinesisAddr }},
+	{"sns-addr", "WHEELAMB_SNS_ADDR", "address for embedded SNS API, disabled when empty", func(c *config) *string { return &c.SNSAddr }},
+	{"apigateway-addr", "WHEELAMB_APIGATEWAY_ADDR", "address for API Gateway REST front end, disabled when empty", func(c *config) *string { return &c.APIGatewayAddr }},
+	{"apigateway-routes", "WHEELAMB_APIGATEWAY_ROUTES", "route table or OpenAPI document of REST API", func(c *config) *string { return &c.APIGatewayRoutes }},
+	{"http-api-addr", "WHEELAMB_HTTP_API_ADDR", "address for API Gateway HTTP API front end, disabled when empty", func(c *config) *string { return &c.HTTPAPIAddr }},
+	{"http-api-routes", "WHEELAMB_HTTP_API_ROUTES", "route table or OpenAPI document of HTTP API", func(c *config) *string { return &c.HTTPAPIRoutes }},
+	{"function-url-addr", "WHEELAMB_FUNCTION_URL_ADDR", "address for function URLs, disabled when empty", func(c *config) *string { return &c.FunctionURLAddr }},
+	{"websocket-addr", "WHEELAMB_WEBSOCKET_ADDR", "address for API Gateway WebSocket API front end, disabled when empty", func(c *config) *string { return &c.WebSocketAddr }},
+	{"websocket-routes", "WHEELAMB_WEBSOCKET_ROUTES", "route table of WebSocket API", func(c *config) *string { return &c.WebSocketRoutes }},
+	{"s3-watch-dir", "WHEELAMB_S3_WATCH_DIR", "directory whose subdirectories are watched as buckets for S3 notifications, disabled when empty", func(c *config) *string { return &c.S3WatchDir }},
+	{"virtual-clock", "WHEELAMB_VIRTUAL_CLOCK", "start time of virtual clock (now or RFC3339), wall clock is used when empty", func(c *config) *string { return &c.VirtualClock }},
+}
+
+// loadFile loads config file, which is TOML with extension .toml and YAML otherwise.
+func (c *config) loadFile(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if strings.ToLower(filepath.Ext(path)) != ".toml" {
+		return yaml.UnmarshalStrict(b, c)
+	}
+	md, err := toml.Decode(string(b), c)
+	if err != nil {
+		return err
+	}
+	if keys := md.Undecoded(); len(keys) > 0 {
+		return fmt.Errorf("%s: unknown keys %v", path, keys)
+	}
+	return nil
+}
+
+// loadConfig parses args and resolves config.
+func loadConfig(fs *flag.FlagSet, args []string, getenv func(string) string) (*config, error) {
+	flagValues := make(map[string]*string, len(configFields))
+	for _, f := range configFields {
+		flagValues[f.flag] = fs.String(f.flag, "", f.usage+" (env: "+f.env+")")
+	}
+	endpoints := fs.String("endpoints", "", "comma separated endpoints of AWS compatible services, e.g. s3=http://localhost:9000 (env: WHEELAMB_ENDPOINTS)")
+	path := fs.String("config", "", "path to YAML or TOML config file (env: WHEELAMB_CONFIG)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	conf := defaultConfig()
+	if *path == "" {
+		*path = getenv("WHEELAMB_CONFIG")
+	}
+	if *path != "" {
+		if err := conf.loadFile(*path); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range configFields {
+		if v := getenv(f.env); v != "" {
+			*f.ptr(conf) = v
+		}
+	}
+	if err := conf.mergeEndpoints(getenv("WHEELAMB_ENDPOINTS")); err != nil {
+		return nil, err
+	}
+	set := map[string]bool{}
+	fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+	for _, f := range configFields {
+		if set[f.flag] {
+			*f.ptr(conf) = *flagValues[f.flag]
+		}
+	}
+	if err := conf.mergeEndpoints(*endpoints); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// virtualClockStart returns start time of virtual clock, and false when virtual clock is disabled.
+func (c *config) virtualClockStart(now time.Time) (time.Time, bool, error) {
+	switch c.VirtualClock {
+	case "":
+		return time.Time{}, false, nil
+	case "now":
+		return now, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, c.VirtualClock)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid virtual clock: %s", c.VirtualClock)
+	}
+	return t, true, nil
+}
+
+// mergeEndpoints parses endpoints given as "service=url,service=url".
+func (c *config) mergeEndpoints(v string) error {
+	if v == "" {
+		return nil
+	}
+	if c.Endpoints == nil {
+		c.Endpoints = map[string]string{}
+	}
+	for _, pair := range strings.Split(v, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return fmt.Errorf("invalid endpoint: %s", pair)
+		}
+		c.Endpoints[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return nil
+}
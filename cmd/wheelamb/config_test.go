@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "wheelamb.yml")
+	if err := ioutil.WriteFile(path, []byte(`log_level: debug
+region: ap-northeast-1
+listen_addr: ':8080'
+schedules:
+  - name: nightly
+    expression: cron(0 3 * * ? *)
+    timezone: Asia/Tokyo
+    target: myfunc
+s3_notifications:
+  - bucket: images
+    suffix: .jpg
+    target: resize
+  - bucket: images
+    events: [s3:ObjectRemoved:*]
+    target: cleanup
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	envs := map[string]string{
+		"WHEELAMB_CONFIG":            path,
+		"AWS_REGION":                 "eu-west-1",
+		"WHEELAMB_ENDPOINTS":         "s3=http://minio:9000,sqs=http://elasticmq:9324",
+		"WHEELAMB_VIRTUAL_CLOCK":     "2024-01-01T09:00:00+09:00",
+		"WHEELAMB_SNS_ADDR":          ":9911",
+		"WHEELAMB_APIGATEWAY_ROUTES": "routes.yml",
+		"WHEELAMB_FUNCTION_URL_ADDR": ":9003",
+		"WHEELAMB_WEBSOCKET_ROUTES":  "websocket.yml",
+	}
+	getenv := func(k string) string { return envs[k] }
+
+	conf, err := loadConfig(flag.NewFlagSet("serve", flag.ContinueOnError), []string{"-addr", ":9999", "-endpoints", "sqs=http://localhost:9324"}, getenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		label    string
+		actual   string
+		expected string
+	}{
+		{"default", conf.DockerHost, "unix:///var/run/docker.sock"},
+		{"config file", conf.LogLevel, "debug"},
+		{"env over config file", conf.Region, "eu-west-1"},
+		{"flag over config file", conf.Addr, ":9999"},
+		{"sns addr from env", conf.SNSAddr, ":9911"},
+		{"apigateway routes from env", conf.APIGatewayRoutes, "routes.yml"},
+		{"function url addr from env", conf.FunctionURLAddr, ":9003"},
+		{"websocket routes from env", conf.WebSocketRoutes, "websocket.yml"},
+		{"endpoint from env", conf.Endpoints["s3"], "http://minio:9000"},
+		{"endpoint from flag", conf.Endpoints["sqs"], "http://localhost:9324"},
+		{"schedule from config file", conf.Schedules[0].Expression, "cron(0 3 * * ? *)"},
+	} {
+		if tt.actual != tt.expected {
+			t.Errorf("%s: %s != %s", tt.label, tt.actual, tt.expected)
+		}
+	}
+
+	notifications := conf.bucketNotifications()
+	if len(notifications) != 1 || *notifications[0].Bucket != "images" {
+		t.Fatalf("unexpected notifications: %v", notifications)
+	}
+	if confs := notifications[0].NotificationConfiguration.LambdaFunctionConfigurations; len(confs) != 2 ||
+		*confs[0].Events[0] != "s3:ObjectCreated:*" || *confs[0].Filter.Key.FilterRules[0].Value != ".jpg" ||
+		*confs[1].LambdaFunctionArn != "cleanup" || len(confs[1].Filter.Key.FilterRules) != 0 || *confs[0].Id == *confs[1].Id {
+		t.Errorf("unexpected configurations: %v", confs)
+	}
+
+	if _, err := loadConfig(flag.NewFlagSet("serve", flag.ContinueOnError), []string{"-config", filepath.Join(dir, "missing.yml")}, getenv); err == nil {
+		t.Error("error should exists for missing config file")
+	}
+
+	tomlPath := filepath.Join(dir, "wheelamb.toml")
+	if err := ioutil.WriteFile(tomlPath, []byte(`log_level = "debug"
+region = "ap-northeast-1"
+listen_addr = ":8080"
+
+[[schedules]]
+name = "nightly"
+expression = "cron(0 3 * * ? *)"
+timezone = "Asia/Tokyo"
+target = "myfunc"
+
+[[s3_notifications]]
+bucket = "images"
+suffix = ".jpg"
+target = "resize"
+
+[[s3_notifications]]
+bucket = "images"
+events = ["s3:ObjectRemoved:*"]
+target = "cleanup"
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tomlConf, err := loadConfig(flag.NewFlagSet("serve", flag.ContinueOnError), []string{"-config", tomlPath, "-addr", ":9999", "-endpoints", "sqs=http://localhost:9324"}, getenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tomlConf, conf) {
+		t.Errorf("TOML config differs from YAML config: %#v", tomlConf)
+	}
+	if err := ioutil.WriteFile(tomlPath, []byte("listen = \":8080\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(flag.NewFlagSet("serve", flag.ContinueOnError), []string{"-config", tomlPath}, getenv); err == nil {
+		t.Error("error should exists for unknown key in TOML config file")
+	}
+
+	now := time.Now()
+	for _, tt := range []struct {
+		value    string
+		expected time.Time
+		virtual  bool
+		err      bool
+	}{
+		{"", time.Time{}, false, false},
+		{"now", now, true, false},
+		{conf.VirtualClock, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), true, false},
+		{"tomorrow", time.Time{}, false, true},
+	} {
+		c := &config{VirtualClock: tt.value}
+		start, virtual, err := c.virtualClockStart(now)
+		if !start.Equal(tt.expected) || virtual != tt.virtual || (err != nil) != tt.err {
+			t.Errorf("virtual clock %q: unexpected start: %s, %v, %v", tt.value, start, virtual, err)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/taiyoh/wheelamb"
+	"github.com/taiyoh/wheelamb/apigatewayd"
+	"github.com/taiyoh/wheelamb/docker"
+	"github.com/taiyoh/wheelamb/kinesisd"
+	"github.com/taiyoh/wheelamb/server"
+	"github.com/taiyoh/wheelamb/snsd"
+	"github.com/taiyoh/wheelamb/sqsd"
+)
+
+const usage = `Usage: wheelamb <command> [options]
+
+Commands:
+  serve    run lambda compatible API server
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	switch cmd := os.Args[1]; cmd {
+	case "serve":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		conf, err := loadConfig(fs, os.Args[2:], os.Getenv)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := serve(conf); err != nil {
+			log.Fatal(err)
+		}
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+}
+
+func serve(conf *config) error {
+	start, virtual, err := conf.virtualClockStart(time.Now())
+	if err != nil {
+		return err
+	}
+	wheelamb.SetAWSAccount(conf.Region, conf.AccountID)
+	for service, url := range conf.Endpoints {
+		wheelamb.SetEndpoint(service, url)
+	}
+	if conf.FunctionURLAddr != "" {
+		if err := wheelamb.SetFunctionURLEndpoint(localURL(conf.FunctionURLAddr)); err != nil {
+			return err
+		}
+	}
+
+	d, err := docker.NewDockerGateway(conf.DockerHost, conf.LogLevel)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(conf.CodeDir, 0755); err != nil {
+		return err
+	}
+	svc := wheelamb.NewLambdaService(d, conf.CodeDir, wheelamb.NewLambdaRegistry())
+
+	var (
+		servers []*http.Server
+		opts    []wheelamb.SourceMappingServiceOption
+		schOpts []wheelamb.SchedulerOption
+		srvOpts []server.Option
+	)
+	if virtual {
+		clock := wheelamb.NewVirtualClock(start)
+		opts = append(opts, wheelamb.WithClock(clock))
+		schOpts = append(schOpts, wheelamb.WithSchedulerClock(clock))
+		srvOpts = append(srvOpts, server.WithVirtualClock(clock))
+		log.Printf("virtual clock starts at %s", start.Format(time.RFC3339))
+	}
+	if conf.SQSAddr != "" {
+		q := sqsd.New(conf.Region, conf.AccountID, localURL(conf.SQSAddr))
+		servers = append(servers, &http.Server{Addr: conf.SQSAddr, Handler: sqsd.NewHandler(q)})
+		opts = append(opts, wheelamb.WithSQS(q))
+	}
+	if conf.KinesisAddr != "" {
+		k := kinesisd.New(conf.Region, conf.AccountID)
+		servers = append(servers, &http.Server{Addr: conf.KinesisAddr, Handler: kinesisd.NewHandler(k)})
+		opts = append(opts, wheelamb.WithKinesis(k))
+	}
+	var topics *snsd.Service
+	if conf.SNSAddr != "" {
+		topics = snsd.New(conf.Region, conf.AccountID, localURL(conf.SNSAddr), svc)
+		servers = append(servers, &http.Server{Addr: conf.SNSAddr, Handler: snsd.NewHandler(topics)})
+		opts = append(opts, wheelamb.WithSNS(topics))
+	}
+	gw := apigatewayd.New(conf.Region, conf.AccountID, svc)
+	if conf.APIGatewayAddr != "" {
+		if conf.APIGatewayRoutes == "" {
+			return errors.New("apigateway-routes is required for API Gateway front end")
+		}
+		api, err := apigatewayd.LoadRESTAPI(conf.APIGatewayRoutes)
+		if err != nil {
+			return err
+		}
+		h, err := gw.RESTHandler(api)
+		if err != nil {
+			return fmt.Errorf("%s: %v", conf.APIGatewayRoutes, err)
+		}
+		servers = append(servers, &http.Server{Addr: conf.APIGatewayAddr, Handler: h})
+	}
+	if conf.HTTPAPIAddr != "" {
+		if conf.HTTPAPIRoutes == "" {
+			return errors.New("http-api-routes is required for HTTP API front end")
+		}
+		api, err := apigatewayd.LoadHTTPAPI(conf.HTTPAPIRoutes)
+		if err != nil {
+			return err
+		}
+		h, err := gw.HTTPHandler(api)
+		if err != nil {
+			return fmt.Errorf("%s: %v", conf.HTTPAPIRoutes, err)
+		}
+		servers = append(servers, &http.Server{Addr: conf.HTTPAPIAddr, Handler: h})
+	}
+	if conf.FunctionURLAddr != "" {
+		servers = append(servers, &http.Server{Addr: conf.FunctionURLAddr, Handler: gw.FunctionURLHandler(svc)})
+	}
+	if conf.WebSocketAddr != "" {
+		if conf.WebSocketRoutes == "" {
+			return errors.New("websocket-routes is required for WebSocket API front end")
+		}
+		api, err := apigatewayd.LoadWebSocketAPI(conf.WebSocketRoutes)
+		if err != nil {
+			return err
+		}
+		h, err := gw.WebSocketHandler(api)
+		if err != nil {
+			return fmt.Errorf("%s: %v", conf.WebSocketRoutes, err)
+		}
+		servers = append(servers, &http.Server{Addr: conf.WebSocketAddr, Handler: h})
+	}
+	msvc := wheelamb.NewSourceMappingService(svc, opts...)
+	sch := wheelamb.NewScheduler(svc, schOpts...)
+	ebs := wheelamb.NewEventBusService(svc)
+	for _, sc := range conf.Schedules {
+		input := &wheelamb.ScheduleInput{
+			Name:                       sc.Name,
+			ScheduleExpression:         sc.Expression,
+			ScheduleExpressionTimezone: sc.Timezone,
+			Target:                     wheelamb.ScheduleTarget{Arn: sc.Target},
+		}
+		if sc.Input != "" {
+			payload := sc.Input
+			input.Target.Input = &payload
+		}
+		if _, err := sch.CreateSchedule(context.Background(), input); err != nil {
+			sch.Close()
+			return fmt.Errorf("schedule %s: %v", sc.Name, err)
+		}
+	}
+	bns := wheelamb.NewBucketNotificationService(svc)
+	for _, input := range conf.bucketNotifications() {
+		if _, err := bns.PutBucketNotificationConfiguration(context.Background(), input); err != nil {
+			sch.Close()
+			bns.Close()
+			return fmt.Errorf("s3 notifications of %s: %v", *input.Bucket, err)
+		}
+	}
+	if conf.S3WatchDir != "" {
+		if err := bns.WatchDirectory(conf.S3WatchDir, time.Second); err != nil {
+			sch.Close()
+			bns.Close()
+			return err
+		}
+		log.Printf("watching %s for S3 notifications", conf.S3WatchDir)
+	}
+	servers = append([]*http.Server{{
+		Addr:    conf.Addr,
+		Handler: server.New(svc, append(srvOpts, server.WithSourceMappingService(msvc), server.WithScheduler(sch), server.WithEventBusService(ebs), server.WithBucketNotificationService(bns))...),
+	}}, servers...)
+
+	errCh := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			log.Printf("wheelamb listening on %s", srv.Addr)
+			if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+				errCh <- err
+			}
+		}(srv)
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err = <-errCh:
+	case sig := <-sigCh:
+		log.Printf("received %s, shutting down", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("failed to shutdown server: %v", err)
+		}
+	}
+	sch.Close()
+	ebs.Close()
+	bns.Close()
+	msvc.Close()
+	if topics != nil {
+		topics.Close()
+	}
+	if cerr := svc.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// localURL returns url of listen address for clients on the same host.
+func localURL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://" + addr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
@@ -17,6 +17,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 )
 
 const (
@@ -292,17 +293,25 @@ type createContainerConfig struct {
 
 // RunImageConfig represents parameters to run specified image.
 type RunImageConfig struct {
-	Name    string
-	Envs    map[string]string
-	Dir     string
-	Tag     string
-	Handler string
+	Name       string
+	Envs       map[string]string
+	Dir        string
+	Tag        string
+	Handler    string
+	MemorySize int64
+	Timeout    int64
 }
 
 func (d *dockerGateway) createContainer(ctx context.Context, params RunImageConfig) (string, error) {
 	envList := []string{
 		"DOCKER_LAMBDA_STAY_OPEN=1",
 	}
+	if params.MemorySize > 0 {
+		envList = append(envList, fmt.Sprintf("AWS_LAMBDA_FUNCTION_MEMORY_SIZE=%d", params.MemorySize))
+	}
+	if params.Timeout > 0 {
+		envList = append(envList, fmt.Sprintf("AWS_LAMBDA_FUNCTION_TIMEOUT=%d", params.Timeout))
+	}
 	for k, v := range params.Envs {
 		envList = append(envList, k+"="+v)
 	}
@@ -383,12 +392,38 @@ func (d *dockerGateway) RunImage(ctx context.Context, params RunImageConfig) (*C
 		return nil, err
 	}
 
+	addr := fmt.Sprintf("%s:9001", params.Name)
+	if err := waitPort(ctx, addr, containerReadyTimeout); err != nil {
+		d.logger.Debug("container:%s is not reachable: %v", containerID, err)
+	}
+
 	return &ContainerInspect{
 		ID:   containerID,
-		Addr: fmt.Sprintf("%s:9001", params.Name),
+		Addr: addr,
 	}, nil
 }
 
+// containerReadyTimeout is how long RunImage waits for the lambda API of container to be reachable.
+const containerReadyTimeout = 10 * time.Second
+
+// waitPort waits until given address accepts connection.
+func waitPort(ctx context.Context, addr string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	dialer := &net.Dialer{}
+	for {
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			return conn.Close()
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
 type errList []error
 
 func (l errList) Error() string {
@@ -402,6 +437,12 @@ func (l errList) Errors() []error {
 func (d *dockerGateway) KillMulti(ctx context.Context, ids []string) error {
 	semaphore := make(chan struct{}, 3)
 	var errs errList
+	mu := &sync.Mutex{}
+	appendErr := func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}
 	wg := &sync.WaitGroup{}
 	for _, id := range ids {
 		semaphore <- struct{}{}
@@ -414,22 +455,30 @@ func (d *dockerGateway) KillMulti(ctx context.Context, ids []string) error {
 			resp, err := d.apiClient.DoRequest(ctx, http.MethodPost,
 				fmt.Sprintf("/containers/%s/kill", id))
 			if err != nil {
-				errs = append(errs, err)
+				appendErr(err)
 				return
 			}
 			defer resp.Body.Close()
-			if resp.StatusCode < 300 {
+			switch {
+			case resp.StatusCode < 300:
 				d.logger.Debug("container:%s closed", id)
 				return
+			case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusConflict:
+				// container is already removed or not running.
+				d.logger.Debug("container:%s already closed", id)
+				return
 			}
 			switch b, err := ioutil.ReadAll(resp.Body); {
 			case err != nil:
-				errs = append(errs, err)
+				appendErr(err)
 			default:
-				errs = append(errs, fmt.Errorf("failed to kill container: %s, err: %s", id, b))
+				appendErr(fmt.Errorf("failed to kill container: %s, err: %s", id, b))
 			}
 		}(id)
 	}
 	wg.Wait()
+	if len(errs) == 0 {
+		return nil
+	}
 	return errs
 }
@@ -0,0 +1,652 @@
+package wheelamb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/google/uuid"
+	"github.com/taiyoh/wheelamb/internal/pattern"
+)
+
+const (
+	defaultEventBus = "default"
+	// maxTargetsPerRule is the maximum number of targets of rule.
+	maxTargetsPerRule = 5
+	// maxPutEventsEntries is the maximum number of entries of PutEvents.
+	maxPutEventsEntries = 10
+	defaultListLimit    = 100
+)
+
+// eventEnvelope is event which EventBridge delivers to functions, including scheduled events.
+// via https://docs.aws.amazon.com/eventbridge/latest/userguide/eb-events-structure.html
+type eventEnvelope struct {
+	Version    string          `json:"version"`
+	ID         string          `json:"id"`
+	DetailType string          `json:"detail-type"`
+	Source     string          `json:"source"`
+	Account    string          `json:"account"`
+	Time       string          `json:"time"`
+	Region     string          `json:"region"`
+	Resources  []string        `json:"resources"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// eventTarget is function which rule invokes, with compiled InputPath or InputTransformer.
+type eventTarget struct {
+	conf        *eventbridge.Target
+	inputPath   jsonPath
+	transformer *inputTransformer
+}
+
+// input builds payload of invocation from event.
+func (t *eventTarget) input(raw []byte, rule *eventbridge.Rule, ingestion time.Time) []byte {
+	if t.conf.Input != nil {
+		return []byte(*t.conf.Input)
+	}
+	if t.inputPath == nil && t.transformer == nil {
+		return raw
+	}
+	// numbers are kept as they are in event.
+	var event interface{}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	d.Decode(&event)
+	if t.inputPath != nil {
+		v, ok := t.inputPath.lookup(event)
+		if !ok {
+			return []byte("null")
+		}
+		b, _ := json.Marshal(v)
+		return b
+	}
+	return t.transformer.transform(event, map[string]interface{}{
+		"aws.events.rule-arn":             aws.StringValue(rule.Arn),
+		"aws.events.rule-name":            aws.StringValue(rule.Name),
+		"aws.events.event.ingestion-time": ingestion.UTC().Format(time.RFC3339),
+		"aws.events.event":                event,
+		"aws.events.event.json":           event,
+	})
+}
+
+type eventRule struct {
+	conf    *eventbridge.Rule
+	pattern *pattern.Pattern
+	targets map[string]*eventTarget
+}
+
+// sortedTargets returns targets of rule sorted by id.
+func (r *eventRule) sortedTargets() []*eventTarget {
+	list := make([]*eventTarget, 0, len(r.targets))
+	for _, t := range r.targets {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return *list[i].conf.Id < *list[j].conf.Id })
+	return list
+}
+
+type eventBus struct {
+	conf  *eventbridge.EventBus
+	rules map[string]*eventRule
+}
+
+// EventBusService provides interfaces of EventBridge, which delivers events put into buses
+// to functions through rules matching their event patterns.
+type EventBusService struct {
+	registry *LambdaRegistry
+	lambda   invoker
+	mu       sync.Mutex
+	buses    map[string]*eventBus
+	// running tracks invocations in progress.
+	running sync.WaitGroup
+}
+
+// NewEventBusService returns EventBusService object which has the default event bus.
+func NewEventBusService(svc *LambdaService) *EventBusService {
+	return newEventBusService(svc.registry, svc)
+}
+
+func newEventBusService(registry *LambdaRegistry, inv invoker) *EventBusService {
+	s := &EventBusService{
+		registry: registry,
+		lambda:   inv,
+		buses:    make(map[string]*eventBus),
+	}
+	s.buses[defaultEventBus] = newEventBus(defaultEventBus)
+	return s
+}
+
+// Close waits for invocations in progress.
+func (s *EventBusService) Close() error {
+	s.running.Wait()
+	return nil
+}
+
+func newEventBus(name string) *eventBus {
+	return &eventBus{
+		conf: &eventbridge.EventBus{
+			Name: aws.String(name),
+			Arn:  aws.String(fmt.Sprintf("arn:aws:events:%s:%s:event-bus/%s", Region(), accountID, name)),
+		},
+		rules: make(map[string]*eventRule),
+	}
+}
+
+func ruleARN(bus, name string) string {
+	if bus == defaultEventBus {
+		return fmt.Sprintf("arn:aws:events:%s:%s:rule/%s", Region(), accountID, name)
+	}
+	return fmt.Sprintf("arn:aws:events:%s:%s:rule/%s/%s", Region(), accountID, bus, name)
+}
+
+// getBus returns event bus of given name or arn, which is default when empty. It must be called with mu locked.
+func (s *EventBusService) getBus(name *string) (*eventBus, error) {
+	n := aws.StringValue(name)
+	if n == "" {
+		n = defaultEventBus
+	}
+	if strings.HasPrefix(n, "arn:") {
+		n = n[strings.LastIndex(n, "/")+1:]
+	}
+	bus, ok := s.buses[n]
+	if !ok {
+		return nil, awserr.New(eventbridge.ErrCodeResourceNotFoundException, "Event bus "+n+" does not exist.", nil)
+	}
+	return bus, nil
+}
+
+// getRule returns rule of given name in event bus. It must be called with mu locked.
+func (s *EventBusService) getRule(busName *string, name string) (*eventRule, error) {
+	bus, err := s.getBus(busName)
+	if err != nil {
+		return nil, err
+	}
+	rule, ok := bus.rules[name]
+	if !ok {
+		return nil, awserr.New(eventbridge.ErrCodeResourceNotFoundException, "Rule "+name+" does not exist on EventBus "+*bus.conf.Name+".", nil)
+	}
+	return rule, nil
+}
+
+// pageNames returns page of sorted names after token, which is the last name of previous page.
+func pageNames(names []string, token *string, limit *int64) ([]string, *string) {
+	sort.Strings(names)
+	if t := aws.StringValue(token); t != "" {
+		i := sort.SearchStrings(names, t)
+		if i < len(names) && names[i] == t {
+			i++
+		}
+		names = names[i:]
+	}
+	n := int(aws.Int64Value(limit))
+	if n <= 0 {
+		n = defaultListLimit
+	}
+	if len(names) <= n {
+		return names, nil
+	}
+	return names[:n], aws.String(names[n-1])
+}
+
+// CreateEventBus creates custom event bus. Partner event sources are not supported.
+func (s *EventBusService) CreateEventBus(ctx context.Context, input *eventbridge.CreateEventBusInput) (*eventbridge.CreateEventBusOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	if input.EventSourceName != nil {
+		return nil, awserr.New(errCodeValidationException, "Partner event sources are not supported.", nil)
+	}
+	name := *input.Name
+	if name == defaultEventBus || strings.Contains(name, "/") {
+		return nil, awserr.New(errCodeValidationException, "Event bus name must not be default and must not contain '/'.", nil)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.buses[name]; ok {
+		return nil, awserr.New(eventbridge.ErrCodeResourceAlreadyExistsException, "Event bus "+name+" already exists.", nil)
+	}
+	bus := newEventBus(name)
+	s.buses[name] = bus
+	return &eventbridge.CreateEventBusOutput{EventBusArn: bus.conf.Arn}, nil
+}
+
+// DescribeEventBus returns event bus, which is default when name is not given.
+func (s *EventBusService) DescribeEventBus(ctx context.Context, input *eventbridge.DescribeEventBusInput) (*eventbridge.DescribeEventBusOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bus, err := s.getBus(input.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &eventbridge.DescribeEventBusOutput{Arn: bus.conf.Arn, Name: bus.conf.Name}, nil
+}
+
+// DeleteEventBus deletes custom event bus with its rules and targets.
+func (s *EventBusService) DeleteEventBus(ctx context.Context, input *eventbridge.DeleteEventBusInput) (*eventbridge.DeleteEventBusOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	if *input.Name == defaultEventBus {
+		return nil, awserr.New(errCodeValidationException, "Cannot delete event bus default.", nil)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.buses, *input.Name)
+	return &eventbridge.DeleteEventBusOutput{}, nil
+}
+
+// ListEventBuses returns event buses sorted by name.
+func (s *EventBusService) ListEventBuses(ctx context.Context, input *eventbridge.ListEventBusesInput) (*eventbridge.ListEventBusesOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for name := range s.buses {
+		if strings.HasPrefix(name, aws.StringValue(input.NamePrefix)) {
+			names = append(names, name)
+		}
+	}
+	page, next := pageNames(names, input.NextToken, input.Limit)
+	out := &eventbridge.ListEventBusesOutput{EventBuses: []*eventbridge.EventBus{}, NextToken: next}
+	for _, name := range page {
+		conf := *s.buses[name].conf
+		out.EventBuses = append(out.EventBuses, &conf)
+	}
+	return out, nil
+}
+
+// PutRule creates or updates rule with event pattern. Rules of schedule expression are not supported,
+// as Scheduler serves schedules.
+func (s *EventBusService) PutRule(ctx context.Context, input *eventbridge.PutRuleInput) (*eventbridge.PutRuleOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	if input.ScheduleExpression != nil {
+		return nil, awserr.New(errCodeValidationException, "ScheduleExpression is not supported, use schedules of EventBridge Scheduler instead.", nil)
+	}
+	if input.EventPattern == nil {
+		return nil, awserr.New(errCodeValidationException, "Parameter EventPattern must be specified.", nil)
+	}
+	p, err := pattern.Compile(*input.EventPattern)
+	if err != nil {
+		return nil, awserr.New(eventbridge.ErrCodeInvalidEventPatternException, "Event pattern is not valid. Reason: "+err.Error(), nil)
+	}
+	state := aws.StringValue(input.State)
+	if state == "" {
+		state = eventbridge.RuleStateEnabled
+	}
+	if state != eventbridge.RuleStateEnabled && state != eventbridge.RuleStateDisabled {
+		return nil, awserr.New(errCodeValidationException, "State must be ENABLED or DISABLED", nil)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bus, err := s.getBus(input.EventBusName)
+	if err != nil {
+		return nil, err
+	}
+	conf := &eventbridge.Rule{
+		Arn:          aws.String(ruleARN(*bus.conf.Name, *input.Name)),
+		Name:         input.Name,
+		EventBusName: bus.conf.Name,
+		EventPattern: input.EventPattern,
+		Description:  input.Description,
+		RoleArn:      input.RoleArn,
+		State:        aws.String(state),
+	}
+	rule, ok := bus.rules[*input.Name]
+	if !ok {
+		rule = &eventRule{targets: make(map[string]*eventTarget)}
+		bus.rules[*input.Name] = rule
+	}
+	rule.conf, rule.pattern = conf, p
+	return &eventbridge.PutRuleOutput{RuleArn: conf.Arn}, nil
+}
+
+// DescribeRule returns rule of given name.
+func (s *EventBusService) DescribeRule(ctx context.Context, input *eventbridge.DescribeRuleInput) (*eventbridge.DescribeRuleOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rule, err := s.getRule(input.EventBusName, *input.Name)
+	if err != nil {
+		return nil, err
+	}
+	c := rule.conf
+	return &eventbridge.DescribeRuleOutput{
+		Arn:          c.Arn,
+		Name:         c.Name,
+		EventBusName: c.EventBusName,
+		EventPattern: c.EventPattern,
+		Description:  c.Description,
+		RoleArn:      c.RoleArn,
+		State:        c.State,
+	}, nil
+}
+
+// setRuleState changes state of rule.
+func (s *EventBusService) setRuleState(busName *string, name, state string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rule, err := s.getRule(busName, name)
+	if err != nil {
+		return err
+	}
+	conf := *rule.conf
+	conf.State = aws.String(state)
+	rule.conf = &conf
+	return nil
+}
+
+// EnableRule enables rule, so that matching events are delivered to its targets.
+func (s *EventBusService) EnableRule(ctx context.Context, input *eventbridge.EnableRuleInput) (*eventbridge.EnableRuleOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.setRuleState(input.EventBusName, *input.Name, eventbridge.RuleStateEnabled); err != nil {
+		return nil, err
+	}
+	return &eventbridge.EnableRuleOutput{}, nil
+}
+
+// DisableRule disables rule, so that no events are delivered to its targets.
+func (s *EventBusService) DisableRule(ctx context.Context, input *eventbridge.DisableRuleInput) (*eventbridge.DisableRuleOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.setRuleState(input.EventBusName, *input.Name, eventbridge.RuleStateDisabled); err != nil {
+		return nil, err
+	}
+	return &eventbridge.DisableRuleOutput{}, nil
+}
+
+// DeleteRule deletes rule, which must not have targets unless Force is given.
+func (s *EventBusService) DeleteRule(ctx context.Context, input *eventbridge.DeleteRuleInput) (*eventbridge.DeleteRuleOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bus, err := s.getBus(input.EventBusName)
+	if err != nil {
+		return nil, err
+	}
+	if rule, ok := bus.rules[*input.Name]; ok {
+		if len(rule.targets) > 0 && !aws.BoolValue(input.Force) {
+			return nil, awserr.New(errCodeValidationException, "Rule can't be deleted since it has targets.", nil)
+		}
+		delete(bus.rules, *input.Name)
+	}
+	return &eventbridge.DeleteRuleOutput{}, nil
+}
+
+// ListRules returns rules of event bus sorted by name.
+func (s *EventBusService) ListRules(ctx context.Context, input *eventbridge.ListRulesInput) (*eventbridge.ListRulesOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bus, err := s.getBus(input.EventBusName)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for name := range bus.rules {
+		if strings.HasPrefix(name, aws.StringValue(input.NamePrefix)) {
+			names = append(names, name)
+		}
+	}
+	page, next := pageNames(names, input.NextToken, input.Limit)
+	out := &eventbridge.ListRulesOutput{Rules: []*eventbridge.Rule{}, NextToken: next}
+	for _, name := range page {
+		conf := *bus.rules[name].conf
+		out.Rules = append(out.Rules, &conf)
+	}
+	return out, nil
+}
+
+// newEventTarget validates target, which must be function of the registry.
+func (s *EventBusService) newEventTarget(t *eventbridge.Target) (*eventTarget, error) {
+	if s.registry.GetFromARN(*t.Arn) == nil {
+		return nil, awserr.New(eventbridge.ErrCodeResourceNotFoundException, "Target must be existing lambda function: "+*t.Arn, nil)
+	}
+	n := 0
+	for _, set := range []bool{t.Input != nil, t.InputPath != nil, t.InputTransformer != nil} {
+		if set {
+			n++
+		}
+	}
+	if n > 1 {
+		return nil, awserr.New(errCodeValidationException, "Only one of Input, InputPath and InputTransformer can be specified.", nil)
+	}
+	if t.Input != nil && !json.Valid([]byte(*t.Input)) {
+		return nil, awserr.New(errCodeValidationException, "Input must be valid json", nil)
+	}
+	conf := *t
+	target := &eventTarget{conf: &conf}
+	var err error
+	switch {
+	case t.InputPath != nil:
+		target.inputPath, err = compileJSONPath(*t.InputPath)
+	case t.InputTransformer != nil:
+		target.transformer, err = newInputTransformer(t.InputTransformer)
+	}
+	if err != nil {
+		return nil, awserr.New(errCodeValidationException, err.Error(), nil)
+	}
+	return target, nil
+}
+
+// PutTargets adds or updates targets of rule. Targets failing validation are returned in FailedEntries.
+func (s *EventBusService) PutTargets(ctx context.Context, input *eventbridge.PutTargetsInput) (*eventbridge.PutTargetsOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rule, err := s.getRule(input.EventBusName, *input.Rule)
+	if err != nil {
+		return nil, err
+	}
+	added := 0
+	for _, t := range input.Targets {
+		if _, ok := rule.targets[*t.Id]; !ok {
+			added++
+		}
+	}
+	if len(rule.targets)+added > maxTargetsPerRule {
+		return nil, awserr.New(eventbridge.ErrCodeLimitExceededException, fmt.Sprintf("The requested resource exceeds the maximum number allowed, %d targets per rule.", maxTargetsPerRule), nil)
+	}
+	out := &eventbridge.PutTargetsOutput{FailedEntries: []*eventbridge.PutTargetsResultEntry{}, FailedEntryCount: aws.Int64(0)}
+	for _, t := range input.Targets {
+		target, err := s.newEventTarget(t)
+		if err != nil {
+			e := err.(awserr.Error)
+			out.FailedEntries = append(out.FailedEntries, &eventbridge.PutTargetsResultEntry{
+				TargetId:     t.Id,
+				ErrorCode:    aws.String(e.Code()),
+				ErrorMessage: aws.String(e.Message()),
+			})
+			continue
+		}
+		rule.targets[*t.Id] = target
+	}
+	out.FailedEntryCount = aws.Int64(int64(len(out.FailedEntries)))
+	return out, nil
+}
+
+// RemoveTargets removes targets of rule.
+func (s *EventBusService) RemoveTargets(ctx context.Context, input *eventbridge.RemoveTargetsInput) (*eventbridge.RemoveTargetsOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rule, err := s.getRule(input.EventBusName, *input.Rule)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range input.Ids {
+		delete(rule.targets, aws.StringValue(id))
+	}
+	return &eventbridge.RemoveTargetsOutput{FailedEntries: []*eventbridge.RemoveTargetsResultEntry{}, FailedEntryCount: aws.Int64(0)}, nil
+}
+
+// ListTargetsByRule returns targets of rule sorted by id.
+func (s *EventBusService) ListTargetsByRule(ctx context.Context, input *eventbridge.ListTargetsByRuleInput) (*eventbridge.ListTargetsByRuleOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rule, err := s.getRule(input.EventBusName, *input.Rule)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(rule.targets))
+	for id := range rule.targets {
+		ids = append(ids, id)
+	}
+	page, next := pageNames(ids, input.NextToken, input.Limit)
+	out := &eventbridge.ListTargetsByRuleOutput{Targets: []*eventbridge.Target{}, NextToken: next}
+	for _, id := range page {
+		conf := *rule.targets[id].conf
+		out.Targets = append(out.Targets, &conf)
+	}
+	return out, nil
+}
+
+// TestEventPattern reports whether event matches event pattern.
+func (s *EventBusService) TestEventPattern(ctx context.Context, input *eventbridge.TestEventPatternInput) (*eventbridge.TestEventPatternOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	p, err := pattern.Compile(*input.EventPattern)
+	if err != nil {
+		return nil, awserr.New(eventbridge.ErrCodeInvalidEventPatternException, "Event pattern is not valid. Reason: "+err.Error(), nil)
+	}
+	var event interface{}
+	if err := json.Unmarshal([]byte(*input.Event), &event); err != nil {
+		return nil, awserr.New(errCodeValidationException, "Event is not valid json", nil)
+	}
+	return &eventbridge.TestEventPatternOutput{Result: aws.Bool(p.Match(event))}, nil
+}
+
+// newEventEnvelope validates entry of PutEvents and returns event in JSON.
+func newEventEnvelope(entry *eventbridge.PutEventsRequestEntry, now time.Time) ([]byte, string, error) {
+	for _, f := range []struct {
+		name  string
+		value *string
+	}{{"Source", entry.Source}, {"DetailType", entry.DetailType}, {"Detail", entry.Detail}} {
+		if aws.StringValue(f.value) == "" {
+			return nil, "", awserr.New("InvalidArgument", "Parameter "+f.name+" is not valid. Reason: "+f.name+" is a required argument.", nil)
+		}
+	}
+	var detail map[string]interface{}
+	if err := json.Unmarshal([]byte(*entry.Detail), &detail); err != nil || detail == nil {
+		return nil, "", awserr.New("MalformedDetail", "Detail is malformed.", nil)
+	}
+	if entry.Time != nil {
+		now = *entry.Time
+	}
+	ev := &eventEnvelope{
+		Version:    "0",
+		ID:         uuid.New().String(),
+		DetailType: *entry.DetailType,
+		Source:     *entry.Source,
+		Account:    accountID,
+		Time:       now.UTC().Format(time.RFC3339),
+		Region:     Region(),
+		Resources:  aws.StringValueSlice(entry.Resources),
+		Detail:     json.RawMessage(*entry.Detail),
+	}
+	if ev.Resources == nil {
+		ev.Resources = []string{}
+	}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return nil, "", awserr.New("MalformedDetail", "Detail is malformed.", err)
+	}
+	return b, ev.ID, nil
+}
+
+// PutEvents puts events into event buses, and invokes targets of matching rules asynchronously.
+// Entries failing validation are returned with error code.
+func (s *EventBusService) PutEvents(ctx context.Context, input *eventbridge.PutEventsInput) (*eventbridge.PutEventsOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	if len(input.Entries) > maxPutEventsEntries {
+		return nil, awserr.New(errCodeValidationException, fmt.Sprintf("Entries must have %d entries at most", maxPutEventsEntries), nil)
+	}
+	now := time.Now()
+	out := &eventbridge.PutEventsOutput{Entries: make([]*eventbridge.PutEventsResultEntry, 0, len(input.Entries))}
+	var failed int64
+	for _, entry := range input.Entries {
+		id, err := s.putEvent(entry, now)
+		if err != nil {
+			e := err.(awserr.Error)
+			out.Entries = append(out.Entries, &eventbridge.PutEventsResultEntry{ErrorCode: aws.String(e.Code()), ErrorMessage: aws.String(e.Message())})
+			failed++
+			continue
+		}
+		out.Entries = append(out.Entries, &eventbridge.PutEventsResultEntry{EventId: aws.String(id)})
+	}
+	out.FailedEntryCount = aws.Int64(failed)
+	return out, nil
+}
+
+// putEvent matches event against rules of event bus, and invokes their targets.
+func (s *EventBusService) putEvent(entry *eventbridge.PutEventsRequestEntry, now time.Time) (string, error) {
+	raw, id, err := newEventEnvelope(entry, now)
+	if err != nil {
+		return "", err
+	}
+	var event interface{}
+	if err := json.Unmarshal(raw, &event); err != nil {
+		return "", awserr.New("MalformedDetail", "Detail is malformed.", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bus, err := s.getBus(entry.EventBusName)
+	if err != nil {
+		return "", err
+	}
+	for _, rule := range bus.rules {
+		if aws.StringValue(rule.conf.State) != eventbridge.RuleStateEnabled || !rule.pattern.Match(event) {
+			continue
+		}
+		for _, t := range rule.sortedTargets() {
+			payload := t.input(raw, rule.conf, now)
+			arn := *t.conf.Arn
+			s.running.Add(1)
+			go func() {
+				defer s.running.Done()
+				s.invoke(arn, id, payload)
+			}()
+		}
+	}
+	return id, nil
+}
+
+// invoke invokes function of target, as asynchronous invocation does.
+func (s *EventBusService) invoke(arn, eventID string, payload []byte) {
+	if s.registry.GetFromARN(arn) == nil {
+		log.Printf("event %s: target %s does not exist", eventID, arn)
+		return
+	}
+	invokeAsync(s.lambda, "event "+eventID, arn, payload)
+}
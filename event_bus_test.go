@@ -0,0 +1,157 @@
+package wheelamb
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+)
+
+func TestEventBusService(t *testing.T) {
+	reg := NewLambdaRegistry()
+	reg.Register(&LambdaFunction{FunctionName: "myfunc", FunctionArn: functionARN("myfunc"), Version: latestVersion})
+	inv := &invokerMock{}
+	s := newEventBusService(reg, inv)
+	ctx := context.Background()
+
+	if _, err := s.CreateEventBus(ctx, &eventbridge.CreateEventBusInput{Name: aws.String("orders")}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	for _, tt := range []struct {
+		label    string
+		call     func() error
+		expected string
+	}{
+		{"existing bus", func() error {
+			_, err := s.CreateEventBus(ctx, &eventbridge.CreateEventBusInput{Name: aws.String("orders")})
+			return err
+		}, eventbridge.ErrCodeResourceAlreadyExistsException},
+		{"unknown bus", func() error {
+			_, err := s.PutRule(ctx, &eventbridge.PutRuleInput{Name: aws.String("r"), EventBusName: aws.String("unknown"), EventPattern: aws.String(`{}`)})
+			return err
+		}, eventbridge.ErrCodeResourceNotFoundException},
+		{"invalid pattern", func() error {
+			_, err := s.PutRule(ctx, &eventbridge.PutRuleInput{Name: aws.String("r"), EventPattern: aws.String(`{"source":"a"}`)})
+			return err
+		}, eventbridge.ErrCodeInvalidEventPatternException},
+		{"schedule expression", func() error {
+			_, err := s.PutRule(ctx, &eventbridge.PutRuleInput{Name: aws.String("r"), ScheduleExpression: aws.String("rate(1 hour)")})
+			return err
+		}, errCodeValidationException},
+		{"unknown rule", func() error {
+			_, err := s.PutTargets(ctx, &eventbridge.PutTargetsInput{Rule: aws.String("r"), Targets: []*eventbridge.Target{{Id: aws.String("t"), Arn: aws.String(functionARN("myfunc"))}}})
+			return err
+		}, eventbridge.ErrCodeResourceNotFoundException},
+	} {
+		if e, ok := tt.call().(awserr.Error); !ok || e.Code() != tt.expected {
+			t.Errorf("%s: unexpected error captured: %#v", tt.label, e)
+		}
+	}
+
+	// only orders of 100 or more on orders bus are delivered.
+	out, err := s.PutRule(ctx, &eventbridge.PutRuleInput{
+		Name:         aws.String("large-orders"),
+		EventBusName: aws.String("orders"),
+		EventPattern: aws.String(`{"source":["shop"],"detail-type":["Order Placed"],"detail":{"amount":[{"numeric":[">=",100]}]}}`),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if *out.RuleArn != "arn:aws:events:"+Region()+":"+AccountID()+":rule/orders/large-orders" {
+		t.Errorf("unexpected rule arn: %s", *out.RuleArn)
+	}
+	targets, err := s.PutTargets(ctx, &eventbridge.PutTargetsInput{
+		Rule:         aws.String("large-orders"),
+		EventBusName: aws.String("arn:aws:events:" + Region() + ":" + AccountID() + ":event-bus/orders"),
+		Targets: []*eventbridge.Target{
+			{Id: aws.String("raw"), Arn: aws.String(functionARN("myfunc"))},
+			{Id: aws.String("path"), Arn: aws.String(functionARN("myfunc")), InputPath: aws.String("$.detail")},
+			{Id: aws.String("transform"), Arn: aws.String(functionARN("myfunc")), InputTransformer: &eventbridge.InputTransformer{
+				InputPathsMap: map[string]*string{"id": aws.String("$.detail.id")},
+				InputTemplate: aws.String(`{"order": <id>, "rule": "<aws.events.rule-name>"}`),
+			}},
+			{Id: aws.String("unknown"), Arn: aws.String(functionARN("unknown"))},
+			{Id: aws.String("both"), Arn: aws.String(functionARN("myfunc")), Input: aws.String(`{}`), InputPath: aws.String("$.detail")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if *targets.FailedEntryCount != 2 || *targets.FailedEntries[0].TargetId != "unknown" || *targets.FailedEntries[1].ErrorCode != errCodeValidationException {
+		t.Errorf("unexpected failed entries: %v", targets)
+	}
+	if list, err := s.ListTargetsByRule(ctx, &eventbridge.ListTargetsByRuleInput{Rule: aws.String("large-orders"), EventBusName: aws.String("orders"), Limit: aws.Int64(2)}); err != nil ||
+		len(list.Targets) != 2 || *list.Targets[0].Id != "path" || *list.NextToken != "raw" {
+		t.Errorf("unexpected targets: %v, %v", list, err)
+	}
+
+	placed := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	events, err := s.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: []*eventbridge.PutEventsRequestEntry{
+		{EventBusName: aws.String("orders"), Source: aws.String("shop"), DetailType: aws.String("Order Placed"), Detail: aws.String(`{"id":"o-1","amount":150}`), Time: &placed},
+		{EventBusName: aws.String("orders"), Source: aws.String("shop"), DetailType: aws.String("Order Placed"), Detail: aws.String(`{"id":"o-2","amount":50}`)},
+		{Source: aws.String("shop"), DetailType: aws.String("Order Placed"), Detail: aws.String(`{"id":"o-3","amount":500}`)},
+		{EventBusName: aws.String("orders"), Source: aws.String("shop"), DetailType: aws.String("Order Placed"), Detail: aws.String(`[]`)},
+		{EventBusName: aws.String("orders"), Source: aws.String("shop"), Detail: aws.String(`{}`)},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if *events.FailedEntryCount != 2 || events.Entries[0].EventId == nil || *events.Entries[3].ErrorCode != "MalformedDetail" || *events.Entries[4].ErrorCode != "InvalidArgument" {
+		t.Errorf("unexpected result: %v", events)
+	}
+	s.Close()
+
+	inv.mu.Lock()
+	payloads := make([]string, 0, len(inv.payloads))
+	for _, p := range inv.payloads {
+		payloads = append(payloads, string(p))
+	}
+	inv.mu.Unlock()
+	sort.Strings(payloads)
+	if len(payloads) != 3 || payloads[0] != `{"amount":150,"id":"o-1"}` || payloads[1] != `{"order": "o-1", "rule": "large-orders"}` {
+		t.Fatalf("unexpected payloads: %v", payloads)
+	}
+	var ev eventEnvelope
+	if err := json.Unmarshal([]byte(payloads[2]), &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.ID != *events.Entries[0].EventId || ev.Source != "shop" || ev.DetailType != "Order Placed" || ev.Time != "2024-01-01T00:00:00Z" ||
+		ev.Account != AccountID() || len(ev.Resources) != 0 || string(ev.Detail) != `{"id":"o-1","amount":150}` {
+		t.Errorf("unexpected event: %s", payloads[2])
+	}
+
+	// disabled rule does not deliver events, and rule with targets can not be deleted.
+	if _, err := s.DisableRule(ctx, &eventbridge.DisableRuleInput{Name: aws.String("large-orders"), EventBusName: aws.String("orders")}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	s.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: []*eventbridge.PutEventsRequestEntry{
+		{EventBusName: aws.String("orders"), Source: aws.String("shop"), DetailType: aws.String("Order Placed"), Detail: aws.String(`{"id":"o-4","amount":150}`)},
+	}})
+	s.Close()
+	inv.mu.Lock()
+	if len(inv.payloads) != 3 {
+		t.Errorf("disabled rule should not deliver events: %d", len(inv.payloads))
+	}
+	inv.mu.Unlock()
+	if _, err := s.DeleteRule(ctx, &eventbridge.DeleteRuleInput{Name: aws.String("large-orders"), EventBusName: aws.String("orders")}); err == nil {
+		t.Error("rule with targets should not be deleted")
+	}
+	if _, err := s.DeleteRule(ctx, &eventbridge.DeleteRuleInput{Name: aws.String("large-orders"), EventBusName: aws.String("orders"), Force: aws.Bool(true)}); err != nil {
+		t.Errorf("unexpected error captured: %#v", err)
+	}
+	if rules, err := s.ListRules(ctx, &eventbridge.ListRulesInput{EventBusName: aws.String("orders")}); err != nil || len(rules.Rules) != 0 {
+		t.Errorf("unexpected rules: %v, %v", rules, err)
+	}
+
+	if res, err := s.TestEventPattern(ctx, &eventbridge.TestEventPatternInput{
+		EventPattern: aws.String(`{"detail":{"id":[{"prefix":"o-"}]}}`),
+		Event:        aws.String(`{"detail":{"id":"o-5"}}`),
+	}); err != nil || !*res.Result {
+		t.Errorf("event should match pattern: %v, %v", res, err)
+	}
+}
@@ -0,0 +1,176 @@
+package wheelamb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+)
+
+// maxInputPaths is the maximum number of InputPathsMap of input transformer.
+const maxInputPaths = 100
+
+var inputPathNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// jsonPath is compiled JSONPath of InputPath and InputPathsMap.
+// It supports members in dot or bracket notation and array indexes, such as $.detail.items[0] and $['detail-type'].
+type jsonPath []interface{}
+
+func compileJSONPath(s string) (jsonPath, error) {
+	if !strings.HasPrefix(s, "$") {
+		return nil, errors.New("path must start with $")
+	}
+	var p jsonPath
+	for rest := s[1:]; rest != ""; {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" || key == "*" {
+				return nil, errors.New("invalid member in path: " + s)
+			}
+			p = append(p, key)
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, errors.New("unclosed bracket in path: " + s)
+			}
+			inner := rest[1:end]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				p = append(p, inner[1:len(inner)-1])
+			} else if i, err := strconv.Atoi(inner); err == nil && i >= 0 {
+				p = append(p, i)
+			} else {
+				return nil, errors.New("invalid index in path: " + s)
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, errors.New("invalid path: " + s)
+		}
+	}
+	return p, nil
+}
+
+// lookup returns value at path in v, and false when it does not exist.
+func (p jsonPath) lookup(v interface{}) (interface{}, bool) {
+	for _, step := range p {
+		switch step := step.(type) {
+		case string:
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = obj[step]; !ok {
+				return nil, false
+			}
+		case int:
+			arr, ok := v.([]interface{})
+			if !ok || step >= len(arr) {
+				return nil, false
+			}
+			v = arr[step]
+		}
+	}
+	return v, true
+}
+
+// inputTransformer builds input of target from InputTemplate, replacing <name> with values at InputPathsMap.
+// via https://docs.aws.amazon.com/eventbridge/latest/userguide/eb-transform-target-input.html
+type inputTransformer struct {
+	paths    map[string]jsonPath
+	template string
+}
+
+func newInputTransformer(t *eventbridge.InputTransformer) (*inputTransformer, error) {
+	if t.InputTemplate == nil {
+		return nil, errors.New("InputTemplate of InputTransformer is required")
+	}
+	if len(t.InputPathsMap) > maxInputPaths {
+		return nil, errors.New("InputPathsMap must have " + strconv.Itoa(maxInputPaths) + " paths at most")
+	}
+	it := &inputTransformer{paths: make(map[string]jsonPath, len(t.InputPathsMap)), template: *t.InputTemplate}
+	for name, path := range t.InputPathsMap {
+		if !inputPathNamePattern.MatchString(name) || strings.HasPrefix(name, "aws.") {
+			return nil, errors.New("invalid name of InputPathsMap: " + name)
+		}
+		p, err := compileJSONPath(aws.StringValue(path))
+		if err != nil {
+			return nil, err
+		}
+		it.paths[name] = p
+	}
+	return it, nil
+}
+
+// transform builds input from event. reserved holds values of predefined variables such as aws.events.rule-arn.
+// Placeholders in JSON strings are replaced with text of values, and the others with JSON of values.
+func (t *inputTransformer) transform(event interface{}, reserved map[string]interface{}) []byte {
+	values := make(map[string]interface{}, len(t.paths)+len(reserved))
+	for name, v := range reserved {
+		values[name] = v
+	}
+	for name, p := range t.paths {
+		if v, ok := p.lookup(event); ok {
+			values[name] = v
+		} else {
+			values[name] = nil
+		}
+	}
+	var buf bytes.Buffer
+	inString := false
+	for i := 0; i < len(t.template); i++ {
+		c := t.template[i]
+		switch {
+		case inString && c == '\\' && i+1 < len(t.template):
+			buf.WriteByte(c)
+			i++
+			buf.WriteByte(t.template[i])
+			continue
+		case c == '"':
+			inString = !inString
+		case c == '<':
+			end := strings.IndexByte(t.template[i:], '>')
+			if end < 0 {
+				break
+			}
+			v, ok := values[t.template[i+1:i+end]]
+			if !ok {
+				break
+			}
+			buf.Write(placeholderValue(v, inString))
+			i += end
+			continue
+		}
+		buf.WriteByte(c)
+	}
+	return buf.Bytes()
+}
+
+// placeholderValue returns JSON of v, or escaped text of v for placeholder in JSON string.
+func placeholderValue(v interface{}, inString bool) []byte {
+	if inString && v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return []byte("null")
+	}
+	if !inString {
+		return b
+	}
+	if s, ok := v.(string); ok {
+		b, _ = json.Marshal(s)
+	} else {
+		b, _ = json.Marshal(string(b))
+	}
+	return b[1 : len(b)-1]
+}
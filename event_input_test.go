@@ -0,0 +1,63 @@
+package wheelamb
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+)
+
+func TestInputTransformer(t *testing.T) {
+	event := []byte(`{"detail-type":"Order Placed","detail":{"id":"o-1","amount":1200000,"items":[{"sku":"a"},{"sku":"b"}],"note":"say \"hi\""}}`)
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(event))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	paths := map[string]*string{
+		"id":     aws.String("$.detail.id"),
+		"amount": aws.String("$.detail.amount"),
+		"sku":    aws.String("$.detail.items[1].sku"),
+		"items":  aws.String("$.detail.items"),
+		"type":   aws.String("$['detail-type']"),
+		"note":   aws.String("$.detail.note"),
+		"none":   aws.String("$.detail.missing"),
+	}
+	for _, tt := range []struct {
+		template string
+		expected string
+	}{
+		{`{"order": <id>, "amount": <amount>, "sku": "<sku>"}`, `{"order": "o-1", "amount": 1200000, "sku": "b"}`},
+		{`"<type> <id> with <amount>"`, `"Order Placed o-1 with 1200000"`},
+		{`{"items": <items>, "text": "<items>"}`, `{"items": [{"sku":"a"},{"sku":"b"}], "text": "[{\"sku\":\"a\"},{\"sku\":\"b\"}]"}`},
+		{`{"note": <note>, "quoted": "<note>"}`, `{"note": "say \"hi\"", "quoted": "say \"hi\""}`},
+		{`{"none": <none>, "text": "<none>", "unknown": "<unknown>"}`, `{"none": null, "text": "", "unknown": "<unknown>"}`},
+		{`{"rule": "<aws.events.rule-name>", "escaped": "\"<id>\""}`, `{"rule": "myrule", "escaped": "\"o-1\""}`},
+	} {
+		it, err := newInputTransformer(&eventbridge.InputTransformer{InputPathsMap: paths, InputTemplate: aws.String(tt.template)})
+		if err != nil {
+			t.Fatalf("unexpected error captured: %v", err)
+		}
+		if actual := string(it.transform(v, map[string]interface{}{"aws.events.rule-name": "myrule"})); actual != tt.expected {
+			t.Errorf("%s: %s != %s", tt.template, actual, tt.expected)
+		}
+	}
+
+	for _, p := range []string{"detail", "$.", "$.detail..id", "$.items[x]", "$.items[0", "$.*"} {
+		if _, err := compileJSONPath(p); err == nil {
+			t.Errorf("%s: error should exist", p)
+		}
+	}
+	for _, tr := range []*eventbridge.InputTransformer{
+		{InputPathsMap: paths},
+		{InputPathsMap: map[string]*string{"aws.id": aws.String("$.id")}, InputTemplate: aws.String("<aws.id>")},
+		{InputPathsMap: map[string]*string{"id": aws.String("detail.id")}, InputTemplate: aws.String("<id>")},
+	} {
+		if _, err := newInputTransformer(tr); err == nil {
+			t.Errorf("%v: error should exist", tr)
+		}
+	}
+}
@@ -3,6 +3,9 @@ module github.com/taiyoh/wheelamb
 go 1.14
 
 require (
+	github.com/BurntSushi/toml v0.3.0
 	github.com/aws/aws-sdk-go v1.30.19
 	github.com/google/uuid v1.1.1
+	golang.org/x/net v0.0.0-20200202094626-16171245cfb2
+	gopkg.in/yaml.v2 v2.3.0
 )
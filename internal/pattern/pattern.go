@@ -0,0 +1,309 @@
+// Package pattern implements event patterns of EventBridge, which filter criteria of event source mappings
+// and filter policies of SNS subscriptions also use.
+package pattern
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Pattern is compiled event pattern.
+// via https://docs.aws.amazon.com/eventbridge/latest/userguide/eb-event-patterns.html
+type Pattern struct {
+	// fields must all match values of the same keys in event.
+	fields map[string]*patternField
+	// or holds alternatives of $or, one of which must match.
+	or []*Pattern
+}
+
+// patternField matches value in event with nested pattern, or with any of matchers.
+type patternField struct {
+	nested   *Pattern
+	matchers []patternMatcher
+}
+
+// patternMatcher matches value in event. present is false when the key does not exist in event.
+type patternMatcher func(v interface{}, present bool) bool
+
+// Compile parses event pattern in JSON.
+func Compile(s string) (*Pattern, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, err
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("pattern must be JSON object")
+	}
+	return newPattern(obj)
+}
+
+func newPattern(obj map[string]interface{}) (*Pattern, error) {
+	p := &Pattern{fields: make(map[string]*patternField, len(obj))}
+	for k, v := range obj {
+		if k == "$or" {
+			alts, ok := v.([]interface{})
+			if !ok || len(alts) < 2 {
+				return nil, errors.New("$or must be array of two or more patterns")
+			}
+			for _, alt := range alts {
+				o, ok := alt.(map[string]interface{})
+				if !ok {
+					return nil, errors.New("$or must be array of two or more patterns")
+				}
+				sub, err := newPattern(o)
+				if err != nil {
+					return nil, err
+				}
+				p.or = append(p.or, sub)
+			}
+			continue
+		}
+		switch v := v.(type) {
+		case map[string]interface{}:
+			nested, err := newPattern(v)
+			if err != nil {
+				return nil, err
+			}
+			p.fields[k] = &patternField{nested: nested}
+		case []interface{}:
+			if len(v) == 0 {
+				return nil, fmt.Errorf("%s: array must not be empty", k)
+			}
+			f := &patternField{}
+			for _, e := range v {
+				m, err := newPatternMatcher(e)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", k, err)
+				}
+				f.matchers = append(f.matchers, m)
+			}
+			p.fields[k] = f
+		default:
+			return nil, fmt.Errorf("%s: value must be object or array", k)
+		}
+	}
+	return p, nil
+}
+
+// Match reports whether event matches the pattern.
+func (p *Pattern) Match(event interface{}) bool {
+	obj, _ := event.(map[string]interface{})
+	for k, f := range p.fields {
+		v, present := obj[k]
+		if !f.match(v, present) {
+			return false
+		}
+	}
+	if len(p.or) == 0 {
+		return true
+	}
+	for _, alt := range p.or {
+		if alt.Match(event) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *patternField) match(v interface{}, present bool) bool {
+	if f.nested != nil {
+		if arr, ok := v.([]interface{}); ok {
+			for _, e := range arr {
+				if f.nested.Match(e) {
+					return true
+				}
+			}
+			return false
+		}
+		return f.nested.Match(v)
+	}
+	for _, m := range f.matchers {
+		if m(v, present) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyElement returns matcher of existing value, which matches array in event when any of its elements matches.
+func anyElement(fn func(v interface{}) bool) patternMatcher {
+	return func(v interface{}, present bool) bool {
+		if !present {
+			return false
+		}
+		if arr, ok := v.([]interface{}); ok {
+			for _, e := range arr {
+				if fn(e) {
+					return true
+				}
+			}
+			return false
+		}
+		return fn(v)
+	}
+}
+
+// newPatternMatcher builds matcher from element of array in pattern, which is literal value or content filter.
+func newPatternMatcher(e interface{}) (patternMatcher, error) {
+	switch e := e.(type) {
+	case string, float64, bool, nil:
+		return anyElement(func(v interface{}) bool { return v == e }), nil
+	case map[string]interface{}:
+		if len(e) != 1 {
+			return nil, errors.New("content filter must have exactly one key")
+		}
+		for op, arg := range e {
+			return newContentFilter(op, arg)
+		}
+	}
+	return nil, fmt.Errorf("invalid value in pattern: %v", e)
+}
+
+func newContentFilter(op string, arg interface{}) (patternMatcher, error) {
+	switch op {
+	case "prefix", "suffix", "equals-ignore-case":
+		fn, err := stringFilter(op, arg)
+		if err != nil {
+			return nil, err
+		}
+		return anyElement(fn), nil
+	case "anything-but":
+		fn, err := anythingBut(arg)
+		if err != nil {
+			return nil, err
+		}
+		return anyElement(func(v interface{}) bool { return !fn(v) }), nil
+	case "numeric":
+		fn, err := numericFilter(arg)
+		if err != nil {
+			return nil, err
+		}
+		return anyElement(fn), nil
+	case "exists":
+		want, ok := arg.(bool)
+		if !ok {
+			return nil, errors.New("exists must be boolean")
+		}
+		return func(_ interface{}, present bool) bool { return present == want }, nil
+	case "cidr":
+		s, ok := arg.(string)
+		if !ok {
+			return nil, errors.New("cidr must be string")
+		}
+		_, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		return anyElement(func(v interface{}) bool {
+			s, ok := v.(string)
+			if !ok {
+				return false
+			}
+			ip := net.ParseIP(s)
+			return ip != nil && ipnet.Contains(ip)
+		}), nil
+	}
+	return nil, fmt.Errorf("unsupported content filter: %s", op)
+}
+
+// stringFilter returns matcher of prefix, suffix or equals-ignore-case.
+func stringFilter(op string, arg interface{}) (func(v interface{}) bool, error) {
+	want, ok := arg.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s must be string", op)
+	}
+	var fn func(s string) bool
+	switch op {
+	case "prefix":
+		fn = func(s string) bool { return strings.HasPrefix(s, want) }
+	case "suffix":
+		fn = func(s string) bool { return strings.HasSuffix(s, want) }
+	default:
+		fn = func(s string) bool { return strings.EqualFold(s, want) }
+	}
+	return func(v interface{}) bool {
+		s, ok := v.(string)
+		return ok && fn(s)
+	}, nil
+}
+
+// anythingBut returns matcher of values which anything-but excludes.
+func anythingBut(arg interface{}) (func(v interface{}) bool, error) {
+	switch arg := arg.(type) {
+	case string, float64:
+		return func(v interface{}) bool { return v == arg }, nil
+	case []interface{}:
+		for _, e := range arg {
+			switch e.(type) {
+			case string, float64:
+			default:
+				return nil, errors.New("anything-but must be array of strings or numbers")
+			}
+		}
+		return func(v interface{}) bool {
+			for _, e := range arg {
+				if v == e {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case map[string]interface{}:
+		if len(arg) == 1 {
+			for op, s := range arg {
+				if op == "prefix" || op == "suffix" {
+					return stringFilter(op, s)
+				}
+			}
+		}
+	}
+	return nil, errors.New("anything-but must be string, number, array of them, prefix or suffix")
+}
+
+// numericFilter returns matcher of numeric ranges such as [">", 0, "<=", 5].
+func numericFilter(arg interface{}) (func(v interface{}) bool, error) {
+	conds, ok := arg.([]interface{})
+	if !ok || len(conds) == 0 || len(conds) > 4 || len(conds)%2 != 0 {
+		return nil, errors.New("numeric must be array of one or two pairs of operator and number")
+	}
+	var fns []func(n float64) bool
+	for i := 0; i < len(conds); i += 2 {
+		op, _ := conds[i].(string)
+		x, ok := conds[i+1].(float64)
+		if !ok {
+			return nil, errors.New("numeric must be compared with number")
+		}
+		var fn func(n float64) bool
+		switch op {
+		case "=":
+			fn = func(n float64) bool { return n == x }
+		case "<":
+			fn = func(n float64) bool { return n < x }
+		case "<=":
+			fn = func(n float64) bool { return n <= x }
+		case ">":
+			fn = func(n float64) bool { return n > x }
+		case ">=":
+			fn = func(n float64) bool { return n >= x }
+		default:
+			return nil, fmt.Errorf("unsupported numeric operator: %v", conds[i])
+		}
+		fns = append(fns, fn)
+	}
+	return func(v interface{}) bool {
+		n, ok := v.(float64)
+		if !ok {
+			return false
+		}
+		for _, fn := range fns {
+			if !fn(n) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
@@ -0,0 +1,86 @@
+package pattern
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEventPattern(t *testing.T) {
+	event := `{
+		"source": "myapp",
+		"detail-type": "order",
+		"detail": {
+			"state": "created",
+			"price": 120.5,
+			"tags": ["a", "b"],
+			"ip": "10.0.0.12",
+			"customer": {"name": "Alice", "vip": null},
+			"items": [{"sku": "x-1"}, {"sku": "y-2"}]
+		}
+	}`
+	var ev interface{}
+	if err := json.Unmarshal([]byte(event), &ev); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		pattern  string
+		expected bool
+	}{
+		{`{}`, true},
+		{`{"source": ["myapp"]}`, true},
+		{`{"source": ["other", "myapp"]}`, true},
+		{`{"source": ["other"]}`, false},
+		{`{"source": ["myapp"], "detail-type": ["invoice"]}`, false},
+		{`{"detail": {"state": ["created"]}}`, true},
+		{`{"detail": {"price": [120.5]}}`, true},
+		{`{"detail": {"price": ["120.5"]}}`, false},
+		{`{"detail": {"tags": ["b"]}}`, true},
+		{`{"detail": {"customer": {"name": [{"prefix": "Al"}]}}}`, true},
+		{`{"detail": {"customer": {"name": [{"suffix": "ce"}]}}}`, true},
+		{`{"detail": {"customer": {"name": [{"equals-ignore-case": "alice"}]}}}`, true},
+		{`{"detail": {"customer": {"vip": [null]}}}`, true},
+		{`{"detail": {"state": [{"anything-but": "created"}]}}`, false},
+		{`{"detail": {"state": [{"anything-but": ["deleted", "updated"]}]}}`, true},
+		{`{"detail": {"state": [{"anything-but": {"prefix": "cre"}}]}}`, false},
+		{`{"detail": {"missing": [{"anything-but": "created"}]}}`, false},
+		{`{"detail": {"price": [{"numeric": [">", 100, "<=", 200]}]}}`, true},
+		{`{"detail": {"price": [{"numeric": ["<", 100]}]}}`, false},
+		{`{"detail": {"state": [{"numeric": [">", 0]}]}}`, false},
+		{`{"detail": {"state": [{"exists": true}]}}`, true},
+		{`{"detail": {"missing": [{"exists": false}]}}`, true},
+		{`{"detail": {"state": [{"exists": false}]}}`, false},
+		{`{"detail": {"missing": {"nested": [{"exists": false}]}}}`, true},
+		{`{"detail": {"ip": [{"cidr": "10.0.0.0/24"}]}}`, true},
+		{`{"detail": {"ip": [{"cidr": "10.0.1.0/24"}]}}`, false},
+		{`{"detail": {"items": {"sku": [{"prefix": "y-"}]}}}`, true},
+		{`{"$or": [{"source": ["other"]}, {"detail": {"state": ["created"]}}]}`, true},
+		{`{"$or": [{"source": ["other"]}, {"detail": {"state": ["deleted"]}}]}`, false},
+	} {
+		p, err := Compile(tt.pattern)
+		if err != nil {
+			t.Errorf("%s: unexpected error captured: %v", tt.pattern, err)
+			continue
+		}
+		if actual := p.Match(ev); actual != tt.expected {
+			t.Errorf("%s: %v != %v", tt.pattern, actual, tt.expected)
+		}
+	}
+
+	for _, pattern := range []string{
+		`[]`,
+		`{"source": "myapp"}`,
+		`{"source": []}`,
+		`{"source": [["myapp"]]}`,
+		`{"source": [{"prefix": 1}]}`,
+		`{"source": [{"unknown": "x"}]}`,
+		`{"source": [{"prefix": "a", "suffix": "b"}]}`,
+		`{"price": [{"numeric": [">"]}]}`,
+		`{"price": [{"numeric": ["!", 1]}]}`,
+		`{"ip": [{"cidr": "10.0.0.0"}]}`,
+		`{"$or": [{"source": ["myapp"]}]}`,
+	} {
+		if _, err := Compile(pattern); err == nil {
+			t.Errorf("%s: error should exists", pattern)
+		}
+	}
+}
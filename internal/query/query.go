@@ -0,0 +1,318 @@
+// Package query implements query protocol of AWS APIs such as SQS and SNS,
+// which decodes form parameters into input structs of aws-sdk-go and encodes outputs in xml.
+package query
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// memberName returns name of struct field in query and xml protocol, following tags of aws-sdk-go.
+func memberName(field reflect.StructField) string {
+	if field.Tag.Get("flattened") != "" && field.Tag.Get("locationNameList") != "" {
+		return field.Tag.Get("locationNameList")
+	}
+	if name := field.Tag.Get("locationName"); name != "" {
+		return name
+	}
+	return field.Name
+}
+
+// ExportedFields returns fields of struct which are encoded in protocols.
+func ExportedFields(t reflect.Type) []reflect.StructField {
+	fields := make([]reflect.StructField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.PkgPath == "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// listMember returns name of list member in query and xml protocol, which is empty for flattened list.
+func listMember(tag reflect.StructTag) string {
+	if tag.Get("flattened") != "" {
+		return ""
+	}
+	if name := tag.Get("locationNameList"); name != "" {
+		return name
+	}
+	return "member"
+}
+
+// mapEntryNames returns names of key and value of map entry in query and xml protocol.
+func mapEntryNames(tag reflect.StructTag) (string, string) {
+	k, v := tag.Get("locationNameKey"), tag.Get("locationNameValue")
+	if k == "" {
+		k = "key"
+	}
+	if v == "" {
+		v = "value"
+	}
+	return k, v
+}
+
+// decoder sets parameters of query protocol into input struct of aws-sdk-go.
+type decoder struct {
+	form url.Values
+}
+
+// Decode sets parameters of form into input, which is pointer to input struct of aws-sdk-go.
+func Decode(form url.Values, input interface{}) error {
+	d := &decoder{form: form}
+	return d.decode(reflect.ValueOf(input).Elem(), "", "")
+}
+
+// has reports whether parameter or its members exist.
+func (d *decoder) has(name string) bool {
+	if _, ok := d.form[name]; ok {
+		return true
+	}
+	for k := range d.form {
+		if strings.HasPrefix(k, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *decoder) decode(v reflect.Value, name string, tag reflect.StructTag) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.Type().Elem().Kind() == reflect.Struct {
+			if !d.has(name) && name != "" {
+				return nil
+			}
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			return d.decode(v.Elem(), name, tag)
+		}
+		s, ok := d.form[name]
+		if !ok {
+			return nil
+		}
+		p := reflect.New(v.Type().Elem())
+		if err := decodeScalar(p.Elem(), s[0]); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		v.Set(p)
+	case reflect.Struct:
+		for _, f := range ExportedFields(v.Type()) {
+			member := memberName(f)
+			if name != "" {
+				member = name + "." + member
+			}
+			if err := d.decode(v.FieldByIndex(f.Index), member, f.Tag); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			s, ok := d.form[name]
+			if !ok {
+				return nil
+			}
+			b, err := base64.StdEncoding.DecodeString(s[0])
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			v.SetBytes(b)
+			return nil
+		}
+		prefix := name
+		if m := listMember(tag); m != "" {
+			prefix += "." + m
+		}
+		for i := 1; d.has(prefix + "." + strconv.Itoa(i)); i++ {
+			e := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decode(e, prefix+"."+strconv.Itoa(i), ""); err != nil {
+				return err
+			}
+			v.Set(reflect.Append(v, e))
+		}
+	case reflect.Map:
+		prefix := name
+		if tag.Get("flattened") == "" {
+			prefix += ".entry"
+		}
+		kname, vname := mapEntryNames(tag)
+		for i := 1; d.has(prefix + "." + strconv.Itoa(i)); i++ {
+			entry := prefix + "." + strconv.Itoa(i)
+			key := d.form.Get(entry + "." + kname)
+			e := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decode(e, entry+"."+vname, ""); err != nil {
+				return err
+			}
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			v.SetMapIndex(reflect.ValueOf(key), e)
+		}
+	}
+	return nil
+}
+
+func decodeScalar(v reflect.Value, s string) error {
+	switch v.Interface().(type) {
+	case string:
+		v.SetString(s)
+	case int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type: %s", v.Type())
+	}
+	return nil
+}
+
+// EncodeXML writes value in xml protocol following tags of aws-sdk-go.
+func EncodeXML(enc *xml.Encoder, v reflect.Value, name string, tag reflect.StructTag) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	switch v.Kind() {
+	case reflect.Struct:
+		if t, ok := v.Interface().(time.Time); ok {
+			return enc.EncodeElement(t.UTC().Format(time.RFC3339), start)
+		}
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, f := range ExportedFields(v.Type()) {
+			if err := EncodeXML(enc, v.FieldByIndex(f.Index), memberName(f), f.Tag); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return enc.EncodeElement(base64.StdEncoding.EncodeToString(v.Bytes()), start)
+		}
+		member := listMember(tag)
+		if member == "" {
+			for i := 0; i < v.Len(); i++ {
+				if err := EncodeXML(enc, v.Index(i), name, ""); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := EncodeXML(enc, v.Index(i), member, ""); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		kname, vname := mapEntryNames(tag)
+		flattened := tag.Get("flattened") != ""
+		entry := start
+		if !flattened {
+			if err := enc.EncodeToken(start); err != nil {
+				return err
+			}
+			entry = xml.StartElement{Name: xml.Name{Local: "entry"}}
+		}
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := enc.EncodeToken(entry); err != nil {
+				return err
+			}
+			if err := enc.EncodeElement(k, xml.StartElement{Name: xml.Name{Local: kname}}); err != nil {
+				return err
+			}
+			if err := EncodeXML(enc, v.MapIndex(reflect.ValueOf(k)), vname, ""); err != nil {
+				return err
+			}
+			if err := enc.EncodeToken(entry.End()); err != nil {
+				return err
+			}
+		}
+		if !flattened {
+			return enc.EncodeToken(start.End())
+		}
+		return nil
+	default:
+		return enc.EncodeElement(v.Interface(), start)
+	}
+}
+
+// JSONValue converts value into the shape of json protocol, where nil members are omitted.
+func JSONValue(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if t, ok := v.Interface().(time.Time); ok {
+			return float64(t.UnixNano()) / float64(time.Second)
+		}
+		obj := map[string]interface{}{}
+		for _, f := range ExportedFields(v.Type()) {
+			if e := JSONValue(v.FieldByIndex(f.Index)); e != nil {
+				obj[f.Name] = e
+			}
+		}
+		return obj
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return base64.StdEncoding.EncodeToString(v.Bytes())
+		}
+		arr := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			arr = append(arr, JSONValue(v.Index(i)))
+		}
+		return arr
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		obj := make(map[string]interface{}, v.Len())
+		for _, k := range v.MapKeys() {
+			obj[k.String()] = JSONValue(v.MapIndex(k))
+		}
+		return obj
+	default:
+		return v.Interface()
+	}
+}
@@ -0,0 +1,61 @@
+package query
+
+import (
+	"encoding/xml"
+	"net/http"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// WriteResponse writes output of action in xml, whose elements are in namespace of the API.
+func WriteResponse(w http.ResponseWriter, namespace, action, requestID string, output reflect.Value) {
+	w.Header().Set("Content-Type", "text/xml")
+	enc := xml.NewEncoder(w)
+	root := xml.StartElement{Name: xml.Name{Local: action + "Response"}, Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: namespace}}}
+	enc.EncodeToken(root)
+	if len(ExportedFields(output.Type().Elem())) > 0 {
+		EncodeXML(enc, output, action+"Result", "")
+	}
+	enc.EncodeElement(struct {
+		RequestID string `xml:"RequestId"`
+	}{requestID}, xml.StartElement{Name: xml.Name{Local: "ResponseMetadata"}})
+	enc.EncodeToken(root.End())
+	enc.Flush()
+}
+
+// ErrorStatus returns code, message and status code of error.
+func ErrorStatus(err error) (string, string, int) {
+	if e, ok := err.(awserr.Error); ok {
+		return e.Code(), e.Message(), http.StatusBadRequest
+	}
+	return "InternalFailure", err.Error(), http.StatusInternalServerError
+}
+
+// ErrorType returns whether client or server caused the error.
+func ErrorType(status int) string {
+	if status >= http.StatusInternalServerError {
+		return "Receiver"
+	}
+	return "Sender"
+}
+
+type errorResponse struct {
+	XMLName xml.Name `xml:"ErrorResponse"`
+	Error   struct {
+		Type    string
+		Code    string
+		Message string
+	}
+	RequestID string `xml:"RequestId"`
+}
+
+// WriteError writes error in xml.
+func WriteError(w http.ResponseWriter, requestID string, err error) {
+	code, msg, status := ErrorStatus(err)
+	res := &errorResponse{RequestID: requestID}
+	res.Error.Type, res.Error.Code, res.Error.Message = ErrorType(status), code, msg
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(res)
+}
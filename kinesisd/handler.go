@@ -0,0 +1,111 @@
+package kinesisd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/google/uuid"
+)
+
+const (
+	jsonTargetPrefix = "Kinesis_20131202."
+	jsonContentType  = "application/x-amz-json-1.1"
+	cborContentType  = "application/x-amz-cbor-1.1"
+)
+
+// actions are operations which handler serves.
+var actions = map[string]bool{
+	"CreateStream":          true,
+	"DeleteStream":          true,
+	"DescribeStream":        true,
+	"DescribeStreamSummary": true,
+	"ListStreams":           true,
+	"ListShards":            true,
+	"PutRecord":             true,
+	"PutRecords":            true,
+	"GetShardIterator":      true,
+	"GetRecords":            true,
+}
+
+// handler serves Service over json protocol.
+type handler struct {
+	svc *Service
+}
+
+// NewHandler returns http.Handler which serves Kinesis API of svc.
+// CBOR encoding is not supported, so that clients such as AWS SDK for Java need to disable it.
+func NewHandler(svc *Service) http.Handler {
+	return &handler{svc: svc}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("x-amzn-RequestId", uuid.New().String())
+	if strings.HasPrefix(r.Header.Get("Content-Type"), cborContentType) {
+		writeError(w, awserr.New(kinesis.ErrCodeInvalidArgumentException, "CBOR encoding is not supported, disable it by AWS_CBOR_DISABLE environment variable of client.", nil))
+		return
+	}
+	target := r.Header.Get("X-Amz-Target")
+	action := strings.TrimPrefix(target, jsonTargetPrefix)
+	if !strings.HasPrefix(target, jsonTargetPrefix) || !actions[action] {
+		writeError(w, awserr.New(errCodeUnknownOperation, "Unknown operation "+target, nil))
+		return
+	}
+
+	method := reflect.ValueOf(h.svc).MethodByName(action + "WithContext")
+	input := reflect.New(method.Type().In(1).Elem())
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, awserr.New(kinesis.ErrCodeInvalidArgumentException, "could not read request body", err))
+		return
+	}
+	if len(bytes.TrimSpace(b)) > 0 {
+		if err := jsonutil.UnmarshalJSON(input.Interface(), bytes.NewReader(b)); err != nil {
+			writeError(w, awserr.New(kinesis.ErrCodeInvalidArgumentException, "could not parse request body into json", err))
+			return
+		}
+	}
+	if v, ok := input.Interface().(request.Validator); ok {
+		if err := v.Validate(); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	res := method.Call([]reflect.Value{reflect.ValueOf(r.Context()), input})
+	if err, _ := res[1].Interface().(error); err != nil {
+		writeError(w, err)
+		return
+	}
+	body, err := jsonutil.BuildJSON(res[0].Interface())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", jsonContentType)
+	w.Write(body)
+}
+
+// writeError writes error in json protocol, where aws-sdk-go reads error code from __type.
+func writeError(w http.ResponseWriter, err error) {
+	code, msg, status := "InternalFailure", err.Error(), http.StatusInternalServerError
+	switch e := err.(type) {
+	case request.ErrInvalidParams:
+		code, msg, status = kinesis.ErrCodeInvalidArgumentException, e.Message(), http.StatusBadRequest
+	case awserr.Error:
+		code, msg, status = e.Code(), e.Message(), http.StatusBadRequest
+		if code == kinesis.ErrCodeInternalFailureException {
+			status = http.StatusInternalServerError
+		}
+	}
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"__type": code, "message": msg})
+}
@@ -0,0 +1,73 @@
+package kinesisd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+func TestHandler(t *testing.T) {
+	ts := httptest.NewServer(NewHandler(New("us-east-1", "000000000000")))
+	defer ts.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(ts.URL),
+		Credentials: credentials.NewStaticCredentials("dummy", "dummy", ""),
+	}))
+	client := kinesis.New(sess)
+
+	if _, err := client.CreateStream(&kinesis.CreateStreamInput{StreamName: aws.String("mystream"), ShardCount: aws.Int64(2)}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if err := client.WaitUntilStreamExists(&kinesis.DescribeStreamInput{StreamName: aws.String("mystream")}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	_, err := client.DescribeStream(&kinesis.DescribeStreamInput{StreamName: aws.String("unknown")})
+	if e, ok := err.(awserr.Error); !ok || e.Code() != kinesis.ErrCodeResourceNotFoundException {
+		t.Errorf("unexpected error captured: %#v", err)
+	}
+
+	put, err := client.PutRecord(&kinesis.PutRecordInput{StreamName: aws.String("mystream"), PartitionKey: aws.String("key"), Data: []byte("hello\x00")})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	it, err := client.GetShardIterator(&kinesis.GetShardIteratorInput{
+		StreamName:             aws.String("mystream"),
+		ShardId:                put.ShardId,
+		ShardIteratorType:      aws.String(kinesis.ShardIteratorTypeAtSequenceNumber),
+		StartingSequenceNumber: put.SequenceNumber,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	got, err := client.GetRecords(&kinesis.GetRecordsInput{ShardIterator: it.ShardIterator})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if len(got.Records) != 1 || string(got.Records[0].Data) != "hello\x00" || *got.Records[0].PartitionKey != "key" ||
+		got.Records[0].ApproximateArrivalTimestamp == nil || got.NextShardIterator == nil {
+		t.Errorf("unexpected records: %s", got)
+	}
+	if _, err := client.GetRecords(&kinesis.GetRecordsInput{ShardIterator: aws.String("invalid")}); err == nil || err.(awserr.Error).Code() != kinesis.ErrCodeInvalidArgumentException {
+		t.Errorf("unexpected error captured: %#v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(`{}`))
+	req.Header.Set("X-Amz-Target", "Kinesis_20131202.SplitShard")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected status: %d", res.StatusCode)
+	}
+}
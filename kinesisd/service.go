@@ -0,0 +1,352 @@
+// Package kinesisd provides in-memory data stream service compatible with subset of Kinesis API,
+// which can be served over HTTP or used in process as kinesisiface.KinesisAPI.
+package kinesisd
+
+import (
+	"encoding/base64"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+)
+
+// errCodeUnknownOperation is the error code which kinesis package of aws-sdk-go does not define.
+const errCodeUnknownOperation = "UnknownOperationException"
+
+const (
+	maxShardCount      = 500
+	maxPutRecords      = 500
+	maxGetRecords      = 10000
+	maxListShards      = 10000
+	maxDescribeShards  = 100
+	maxListStreams     = 100
+	defaultListStreams = 10
+	streamStatusActive = "ACTIVE"
+	encryptionTypeNone = "NONE"
+)
+
+var streamNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,128}$`)
+
+// Service is in-memory data stream service.
+// Operations which are not implemented panic, as the embedded KinesisAPI is nil.
+type Service struct {
+	kinesisiface.KinesisAPI
+	region    string
+	accountID string
+	mu        sync.Mutex
+	streams   map[string]*stream
+}
+
+// New returns Service object. Stream ARNs are built from region and accountID.
+func New(region, accountID string) *Service {
+	return &Service{
+		region:    region,
+		accountID: accountID,
+		streams:   map[string]*stream{},
+	}
+}
+
+func (s *Service) getStream(name *string) (*stream, error) {
+	n := aws.StringValue(name)
+	st := s.streams[n]
+	if st == nil {
+		return nil, awserr.New(kinesis.ErrCodeResourceNotFoundException, "Stream "+n+" under account "+s.accountID+" not found.", nil)
+	}
+	return st, nil
+}
+
+// pageShards returns shards after the exclusive start up to limit, and whether more shards exist.
+func pageShards(st *stream, exclusiveStart string, limit int64) ([]*kinesis.Shard, bool) {
+	shards := []*kinesis.Shard{}
+	for _, sh := range st.shards {
+		if sh.id <= exclusiveStart {
+			continue
+		}
+		if int64(len(shards)) == limit {
+			return shards, true
+		}
+		shards = append(shards, sh.description())
+	}
+	return shards, false
+}
+
+// CreateStreamWithContext creates stream whose hash key space is evenly split into ShardCount shards.
+// The stream becomes ACTIVE immediately.
+func (s *Service) CreateStreamWithContext(_ aws.Context, input *kinesis.CreateStreamInput, _ ...request.Option) (*kinesis.CreateStreamOutput, error) {
+	name := aws.StringValue(input.StreamName)
+	if !streamNamePattern.MatchString(name) {
+		return nil, awserr.New(kinesis.ErrCodeInvalidArgumentException, "StreamName must satisfy regular expression pattern: [a-zA-Z0-9_.-]+ and be 1 to 128 in length.", nil)
+	}
+	count := aws.Int64Value(input.ShardCount)
+	if input.ShardCount == nil {
+		count = 1
+	}
+	if count < 1 || count > maxShardCount {
+		return nil, awserr.New(kinesis.ErrCodeInvalidArgumentException, "ShardCount must be between 1 and 500.", nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.streams[name]; ok {
+		return nil, awserr.New(kinesis.ErrCodeResourceInUseException, "Stream "+name+" under account "+s.accountID+" already exists.", nil)
+	}
+	arn := "arn:aws:kinesis:" + s.region + ":" + s.accountID + ":stream/" + name
+	s.streams[name] = newStream(name, arn, count, time.Now())
+	return &kinesis.CreateStreamOutput{}, nil
+}
+
+// DeleteStreamWithContext deletes stream and its records.
+func (s *Service) DeleteStreamWithContext(_ aws.Context, input *kinesis.DeleteStreamInput, _ ...request.Option) (*kinesis.DeleteStreamOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, err := s.getStream(input.StreamName)
+	if err != nil {
+		return nil, err
+	}
+	delete(s.streams, st.name)
+	return &kinesis.DeleteStreamOutput{}, nil
+}
+
+// DescribeStreamWithContext returns stream and its shards up to Limit.
+func (s *Service) DescribeStreamWithContext(_ aws.Context, input *kinesis.DescribeStreamInput, _ ...request.Option) (*kinesis.DescribeStreamOutput, error) {
+	limit := aws.Int64Value(input.Limit)
+	if limit <= 0 || limit > maxDescribeShards {
+		limit = maxDescribeShards
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, err := s.getStream(input.StreamName)
+	if err != nil {
+		return nil, err
+	}
+	shards, more := pageShards(st, aws.StringValue(input.ExclusiveStartShardId), limit)
+	return &kinesis.DescribeStreamOutput{
+		StreamDescription: &kinesis.StreamDescription{
+			StreamName:              aws.String(st.name),
+			StreamARN:               aws.String(st.arn),
+			StreamStatus:            aws.String(streamStatusActive),
+			StreamCreationTimestamp: aws.Time(st.created),
+			RetentionPeriodHours:    aws.Int64(st.retention),
+			EncryptionType:          aws.String(encryptionTypeNone),
+			EnhancedMonitoring:      []*kinesis.EnhancedMetrics{{ShardLevelMetrics: []*string{}}},
+			Shards:                  shards,
+			HasMoreShards:           aws.Bool(more),
+		},
+	}, nil
+}
+
+// DescribeStreamPagesWithContext calls fn with pages of DescribeStream until all shards are described.
+func (s *Service) DescribeStreamPagesWithContext(ctx aws.Context, input *kinesis.DescribeStreamInput, fn func(*kinesis.DescribeStreamOutput, bool) bool, _ ...request.Option) error {
+	in := *input
+	for {
+		out, err := s.DescribeStreamWithContext(ctx, &in)
+		if err != nil {
+			return err
+		}
+		desc := out.StreamDescription
+		last := !*desc.HasMoreShards || len(desc.Shards) == 0
+		if !fn(out, last) || last {
+			return nil
+		}
+		in.ExclusiveStartShardId = desc.Shards[len(desc.Shards)-1].ShardId
+	}
+}
+
+// DescribeStreamSummaryWithContext returns stream without its shards.
+func (s *Service) DescribeStreamSummaryWithContext(_ aws.Context, input *kinesis.DescribeStreamSummaryInput, _ ...request.Option) (*kinesis.DescribeStreamSummaryOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, err := s.getStream(input.StreamName)
+	if err != nil {
+		return nil, err
+	}
+	return &kinesis.DescribeStreamSummaryOutput{
+		StreamDescriptionSummary: &kinesis.StreamDescriptionSummary{
+			StreamName:              aws.String(st.name),
+			StreamARN:               aws.String(st.arn),
+			StreamStatus:            aws.String(streamStatusActive),
+			StreamCreationTimestamp: aws.Time(st.created),
+			RetentionPeriodHours:    aws.Int64(st.retention),
+			EncryptionType:          aws.String(encryptionTypeNone),
+			EnhancedMonitoring:      []*kinesis.EnhancedMetrics{{ShardLevelMetrics: []*string{}}},
+			OpenShardCount:          aws.Int64(int64(len(st.shards))),
+			ConsumerCount:           aws.Int64(0),
+		},
+	}, nil
+}
+
+// ListStreamsWithContext returns names of streams in alphabetical order.
+func (s *Service) ListStreamsWithContext(_ aws.Context, input *kinesis.ListStreamsInput, _ ...request.Option) (*kinesis.ListStreamsOutput, error) {
+	limit := aws.Int64Value(input.Limit)
+	if limit <= 0 || limit > maxListStreams {
+		limit = defaultListStreams
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.streams))
+	for name := range s.streams {
+		if name > aws.StringValue(input.ExclusiveStartStreamName) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	more := int64(len(names)) > limit
+	if more {
+		names = names[:limit]
+	}
+	return &kinesis.ListStreamsOutput{StreamNames: aws.StringSlice(names), HasMoreStreams: aws.Bool(more)}, nil
+}
+
+// ListShardsWithContext returns shards of stream up to MaxResults.
+// NextToken is given in place of StreamName to read the following shards.
+func (s *Service) ListShardsWithContext(_ aws.Context, input *kinesis.ListShardsInput, _ ...request.Option) (*kinesis.ListShardsOutput, error) {
+	name, start := aws.StringValue(input.StreamName), aws.StringValue(input.ExclusiveStartShardId)
+	if input.NextToken != nil {
+		if input.StreamName != nil || input.ExclusiveStartShardId != nil {
+			return nil, awserr.New(kinesis.ErrCodeInvalidArgumentException, "NextToken and StreamName cannot be provided together.", nil)
+		}
+		b, err := base64.StdEncoding.DecodeString(*input.NextToken)
+		i := strings.LastIndex(string(b), "/")
+		if err != nil || i < 0 {
+			return nil, awserr.New(kinesis.ErrCodeInvalidArgumentException, "Invalid NextToken.", err)
+		}
+		name, start = string(b[:i]), string(b[i+1:])
+	}
+	limit := aws.Int64Value(input.MaxResults)
+	if limit <= 0 || limit > maxListShards {
+		limit = maxListShards
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, err := s.getStream(&name)
+	if err != nil {
+		return nil, err
+	}
+	shards, more := pageShards(st, start, limit)
+	out := &kinesis.ListShardsOutput{Shards: shards}
+	if more {
+		out.NextToken = aws.String(base64.StdEncoding.EncodeToString([]byte(name + "/" + *shards[len(shards)-1].ShardId)))
+	}
+	return out, nil
+}
+
+// PutRecordWithContext writes record into the shard which is chosen by hash of PartitionKey or ExplicitHashKey.
+func (s *Service) PutRecordWithContext(_ aws.Context, input *kinesis.PutRecordInput, _ ...request.Option) (*kinesis.PutRecordOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, err := s.getStream(input.StreamName)
+	if err != nil {
+		return nil, err
+	}
+	sh, r, err := st.put(aws.StringValue(input.PartitionKey), input.ExplicitHashKey, input.Data, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &kinesis.PutRecordOutput{
+		ShardId:        aws.String(sh.id),
+		SequenceNumber: aws.String(formatSequenceNumber(r.sequence)),
+		EncryptionType: aws.String(encryptionTypeNone),
+	}, nil
+}
+
+// PutRecordsWithContext writes records in order. Invalid records are reported as failure of each entry.
+func (s *Service) PutRecordsWithContext(_ aws.Context, input *kinesis.PutRecordsInput, _ ...request.Option) (*kinesis.PutRecordsOutput, error) {
+	if l := len(input.Records); l < 1 || l > maxPutRecords {
+		return nil, awserr.New(kinesis.ErrCodeInvalidArgumentException, "Records must contain 1 to 500 entries.", nil)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, err := s.getStream(input.StreamName)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	out := &kinesis.PutRecordsOutput{FailedRecordCount: aws.Int64(0), EncryptionType: aws.String(encryptionTypeNone)}
+	for _, e := range input.Records {
+		sh, r, err := st.put(aws.StringValue(e.PartitionKey), e.ExplicitHashKey, e.Data, now)
+		if err != nil {
+			e := err.(awserr.Error)
+			*out.FailedRecordCount++
+			out.Records = append(out.Records, &kinesis.PutRecordsResultEntry{ErrorCode: aws.String(e.Code()), ErrorMessage: aws.String(e.Message())})
+			continue
+		}
+		out.Records = append(out.Records, &kinesis.PutRecordsResultEntry{
+			ShardId:        aws.String(sh.id),
+			SequenceNumber: aws.String(formatSequenceNumber(r.sequence)),
+		})
+	}
+	return out, nil
+}
+
+// GetShardIteratorWithContext returns iterator which is valid for 5 minutes.
+func (s *Service) GetShardIteratorWithContext(_ aws.Context, input *kinesis.GetShardIteratorInput, _ ...request.Option) (*kinesis.GetShardIteratorOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, err := s.getStream(input.StreamName)
+	if err != nil {
+		return nil, err
+	}
+	sh, err := st.getShard(aws.StringValue(input.ShardId))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	st.expire(now)
+	after, err := st.position(sh, input)
+	if err != nil {
+		return nil, err
+	}
+	it := &shardIterator{Stream: st.name, Shard: sh.id, After: after, Issued: now.UnixNano()}
+	return &kinesis.GetShardIteratorOutput{ShardIterator: it.encode()}, nil
+}
+
+// GetRecordsWithContext returns records from the position of iterator up to Limit, with iterator of the next position.
+func (s *Service) GetRecordsWithContext(_ aws.Context, input *kinesis.GetRecordsInput, _ ...request.Option) (*kinesis.GetRecordsOutput, error) {
+	limit := aws.Int64Value(input.Limit)
+	if input.Limit == nil {
+		limit = maxGetRecords
+	}
+	if limit < 1 || limit > maxGetRecords {
+		return nil, awserr.New(kinesis.ErrCodeInvalidArgumentException, "Limit must be between 1 and 10000.", nil)
+	}
+	now := time.Now()
+	it, err := decodeShardIterator(aws.StringValue(input.ShardIterator), now)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, err := s.getStream(&it.Stream)
+	if err != nil {
+		return nil, err
+	}
+	sh, err := st.getShard(it.Shard)
+	if err != nil {
+		return nil, err
+	}
+	st.expire(now)
+	records := sh.read(it.After, limit)
+	out := &kinesis.GetRecordsOutput{Records: make([]*kinesis.Record, 0, len(records)), MillisBehindLatest: aws.Int64(0)}
+	next := &shardIterator{Stream: st.name, Shard: sh.id, After: it.After, Issued: now.UnixNano()}
+	for _, r := range records {
+		out.Records = append(out.Records, &kinesis.Record{
+			SequenceNumber:              aws.String(formatSequenceNumber(r.sequence)),
+			PartitionKey:                aws.String(r.partitionKey),
+			Data:                        r.data,
+			ApproximateArrivalTimestamp: aws.Time(r.arrival),
+		})
+		next.After = r.sequence
+	}
+	if n := len(records); n > 0 && sh.records[len(sh.records)-1] != records[n-1] {
+		out.MillisBehindLatest = aws.Int64(int64(now.Sub(records[n-1].arrival) / time.Millisecond))
+	}
+	out.NextShardIterator = next.encode()
+	return out, nil
+}
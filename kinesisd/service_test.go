@@ -0,0 +1,152 @@
+package kinesisd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+func iterator(t *testing.T, s *Service, input *kinesis.GetShardIteratorInput) *string {
+	t.Helper()
+	out, err := s.GetShardIteratorWithContext(context.Background(), input)
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	return out.ShardIterator
+}
+
+func TestServiceStream(t *testing.T) {
+	s := New("us-east-1", "000000000000")
+	ctx := context.Background()
+	if _, err := s.CreateStreamWithContext(ctx, &kinesis.CreateStreamInput{StreamName: aws.String("mystream"), ShardCount: aws.Int64(3)}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	for _, tt := range []struct {
+		label    string
+		input    *kinesis.CreateStreamInput
+		expected string
+	}{
+		{"exists", &kinesis.CreateStreamInput{StreamName: aws.String("mystream"), ShardCount: aws.Int64(1)}, kinesis.ErrCodeResourceInUseException},
+		{"invalid name", &kinesis.CreateStreamInput{StreamName: aws.String("my stream"), ShardCount: aws.Int64(1)}, kinesis.ErrCodeInvalidArgumentException},
+		{"too many shards", &kinesis.CreateStreamInput{StreamName: aws.String("s"), ShardCount: aws.Int64(501)}, kinesis.ErrCodeInvalidArgumentException},
+	} {
+		_, err := s.CreateStreamWithContext(ctx, tt.input)
+		if e, ok := err.(awserr.Error); !ok || e.Code() != tt.expected {
+			t.Errorf("%s: unexpected error captured: %#v", tt.label, err)
+		}
+	}
+
+	listed, err := s.ListShardsWithContext(ctx, &kinesis.ListShardsInput{StreamName: aws.String("mystream"), MaxResults: aws.Int64(2)})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if len(listed.Shards) != 2 || listed.NextToken == nil || *listed.Shards[0].HashKeyRange.StartingHashKey != "0" {
+		t.Fatalf("unexpected shards: %s", listed)
+	}
+	rest, err := s.ListShardsWithContext(ctx, &kinesis.ListShardsInput{NextToken: listed.NextToken})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if len(rest.Shards) != 1 || rest.NextToken != nil || *rest.Shards[0].HashKeyRange.EndingHashKey != maxHashKey.String() {
+		t.Fatalf("unexpected shards: %s", rest)
+	}
+	var pages int
+	s.DescribeStreamPagesWithContext(ctx, &kinesis.DescribeStreamInput{StreamName: aws.String("mystream"), Limit: aws.Int64(1)}, func(out *kinesis.DescribeStreamOutput, _ bool) bool {
+		pages++
+		return true
+	})
+	if pages != 3 {
+		t.Errorf("unexpected pages: %d", pages)
+	}
+
+	// records of the same partition key go to the same shard in order.
+	var shardID string
+	var sequences []string
+	for _, data := range []string{"a", "b", "c"} {
+		out, err := s.PutRecordWithContext(ctx, &kinesis.PutRecordInput{StreamName: aws.String("mystream"), PartitionKey: aws.String("key"), Data: []byte(data)})
+		if err != nil {
+			t.Fatalf("unexpected error captured: %#v", err)
+		}
+		if shardID != "" && *out.ShardId != shardID {
+			t.Errorf("unexpected shard: %s", *out.ShardId)
+		}
+		shardID = *out.ShardId
+		sequences = append(sequences, *out.SequenceNumber)
+	}
+	if !(sequences[0] < sequences[1] && sequences[1] < sequences[2]) {
+		t.Errorf("sequence numbers should increase: %v", sequences)
+	}
+
+	it := iterator(t, s, &kinesis.GetShardIteratorInput{StreamName: aws.String("mystream"), ShardId: aws.String(shardID), ShardIteratorType: aws.String(kinesis.ShardIteratorTypeTrimHorizon)})
+	got, err := s.GetRecordsWithContext(ctx, &kinesis.GetRecordsInput{ShardIterator: it, Limit: aws.Int64(2)})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if len(got.Records) != 2 || string(got.Records[0].Data) != "a" || string(got.Records[1].Data) != "b" || *got.MillisBehindLatest < 0 {
+		t.Fatalf("unexpected records: %s", got)
+	}
+	got, _ = s.GetRecordsWithContext(ctx, &kinesis.GetRecordsInput{ShardIterator: got.NextShardIterator})
+	if len(got.Records) != 1 || string(got.Records[0].Data) != "c" || *got.MillisBehindLatest != 0 {
+		t.Fatalf("unexpected records: %s", got)
+	}
+	got, _ = s.GetRecordsWithContext(ctx, &kinesis.GetRecordsInput{ShardIterator: got.NextShardIterator})
+	if len(got.Records) != 0 || got.NextShardIterator == nil {
+		t.Fatalf("unexpected records: %s", got)
+	}
+
+	for _, tt := range []struct {
+		label    string
+		input    *kinesis.GetShardIteratorInput
+		expected []string
+	}{
+		{"latest", &kinesis.GetShardIteratorInput{ShardIteratorType: aws.String(kinesis.ShardIteratorTypeLatest)}, nil},
+		{"at sequence number", &kinesis.GetShardIteratorInput{ShardIteratorType: aws.String(kinesis.ShardIteratorTypeAtSequenceNumber), StartingSequenceNumber: aws.String(sequences[1])}, []string{"b", "c"}},
+		{"after sequence number", &kinesis.GetShardIteratorInput{ShardIteratorType: aws.String(kinesis.ShardIteratorTypeAfterSequenceNumber), StartingSequenceNumber: aws.String(sequences[1])}, []string{"c"}},
+		{"at timestamp", &kinesis.GetShardIteratorInput{ShardIteratorType: aws.String(kinesis.ShardIteratorTypeAtTimestamp), Timestamp: aws.Time(time.Now().Add(-time.Minute))}, []string{"a", "b", "c"}},
+	} {
+		tt.input.StreamName, tt.input.ShardId = aws.String("mystream"), aws.String(shardID)
+		got, err := s.GetRecordsWithContext(ctx, &kinesis.GetRecordsInput{ShardIterator: iterator(t, s, tt.input)})
+		if err != nil {
+			t.Fatalf("%s: unexpected error captured: %#v", tt.label, err)
+		}
+		var data []string
+		for _, r := range got.Records {
+			data = append(data, string(r.Data))
+		}
+		if len(data) != len(tt.expected) || (len(data) > 0 && data[0] != tt.expected[0]) {
+			t.Errorf("%s: unexpected records: %v", tt.label, data)
+		}
+	}
+
+	// explicit hash key overrides partition key.
+	put, err := s.PutRecordsWithContext(ctx, &kinesis.PutRecordsInput{
+		StreamName: aws.String("mystream"),
+		Records: []*kinesis.PutRecordsRequestEntry{
+			{PartitionKey: aws.String("key"), ExplicitHashKey: aws.String("0"), Data: []byte("first")},
+			{PartitionKey: aws.String("key"), ExplicitHashKey: aws.String(maxHashKey.String()), Data: []byte("last")},
+			{PartitionKey: aws.String(""), Data: []byte("invalid")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if *put.FailedRecordCount != 1 || *put.Records[0].ShardId != "shardId-000000000000" || *put.Records[1].ShardId != "shardId-000000000002" ||
+		*put.Records[2].ErrorCode != kinesis.ErrCodeInvalidArgumentException {
+		t.Errorf("unexpected result: %s", put)
+	}
+
+	expired := (&shardIterator{Stream: "mystream", Shard: shardID, Issued: time.Now().Add(-iteratorTTL - time.Second).UnixNano()}).encode()
+	if _, err := s.GetRecordsWithContext(ctx, &kinesis.GetRecordsInput{ShardIterator: expired}); err == nil || err.(awserr.Error).Code() != kinesis.ErrCodeExpiredIteratorException {
+		t.Errorf("unexpected error captured: %#v", err)
+	}
+	if _, err := s.DeleteStreamWithContext(ctx, &kinesis.DeleteStreamInput{StreamName: aws.String("mystream")}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if _, err := s.GetRecordsWithContext(ctx, &kinesis.GetRecordsInput{ShardIterator: it}); err == nil || err.(awserr.Error).Code() != kinesis.ErrCodeResourceNotFoundException {
+		t.Errorf("unexpected error captured: %#v", err)
+	}
+}
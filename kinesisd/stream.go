@@ -0,0 +1,225 @@
+package kinesisd
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+const (
+	// iteratorTTL is the duration in which shard iterator is valid.
+	iteratorTTL = 5 * time.Minute
+	// sequenceNumberDigits is the width of sequence numbers, which keeps them ordered as strings.
+	sequenceNumberDigits  = 56
+	defaultRetentionHours = 24
+)
+
+// maxHashKey is the largest hash key, 2^128 - 1.
+var maxHashKey = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+
+type record struct {
+	sequence     int64
+	partitionKey string
+	data         []byte
+	arrival      time.Time
+}
+
+type shard struct {
+	id       string
+	startKey *big.Int
+	endKey   *big.Int
+	// first is the sequence number which shard starts with.
+	first   int64
+	records []*record
+}
+
+type stream struct {
+	name      string
+	arn       string
+	created   time.Time
+	retention int64
+	shards    []*shard
+	// sequence is the last sequence number in stream, which is shared by shards.
+	sequence int64
+}
+
+func newStream(name, arn string, shardCount int64, now time.Time) *stream {
+	s := &stream{name: name, arn: arn, created: now, retention: defaultRetentionHours}
+	width := new(big.Int).Div(new(big.Int).Add(maxHashKey, big.NewInt(1)), big.NewInt(shardCount))
+	for i := int64(0); i < shardCount; i++ {
+		start := new(big.Int).Mul(width, big.NewInt(i))
+		end := new(big.Int).Sub(new(big.Int).Add(start, width), big.NewInt(1))
+		if i == shardCount-1 {
+			end = maxHashKey
+		}
+		s.shards = append(s.shards, &shard{
+			id:       fmt.Sprintf("shardId-%012d", i),
+			startKey: start,
+			endKey:   end,
+			first:    1,
+		})
+	}
+	return s
+}
+
+func formatSequenceNumber(n int64) string {
+	return fmt.Sprintf("%0*d", sequenceNumberDigits, n)
+}
+
+func parseSequenceNumber(s string) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, awserr.New(kinesis.ErrCodeInvalidArgumentException, "Invalid SequenceNumber "+s, nil)
+	}
+	return n, nil
+}
+
+func (s *stream) getShard(id string) (*shard, error) {
+	for _, sh := range s.shards {
+		if sh.id == id {
+			return sh, nil
+		}
+	}
+	return nil, awserr.New(kinesis.ErrCodeResourceNotFoundException, "Shard "+id+" in stream "+s.name+" under account does not exist", nil)
+}
+
+// hashKey returns hash key of record, which is MD5 of partition key as 128 bit integer unless explicit one is given.
+func hashKey(partitionKey string, explicit *string) (*big.Int, error) {
+	if explicit != nil {
+		k, ok := new(big.Int).SetString(*explicit, 10)
+		if !ok || k.Sign() < 0 || k.Cmp(maxHashKey) > 0 {
+			return nil, awserr.New(kinesis.ErrCodeInvalidArgumentException, "Invalid ExplicitHashKey "+*explicit, nil)
+		}
+		return k, nil
+	}
+	sum := md5.Sum([]byte(partitionKey))
+	return new(big.Int).SetBytes(sum[:]), nil
+}
+
+// put appends record to the shard which hash key range contains the key of record.
+func (s *stream) put(partitionKey string, explicitHashKey *string, data []byte, now time.Time) (*shard, *record, error) {
+	if l := len(partitionKey); l < 1 || l > 256 {
+		return nil, nil, awserr.New(kinesis.ErrCodeInvalidArgumentException, "PartitionKey must be between 1 and 256 characters", nil)
+	}
+	if len(data) > 1024*1024 {
+		return nil, nil, awserr.New(kinesis.ErrCodeInvalidArgumentException, "Data must be 1 MiB at most", nil)
+	}
+	key, err := hashKey(partitionKey, explicitHashKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.expire(now)
+	for _, sh := range s.shards {
+		if key.Cmp(sh.startKey) >= 0 && key.Cmp(sh.endKey) <= 0 {
+			s.sequence++
+			r := &record{sequence: s.sequence, partitionKey: partitionKey, data: data, arrival: now}
+			sh.records = append(sh.records, r)
+			return sh, r, nil
+		}
+	}
+	return nil, nil, awserr.New(kinesis.ErrCodeInternalFailureException, "no shard for hash key "+key.String(), nil)
+}
+
+// expire removes records older than retention period.
+func (s *stream) expire(now time.Time) {
+	oldest := now.Add(-time.Duration(s.retention) * time.Hour)
+	for _, sh := range s.shards {
+		i := sort.Search(len(sh.records), func(i int) bool { return !sh.records[i].arrival.Before(oldest) })
+		sh.records = sh.records[i:]
+	}
+}
+
+// shardIterator is position in shard, which is given to clients as opaque token.
+type shardIterator struct {
+	Stream string `json:"s"`
+	Shard  string `json:"h"`
+	// After is the sequence number which reading starts after.
+	After  int64 `json:"a"`
+	Issued int64 `json:"t"`
+}
+
+func (it *shardIterator) encode() *string {
+	b, _ := json.Marshal(it)
+	return aws.String(base64.StdEncoding.EncodeToString(b))
+}
+
+func decodeShardIterator(s string, now time.Time) (*shardIterator, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, awserr.New(kinesis.ErrCodeInvalidArgumentException, "Invalid ShardIterator", err)
+	}
+	it := &shardIterator{}
+	if err := json.Unmarshal(b, it); err != nil {
+		return nil, awserr.New(kinesis.ErrCodeInvalidArgumentException, "Invalid ShardIterator", err)
+	}
+	if now.Sub(time.Unix(0, it.Issued)) > iteratorTTL {
+		return nil, awserr.New(kinesis.ErrCodeExpiredIteratorException, "Iterator expired", nil)
+	}
+	return it, nil
+}
+
+// position returns the sequence number which reading starts after for iterator type.
+func (s *stream) position(sh *shard, input *kinesis.GetShardIteratorInput) (int64, error) {
+	switch t := aws.StringValue(input.ShardIteratorType); t {
+	case kinesis.ShardIteratorTypeTrimHorizon:
+		if len(sh.records) > 0 {
+			return sh.records[0].sequence - 1, nil
+		}
+		return s.sequence, nil
+	case kinesis.ShardIteratorTypeLatest:
+		return s.sequence, nil
+	case kinesis.ShardIteratorTypeAtSequenceNumber, kinesis.ShardIteratorTypeAfterSequenceNumber:
+		n, err := parseSequenceNumber(aws.StringValue(input.StartingSequenceNumber))
+		if err != nil {
+			return 0, err
+		}
+		if t == kinesis.ShardIteratorTypeAtSequenceNumber {
+			n--
+		}
+		return n, nil
+	case kinesis.ShardIteratorTypeAtTimestamp:
+		if input.Timestamp == nil {
+			return 0, awserr.New(kinesis.ErrCodeInvalidArgumentException, "Timestamp is required for AT_TIMESTAMP", nil)
+		}
+		for _, r := range sh.records {
+			if !r.arrival.Before(*input.Timestamp) {
+				return r.sequence - 1, nil
+			}
+		}
+		return s.sequence, nil
+	default:
+		return 0, awserr.New(kinesis.ErrCodeInvalidArgumentException, "Invalid ShardIteratorType "+t, nil)
+	}
+}
+
+// read returns records after the sequence number up to limit.
+func (sh *shard) read(after, limit int64) []*record {
+	i := sort.Search(len(sh.records), func(i int) bool { return sh.records[i].sequence > after })
+	end := len(sh.records)
+	if int64(end-i) > limit {
+		end = i + int(limit)
+	}
+	return sh.records[i:end]
+}
+
+func (sh *shard) description() *kinesis.Shard {
+	return &kinesis.Shard{
+		ShardId: aws.String(sh.id),
+		HashKeyRange: &kinesis.HashKeyRange{
+			StartingHashKey: aws.String(sh.startKey.String()),
+			EndingHashKey:   aws.String(sh.endKey.String()),
+		},
+		SequenceNumberRange: &kinesis.SequenceNumberRange{
+			StartingSequenceNumber: aws.String(formatSequenceNumber(sh.first)),
+		},
+	}
+}
@@ -1,9 +1,15 @@
 package wheelamb
 
 import (
+	"math/rand"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
 	"github.com/taiyoh/wheelamb/docker"
 )
 
@@ -16,14 +22,52 @@ type LambdaFunction struct {
 	RevisionID   string `json:"RevisionId"` // use uuid
 	MemorySize   int64
 	FunctionArn  string
-	Version      string // "$LATEST",
+	Version      string // "$LATEST" or published version number
 	Timeout      int64
 	LastModified time.Time
 	Handler      string
 	Runtime      string
+	Role         string
 	Description  *string
 	envs         map[string]string
+	tags         map[string]string
+	codeDir      string
 	inspect      *docker.ContainerInspect
+	inflight     *sync.WaitGroup
+	// publishedFrom is RevisionID of $LATEST which this version is published from.
+	publishedFrom string
+}
+
+const latestVersion = "$LATEST"
+
+// lastModifiedFormat is the timestamp layout lambda API uses for LastModified.
+const lastModifiedFormat = "2006-01-02T15:04:05.000-0700"
+
+// Configuration returns function settings as lambda.FunctionConfiguration.
+func (lf *LambdaFunction) Configuration() *lambda.FunctionConfiguration {
+	conf := &lambda.FunctionConfiguration{
+		CodeSha256:       aws.String(lf.CodeSha256),
+		CodeSize:         aws.Int64(lf.CodeSize),
+		Description:      lf.Description,
+		FunctionArn:      aws.String(lf.FunctionArn),
+		FunctionName:     aws.String(lf.FunctionName),
+		Handler:          aws.String(lf.Handler),
+		LastModified:     aws.String(lf.LastModified.Format(lastModifiedFormat)),
+		LastUpdateStatus: aws.String(lambda.LastUpdateStatusSuccessful),
+		MemorySize:       aws.Int64(lf.MemorySize),
+		RevisionId:       aws.String(lf.RevisionID),
+		Role:             aws.String(lf.Role),
+		Runtime:          aws.String(lf.Runtime),
+		State:            aws.String(lambda.StateActive),
+		Timeout:          aws.Int64(lf.Timeout),
+		Version:          aws.String(lf.Version),
+	}
+	if len(lf.envs) > 0 {
+		conf.Environment = &lambda.EnvironmentResponse{
+			Variables: aws.StringMap(lf.envs),
+		}
+	}
+	return conf
 }
 
 // https://github.com/lambci/docker-lambda#docker-tags
@@ -68,34 +112,216 @@ var availableTags = map[string]struct{}{
 
 // LambdaRegistry holds lambda function settings in memory.
 type LambdaRegistry struct {
-	mapping map[string]*LambdaFunction
+	mu           sync.RWMutex
+	mapping      map[string]*LambdaFunction
+	versions     map[string]map[string]*LambdaFunction
+	lastVersions map[string]int
+	aliases      map[string]map[string]*LambdaAlias
+	urls         map[string]map[string]*FunctionURLConfig
+	unregistered []func(*LambdaFunction)
+	// random returns number in [0.0,1.0) for routing invocations of alias.
+	random func() float64
 }
 
 // NewLambdaRegistry returns LambdaRegistry object.
 func NewLambdaRegistry() *LambdaRegistry {
 	return &LambdaRegistry{
-		mapping: make(map[string]*LambdaFunction),
+		mapping:      make(map[string]*LambdaFunction),
+		versions:     make(map[string]map[string]*LambdaFunction),
+		lastVersions: make(map[string]int),
+		aliases:      make(map[string]map[string]*LambdaAlias),
+		urls:         make(map[string]map[string]*FunctionURLConfig),
+		random:       rand.Float64,
 	}
 }
 
 // Get returns LambdaFucntion object from given name.
 func (r *LambdaRegistry) Get(name string) *LambdaFunction {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	return r.mapping[name]
 }
 
+// GetVersion returns LambdaFunction object from given name and qualifier.
+// Empty qualifier means $LATEST, and alias returns its primary version.
+func (r *LambdaRegistry) GetVersion(name, qualifier string) *LambdaFunction {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if a, ok := r.aliases[name][qualifier]; ok {
+		qualifier = a.FunctionVersion
+	}
+	return r.getVersion(name, qualifier)
+}
+
+func (r *LambdaRegistry) getVersion(name, version string) *LambdaFunction {
+	if version == "" || version == latestVersion {
+		return r.mapping[name]
+	}
+	return r.versions[name][version]
+}
+
 // GetFromARN returns LambdaFunction object from given function arn.
+// Qualified arn returns the version.
 func (r *LambdaRegistry) GetFromARN(arn string) *LambdaFunction {
-	// arn:aws:lambda:%s:000000000000:function:%s
+	name, qualifier, ok := parseFunctionARN(arn)
+	if !ok {
+		return nil
+	}
+	return r.GetVersion(name, qualifier)
+}
+
+// parseFunctionARN extracts function name and qualifier from given function arn.
+func parseFunctionARN(arn string) (name, qualifier string, ok bool) {
+	// arn:aws:lambda:%s:%s:function:%s[:%s]
 	parts := strings.Split(arn, ":")
-	for i, p := range []string{"arn", "aws", "lambda", *awsConf.Region, "000000000000", "function"} {
+	if len(parts) != 7 && len(parts) != 8 {
+		return "", "", false
+	}
+	for i, p := range []string{"arn", "aws", "lambda", Region(), accountID, "function"} {
 		if parts[i] != p {
-			return nil
+			return "", "", false
 		}
 	}
-	return r.mapping[parts[6]]
+	if len(parts) == 8 {
+		qualifier = parts[7]
+	}
+	return parts[6], qualifier, true
+}
+
+// List returns all LambdaFunction objects sorted by function name.
+func (r *LambdaRegistry) List() []*LambdaFunction {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]*LambdaFunction, 0, len(r.mapping))
+	for _, lf := range r.mapping {
+		list = append(list, lf)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].FunctionName < list[j].FunctionName
+	})
+	return list
+}
+
+// Versions returns $LATEST and published versions of function in order.
+func (r *LambdaRegistry) Versions(name string) []*LambdaFunction {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	latest, ok := r.mapping[name]
+	if !ok {
+		return nil
+	}
+	list := make([]*LambdaFunction, 0, len(r.versions[name]))
+	for _, lf := range r.versions[name] {
+		list = append(list, lf)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return versionNumber(list[i].Version) < versionNumber(list[j].Version)
+	})
+	return append([]*LambdaFunction{latest}, list...)
+}
+
+func versionNumber(v string) int {
+	n, _ := strconv.Atoi(v)
+	return n
 }
 
 // Register sets LambdaFunction into registry.
 func (r *LambdaRegistry) Register(lf *LambdaFunction) {
+	if lf.inflight == nil {
+		lf.inflight = &sync.WaitGroup{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.mapping[lf.FunctionName] = lf
 }
+
+// nextVersion returns version number which is published next.
+// Numbers are never reused until the function is unregistered.
+func (r *LambdaRegistry) nextVersion(name string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return strconv.Itoa(r.lastVersions[name] + 1)
+}
+
+// lastPublished returns the last published version of function.
+func (r *LambdaRegistry) lastPublished(name string) *LambdaFunction {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.versions[name][strconv.Itoa(r.lastVersions[name])]
+}
+
+// registerVersion sets published version of LambdaFunction into registry.
+func (r *LambdaRegistry) registerVersion(lf *LambdaFunction) {
+	if lf.inflight == nil {
+		lf.inflight = &sync.WaitGroup{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.versions[lf.FunctionName]; !ok {
+		r.versions[lf.FunctionName] = make(map[string]*LambdaFunction)
+	}
+	r.versions[lf.FunctionName][lf.Version] = lf
+	if n := versionNumber(lf.Version); n > r.lastVersions[lf.FunctionName] {
+		r.lastVersions[lf.FunctionName] = n
+	}
+}
+
+// acquire returns LambdaFunction marked as in use until release is called.
+// Marking is done under lock, so that no invocation starts after the function is replaced.
+// Alias is routed to one of its versions according to the weights.
+func (r *LambdaRegistry) acquire(name, qualifier string) (lf *LambdaFunction, release func()) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if a, ok := r.aliases[name][qualifier]; ok {
+		qualifier = a.route(r.random())
+	}
+	lf = r.getVersion(name, qualifier)
+	if lf == nil {
+		return nil, nil
+	}
+	lf.inflight.Add(1)
+	return lf, lf.inflight.Done
+}
+
+// Unregister removes LambdaFunction and its versions from registry and notifies it to subscribers.
+func (r *LambdaRegistry) Unregister(name string) *LambdaFunction {
+	r.mu.Lock()
+	lf, ok := r.mapping[name]
+	delete(r.mapping, name)
+	delete(r.versions, name)
+	delete(r.lastVersions, name)
+	delete(r.aliases, name)
+	delete(r.urls, name)
+	hooks := r.unregistered
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	for _, fn := range hooks {
+		fn(lf)
+	}
+	return lf
+}
+
+// unregisterVersion removes published version from registry and notifies it to subscribers.
+func (r *LambdaRegistry) unregisterVersion(name, version string) *LambdaFunction {
+	r.mu.Lock()
+	lf, ok := r.versions[name][version]
+	delete(r.versions[name], version)
+	hooks := r.unregistered
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	for _, fn := range hooks {
+		fn(lf)
+	}
+	return lf
+}
+
+// OnUnregister subscribes function which is called when LambdaFunction, its version or alias is unregistered.
+func (r *LambdaRegistry) OnUnregister(fn func(*LambdaFunction)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.unregistered = append(r.unregistered, fn)
+}
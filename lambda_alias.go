@@ -0,0 +1,295 @@
+package wheelamb
+
+import (
+	"context"
+	"regexp"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/google/uuid"
+)
+
+// LambdaAlias describes alias of lambda function.
+// via https://docs.aws.amazon.com/cli/latest/reference/lambda/create-alias.html
+type LambdaAlias struct {
+	Name            string
+	FunctionName    string
+	FunctionVersion string
+	Description     *string
+	RevisionID      string `json:"RevisionId"`
+	// AdditionalVersionWeights routes the weight of invocations to the version instead of FunctionVersion.
+	AdditionalVersionWeights map[string]float64
+}
+
+// AliasArn returns arn of alias.
+func (a *LambdaAlias) AliasArn() string {
+	return functionARN(a.FunctionName) + ":" + a.Name
+}
+
+// Configuration returns alias settings as lambda.AliasConfiguration.
+func (a *LambdaAlias) Configuration() *lambda.AliasConfiguration {
+	conf := &lambda.AliasConfiguration{
+		AliasArn:        aws.String(a.AliasArn()),
+		Description:     a.Description,
+		FunctionVersion: aws.String(a.FunctionVersion),
+		Name:            aws.String(a.Name),
+		RevisionId:      aws.String(a.RevisionID),
+	}
+	if len(a.AdditionalVersionWeights) > 0 {
+		conf.RoutingConfig = &lambda.AliasRoutingConfiguration{
+			AdditionalVersionWeights: aws.Float64Map(a.AdditionalVersionWeights),
+		}
+	}
+	return conf
+}
+
+// route returns version for the invocation from given number in [0.0,1.0).
+func (a *LambdaAlias) route(n float64) string {
+	versions := make([]string, 0, len(a.AdditionalVersionWeights))
+	for v := range a.AdditionalVersionWeights {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	for _, v := range versions {
+		if n < a.AdditionalVersionWeights[v] {
+			return v
+		}
+		n -= a.AdditionalVersionWeights[v]
+	}
+	return a.FunctionVersion
+}
+
+// GetAlias returns LambdaAlias object from given function name and alias name.
+func (r *LambdaRegistry) GetAlias(name, alias string) *LambdaAlias {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.aliases[name][alias]
+}
+
+// Aliases returns aliases of function sorted by name.
+func (r *LambdaRegistry) Aliases(name string) []*LambdaAlias {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]*LambdaAlias, 0, len(r.aliases[name]))
+	for _, a := range r.aliases[name] {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// RegisterAlias sets LambdaAlias into registry.
+func (r *LambdaRegistry) RegisterAlias(a *LambdaAlias) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.aliases[a.FunctionName]; !ok {
+		r.aliases[a.FunctionName] = make(map[string]*LambdaAlias)
+	}
+	r.aliases[a.FunctionName][a.Name] = a
+}
+
+// UnregisterAlias removes LambdaAlias and its function URL from registry, and notifies it to subscribers
+// as LambdaFunction whose FunctionArn is arn of alias.
+func (r *LambdaRegistry) UnregisterAlias(name, alias string) {
+	r.mu.Lock()
+	a, ok := r.aliases[name][alias]
+	delete(r.aliases[name], alias)
+	delete(r.urls[name], alias)
+	hooks := r.unregistered
+	r.mu.Unlock()
+	if !ok {
+		return
+	}
+	lf := &LambdaFunction{FunctionName: name, FunctionArn: a.AliasArn(), Version: a.FunctionVersion}
+	for _, fn := range hooks {
+		fn(lf)
+	}
+}
+
+var (
+	aliasNamePattern = regexp.MustCompile(`^[a-zA-Z0-9-_]+$`)
+	versionPattern   = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// validateAlias checks versions which alias points to.
+func (s *LambdaService) validateAlias(a *LambdaAlias) error {
+	if s.registry.GetVersion(a.FunctionName, a.FunctionVersion) == nil || s.registry.GetAlias(a.FunctionName, a.FunctionVersion) != nil {
+		return awserr.New(lambda.ErrCodeResourceNotFoundException, "function version not found: "+a.FunctionVersion, nil)
+	}
+	if len(a.AdditionalVersionWeights) == 0 {
+		return nil
+	}
+	if len(a.AdditionalVersionWeights) > 1 {
+		return awserr.New(lambda.ErrCodeInvalidParameterValueException, "only one additional version can be routed", nil)
+	}
+	if a.FunctionVersion == latestVersion {
+		return awserr.New(lambda.ErrCodeInvalidParameterValueException, "$LATEST is not supported for alias with routing", nil)
+	}
+	for v, w := range a.AdditionalVersionWeights {
+		if !versionPattern.MatchString(v) || s.registry.GetVersion(a.FunctionName, v) == nil {
+			return awserr.New(lambda.ErrCodeResourceNotFoundException, "function version not found: "+v, nil)
+		}
+		if v == a.FunctionVersion {
+			return awserr.New(lambda.ErrCodeInvalidParameterValueException, "additional version must be different from primary version", nil)
+		}
+		if w < 0 || w > 1 {
+			return awserr.New(lambda.ErrCodeInvalidParameterValueException, "weight must be between 0.0 and 1.0", nil)
+		}
+	}
+	return nil
+}
+
+func routingWeights(conf *lambda.AliasRoutingConfiguration) map[string]float64 {
+	weights := map[string]float64{}
+	if conf == nil {
+		return weights
+	}
+	for v, w := range conf.AdditionalVersionWeights {
+		weights[v] = aws.Float64Value(w)
+	}
+	return weights
+}
+
+// CreateAlias creates alias for version of function.
+func (s *LambdaService) CreateAlias(ctx context.Context, input *lambda.CreateAliasInput) (*LambdaAlias, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	if !aliasNamePattern.MatchString(*input.Name) || versionPattern.MatchString(*input.Name) || *input.Name == latestVersion {
+		return nil, awserr.New(lambda.ErrCodeInvalidParameterValueException, "invalid alias name", nil)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lf, err := s.getFunction(*input.FunctionName, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.registry.GetAlias(lf.FunctionName, *input.Name) != nil {
+		return nil, awserr.New(lambda.ErrCodeResourceConflictException, "alias already exists", nil)
+	}
+	a := &LambdaAlias{
+		Name:                     *input.Name,
+		FunctionName:             lf.FunctionName,
+		FunctionVersion:          *input.FunctionVersion,
+		Description:              input.Description,
+		RevisionID:               uuid.New().String(),
+		AdditionalVersionWeights: routingWeights(input.RoutingConfig),
+	}
+	if err := s.validateAlias(a); err != nil {
+		return nil, err
+	}
+	s.registry.RegisterAlias(a)
+	return a, nil
+}
+
+// getAlias returns LambdaAlias object from given function name or arn and alias name.
+func (s *LambdaService) getAlias(name, alias string) (*LambdaAlias, error) {
+	lf, err := s.getFunction(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	a := s.registry.GetAlias(lf.FunctionName, alias)
+	if a == nil {
+		return nil, awserr.New(lambda.ErrCodeResourceNotFoundException, "alias not found", nil)
+	}
+	return a, nil
+}
+
+// GetAlias returns alias of function.
+func (s *LambdaService) GetAlias(ctx context.Context, input *lambda.GetAliasInput) (*LambdaAlias, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	return s.getAlias(*input.FunctionName, *input.Name)
+}
+
+// UpdateAlias updates version and routing of alias.
+func (s *LambdaService) UpdateAlias(ctx context.Context, input *lambda.UpdateAliasInput) (*LambdaAlias, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, err := s.getAlias(*input.FunctionName, *input.Name)
+	if err != nil {
+		return nil, err
+	}
+	if rev := aws.StringValue(input.RevisionId); rev != "" && rev != old.RevisionID {
+		return nil, awserr.New(lambda.ErrCodePreconditionFailedException, "revision id does not match", nil)
+	}
+	a := *old
+	a.RevisionID = uuid.New().String()
+	if input.FunctionVersion != nil {
+		a.FunctionVersion = *input.FunctionVersion
+	}
+	if input.Description != nil {
+		a.Description = input.Description
+	}
+	if input.RoutingConfig != nil {
+		a.AdditionalVersionWeights = routingWeights(input.RoutingConfig)
+	}
+	if err := s.validateAlias(&a); err != nil {
+		return nil, err
+	}
+	s.registry.RegisterAlias(&a)
+	return &a, nil
+}
+
+// ListAliases returns aliases of function sorted by name.
+// Marker is the name of the first alias in the next page.
+func (s *LambdaService) ListAliases(ctx context.Context, input *lambda.ListAliasesInput) (*lambda.ListAliasesOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	lf, err := s.getFunction(*input.FunctionName, nil)
+	if err != nil {
+		return nil, err
+	}
+	limit := maxItems(input.MaxItems)
+	marker := aws.StringValue(input.Marker)
+	version := aws.StringValue(input.FunctionVersion)
+	out := &lambda.ListAliasesOutput{
+		Aliases: []*lambda.AliasConfiguration{},
+	}
+	for _, a := range s.registry.Aliases(lf.FunctionName) {
+		if a.Name < marker || (version != "" && a.FunctionVersion != version) {
+			continue
+		}
+		if int64(len(out.Aliases)) == limit {
+			out.NextMarker = aws.String(a.Name)
+			break
+		}
+		out.Aliases = append(out.Aliases, a.Configuration())
+	}
+	return out, nil
+}
+
+// DeleteAlias removes alias of function.
+func (s *LambdaService) DeleteAlias(ctx context.Context, input *lambda.DeleteAliasInput) error {
+	if err := input.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, err := s.getAlias(*input.FunctionName, *input.Name)
+	if err != nil {
+		return err
+	}
+	s.registry.UnregisterAlias(a.FunctionName, a.Name)
+	return nil
+}
+
+// aliasesFor returns names of aliases routing to given version.
+func (s *LambdaService) aliasesFor(lf *LambdaFunction) []string {
+	var names []string
+	for _, a := range s.registry.Aliases(lf.FunctionName) {
+		if _, ok := a.AdditionalVersionWeights[lf.Version]; ok || a.FunctionVersion == lf.Version {
+			names = append(names, a.Name)
+		}
+	}
+	return names
+}
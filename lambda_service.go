@@ -7,42 +7,124 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/google/uuid"
 	"github.com/taiyoh/wheelamb/docker"
 )
 
+const (
+	defaultMemorySize int64 = 128
+	maxMemorySize     int64 = 3008
+	defaultTimeout    int64 = 3
+	maxTimeout        int64 = 900
+	// maxEnvironmentSize is the limit of total size of environment variables.
+	maxEnvironmentSize = 4 * 1024
+)
+
+// reservedEnvironmentKeys are set by runtime and cannot be overridden.
+// https://docs.aws.amazon.com/lambda/latest/dg/configuration-envvars.html#configuration-envvars-runtime
+var reservedEnvironmentKeys = map[string]struct{}{
+	"_HANDLER":                        {},
+	"_X_AMZN_TRACE_ID":                {},
+	"AWS_REGION":                      {},
+	"AWS_EXECUTION_ENV":               {},
+	"AWS_LAMBDA_FUNCTION_NAME":        {},
+	"AWS_LAMBDA_FUNCTION_MEMORY_SIZE": {},
+	"AWS_LAMBDA_FUNCTION_VERSION":     {},
+	"AWS_LAMBDA_LOG_GROUP_NAME":       {},
+	"AWS_LAMBDA_LOG_STREAM_NAME":      {},
+	"AWS_ACCESS_KEY_ID":               {},
+	"AWS_SECRET_ACCESS_KEY":           {},
+	"AWS_SESSION_TOKEN":               {},
+	"AWS_LAMBDA_RUNTIME_API":          {},
+	"LAMBDA_TASK_ROOT":                {},
+	"LAMBDA_RUNTIME_DIR":              {},
+}
+
+var environmentKeyPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]+$`)
+
+// environmentVariables returns validated environment variables as map.
+func environmentVariables(env *lambda.Environment) (map[string]string, error) {
+	envs := map[string]string{}
+	if env == nil {
+		return envs, nil
+	}
+	size := 0
+	for k, v := range env.Variables {
+		if !environmentKeyPattern.MatchString(k) {
+			return nil, awserr.New(lambda.ErrCodeInvalidParameterValueException, "invalid environment variable key: "+k, nil)
+		}
+		if _, ok := reservedEnvironmentKeys[k]; ok {
+			return nil, awserr.New(lambda.ErrCodeInvalidParameterValueException, "reserved environment variable key: "+k, nil)
+		}
+		envs[k] = aws.StringValue(v)
+		size += len(k) + len(envs[k])
+	}
+	if size > maxEnvironmentSize {
+		return nil, awserr.New(lambda.ErrCodeInvalidParameterValueException, "environment variables exceed 4KB", nil)
+	}
+	return envs, nil
+}
+
+func validateResources(memorySize, timeout int64) error {
+	if memorySize > maxMemorySize {
+		return awserr.New(lambda.ErrCodeInvalidParameterValueException, fmt.Sprintf("MemorySize must be less than or equal to %d", maxMemorySize), nil)
+	}
+	if timeout > maxTimeout {
+		return awserr.New(lambda.ErrCodeInvalidParameterValueException, fmt.Sprintf("Timeout must be less than or equal to %d", maxTimeout), nil)
+	}
+	return nil
+}
+
 // LambdaService provides interfaces for operationg lambda functions.
 type LambdaService struct {
 	docker   docker.Docker
 	dir      string
 	registry *LambdaRegistry
 	session  *session.Session
+	s3       s3iface.S3API
+	// mu serializes operations which replace or remove functions.
+	mu sync.Mutex
+	// draining tracks replaced containers waiting for invocations in progress.
+	draining sync.WaitGroup
 }
 
 // NewLambdaService returns LambdaService object.
 func NewLambdaService(docker docker.Docker, dir string, r *LambdaRegistry) *LambdaService {
+	sess := session.Must(session.NewSession(awsConf))
 	return &LambdaService{
 		dir:      dir,
 		docker:   docker,
 		registry: r,
-		session:  session.Must(session.NewSession(awsConf)),
+		session:  sess,
+		s3:       s3.New(sess, serviceConfig("s3").WithS3ForcePathStyle(true)),
 	}
 }
 
 // Close closes all lambda function containers.
 func (s *LambdaService) Close() error {
-	ids := make([]string, 0, len(s.registry.mapping))
-	for _, lf := range s.registry.mapping {
-		ids = append(ids, lf.inspect.ID)
+	s.draining.Wait()
+	var ids []string
+	for _, lf := range s.registry.List() {
+		for _, v := range s.registry.Versions(lf.FunctionName) {
+			ids = append(ids, v.inspect.ID)
+		}
 	}
 	return s.docker.KillMulti(context.Background(), ids)
 }
@@ -86,6 +168,67 @@ func putZippedCode(d, name string, zippedFile []byte) (size int64, err error) {
 	return
 }
 
+// codeSha256 returns base64 encoded sha256 digest of zipped code given as base64 text.
+func codeSha256(zippedFile []byte) string {
+	zipped, err := base64.StdEncoding.DecodeString(string(zippedFile))
+	if err != nil {
+		zipped = zippedFile
+	}
+	sum := sha256.Sum256(zipped)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func writeZippedCode(dir string, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+			_, err := zw.CreateHeader(header)
+			return err
+		}
+		header.Method = zip.Deflate
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(fw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// validateZippedCode checks whether given base64 text is readable as zip.
+func validateZippedCode(zippedFile []byte) error {
+	zipped, err := base64.StdEncoding.DecodeString(string(zippedFile))
+	if err != nil {
+		return awserr.New(lambda.ErrCodeInvalidZipFileException, "unable to decode from base64", err)
+	}
+	if _, err := zip.NewReader(bytes.NewReader(zipped), int64(len(zipped))); err != nil {
+		return awserr.New(lambda.ErrCodeInvalidZipFileException, "unable to read zip code", err)
+	}
+	return nil
+}
+
 func putZippedFile(f *zip.File, dest string) error {
 	rc, err := f.Open()
 	if err != nil {
@@ -114,71 +257,469 @@ func (s *LambdaService) Create(ctx context.Context, input *lambda.CreateFunction
 	if input.Code.ZipFile == nil {
 		return nil, awserr.New(lambda.ErrCodeInvalidZipFileException, "requires zipfile", nil)
 	}
-	name := *input.FunctionName
-	size, err := putZippedCode(s.dir, name, input.Code.ZipFile)
+	if input.MemorySize == nil {
+		input.MemorySize = aws.Int64(defaultMemorySize)
+	}
+	if input.Timeout == nil {
+		input.Timeout = aws.Int64(defaultTimeout)
+	}
+	if err := validateResources(*input.MemorySize, *input.Timeout); err != nil {
+		return nil, err
+	}
+	envs, err := environmentVariables(input.Environment)
 	if err != nil {
 		return nil, err
 	}
-	envs := map[string]string{}
-	if input.Environment != nil && input.Environment.Variables != nil {
-		for k, v := range input.Environment.Variables {
-			envs[k] = *v
-		}
+	name := *input.FunctionName
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.registry.Get(name) != nil {
+		return nil, awserr.New(lambda.ErrCodeResourceConflictException, "function already exist", nil)
 	}
-	inspect, err := s.docker.RunImage(ctx, docker.RunImageConfig{
-		Name:    "wheelamb-" + name,
-		Dir:     filepath.Join(s.dir, name),
-		Tag:     *input.Runtime,
-		Handler: *input.Handler,
-		Envs:    envs,
-	})
+	size, err := putZippedCode(s.dir, name, input.Code.ZipFile)
 	if err != nil {
-		return nil, awserr.New(lambda.ErrCodeServiceException, "failed to start container", err)
+		return nil, err
+	}
+	tags := map[string]string{}
+	for k, v := range input.Tags {
+		tags[k] = *v
 	}
-	sha256Sum := sha256.Sum256(input.Code.ZipFile)
 	lf := &LambdaFunction{
 		RevisionID:   uuid.New().String(),
-		Version:      "$LATEST",
-		CodeSha256:   string(sha256Sum[:]),
+		Version:      latestVersion,
+		CodeSha256:   codeSha256(input.Code.ZipFile),
 		LastModified: time.Now().UTC(),
 		FunctionName: name,
-		FunctionArn:  fmt.Sprintf("arn:aws:lambda:%s:000000000000:function:%s", *awsConf.Region, name),
+		FunctionArn:  functionARN(name),
 		MemorySize:   *input.MemorySize,
 		Handler:      *input.Handler,
 		Runtime:      *input.Runtime,
+		Role:         *input.Role,
 		Timeout:      *input.Timeout,
 		Description:  input.Description,
 		CodeSize:     size,
 		envs:         envs,
-		inspect:      inspect,
+		tags:         tags,
+		codeDir:      name,
+	}
+	if lf.inspect, err = s.runContainer(ctx, lf); err != nil {
+		// code is removed so that function can be created again.
+		os.RemoveAll(filepath.Join(s.dir, name))
+		return nil, err
 	}
 	s.registry.Register(lf)
 	return lf, nil
 }
 
-func (s *LambdaService) initCaller(name string) (*lambda.Lambda, error) {
-	lf := s.registry.Get(name)
+// runContainer starts container for given function.
+func (s *LambdaService) runContainer(ctx context.Context, lf *LambdaFunction) (*docker.ContainerInspect, error) {
+	inspect, err := s.docker.RunImage(ctx, docker.RunImageConfig{
+		Name:       "wheelamb-" + lf.FunctionName + "-" + lf.RevisionID[:8],
+		Dir:        filepath.Join(s.dir, lf.codeDir),
+		Tag:        lf.Runtime,
+		Handler:    lf.Handler,
+		Envs:       lf.envs,
+		MemorySize: lf.MemorySize,
+		Timeout:    lf.Timeout,
+	})
+	if err != nil {
+		return nil, awserr.New(lambda.ErrCodeServiceException, "failed to start container", err)
+	}
+	return inspect, nil
+}
+
+// retire closes container and removes code of replaced function after invocations in progress finished.
+// Container and code shared with the current function are kept.
+func (s *LambdaService) retire(old, current *LambdaFunction) {
+	s.draining.Add(1)
+	go func() {
+		defer s.draining.Done()
+		old.inflight.Wait()
+		if old.inspect != current.inspect {
+			s.docker.KillMulti(context.Background(), []string{old.inspect.ID})
+		}
+		if old.codeDir != current.codeDir {
+			os.RemoveAll(filepath.Join(s.dir, old.codeDir))
+		}
+	}()
+}
+
+// resolveName returns function name and qualifier from given function name or arn.
+// Qualifier in arn takes precedence over given qualifier.
+func resolveName(name string, qualifier *string) (string, string) {
+	q := aws.StringValue(qualifier)
+	if !strings.HasPrefix(name, "arn:") {
+		return name, q
+	}
+	n, arnQualifier, ok := parseFunctionARN(name)
+	if !ok {
+		return "", ""
+	}
+	if arnQualifier != "" {
+		q = arnQualifier
+	}
+	return n, q
+}
+
+// initCaller returns client for the container running function.
+// release must be called after invocation, so that the container is not closed while invoking.
+func (s *LambdaService) initCaller(name string, qualifier *string) (svc *lambda.Lambda, lf *LambdaFunction, release func(), err error) {
+	lf, release = s.registry.acquire(resolveName(name, qualifier))
 	if lf == nil {
-		return nil, awserr.New(lambda.ErrCodeResourceNotFoundException, "function not found", nil)
+		return nil, nil, nil, awserr.New(lambda.ErrCodeResourceNotFoundException, "function not found", nil)
 	}
-	conf := aws.NewConfig().WithEndpoint(fmt.Sprintf("http://%s", lf.inspect.Addr))
-	return lambda.New(s.session, conf), nil
+	// containers never verify signatures, so credentials are not required.
+	conf := aws.NewConfig().
+		WithEndpoint(fmt.Sprintf("http://%s", lf.inspect.Addr)).
+		WithCredentials(credentials.AnonymousCredentials)
+	return lambda.New(s.session, conf), lf, release, nil
 }
 
 // InvokeSync invokes lambda function with waiting response.
 func (s *LambdaService) InvokeSync(ctx context.Context, input *lambda.InvokeInput) (*lambda.InvokeOutput, error) {
-	svc, err := s.initCaller(*input.FunctionName)
+	svc, lf, release, err := s.initCaller(*input.FunctionName, input.Qualifier)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	// container runs only the resolved version.
+	in := *input
+	in.Qualifier = nil
+	out, err := svc.InvokeWithContext(ctx, &in)
 	if err != nil {
 		return nil, err
 	}
-	return svc.InvokeWithContext(ctx, input)
+	if out.ExecutedVersion == nil {
+		out.ExecutedVersion = aws.String(lf.Version)
+	}
+	return out, nil
 }
 
 // InvokeAsync invokes lambda function without waiting response.
 func (s *LambdaService) InvokeAsync(ctx context.Context, input *lambda.InvokeAsyncInput) (*lambda.InvokeAsyncOutput, error) {
-	svc, err := s.initCaller(*input.FunctionName)
+	svc, _, release, err := s.initCaller(*input.FunctionName, nil)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 	return svc.InvokeAsyncWithContext(ctx, input)
 }
+
+// getFunction returns LambdaFunction object from given name and qualifier.
+func (s *LambdaService) getFunction(name string, qualifier *string) (*LambdaFunction, error) {
+	n, q := resolveName(name, qualifier)
+	if s.registry.Get(n) == nil {
+		return nil, awserr.New(lambda.ErrCodeResourceNotFoundException, "function not found", nil)
+	}
+	lf := s.registry.GetVersion(n, q)
+	if lf == nil {
+		return nil, awserr.New(lambda.ErrCodeResourceNotFoundException, "function version not found", nil)
+	}
+	return lf, nil
+}
+
+// GetFunction returns function configuration, code location and tags.
+// Location of code is left empty, because it depends on how the code is served.
+func (s *LambdaService) GetFunction(ctx context.Context, input *lambda.GetFunctionInput) (*lambda.GetFunctionOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	lf, err := s.getFunction(*input.FunctionName, input.Qualifier)
+	if err != nil {
+		return nil, err
+	}
+	return &lambda.GetFunctionOutput{
+		Code: &lambda.FunctionCodeLocation{
+			RepositoryType: aws.String("S3"),
+		},
+		Configuration: lf.Configuration(),
+		Tags:          aws.StringMap(lf.tags),
+	}, nil
+}
+
+// GetFunctionConfiguration returns function configuration.
+func (s *LambdaService) GetFunctionConfiguration(ctx context.Context, input *lambda.GetFunctionConfigurationInput) (*lambda.FunctionConfiguration, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	lf, err := s.getFunction(*input.FunctionName, input.Qualifier)
+	if err != nil {
+		return nil, err
+	}
+	return lf.Configuration(), nil
+}
+
+const (
+	defaultListMaxItems int64 = 50
+	maxListMaxItems     int64 = 10000
+)
+
+// ListFunctions returns function configurations sorted by name.
+func (s *LambdaService) ListFunctions(ctx context.Context, input *lambda.ListFunctionsInput) (*lambda.ListFunctionsOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	list := s.registry.List()
+	if aws.StringValue(input.FunctionVersion) == lambda.FunctionVersionAll {
+		all := make([]*LambdaFunction, 0, len(list))
+		for _, lf := range list {
+			all = append(all, s.registry.Versions(lf.FunctionName)...)
+		}
+		list = all
+	}
+	out := &lambda.ListFunctionsOutput{
+		Functions: []*lambda.FunctionConfiguration{},
+	}
+	out.NextMarker = paginate(list, aws.StringValue(input.Marker), maxItems(input.MaxItems), func(lf *LambdaFunction) {
+		out.Functions = append(out.Functions, lf.Configuration())
+	})
+	return out, nil
+}
+
+// paginate calls fn for functions in the page from marker, and returns marker for the next page.
+// Marker is the qualified arn of the first function in the page.
+func paginate(list []*LambdaFunction, marker string, maxItems int64, fn func(*LambdaFunction)) *string {
+	started := marker == ""
+	var n int64
+	for _, lf := range list {
+		arn := qualifiedARN(lf)
+		if !started {
+			if arn != marker {
+				continue
+			}
+			started = true
+		}
+		if n == maxItems {
+			return aws.String(arn)
+		}
+		fn(lf)
+		n++
+	}
+	return nil
+}
+
+// qualifiedARN returns function arn with version.
+func qualifiedARN(lf *LambdaFunction) string {
+	return functionARN(lf.FunctionName) + ":" + lf.Version
+}
+
+// maxItems returns page size from given MaxItems.
+func maxItems(v *int64) int64 {
+	n := aws.Int64Value(v)
+	if n == 0 {
+		n = defaultListMaxItems
+	}
+	if n > maxListMaxItems {
+		n = maxListMaxItems
+	}
+	return n
+}
+
+// WriteCode writes zipped code of given function into w.
+func (s *LambdaService) WriteCode(ctx context.Context, name string, qualifier *string, w io.Writer) error {
+	lf, err := s.getFunction(name, qualifier)
+	if err != nil {
+		return err
+	}
+	if err := writeZippedCode(filepath.Join(s.dir, lf.codeDir), w); err != nil {
+		return awserr.New(lambda.ErrCodeServiceException, "failed to archive code", err)
+	}
+	return nil
+}
+
+// DeleteFunction kills container, removes code and unregisters function.
+func (s *LambdaService) DeleteFunction(ctx context.Context, input *lambda.DeleteFunctionInput) error {
+	if err := input.Validate(); err != nil {
+		return err
+	}
+	if aws.StringValue(input.Qualifier) == latestVersion {
+		return awserr.New(lambda.ErrCodeInvalidParameterValueException, "$LATEST version cannot be deleted without deleting the function", nil)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name, q := resolveName(*input.FunctionName, input.Qualifier)
+	if s.registry.GetAlias(name, q) != nil {
+		return awserr.New(lambda.ErrCodeInvalidParameterValueException, "alias cannot be deleted by DeleteFunction", nil)
+	}
+	lf, err := s.getFunction(*input.FunctionName, input.Qualifier)
+	if err != nil {
+		return err
+	}
+	if lf.Version != latestVersion {
+		if aliases := s.aliasesFor(lf); len(aliases) > 0 {
+			return awserr.New(lambda.ErrCodeResourceConflictException, fmt.Sprintf("version %s is used by aliases %v", lf.Version, aliases), nil)
+		}
+	}
+	targets := []*LambdaFunction{lf}
+	if lf.Version == latestVersion {
+		targets = s.registry.Versions(lf.FunctionName)
+	}
+	ids := make([]string, 0, len(targets))
+	for _, t := range targets {
+		ids = append(ids, t.inspect.ID)
+	}
+	if err := s.docker.KillMulti(ctx, ids); err != nil {
+		return awserr.New(lambda.ErrCodeServiceException, "failed to kill container", err)
+	}
+	for _, t := range targets {
+		if err := os.RemoveAll(filepath.Join(s.dir, t.codeDir)); err != nil {
+			return awserr.New(lambda.ErrCodeServiceException, "failed to remove code", err)
+		}
+	}
+	if lf.Version == latestVersion {
+		s.registry.Unregister(lf.FunctionName)
+	} else {
+		s.registry.unregisterVersion(lf.FunctionName, lf.Version)
+	}
+	return nil
+}
+
+// fetchCode returns zipped code as base64 text from given zip file or S3 object.
+func (s *LambdaService) fetchCode(ctx context.Context, zipFile []byte, bucket, key, version *string) ([]byte, error) {
+	if zipFile != nil {
+		return zipFile, nil
+	}
+	if bucket == nil || key == nil {
+		return nil, awserr.New(lambda.ErrCodeInvalidParameterValueException, "requires ZipFile or S3Bucket and S3Key", nil)
+	}
+	out, err := s.s3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket:    bucket,
+		Key:       key,
+		VersionId: version,
+	})
+	if err != nil {
+		return nil, awserr.New(lambda.ErrCodeInvalidParameterValueException, "error occurred while GetObject", err)
+	}
+	defer out.Body.Close()
+	zipped, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return nil, awserr.New(lambda.ErrCodeInvalidParameterValueException, "error occurred while GetObject", err)
+	}
+	return []byte(base64.StdEncoding.EncodeToString(zipped)), nil
+}
+
+// UpdateFunctionCode replaces code of function.
+// New code is extracted into fresh directory and new container is started for it,
+// then the old container is closed after invocations in progress finished.
+func (s *LambdaService) UpdateFunctionCode(ctx context.Context, input *lambda.UpdateFunctionCodeInput) (*LambdaFunction, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	zipFile, err := s.fetchCode(ctx, input.ZipFile, input.S3Bucket, input.S3Key, input.S3ObjectVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, err := s.getFunction(*input.FunctionName, nil)
+	if err != nil {
+		return nil, err
+	}
+	if rev := aws.StringValue(input.RevisionId); rev != "" && rev != old.RevisionID {
+		return nil, awserr.New(lambda.ErrCodePreconditionFailedException, "revision id does not match", nil)
+	}
+	if aws.BoolValue(input.DryRun) {
+		if err := validateZippedCode(zipFile); err != nil {
+			return nil, err
+		}
+		return old, nil
+	}
+
+	lf := *old
+	lf.RevisionID = uuid.New().String()
+	lf.codeDir = old.FunctionName + "." + lf.RevisionID[:8]
+	lf.inflight = nil
+	size, err := putZippedCode(s.dir, lf.codeDir, zipFile)
+	if err != nil {
+		return nil, err
+	}
+	if lf.inspect, err = s.runContainer(ctx, &lf); err != nil {
+		os.RemoveAll(filepath.Join(s.dir, lf.codeDir))
+		return nil, err
+	}
+	lf.CodeSize = size
+	lf.CodeSha256 = codeSha256(zipFile)
+	lf.LastModified = time.Now().UTC()
+	s.registry.Register(&lf)
+	s.retire(old, &lf)
+	if aws.BoolValue(input.Publish) {
+		return s.publishVersion(ctx, lf.FunctionName, nil, nil, nil)
+	}
+	return &lf, nil
+}
+
+// UpdateFunctionConfiguration updates settings of function.
+// Container is recreated when settings passed to it are changed.
+func (s *LambdaService) UpdateFunctionConfiguration(ctx context.Context, input *lambda.UpdateFunctionConfigurationInput) (*LambdaFunction, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	if input.Runtime != nil {
+		if _, ok := availableTags[*input.Runtime]; !ok {
+			return nil, awserr.New(lambda.ErrCodeInvalidRuntimeException, "invalid runtime", nil)
+		}
+	}
+	var envs map[string]string
+	if input.Environment != nil {
+		var err error
+		if envs, err = environmentVariables(input.Environment); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, err := s.getFunction(*input.FunctionName, nil)
+	if err != nil {
+		return nil, err
+	}
+	if rev := aws.StringValue(input.RevisionId); rev != "" && rev != old.RevisionID {
+		return nil, awserr.New(lambda.ErrCodePreconditionFailedException, "revision id does not match", nil)
+	}
+
+	lf := *old
+	restart := false
+	setString := func(dst *string, v *string) {
+		if v != nil && *v != *dst {
+			*dst = *v
+			restart = true
+		}
+	}
+	setInt64 := func(dst *int64, v *int64) {
+		if v != nil && *v != *dst {
+			*dst = *v
+			restart = true
+		}
+	}
+	setString(&lf.Handler, input.Handler)
+	setString(&lf.Runtime, input.Runtime)
+	setInt64(&lf.MemorySize, input.MemorySize)
+	setInt64(&lf.Timeout, input.Timeout)
+	if envs != nil && !reflect.DeepEqual(envs, old.envs) {
+		lf.envs = envs
+		restart = true
+	}
+	if input.Description != nil {
+		lf.Description = input.Description
+	}
+	if input.Role != nil {
+		lf.Role = *input.Role
+	}
+	if err := validateResources(lf.MemorySize, lf.Timeout); err != nil {
+		return nil, err
+	}
+	lf.RevisionID = uuid.New().String()
+	lf.LastModified = time.Now().UTC()
+	if restart {
+		lf.inflight = nil
+		if lf.inspect, err = s.runContainer(ctx, &lf); err != nil {
+			return nil, err
+		}
+	}
+	s.registry.Register(&lf)
+	if restart {
+		s.retire(old, &lf)
+	}
+	return &lf, nil
+}
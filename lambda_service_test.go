@@ -3,9 +3,11 @@ package wheelamb
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -96,6 +98,20 @@ func (m *dockerGatewayMock) KillMulti(context.Context, []string) error {
 	return nil
 }
 
+// failingDockerGatewayMock fails to run container for the first given times.
+type failingDockerGatewayMock struct {
+	dockerGatewayMock
+	failures int
+}
+
+func (m *failingDockerGatewayMock) RunImage(ctx context.Context, conf docker.RunImageConfig) (*docker.ContainerInspect, error) {
+	if m.failures > 0 {
+		m.failures--
+		return nil, errors.New("failed to run container")
+	}
+	return m.dockerGatewayMock.RunImage(ctx, conf)
+}
+
 func TestServiceCreate(t *testing.T) {
 	dir, err := ioutil.TempDir("", "")
 	if err != nil {
@@ -219,3 +235,611 @@ func TestServiceCreate(t *testing.T) {
 		}
 	})
 }
+
+func TestServiceCreateRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	reg := NewLambdaRegistry()
+	svc := NewLambdaService(&failingDockerGatewayMock{dockerGatewayMock{"foobar"}, 1}, dir, reg)
+	codeZipped, _ := ioutil.ReadFile(filepath.Join("testdata", "fake.zip"))
+	input := &lambda.CreateFunctionInput{
+		Code: &lambda.FunctionCode{
+			ZipFile: []byte(base64.StdEncoding.EncodeToString(codeZipped)),
+		},
+		FunctionName: aws.String("mytest"),
+		Handler:      aws.String("fake"),
+		Role:         aws.String("foobar"),
+		Runtime:      aws.String("go1.x"),
+	}
+	if _, err := svc.Create(context.Background(), input); err == nil {
+		t.Fatal("error should exist when container fails to run")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "mytest")); !os.IsNotExist(err) {
+		t.Errorf("code should be removed: %v", err)
+	}
+	if reg.Get("mytest") != nil {
+		t.Error("mytest should not be registered")
+	}
+	if _, err := svc.Create(context.Background(), input); err != nil {
+		t.Errorf("unexpected error captured: %#v", err)
+	}
+	if reg.Get("mytest") == nil {
+		t.Error("mytest not registered")
+	}
+}
+
+func TestServiceListFunctions(t *testing.T) {
+	reg := NewLambdaRegistry()
+	for _, name := range []string{"func-c", "func-a", "func-b"} {
+		reg.Register(&LambdaFunction{FunctionName: name, Version: "$LATEST"})
+	}
+	svc := NewLambdaService(&dockerGatewayMock{"foobar"}, "", reg)
+
+	var names []string
+	input := &lambda.ListFunctionsInput{MaxItems: aws.Int64(2)}
+	for i := 0; i < 3; i++ {
+		out, err := svc.ListFunctions(context.Background(), input)
+		if err != nil {
+			t.Fatalf("unexpected error captured: %#v", err)
+		}
+		for _, fn := range out.Functions {
+			names = append(names, *fn.FunctionName)
+		}
+		if out.NextMarker == nil {
+			break
+		}
+		input.Marker = out.NextMarker
+	}
+	if len(names) != 3 || names[0] != "func-a" || names[1] != "func-b" || names[2] != "func-c" {
+		t.Errorf("unexpected functions listed: %v", names)
+	}
+
+	if _, err := svc.GetFunctionConfiguration(context.Background(), &lambda.GetFunctionConfigurationInput{
+		FunctionName: aws.String("func-a"),
+		Qualifier:    aws.String("1"),
+	}); err == nil {
+		t.Error("error should exists for unknown qualifier")
+	}
+}
+
+func TestServiceDeleteFunction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	reg := NewLambdaRegistry()
+	svc := NewLambdaService(&dockerGatewayMock{"foobar"}, dir, reg)
+	msvc := NewSourceMappingService(svc)
+	codeZipped, _ := ioutil.ReadFile(filepath.Join("testdata", "fake.zip"))
+	lf, err := svc.Create(context.Background(), &lambda.CreateFunctionInput{
+		Code: &lambda.FunctionCode{
+			ZipFile: []byte(base64.StdEncoding.EncodeToString(codeZipped)),
+		},
+		FunctionName: aws.String("mytest"),
+		Handler:      aws.String("fake"),
+		Role:         aws.String("foobar"),
+		Runtime:      aws.String("go1.x"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	msvc.mappings["mapping-1"] = &eventSourceMapping{conf: &lambda.EventSourceMappingConfiguration{
+		FunctionArn: aws.String(lf.FunctionArn),
+	}}
+
+	if err := svc.DeleteFunction(context.Background(), &lambda.DeleteFunctionInput{
+		FunctionName: aws.String("mytest"),
+		Qualifier:    aws.String("$LATEST"),
+	}); err == nil {
+		t.Error("error should exists for deleting $LATEST")
+	}
+	if err := svc.DeleteFunction(context.Background(), &lambda.DeleteFunctionInput{
+		FunctionName: aws.String(lf.FunctionArn),
+	}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "mytest")); !os.IsNotExist(err) {
+		t.Errorf("code directory should be removed: %v", err)
+	}
+	if reg.Get("mytest") != nil {
+		t.Error("mytest should be unregistered")
+	}
+	if len(msvc.mappings) > 0 {
+		t.Errorf("mappings should be removed: %#v", msvc.mappings)
+	}
+	err = svc.DeleteFunction(context.Background(), &lambda.DeleteFunctionInput{
+		FunctionName: aws.String("mytest"),
+	})
+	if e, ok := err.(awserr.Error); !ok || e.Code() != lambda.ErrCodeResourceNotFoundException {
+		t.Errorf("unexpected error captured: %#v", err)
+	}
+}
+
+func TestServiceUpdateFunctionCode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	reg := NewLambdaRegistry()
+	svc := NewLambdaService(&dockerGatewayMock{"foobar"}, dir, reg)
+	codeZipped, _ := ioutil.ReadFile(filepath.Join("testdata", "fake.zip"))
+	zipFile := []byte(base64.StdEncoding.EncodeToString(codeZipped))
+	old, err := svc.Create(context.Background(), &lambda.CreateFunctionInput{
+		Code:         &lambda.FunctionCode{ZipFile: zipFile},
+		FunctionName: aws.String("mytest"),
+		Handler:      aws.String("fake"),
+		Role:         aws.String("foobar"),
+		Runtime:      aws.String("go1.x"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+
+	_, err = svc.UpdateFunctionCode(context.Background(), &lambda.UpdateFunctionCodeInput{
+		FunctionName: aws.String("mytest"),
+		ZipFile:      zipFile,
+		RevisionId:   aws.String("wrong-revision"),
+	})
+	if e, ok := err.(awserr.Error); !ok || e.Code() != lambda.ErrCodePreconditionFailedException {
+		t.Errorf("unexpected error captured: %#v", err)
+	}
+
+	dry, err := svc.UpdateFunctionCode(context.Background(), &lambda.UpdateFunctionCodeInput{
+		FunctionName: aws.String("mytest"),
+		ZipFile:      zipFile,
+		DryRun:       aws.Bool(true),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if dry != old {
+		t.Error("dry run should not replace function")
+	}
+
+	lf, err := svc.UpdateFunctionCode(context.Background(), &lambda.UpdateFunctionCodeInput{
+		FunctionName: aws.String("mytest"),
+		ZipFile:      zipFile,
+		RevisionId:   aws.String(old.RevisionID),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if lf.RevisionID == old.RevisionID {
+		t.Error("RevisionID should be renewed")
+	}
+	if lf.CodeSha256 != old.CodeSha256 || lf.CodeSize != old.CodeSize {
+		t.Errorf("code should be same: %s:%d != %s:%d", lf.CodeSha256, lf.CodeSize, old.CodeSha256, old.CodeSize)
+	}
+	if reg.Get("mytest") != lf {
+		t.Error("updated function should be registered")
+	}
+	if _, err := os.Stat(filepath.Join(dir, lf.codeDir, "fake")); err != nil {
+		t.Errorf("new code should be extracted: %v", err)
+	}
+	svc.Close()
+	if _, err := os.Stat(filepath.Join(dir, old.codeDir)); !os.IsNotExist(err) {
+		t.Errorf("old code should be removed: %v", err)
+	}
+}
+
+func TestServiceUpdateFunctionConfiguration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	reg := NewLambdaRegistry()
+	svc := NewLambdaService(&dockerGatewayMock{"foobar"}, dir, reg)
+	t.Cleanup(func() { svc.Close() })
+	codeZipped, _ := ioutil.ReadFile(filepath.Join("testdata", "fake.zip"))
+	old, err := svc.Create(context.Background(), &lambda.CreateFunctionInput{
+		Code: &lambda.FunctionCode{
+			ZipFile: []byte(base64.StdEncoding.EncodeToString(codeZipped)),
+		},
+		FunctionName: aws.String("mytest"),
+		Handler:      aws.String("fake"),
+		Role:         aws.String("foobar"),
+		Runtime:      aws.String("go1.x"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+
+	for _, tt := range []struct {
+		label    string
+		input    *lambda.UpdateFunctionConfigurationInput
+		expected string
+	}{
+		{
+			label: "invalid runtime",
+			input: &lambda.UpdateFunctionConfigurationInput{
+				Runtime: aws.String("go1.14"),
+			},
+			expected: lambda.ErrCodeInvalidRuntimeException,
+		},
+		{
+			label: "reserved environment variable",
+			input: &lambda.UpdateFunctionConfigurationInput{
+				Environment: &lambda.Environment{
+					Variables: map[string]*string{"AWS_REGION": aws.String("us-west-2")},
+				},
+			},
+			expected: lambda.ErrCodeInvalidParameterValueException,
+		},
+		{
+			label: "too large environment variables",
+			input: &lambda.UpdateFunctionConfigurationInput{
+				Environment: &lambda.Environment{
+					Variables: map[string]*string{"LARGE": aws.String(strings.Repeat("a", 4097))},
+				},
+			},
+			expected: lambda.ErrCodeInvalidParameterValueException,
+		},
+		{
+			label: "wrong revision",
+			input: &lambda.UpdateFunctionConfigurationInput{
+				Timeout:    aws.Int64(10),
+				RevisionId: aws.String("wrong-revision"),
+			},
+			expected: lambda.ErrCodePreconditionFailedException,
+		},
+	} {
+		t.Run(tt.label, func(t *testing.T) {
+			tt.input.FunctionName = aws.String("mytest")
+			_, err := svc.UpdateFunctionConfiguration(context.Background(), tt.input)
+			if e, ok := err.(awserr.Error); !ok || e.Code() != tt.expected {
+				t.Errorf("unexpected error captured: %#v", err)
+			}
+		})
+	}
+
+	lf, err := svc.UpdateFunctionConfiguration(context.Background(), &lambda.UpdateFunctionConfigurationInput{
+		FunctionName: aws.String("mytest"),
+		Description:  aws.String("only description"),
+		RevisionId:   aws.String(old.RevisionID),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if lf.RevisionID == old.RevisionID {
+		t.Error("RevisionID should be renewed")
+	}
+	if lf.inspect != old.inspect {
+		t.Error("container should not be recreated for description")
+	}
+
+	updated, err := svc.UpdateFunctionConfiguration(context.Background(), &lambda.UpdateFunctionConfigurationInput{
+		FunctionName: aws.String("mytest"),
+		Environment: &lambda.Environment{
+			Variables: map[string]*string{"hoge": aws.String("fuga")},
+		},
+		Timeout: aws.Int64(30),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if updated.inspect == lf.inspect {
+		t.Error("container should be recreated for environment")
+	}
+	if updated.Timeout != 30 || updated.envs["hoge"] != "fuga" || aws.StringValue(updated.Description) != "only description" {
+		t.Errorf("unexpected configuration: %#v", updated.Configuration())
+	}
+}
+
+func TestServicePublishVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	reg := NewLambdaRegistry()
+	svc := NewLambdaService(&dockerGatewayMock{"foobar"}, dir, reg)
+	t.Cleanup(func() { svc.Close() })
+	codeZipped, _ := ioutil.ReadFile(filepath.Join("testdata", "fake.zip"))
+	zipFile := []byte(base64.StdEncoding.EncodeToString(codeZipped))
+	if _, err := svc.Create(context.Background(), &lambda.CreateFunctionInput{
+		Code:         &lambda.FunctionCode{ZipFile: zipFile},
+		FunctionName: aws.String("mytest"),
+		Handler:      aws.String("fake"),
+		Role:         aws.String("foobar"),
+		Runtime:      aws.String("go1.x"),
+	}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+
+	v1, err := svc.PublishVersion(context.Background(), &lambda.PublishVersionInput{
+		FunctionName: aws.String("mytest"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if v1.Version != "1" || v1.FunctionArn != functionARN("mytest")+":1" {
+		t.Errorf("unexpected version: %s %s", v1.Version, v1.FunctionArn)
+	}
+	if _, err := os.Stat(filepath.Join(dir, v1.codeDir, "fake")); err != nil {
+		t.Errorf("code should be copied for version: %v", err)
+	}
+	same, err := svc.PublishVersion(context.Background(), &lambda.PublishVersionInput{
+		FunctionName: aws.String("mytest"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if same != v1 {
+		t.Error("publishing unchanged function should return the last version")
+	}
+
+	v2, err := svc.UpdateFunctionCode(context.Background(), &lambda.UpdateFunctionCodeInput{
+		FunctionName: aws.String("mytest"),
+		ZipFile:      zipFile,
+		Publish:      aws.Bool(true),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if v2.Version != "2" {
+		t.Errorf("Version: %s != 2", v2.Version)
+	}
+	if reg.GetFromARN(v1.FunctionArn) != v1 {
+		t.Error("qualified arn should return the version")
+	}
+
+	out, err := svc.ListVersionsByFunction(context.Background(), &lambda.ListVersionsByFunctionInput{
+		FunctionName: aws.String("mytest"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	var versions []string
+	for _, v := range out.Versions {
+		versions = append(versions, *v.Version)
+	}
+	if strings.Join(versions, ",") != "$LATEST,1,2" {
+		t.Errorf("unexpected versions: %v", versions)
+	}
+
+	if err := svc.DeleteFunction(context.Background(), &lambda.DeleteFunctionInput{
+		FunctionName: aws.String("mytest"),
+		Qualifier:    aws.String("1"),
+	}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if reg.GetVersion("mytest", "1") != nil {
+		t.Error("version 1 should be removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, v1.codeDir)); !os.IsNotExist(err) {
+		t.Errorf("code of version 1 should be removed: %v", err)
+	}
+	v3, err := svc.PublishVersion(context.Background(), &lambda.PublishVersionInput{
+		FunctionName: aws.String("mytest"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if v3 != v2 {
+		t.Error("publishing unchanged function should return the last version")
+	}
+}
+
+func TestServiceAlias(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	reg := NewLambdaRegistry()
+	svc := NewLambdaService(&dockerGatewayMock{"foobar"}, dir, reg)
+	t.Cleanup(func() { svc.Close() })
+	msvc := NewSourceMappingService(svc)
+	ctx := context.Background()
+	codeZipped, _ := ioutil.ReadFile(filepath.Join("testdata", "fake.zip"))
+	zipFile := []byte(base64.StdEncoding.EncodeToString(codeZipped))
+	if _, err := svc.Create(ctx, &lambda.CreateFunctionInput{
+		Code:         &lambda.FunctionCode{ZipFile: zipFile},
+		FunctionName: aws.String("mytest"),
+		Handler:      aws.String("fake"),
+		Role:         aws.String("foobar"),
+		Runtime:      aws.String("go1.x"),
+	}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	v1, _ := svc.PublishVersion(ctx, &lambda.PublishVersionInput{FunctionName: aws.String("mytest")})
+	v2, err := svc.UpdateFunctionCode(ctx, &lambda.UpdateFunctionCodeInput{
+		FunctionName: aws.String("mytest"),
+		ZipFile:      zipFile,
+		Publish:      aws.Bool(true),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+
+	for _, tt := range []struct {
+		label    string
+		input    *lambda.CreateAliasInput
+		expected string
+	}{
+		{
+			label:    "numeric name",
+			input:    &lambda.CreateAliasInput{Name: aws.String("1"), FunctionVersion: aws.String("1")},
+			expected: lambda.ErrCodeInvalidParameterValueException,
+		},
+		{
+			label:    "unknown version",
+			input:    &lambda.CreateAliasInput{Name: aws.String("live"), FunctionVersion: aws.String("3")},
+			expected: lambda.ErrCodeResourceNotFoundException,
+		},
+		{
+			label: "routing from $LATEST",
+			input: &lambda.CreateAliasInput{
+				Name:            aws.String("live"),
+				FunctionVersion: aws.String("$LATEST"),
+				RoutingConfig: &lambda.AliasRoutingConfiguration{
+					AdditionalVersionWeights: map[string]*float64{"2": aws.Float64(0.3)},
+				},
+			},
+			expected: lambda.ErrCodeInvalidParameterValueException,
+		},
+	} {
+		t.Run(tt.label, func(t *testing.T) {
+			tt.input.FunctionName = aws.String("mytest")
+			_, err := svc.CreateAlias(ctx, tt.input)
+			if e, ok := err.(awserr.Error); !ok || e.Code() != tt.expected {
+				t.Errorf("unexpected error captured: %#v", err)
+			}
+		})
+	}
+
+	a, err := svc.CreateAlias(ctx, &lambda.CreateAliasInput{
+		FunctionName:    aws.String("mytest"),
+		Name:            aws.String("live"),
+		FunctionVersion: aws.String("1"),
+		RoutingConfig: &lambda.AliasRoutingConfiguration{
+			AdditionalVersionWeights: map[string]*float64{"2": aws.Float64(0.3)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if reg.GetFromARN(a.AliasArn()) != v1 {
+		t.Error("alias arn should return primary version")
+	}
+	for _, tt := range []struct {
+		random   float64
+		expected *LambdaFunction
+	}{
+		{0.1, v2},
+		{0.29, v2},
+		{0.3, v1},
+		{0.9, v1},
+	} {
+		reg.random = func() float64 { return tt.random }
+		lf, release := reg.acquire("mytest", "live")
+		release()
+		if lf != tt.expected {
+			t.Errorf("random %f routed to version %s", tt.random, lf.Version)
+		}
+	}
+
+	err = svc.DeleteFunction(ctx, &lambda.DeleteFunctionInput{
+		FunctionName: aws.String("mytest"),
+		Qualifier:    aws.String("2"),
+	})
+	if e, ok := err.(awserr.Error); !ok || e.Code() != lambda.ErrCodeResourceConflictException {
+		t.Errorf("unexpected error captured: %#v", err)
+	}
+
+	_, err = svc.UpdateAlias(ctx, &lambda.UpdateAliasInput{
+		FunctionName: aws.String("mytest"),
+		Name:         aws.String("live"),
+		RevisionId:   aws.String("wrong-revision"),
+	})
+	if e, ok := err.(awserr.Error); !ok || e.Code() != lambda.ErrCodePreconditionFailedException {
+		t.Errorf("unexpected error captured: %#v", err)
+	}
+	updated, err := svc.UpdateAlias(ctx, &lambda.UpdateAliasInput{
+		FunctionName:    aws.String("mytest"),
+		Name:            aws.String("live"),
+		FunctionVersion: aws.String("2"),
+		RoutingConfig:   &lambda.AliasRoutingConfiguration{},
+		RevisionId:      aws.String(a.RevisionID),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if len(updated.AdditionalVersionWeights) > 0 || reg.GetVersion("mytest", "live") != v2 {
+		t.Errorf("alias should point only version 2: %#v", updated.Configuration())
+	}
+
+	msvc.mappings["mapping-alias"] = &eventSourceMapping{conf: &lambda.EventSourceMappingConfiguration{
+		FunctionArn: aws.String(updated.AliasArn()),
+	}}
+	msvc.mappings["mapping-version"] = &eventSourceMapping{conf: &lambda.EventSourceMappingConfiguration{
+		FunctionArn: aws.String(v2.FunctionArn),
+	}}
+	if err := svc.DeleteAlias(ctx, &lambda.DeleteAliasInput{
+		FunctionName: aws.String("mytest"),
+		Name:         aws.String("live"),
+	}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	out, err := svc.ListAliases(ctx, &lambda.ListAliasesInput{FunctionName: aws.String("mytest")})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if len(out.Aliases) > 0 {
+		t.Errorf("aliases should be empty: %#v", out.Aliases)
+	}
+	if _, ok := msvc.mappings["mapping-version"]; len(msvc.mappings) != 1 || !ok {
+		t.Errorf("only mapping of alias should be removed: %#v", msvc.mappings)
+	}
+}
+
+func TestServiceFunctionURLConfig(t *testing.T) {
+	reg := NewLambdaRegistry()
+	reg.Register(&LambdaFunction{FunctionName: "mytest", FunctionArn: functionARN("mytest"), Version: latestVersion})
+	reg.registerVersion(&LambdaFunction{FunctionName: "mytest", FunctionArn: functionARN("mytest"), Version: "1"})
+	reg.RegisterAlias(&LambdaAlias{Name: "live", FunctionName: "mytest", FunctionVersion: "1"})
+	svc := NewLambdaService(&dockerGatewayMock{"foobar"}, "", reg)
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		label    string
+		input    *FunctionURLConfigInput
+		expected string
+	}{
+		{"unknown auth type", &FunctionURLConfigInput{FunctionName: "mytest", AuthType: "COGNITO"}, lambda.ErrCodeInvalidParameterValueException},
+		{"invalid cors method", &FunctionURLConfigInput{FunctionName: "mytest", AuthType: "NONE", Cors: &FunctionURLCors{AllowMethods: []string{"FETCH"}}}, lambda.ErrCodeInvalidParameterValueException},
+		{"too long max age", &FunctionURLConfigInput{FunctionName: "mytest", AuthType: "NONE", Cors: &FunctionURLCors{MaxAge: 86401}}, lambda.ErrCodeInvalidParameterValueException},
+		{"version", &FunctionURLConfigInput{FunctionName: "mytest", Qualifier: "1", AuthType: "NONE"}, lambda.ErrCodeInvalidParameterValueException},
+		{"unknown alias", &FunctionURLConfigInput{FunctionName: "mytest", Qualifier: "dev", AuthType: "NONE"}, lambda.ErrCodeResourceNotFoundException},
+		{"unknown function", &FunctionURLConfigInput{FunctionName: "missing", AuthType: "NONE"}, lambda.ErrCodeResourceNotFoundException},
+	} {
+		_, err := svc.CreateFunctionURLConfig(ctx, tt.input)
+		if e, ok := err.(awserr.Error); !ok || e.Code() != tt.expected {
+			t.Errorf("%s: unexpected error captured: %#v", tt.label, err)
+		}
+	}
+
+	latest, err := svc.CreateFunctionURLConfig(ctx, &FunctionURLConfigInput{FunctionName: functionARN("mytest"), AuthType: "NONE"})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	live, err := svc.CreateFunctionURLConfig(ctx, &FunctionURLConfigInput{FunctionName: "mytest", Qualifier: "live", AuthType: "AWS_IAM"})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if latest.FunctionName != "mytest" || latest.FunctionArn() != functionARN("mytest") || live.FunctionArn() != functionARN("mytest")+":live" ||
+		latest.URLID == live.URLID || !strings.HasPrefix(latest.FunctionURL(), "https://"+latest.URLID+".lambda-url.") {
+		t.Errorf("unexpected function URLs: %#v, %#v", latest, live)
+	}
+	if _, err := svc.CreateFunctionURLConfig(ctx, &FunctionURLConfigInput{FunctionName: "mytest", Qualifier: "$LATEST", AuthType: "NONE"}); err == nil {
+		t.Error("function URL of $LATEST should conflict with unqualified function")
+	}
+	if c, err := svc.GetFunctionURLConfig(ctx, "mytest", "live"); err != nil || c != live || svc.FunctionURLConfigByID(live.URLID) != live {
+		t.Errorf("unexpected function URL: %#v, %v", c, err)
+	}
+
+	if err := svc.DeleteAlias(ctx, &lambda.DeleteAliasInput{FunctionName: aws.String("mytest"), Name: aws.String("live")}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if svc.FunctionURLConfigByID(live.URLID) != nil {
+		t.Error("function URL of alias should be removed with alias")
+	}
+	if err := svc.DeleteFunctionURLConfig(ctx, "mytest", ""); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if _, err := svc.GetFunctionURLConfig(ctx, "mytest", ""); err == nil {
+		t.Error("function URL should be removed")
+	}
+}
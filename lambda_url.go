@@ -0,0 +1,206 @@
+package wheelamb
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/google/uuid"
+)
+
+// auth types of function URL.
+const (
+	FunctionURLAuthTypeNone   = "NONE"
+	FunctionURLAuthTypeAWSIAM = "AWS_IAM"
+)
+
+// maxCorsMaxAge is the maximum seconds of MaxAge in CORS settings of function URL.
+const maxCorsMaxAge = 86400
+
+// FunctionURLCors is CORS settings of function URL, which are applied to responses instead of function.
+type FunctionURLCors struct {
+	AllowCredentials bool
+	AllowHeaders     []string
+	AllowMethods     []string
+	AllowOrigins     []string
+	ExposeHeaders    []string
+	MaxAge           int64
+}
+
+// FunctionURLConfigInput is parameters of function URL, which aws-sdk-go does not define yet.
+// via https://docs.aws.amazon.com/lambda/latest/dg/API_CreateFunctionUrlConfig.html
+type FunctionURLConfigInput struct {
+	// FunctionName is name or arn of function.
+	FunctionName string
+	// Qualifier is alias name, and function URL of unqualified function is created when empty.
+	Qualifier string
+	// AuthType is NONE or AWS_IAM.
+	AuthType string
+	Cors     *FunctionURLCors
+}
+
+// FunctionURLConfig is function URL, which invokes function or its alias by HTTP requests.
+type FunctionURLConfig struct {
+	FunctionURLConfigInput
+	// URLID is the first label of host of function URL.
+	URLID            string
+	CreationTime     time.Time
+	LastModifiedTime time.Time
+}
+
+// FunctionArn returns arn of function, which is qualified by alias.
+func (c *FunctionURLConfig) FunctionArn() string {
+	if c.Qualifier == "" {
+		return functionARN(c.FunctionName)
+	}
+	return functionARN(c.FunctionName) + ":" + c.Qualifier
+}
+
+// FunctionURL returns URL of function, which is served by the endpoint given to SetFunctionURLEndpoint.
+func (c *FunctionURLConfig) FunctionURL() string {
+	return functionURL(c.URLID)
+}
+
+// GetURLConfig returns function URL of function or its alias.
+func (r *LambdaRegistry) GetURLConfig(name, qualifier string) *FunctionURLConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.urls[name][qualifier]
+}
+
+// URLConfigByID returns function URL from its id.
+func (r *LambdaRegistry) URLConfigByID(id string) *FunctionURLConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, urls := range r.urls {
+		for _, c := range urls {
+			if c.URLID == id {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// RegisterURLConfig sets FunctionURLConfig into registry.
+func (r *LambdaRegistry) RegisterURLConfig(c *FunctionURLConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.urls[c.FunctionName]; !ok {
+		r.urls[c.FunctionName] = make(map[string]*FunctionURLConfig)
+	}
+	r.urls[c.FunctionName][c.Qualifier] = c
+}
+
+// UnregisterURLConfig removes FunctionURLConfig from registry.
+func (r *LambdaRegistry) UnregisterURLConfig(name, qualifier string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.urls[name], qualifier)
+}
+
+var corsMethods = map[string]bool{
+	"*":                true,
+	http.MethodGet:     true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+}
+
+func validateCors(cors *FunctionURLCors) error {
+	if cors == nil {
+		return nil
+	}
+	for _, m := range cors.AllowMethods {
+		if !corsMethods[strings.ToUpper(m)] {
+			return awserr.New(lambda.ErrCodeInvalidParameterValueException, "invalid method of AllowMethods: "+m, nil)
+		}
+	}
+	if cors.MaxAge < 0 || cors.MaxAge > maxCorsMaxAge {
+		return awserr.New(lambda.ErrCodeInvalidParameterValueException, "MaxAge must be between 0 and 86400", nil)
+	}
+	return nil
+}
+
+// urlConfigTarget returns function name and qualifier of function URL, which must be alias or unqualified function.
+func (s *LambdaService) urlConfigTarget(name, qualifier string) (string, string, error) {
+	n, q := resolveName(name, &qualifier)
+	if q == latestVersion {
+		q = ""
+	}
+	if versionPattern.MatchString(q) {
+		return "", "", awserr.New(lambda.ErrCodeInvalidParameterValueException, "function URL of version is not supported, use alias instead", nil)
+	}
+	if s.registry.Get(n) == nil {
+		return "", "", awserr.New(lambda.ErrCodeResourceNotFoundException, "function not found", nil)
+	}
+	if q != "" && s.registry.GetAlias(n, q) == nil {
+		return "", "", awserr.New(lambda.ErrCodeResourceNotFoundException, "alias not found", nil)
+	}
+	return n, q, nil
+}
+
+// CreateFunctionURLConfig creates function URL of function or its alias.
+func (s *LambdaService) CreateFunctionURLConfig(ctx context.Context, input *FunctionURLConfigInput) (*FunctionURLConfig, error) {
+	if input.AuthType != FunctionURLAuthTypeNone && input.AuthType != FunctionURLAuthTypeAWSIAM {
+		return nil, awserr.New(lambda.ErrCodeInvalidParameterValueException, "AuthType must be NONE or AWS_IAM", nil)
+	}
+	if err := validateCors(input.Cors); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name, qualifier, err := s.urlConfigTarget(input.FunctionName, input.Qualifier)
+	if err != nil {
+		return nil, err
+	}
+	if s.registry.GetURLConfig(name, qualifier) != nil {
+		return nil, awserr.New(lambda.ErrCodeResourceConflictException, "function URL already exists", nil)
+	}
+	now := time.Now().UTC()
+	c := &FunctionURLConfig{
+		FunctionURLConfigInput: *input,
+		URLID:                  strings.ReplaceAll(uuid.New().String(), "-", ""),
+		CreationTime:           now,
+		LastModifiedTime:       now,
+	}
+	c.FunctionName, c.Qualifier = name, qualifier
+	s.registry.RegisterURLConfig(c)
+	return c, nil
+}
+
+// GetFunctionURLConfig returns function URL of function or its alias.
+func (s *LambdaService) GetFunctionURLConfig(ctx context.Context, name, qualifier string) (*FunctionURLConfig, error) {
+	n, q, err := s.urlConfigTarget(name, qualifier)
+	if err != nil {
+		return nil, err
+	}
+	c := s.registry.GetURLConfig(n, q)
+	if c == nil {
+		return nil, awserr.New(lambda.ErrCodeResourceNotFoundException, "function URL not found", nil)
+	}
+	return c, nil
+}
+
+// DeleteFunctionURLConfig removes function URL of function or its alias.
+func (s *LambdaService) DeleteFunctionURLConfig(ctx context.Context, name, qualifier string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.GetFunctionURLConfig(ctx, name, qualifier)
+	if err != nil {
+		return err
+	}
+	s.registry.UnregisterURLConfig(c.FunctionName, c.Qualifier)
+	return nil
+}
+
+// FunctionURLConfigByID returns function URL from its id, or nil when it is not found.
+func (s *LambdaService) FunctionURLConfigByID(id string) *FunctionURLConfig {
+	return s.registry.URLConfigByID(id)
+}
@@ -0,0 +1,114 @@
+package wheelamb
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/google/uuid"
+)
+
+// PublishVersion creates immutable version from current code and configuration of function.
+// Code is copied into its own directory and dedicated container is started for the version.
+// If nothing is changed since the last version, the last version is returned.
+func (s *LambdaService) PublishVersion(ctx context.Context, input *lambda.PublishVersionInput) (*LambdaFunction, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.publishVersion(ctx, *input.FunctionName, input.CodeSha256, input.RevisionId, input.Description)
+}
+
+func (s *LambdaService) publishVersion(ctx context.Context, name string, sha256, revisionID, description *string) (*LambdaFunction, error) {
+	latest, err := s.getFunction(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	if rev := aws.StringValue(revisionID); rev != "" && rev != latest.RevisionID {
+		return nil, awserr.New(lambda.ErrCodePreconditionFailedException, "revision id does not match", nil)
+	}
+	if sum := aws.StringValue(sha256); sum != "" && sum != latest.CodeSha256 {
+		return nil, awserr.New(lambda.ErrCodeInvalidParameterValueException, "CodeSha256 does not match", nil)
+	}
+	if last := s.registry.lastPublished(latest.FunctionName); last != nil && last.publishedFrom == latest.RevisionID {
+		return last, nil
+	}
+
+	v := *latest
+	v.Version = s.registry.nextVersion(latest.FunctionName)
+	v.FunctionArn = qualifiedARN(&v)
+	v.RevisionID = uuid.New().String()
+	v.LastModified = time.Now().UTC()
+	v.codeDir = latest.FunctionName + ".v" + v.Version
+	v.publishedFrom = latest.RevisionID
+	v.inflight = nil
+	if description != nil {
+		v.Description = description
+	}
+	if err := copyDir(filepath.Join(s.dir, latest.codeDir), filepath.Join(s.dir, v.codeDir)); err != nil {
+		os.RemoveAll(filepath.Join(s.dir, v.codeDir))
+		return nil, awserr.New(lambda.ErrCodeServiceException, "failed to copy code", err)
+	}
+	if v.inspect, err = s.runContainer(ctx, &v); err != nil {
+		os.RemoveAll(filepath.Join(s.dir, v.codeDir))
+		return nil, err
+	}
+	s.registry.registerVersion(&v)
+	return &v, nil
+}
+
+// ListVersionsByFunction returns configurations of $LATEST and published versions.
+func (s *LambdaService) ListVersionsByFunction(ctx context.Context, input *lambda.ListVersionsByFunctionInput) (*lambda.ListVersionsByFunctionOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	lf, err := s.getFunction(*input.FunctionName, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := &lambda.ListVersionsByFunctionOutput{
+		Versions: []*lambda.FunctionConfiguration{},
+	}
+	list := s.registry.Versions(lf.FunctionName)
+	out.NextMarker = paginate(list, aws.StringValue(input.Marker), maxItems(input.MaxItems), func(lf *LambdaFunction) {
+		out.Versions = append(out.Versions, lf.Configuration())
+	})
+	return out, nil
+}
+
+// copyDir copies files in src into newly created dst.
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode())
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
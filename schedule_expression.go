@@ -0,0 +1,306 @@
+package wheelamb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scheduleExpression computes fire times of schedule.
+type scheduleExpression interface {
+	// next returns the first fire time after given time, or zero time when schedule never fires again.
+	next(after time.Time) time.Time
+}
+
+// parseScheduleExpression parses rate(value unit) or cron(fields) expression.
+// Rate schedules fire at base and every interval after it, and cron schedules are evaluated in loc.
+func parseScheduleExpression(expr string, loc *time.Location, base time.Time) (scheduleExpression, error) {
+	switch {
+	case strings.HasPrefix(expr, "rate(") && strings.HasSuffix(expr, ")"):
+		return parseRateExpression(expr[len("rate("):len(expr)-1], base)
+	case strings.HasPrefix(expr, "cron(") && strings.HasSuffix(expr, ")"):
+		return parseCronExpression(expr[len("cron("):len(expr)-1], loc)
+	}
+	return nil, fmt.Errorf("expression must be rate(value unit) or cron(fields): %s", expr)
+}
+
+type rateExpression struct {
+	base     time.Time
+	interval time.Duration
+}
+
+var rateUnits = map[string]time.Duration{
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+}
+
+func parseRateExpression(s string, base time.Time) (*rateExpression, error) {
+	parts := strings.Fields(s)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("rate expression must be value and unit: %s", s)
+	}
+	n, err := strconv.Atoi(parts[0])
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("value of rate expression must be positive integer: %s", parts[0])
+	}
+	unit := parts[1]
+	// unit is singular for 1 and plural for others.
+	if n > 1 {
+		if !strings.HasSuffix(unit, "s") {
+			return nil, fmt.Errorf("unit of rate expression must be plural for value %d: %s", n, unit)
+		}
+		unit = strings.TrimSuffix(unit, "s")
+	}
+	d, ok := rateUnits[unit]
+	if !ok {
+		return nil, fmt.Errorf("unit of rate expression must be minute(s), hour(s) or day(s): %s", parts[1])
+	}
+	return &rateExpression{base: base, interval: time.Duration(n) * d}, nil
+}
+
+func (e *rateExpression) next(after time.Time) time.Time {
+	if after.Before(e.base) {
+		return e.base
+	}
+	n := after.Sub(e.base)/e.interval + 1
+	return e.base.Add(n * e.interval)
+}
+
+const (
+	cronMinYear = 1970
+	cronMaxYear = 2199
+)
+
+var (
+	cronMonthNames = []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+	cronDayNames   = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+)
+
+// cronField holds values which field of cron expression matches.
+type cronField struct {
+	min    int
+	values []bool
+}
+
+func (f *cronField) has(v int) bool {
+	i := v - f.min
+	return i >= 0 && i < len(f.values) && f.values[i]
+}
+
+type cronExpression struct {
+	minutes, hours, months, years *cronField
+	// day reports whether date matches day-of-month or day-of-week field.
+	day func(t time.Time) bool
+	loc *time.Location
+}
+
+// parseCronExpression parses six fields of minutes, hours, day-of-month, month, day-of-week and year.
+// Either day-of-month or day-of-week must be ?.
+func parseCronExpression(s string, loc *time.Location) (*cronExpression, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("cron expression must have 6 fields: %s", s)
+	}
+	e := &cronExpression{loc: loc}
+	var err error
+	if e.minutes, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minutes: %v", err)
+	}
+	if e.hours, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hours: %v", err)
+	}
+	if e.months, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, fmt.Errorf("month: %v", err)
+	}
+	if e.years, err = parseCronField(fields[5], cronMinYear, cronMaxYear, nil); err != nil {
+		return nil, fmt.Errorf("year: %v", err)
+	}
+	dom, dow := fields[2], fields[4]
+	switch {
+	case dom == "?" && dow != "?":
+		if e.day, err = parseDayOfWeek(dow); err != nil {
+			return nil, fmt.Errorf("day-of-week: %v", err)
+		}
+	case dom != "?" && dow == "?":
+		if e.day, err = parseDayOfMonth(dom); err != nil {
+			return nil, fmt.Errorf("day-of-month: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("either day-of-month or day-of-week must be ?: %s", s)
+	}
+	return e, nil
+}
+
+// parseCronValue parses number or name, where names start from min.
+func parseCronValue(s string, min, max int, names []string) (int, error) {
+	for i, name := range names {
+		if strings.EqualFold(s, name) {
+			return min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("value must be between %d and %d: %s", min, max, s)
+	}
+	return v, nil
+}
+
+// parseCronField parses comma separated list of *, value, range and increment such as 0/15 or 1-5/2.
+func parseCronField(s string, min, max int, names []string) (*cronField, error) {
+	f := &cronField{min: min, values: make([]bool, max-min+1)}
+	for _, part := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("increment must be positive integer: %s", part)
+			}
+			step, part = n, part[:i]
+		}
+		start, end := min, max
+		switch i := strings.Index(part, "-"); {
+		case part == "*":
+		case i >= 0:
+			var err error
+			if start, err = parseCronValue(part[:i], min, max, names); err != nil {
+				return nil, err
+			}
+			if end, err = parseCronValue(part[i+1:], min, max, names); err != nil {
+				return nil, err
+			}
+			if end < start {
+				return nil, fmt.Errorf("range must be ascending: %s", part)
+			}
+		default:
+			v, err := parseCronValue(part, min, max, names)
+			if err != nil {
+				return nil, err
+			}
+			start = v
+			// single value without increment matches only itself.
+			if step == 1 {
+				end = v
+			}
+		}
+		for v := start; v <= end; v += step {
+			f.values[v-min] = true
+		}
+	}
+	return f, nil
+}
+
+func lastDayOfMonth(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// nearestWeekday returns weekday nearest to given day in the same month.
+func nearestWeekday(t time.Time, day int) int {
+	last := lastDayOfMonth(t)
+	switch time.Date(t.Year(), t.Month(), day, 0, 0, 0, 0, time.UTC).Weekday() {
+	case time.Saturday:
+		if day == 1 {
+			return day + 2
+		}
+		return day - 1
+	case time.Sunday:
+		if day == last {
+			return day - 2
+		}
+		return day + 1
+	}
+	return day
+}
+
+// parseDayOfMonth parses day-of-month field, which also accepts L (last day), LW (last weekday) and nW (nearest weekday).
+func parseDayOfMonth(s string) (func(time.Time) bool, error) {
+	switch {
+	case s == "L":
+		return func(t time.Time) bool { return t.Day() == lastDayOfMonth(t) }, nil
+	case s == "LW":
+		return func(t time.Time) bool { return t.Day() == nearestWeekday(t, lastDayOfMonth(t)) }, nil
+	case strings.HasSuffix(s, "W"):
+		day, err := parseCronValue(strings.TrimSuffix(s, "W"), 1, 31, nil)
+		if err != nil {
+			return nil, err
+		}
+		return func(t time.Time) bool { return day <= lastDayOfMonth(t) && t.Day() == nearestWeekday(t, day) }, nil
+	}
+	f, err := parseCronField(s, 1, 31, nil)
+	if err != nil {
+		return nil, err
+	}
+	return func(t time.Time) bool { return f.has(t.Day()) }, nil
+}
+
+// parseDayOfWeek parses day-of-week field where 1 is SUN, which also accepts nL (last n-day of month) and n#k (k-th n-day of month).
+func parseDayOfWeek(s string) (func(time.Time) bool, error) {
+	weekday := func(t time.Time) int { return int(t.Weekday()) + 1 }
+	if s == "L" {
+		s = "7"
+	}
+	switch i := strings.Index(s, "#"); {
+	case i >= 0:
+		day, err := parseCronValue(s[:i], 1, 7, cronDayNames)
+		if err != nil {
+			return nil, err
+		}
+		nth, err := strconv.Atoi(s[i+1:])
+		if err != nil || nth < 1 || nth > 5 {
+			return nil, fmt.Errorf("n-th day of week must be between 1 and 5: %s", s)
+		}
+		return func(t time.Time) bool { return weekday(t) == day && (t.Day()-1)/7+1 == nth }, nil
+	case strings.HasSuffix(s, "L"):
+		day, err := parseCronValue(strings.TrimSuffix(s, "L"), 1, 7, cronDayNames)
+		if err != nil {
+			return nil, err
+		}
+		return func(t time.Time) bool { return weekday(t) == day && t.Day()+7 > lastDayOfMonth(t) }, nil
+	}
+	f, err := parseCronField(s, 1, 7, cronDayNames)
+	if err != nil {
+		return nil, err
+	}
+	return func(t time.Time) bool { return f.has(weekday(t)) }, nil
+}
+
+// repeated reports whether wall clock of t already appeared before, which happens when daylight saving time ends.
+func repeated(t time.Time) bool {
+	_, off := t.Zone()
+	_, prev := t.Add(-24 * time.Hour).Zone()
+	if prev <= off {
+		return false
+	}
+	earlier := t.Add(-time.Duration(prev-off) * time.Second)
+	return earlier.Hour() == t.Hour() && earlier.Minute() == t.Minute()
+}
+
+func (e *cronExpression) next(after time.Time) time.Time {
+	t := after.In(e.loc).Truncate(time.Minute).Add(time.Minute)
+	// forward moves t to u, which may not be after t around transition of daylight saving time.
+	forward := func(u time.Time, d time.Duration) time.Time {
+		if u.After(t) {
+			return u
+		}
+		return t.Add(d)
+	}
+	for t.Year() <= cronMaxYear {
+		y, m, d := t.Date()
+		switch {
+		case !e.years.has(y):
+			t = forward(time.Date(y+1, 1, 1, 0, 0, 0, 0, e.loc), time.Hour)
+		case !e.months.has(int(m)):
+			t = forward(time.Date(y, m+1, 1, 0, 0, 0, 0, e.loc), time.Hour)
+		case !e.day(t):
+			t = forward(time.Date(y, m, d+1, 0, 0, 0, 0, e.loc), time.Hour)
+		case !e.hours.has(t.Hour()):
+			t = forward(time.Date(y, m, d, t.Hour()+1, 0, 0, 0, e.loc), time.Minute)
+		case !e.minutes.has(t.Minute()) || repeated(t):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
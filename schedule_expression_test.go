@@ -0,0 +1,80 @@
+package wheelamb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleExpression(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2024, 1, 31, 10, 30, 15, 0, time.UTC)
+	for _, tt := range []struct {
+		expr     string
+		loc      *time.Location
+		after    time.Time
+		expected []string
+	}{
+		{"rate(1 minute)", time.UTC, base, []string{"2024-01-31T10:31:15Z", "2024-01-31T10:32:15Z"}},
+		{"rate(2 hours)", time.UTC, base.Add(-time.Hour), []string{"2024-01-31T10:30:15Z", "2024-01-31T12:30:15Z"}},
+		{"rate(3 days)", time.UTC, base.Add(24 * time.Hour), []string{"2024-02-03T10:30:15Z"}},
+		{"cron(0 12 * * ? *)", time.UTC, base, []string{"2024-01-31T12:00:00Z", "2024-02-01T12:00:00Z"}},
+		{"cron(0/15 * * * ? *)", time.UTC, base, []string{"2024-01-31T10:45:00Z", "2024-01-31T11:00:00Z"}},
+		{"cron(0 12 * * ? *)", tokyo, base, []string{"2024-02-01T03:00:00Z"}},
+		{"cron(0 9 ? * MON-FRI *)", time.UTC, base, []string{"2024-02-01T09:00:00Z", "2024-02-02T09:00:00Z", "2024-02-05T09:00:00Z"}},
+		{"cron(0 0 L * ? *)", time.UTC, base, []string{"2024-02-29T00:00:00Z", "2024-03-31T00:00:00Z"}},
+		{"cron(0 0 LW * ? *)", time.UTC, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), []string{"2024-03-29T00:00:00Z", "2024-04-30T00:00:00Z"}},
+		{"cron(0 0 1W * ? *)", time.UTC, time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC), []string{"2024-06-03T00:00:00Z"}},
+		{"cron(0 0 ? * 6#3 *)", time.UTC, base, []string{"2024-02-16T00:00:00Z", "2024-03-15T00:00:00Z"}},
+		{"cron(0 0 ? * 2L *)", time.UTC, base, []string{"2024-02-26T00:00:00Z"}},
+		{"cron(30 2 29 FEB ? 2025-2028)", time.UTC, base, []string{"2028-02-29T02:30:00Z"}},
+		{"cron(0 10 1,15 * ? 2024)", time.UTC, time.Date(2024, 12, 15, 10, 0, 0, 0, time.UTC), []string{}},
+		// 02:30 is skipped on the day daylight saving time starts.
+		{"cron(30 2 * * ? *)", newYork, time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC), []string{"2024-03-11T06:30:00Z", "2024-03-12T06:30:00Z"}},
+		{"cron(30 1 * * ? *)", newYork, time.Date(2024, 11, 2, 12, 0, 0, 0, time.UTC), []string{"2024-11-03T05:30:00Z", "2024-11-04T06:30:00Z"}},
+	} {
+		expr, err := parseScheduleExpression(tt.expr, tt.loc, base)
+		if err != nil {
+			t.Errorf("%s: unexpected error captured: %v", tt.expr, err)
+			continue
+		}
+		actual := []string{}
+		for at := expr.next(tt.after); !at.IsZero() && len(actual) < len(tt.expected); at = expr.next(at) {
+			actual = append(actual, at.UTC().Format(time.RFC3339))
+		}
+		if len(tt.expected) == 0 && !expr.next(tt.after).IsZero() {
+			t.Errorf("%s: schedule should end: %s", tt.expr, expr.next(tt.after))
+		}
+		for i := range tt.expected {
+			if i >= len(actual) || actual[i] != tt.expected[i] {
+				t.Errorf("%s: %v != %v", tt.expr, actual, tt.expected)
+				break
+			}
+		}
+	}
+
+	for _, expr := range []string{
+		"rate(1 minutes)",
+		"rate(5 minute)",
+		"rate(0 minutes)",
+		"rate(1 week)",
+		"cron(0 12 * * *)",
+		"cron(0 12 * * * *)",
+		"cron(0 12 ? * ? *)",
+		"cron(60 12 * * ? *)",
+		"cron(0 12 ? * 8 *)",
+		"cron(0 12 ? * MON#6 *)",
+		"cron(0 12 10-5 * ? *)",
+		"at(2024-01-01T00:00:00)",
+	} {
+		if _, err := parseScheduleExpression(expr, time.UTC, base); err == nil {
+			t.Errorf("%s: error should exist", expr)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package wheelamb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/google/uuid"
+)
+
+// error codes of EventBridge Scheduler API.
+const (
+	errCodeValidationException = "ValidationException"
+	errCodeConflictException   = "ConflictException"
+)
+
+// states of schedule.
+const (
+	ScheduleStateEnabled  = "ENABLED"
+	ScheduleStateDisabled = "DISABLED"
+)
+
+const defaultScheduleGroup = "default"
+
+var scheduleNamePattern = regexp.MustCompile(`^[0-9a-zA-Z_.-]{1,64}$`)
+
+// ScheduleTarget is function which schedule invokes.
+type ScheduleTarget struct {
+	// Arn is function arn. Function name is also accepted on creation.
+	Arn     string
+	RoleArn string
+	// Input is payload of invocation. Scheduled Event is sent when Input is nil.
+	Input *string
+}
+
+// ScheduleInput describes schedule to be created.
+type ScheduleInput struct {
+	Name string
+	// GroupName must be empty or default, as schedule groups are not supported.
+	GroupName string
+	// ScheduleExpression is rate(value unit) or cron(minutes hours day-of-month month day-of-week year).
+	ScheduleExpression string
+	// ScheduleExpressionTimezone is IANA time zone in which cron expression is evaluated, UTC by default.
+	ScheduleExpressionTimezone string
+	Description                string
+	// State is ENABLED by default.
+	State     string
+	StartDate *time.Time
+	EndDate   *time.Time
+	Target    ScheduleTarget
+}
+
+// Schedule is schedule which invokes function periodically.
+type Schedule struct {
+	ScheduleInput
+	Arn                  string
+	CreationDate         time.Time
+	LastModificationDate time.Time
+}
+
+type schedule struct {
+	conf Schedule
+	expr scheduleExpression
+	// stopped and timer are guarded by mu of Scheduler.
+	stopped bool
+	timer   func() bool
+}
+
+// next returns the first fire time after given time within StartDate and EndDate, or zero time when schedule ended.
+func (s *schedule) next(after time.Time) time.Time {
+	if start := s.conf.StartDate; start != nil && after.Before(*start) {
+		after = start.Add(-time.Nanosecond)
+	}
+	t := s.expr.next(after)
+	if end := s.conf.EndDate; end != nil && t.After(*end) {
+		return time.Time{}
+	}
+	return t
+}
+
+// Scheduler invokes functions with rate or cron expressions.
+type Scheduler struct {
+	lambda    invoker
+	clock     Clock
+	mu        sync.Mutex
+	schedules map[string]*schedule
+	// running tracks timers of schedules and invocations.
+	running sync.WaitGroup
+}
+
+// SchedulerOption is optional parameter of Scheduler.
+type SchedulerOption func(*Scheduler)
+
+// WithSchedulerClock makes Scheduler fire schedules by given clock instead of wall clock.
+func WithSchedulerClock(c Clock) SchedulerOption {
+	return func(s *Scheduler) {
+		s.clock = c
+	}
+}
+
+// NewScheduler returns Scheduler object which invokes functions of given LambdaService.
+func NewScheduler(svc *LambdaService, opts ...SchedulerOption) *Scheduler {
+	s := &Scheduler{
+		lambda:    svc,
+		clock:     systemClock{},
+		schedules: make(map[string]*schedule),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Close stops all schedules and waits for invocations in progress.
+func (s *Scheduler) Close() error {
+	s.mu.Lock()
+	for _, sch := range s.schedules {
+		s.stop(sch)
+	}
+	s.mu.Unlock()
+	s.running.Wait()
+	return nil
+}
+
+func scheduleARN(name string) string {
+	return fmt.Sprintf("arn:aws:scheduler:%s:%s:schedule/%s/%s", Region(), accountID, defaultScheduleGroup, name)
+}
+
+func validateScheduleGroup(group string) error {
+	if group != "" && group != defaultScheduleGroup {
+		return awserr.New(lambda.ErrCodeResourceNotFoundException, "Schedule group "+group+" does not exist.", nil)
+	}
+	return nil
+}
+
+// newSchedule validates input and returns schedule which is not started yet.
+func newSchedule(input *ScheduleInput, now time.Time) (*schedule, error) {
+	if !scheduleNamePattern.MatchString(input.Name) {
+		return nil, awserr.New(errCodeValidationException, "Name must be 1 to 64 characters of alphanumerics, hyphens, underscores and periods", nil)
+	}
+	if err := validateScheduleGroup(input.GroupName); err != nil {
+		return nil, err
+	}
+	conf := Schedule{ScheduleInput: *input, Arn: scheduleARN(input.Name), CreationDate: now, LastModificationDate: now}
+	conf.GroupName = defaultScheduleGroup
+	// pointers are copied, so that callers can not modify schedule.
+	if v := input.Target.Input; v != nil {
+		conf.Target.Input = aws.String(*v)
+	}
+	if v := input.StartDate; v != nil {
+		conf.StartDate = aws.Time(*v)
+	}
+	if v := input.EndDate; v != nil {
+		conf.EndDate = aws.Time(*v)
+	}
+	if conf.State == "" {
+		conf.State = ScheduleStateEnabled
+	}
+	if conf.State != ScheduleStateEnabled && conf.State != ScheduleStateDisabled {
+		return nil, awserr.New(errCodeValidationException, "State must be ENABLED or DISABLED", nil)
+	}
+	// function name is resolved to arn, so that schedules always show arn.
+	name, qualifier := resolveName(conf.Target.Arn, nil)
+	if name == "" {
+		return nil, awserr.New(errCodeValidationException, "Target must be lambda function: "+conf.Target.Arn, nil)
+	}
+	conf.Target.Arn = functionARN(name)
+	if qualifier != "" {
+		conf.Target.Arn += ":" + qualifier
+	}
+	if conf.Target.Input != nil && !json.Valid([]byte(*conf.Target.Input)) {
+		return nil, awserr.New(errCodeValidationException, "Input of target must be valid json", nil)
+	}
+	if conf.StartDate != nil && conf.EndDate != nil && !conf.EndDate.After(*conf.StartDate) {
+		return nil, awserr.New(errCodeValidationException, "EndDate must be after StartDate", nil)
+	}
+	loc := time.UTC
+	if tz := conf.ScheduleExpressionTimezone; tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, awserr.New(errCodeValidationException, "Invalid time zone: "+tz, err)
+		}
+		loc = l
+	} else {
+		conf.ScheduleExpressionTimezone = "UTC"
+	}
+	base := now
+	if conf.StartDate != nil {
+		base = *conf.StartDate
+	}
+	expr, err := parseScheduleExpression(conf.ScheduleExpression, loc, base)
+	if err != nil {
+		return nil, awserr.New(errCodeValidationException, "Invalid Schedule Expression "+conf.ScheduleExpression+": "+err.Error(), nil)
+	}
+	return &schedule{conf: conf, expr: expr}, nil
+}
+
+// CreateSchedule creates schedule, which starts immediately when it is enabled.
+func (s *Scheduler) CreateSchedule(ctx context.Context, input *ScheduleInput) (*Schedule, error) {
+	sch, err := newSchedule(input, s.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.schedules[sch.conf.Name]; ok {
+		return nil, awserr.New(errCodeConflictException, "Schedule "+sch.conf.Name+" already exists.", nil)
+	}
+	s.schedules[sch.conf.Name] = sch
+	if sch.conf.State == ScheduleStateEnabled {
+		s.arm(sch, s.clock.Now())
+	}
+	conf := sch.conf
+	return &conf, nil
+}
+
+func (s *Scheduler) getSchedule(name, group string) (*schedule, error) {
+	if err := validateScheduleGroup(group); err != nil {
+		return nil, err
+	}
+	sch, ok := s.schedules[name]
+	if !ok {
+		return nil, awserr.New(lambda.ErrCodeResourceNotFoundException, "Schedule "+name+" does not exist.", nil)
+	}
+	return sch, nil
+}
+
+// GetSchedule returns schedule of given name in group.
+func (s *Scheduler) GetSchedule(ctx context.Context, name, group string) (*Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sch, err := s.getSchedule(name, group)
+	if err != nil {
+		return nil, err
+	}
+	conf := sch.conf
+	return &conf, nil
+}
+
+// ListSchedules returns all schedules sorted by name.
+func (s *Scheduler) ListSchedules(ctx context.Context) []*Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*Schedule, 0, len(s.schedules))
+	for _, sch := range s.schedules {
+		conf := sch.conf
+		list = append(list, &conf)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// DeleteSchedule stops and deletes schedule. Invocations in progress are not cancelled.
+func (s *Scheduler) DeleteSchedule(ctx context.Context, name, group string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sch, err := s.getSchedule(name, group)
+	if err != nil {
+		return err
+	}
+	s.stop(sch)
+	delete(s.schedules, name)
+	return nil
+}
+
+// arm sets timer of schedule to the first fire time after given time, unless schedule ended.
+// The timer invokes target and arms the next one, until schedule is stopped.
+// It must be called with mu locked.
+func (s *Scheduler) arm(sch *schedule, after time.Time) {
+	at := sch.next(after)
+	if at.IsZero() {
+		return
+	}
+	s.running.Add(1)
+	sch.timer = s.clock.AfterFunc(at.Sub(s.clock.Now()), func() {
+		defer s.running.Done()
+		s.mu.Lock()
+		if sch.stopped {
+			s.mu.Unlock()
+			return
+		}
+		s.arm(sch, at)
+		s.mu.Unlock()
+		// invocation is done in the timer, so that VirtualClock.Advance returns after it.
+		s.invoke(sch.conf, at)
+	})
+}
+
+// stop cancels timer of schedule. It must be called with mu locked.
+func (s *Scheduler) stop(sch *schedule) {
+	sch.stopped = true
+	if sch.timer != nil && sch.timer() {
+		s.running.Done()
+	}
+}
+
+// invoke invokes target of schedule for given fire time, as asynchronous invocation does.
+func (s *Scheduler) invoke(conf Schedule, at time.Time) {
+	payload := []byte(aws.StringValue(conf.Target.Input))
+	if conf.Target.Input == nil {
+		var err error
+		payload, err = json.Marshal(&eventEnvelope{
+			Version:    "0",
+			ID:         uuid.New().String(),
+			DetailType: "Scheduled Event",
+			Source:     "aws.events",
+			Account:    accountID,
+			Time:       at.UTC().Format(time.RFC3339),
+			Region:     Region(),
+			Resources:  []string{conf.Arn},
+			Detail:     json.RawMessage(`{}`),
+		})
+		if err != nil {
+			log.Printf("schedule %s: %v", conf.Name, err)
+			return
+		}
+	}
+	invokeAsync(s.lambda, "schedule "+conf.Name, conf.Target.Arn, payload)
+}
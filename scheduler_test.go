@@ -0,0 +1,161 @@
+package wheelamb
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+func TestScheduler(t *testing.T) {
+	inv := &invokerMock{}
+	s := &Scheduler{lambda: inv, clock: systemClock{}, schedules: make(map[string]*schedule)}
+	t.Cleanup(func() { s.Close() })
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		label    string
+		input    *ScheduleInput
+		expected string
+	}{
+		{"invalid name", &ScheduleInput{Name: "my schedule", ScheduleExpression: "rate(1 minute)", Target: ScheduleTarget{Arn: "myfunc"}}, errCodeValidationException},
+		{"unknown group", &ScheduleInput{Name: "s", GroupName: "mygroup", ScheduleExpression: "rate(1 minute)", Target: ScheduleTarget{Arn: "myfunc"}}, lambda.ErrCodeResourceNotFoundException},
+		{"invalid expression", &ScheduleInput{Name: "s", ScheduleExpression: "rate(1 minutes)", Target: ScheduleTarget{Arn: "myfunc"}}, errCodeValidationException},
+		{"invalid time zone", &ScheduleInput{Name: "s", ScheduleExpression: "cron(0 12 * * ? *)", ScheduleExpressionTimezone: "Mars/Olympus", Target: ScheduleTarget{Arn: "myfunc"}}, errCodeValidationException},
+		{"invalid target", &ScheduleInput{Name: "s", ScheduleExpression: "rate(1 minute)", Target: ScheduleTarget{Arn: "arn:aws:sqs:us-east-1:000000000000:myqueue"}}, errCodeValidationException},
+		{"invalid input", &ScheduleInput{Name: "s", ScheduleExpression: "rate(1 minute)", Target: ScheduleTarget{Arn: "myfunc", Input: aws.String("{")}}, errCodeValidationException},
+		{"invalid state", &ScheduleInput{Name: "s", ScheduleExpression: "rate(1 minute)", State: "PAUSED", Target: ScheduleTarget{Arn: "myfunc"}}, errCodeValidationException},
+	} {
+		_, err := s.CreateSchedule(ctx, tt.input)
+		if e, ok := err.(awserr.Error); !ok || e.Code() != tt.expected {
+			t.Errorf("%s: unexpected error captured: %#v", tt.label, err)
+		}
+	}
+
+	// rate schedule fires first at StartDate.
+	start := time.Now().Add(50 * time.Millisecond)
+	sch, err := s.CreateSchedule(ctx, &ScheduleInput{
+		Name:               "every-minute",
+		ScheduleExpression: "rate(1 minute)",
+		StartDate:          &start,
+		Target:             ScheduleTarget{Arn: "myfunc"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if sch.Target.Arn != functionARN("myfunc") || sch.State != ScheduleStateEnabled || sch.ScheduleExpressionTimezone != "UTC" ||
+		sch.Arn != "arn:aws:scheduler:"+Region()+":"+AccountID()+":schedule/default/every-minute" {
+		t.Errorf("unexpected schedule: %#v", sch)
+	}
+	if _, err := s.CreateSchedule(ctx, &ScheduleInput{Name: "every-minute", ScheduleExpression: "rate(1 minute)", Target: ScheduleTarget{Arn: "myfunc"}}); err == nil || err.(awserr.Error).Code() != errCodeConflictException {
+		t.Errorf("unexpected error captured: %#v", err)
+	}
+	if _, err := s.CreateSchedule(ctx, &ScheduleInput{
+		Name:               "disabled",
+		ScheduleExpression: "rate(1 minute)",
+		State:              ScheduleStateDisabled,
+		StartDate:          &start,
+		Target:             ScheduleTarget{Arn: functionARN("myfunc"), Input: aws.String(`{"foo":"bar"}`)},
+	}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	waitFor(t, func() bool {
+		inv.mu.Lock()
+		defer inv.mu.Unlock()
+		return len(inv.payloads) == 1
+	})
+	var ev eventEnvelope
+	if err := json.Unmarshal(inv.payloads[0], &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.DetailType != "Scheduled Event" || ev.Source != "aws.events" || len(ev.Resources) != 1 || ev.Resources[0] != sch.Arn ||
+		ev.Time != start.UTC().Format(time.RFC3339) || string(ev.Detail) != "{}" {
+		t.Errorf("unexpected event: %s", inv.payloads[0])
+	}
+
+	if list := s.ListSchedules(ctx); len(list) != 2 || list[0].Name != "disabled" || list[1].Name != "every-minute" {
+		t.Errorf("unexpected schedules: %v", list)
+	}
+	if err := s.DeleteSchedule(ctx, "every-minute", ""); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if _, err := s.GetSchedule(ctx, "every-minute", "default"); err == nil || err.(awserr.Error).Code() != lambda.ErrCodeResourceNotFoundException {
+		t.Errorf("unexpected error captured: %#v", err)
+	}
+	got, err := s.GetSchedule(ctx, "disabled", "")
+	if err != nil || *got.Target.Input != `{"foo":"bar"}` {
+		t.Errorf("unexpected schedule: %#v, %v", got, err)
+	}
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if len(inv.payloads) != 1 {
+		t.Errorf("disabled schedule should not fire: %d", len(inv.payloads))
+	}
+}
+
+func TestSchedulerVirtualClock(t *testing.T) {
+	inv := &invokerMock{}
+	clock := NewVirtualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := &Scheduler{lambda: inv, clock: clock, schedules: make(map[string]*schedule)}
+	t.Cleanup(func() { s.Close() })
+	ctx := context.Background()
+
+	end := time.Date(2024, 1, 1, 18, 0, 0, 0, time.UTC)
+	for _, input := range []*ScheduleInput{
+		{Name: "noon", ScheduleExpression: "cron(0 12 * * ? *)", ScheduleExpressionTimezone: "Asia/Tokyo", Target: ScheduleTarget{Arn: "myfunc"}},
+		{Name: "six-hourly", ScheduleExpression: "rate(6 hours)", EndDate: &end, Target: ScheduleTarget{Arn: "myfunc"}},
+		{Name: "hourly", ScheduleExpression: "rate(1 hour)", Target: ScheduleTarget{Arn: "myfunc"}},
+	} {
+		if _, err := s.CreateSchedule(ctx, input); err != nil {
+			t.Fatalf("unexpected error captured: %#v", err)
+		}
+	}
+	// hourly is deleted before it fires.
+	if err := s.DeleteSchedule(ctx, "hourly", ""); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+
+	fired := func() []string {
+		inv.mu.Lock()
+		defer inv.mu.Unlock()
+		list := []string{}
+		for _, p := range inv.payloads {
+			var ev eventEnvelope
+			if err := json.Unmarshal(p, &ev); err != nil {
+				t.Fatal(err)
+			}
+			list = append(list, strings.TrimPrefix(ev.Resources[0], scheduleARN(""))+" "+ev.Time)
+		}
+		inv.payloads = nil
+		return list
+	}
+	for _, tt := range []struct {
+		advance  time.Duration
+		now      string
+		expected []string
+	}{
+		{time.Hour, "2024-01-01T01:00:00Z", []string{}},
+		{23 * time.Hour, "2024-01-02T00:00:00Z", []string{
+			"noon 2024-01-01T03:00:00Z",
+			"six-hourly 2024-01-01T06:00:00Z",
+			"six-hourly 2024-01-01T12:00:00Z",
+			"six-hourly 2024-01-01T18:00:00Z",
+		}},
+		{48 * time.Hour, "2024-01-04T00:00:00Z", []string{
+			"noon 2024-01-02T03:00:00Z",
+			"noon 2024-01-03T03:00:00Z",
+		}},
+	} {
+		if now := clock.Advance(tt.advance); now.Format(time.RFC3339) != tt.now {
+			t.Errorf("unexpected time: %s", now)
+		}
+		if actual := fired(); strings.Join(actual, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("advance %s: %v != %v", tt.advance, actual, tt.expected)
+		}
+	}
+}
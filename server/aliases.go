@@ -0,0 +1,90 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+// POST /2015-03-31/functions/{name}/aliases
+func (s *Server) createAlias(w http.ResponseWriter, r *http.Request, params []string) {
+	input := &lambda.CreateAliasInput{}
+	if err := readJSON(r, input); err != nil {
+		writeError(w, err)
+		return
+	}
+	input.FunctionName = aws.String(params[0])
+	a, err := s.lambda.CreateAlias(r.Context(), input)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, a.Configuration())
+}
+
+// GET /2015-03-31/functions/{name}/aliases
+func (s *Server) listAliases(w http.ResponseWriter, r *http.Request, params []string) {
+	marker, maxItems, err := pagination(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	input := &lambda.ListAliasesInput{
+		FunctionName: aws.String(params[0]),
+		Marker:       marker,
+		MaxItems:     maxItems,
+	}
+	if v := r.URL.Query().Get("FunctionVersion"); v != "" {
+		input.FunctionVersion = aws.String(v)
+	}
+	out, err := s.lambda.ListAliases(r.Context(), input)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// GET /2015-03-31/functions/{name}/aliases/{alias}
+func (s *Server) getAlias(w http.ResponseWriter, r *http.Request, params []string) {
+	a, err := s.lambda.GetAlias(r.Context(), &lambda.GetAliasInput{
+		FunctionName: aws.String(params[0]),
+		Name:         aws.String(params[1]),
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.Configuration())
+}
+
+// PUT /2015-03-31/functions/{name}/aliases/{alias}
+func (s *Server) updateAlias(w http.ResponseWriter, r *http.Request, params []string) {
+	input := &lambda.UpdateAliasInput{}
+	if err := readJSON(r, input); err != nil {
+		writeError(w, err)
+		return
+	}
+	input.FunctionName = aws.String(params[0])
+	input.Name = aws.String(params[1])
+	a, err := s.lambda.UpdateAlias(r.Context(), input)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.Configuration())
+}
+
+// DELETE /2015-03-31/functions/{name}/aliases/{alias}
+func (s *Server) deleteAlias(w http.ResponseWriter, r *http.Request, params []string) {
+	err := s.lambda.DeleteAlias(r.Context(), &lambda.DeleteAliasInput{
+		FunctionName: aws.String(params[0]),
+		Name:         aws.String(params[1]),
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
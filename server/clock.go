@@ -0,0 +1,45 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+// clockJSON is current time of virtual clock, which is formatted in RFC3339 for humans.
+type clockJSON struct {
+	Now *string
+}
+
+// advanceClockJSON is request to advance virtual clock by Duration such as "24h" or "90m".
+type advanceClockJSON struct {
+	Duration *string
+}
+
+func newClockJSON(now time.Time) *clockJSON {
+	return &clockJSON{Now: aws.String(now.UTC().Format(time.RFC3339Nano))}
+}
+
+// GET /_wheelamb/clock
+func (s *Server) getClock(w http.ResponseWriter, r *http.Request, _ []string) {
+	writeJSON(w, http.StatusOK, newClockJSON(s.clock.Now()))
+}
+
+// POST /_wheelamb/clock/advance
+// It responds after timers due until the new time have fired.
+func (s *Server) advanceClock(w http.ResponseWriter, r *http.Request, _ []string) {
+	var in advanceClockJSON
+	if err := readJSON(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+	d, err := time.ParseDuration(aws.StringValue(in.Duration))
+	if err != nil || d < 0 {
+		writeError(w, awserr.New(lambda.ErrCodeInvalidParameterValueException, "Duration must be non-negative duration such as 24h: "+aws.StringValue(in.Duration), nil))
+		return
+	}
+	writeJSON(w, http.StatusOK, newClockJSON(s.clock.Advance(d)))
+}
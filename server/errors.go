@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+const (
+	errCodeUnknownOperation = "UnknownOperationException"
+	errorTypeHeader         = "X-Amzn-ErrorType"
+	// error codes of EventBridge Scheduler API.
+	errCodeValidationException = "ValidationException"
+	errCodeConflictException   = "ConflictException"
+)
+
+// https://docs.aws.amazon.com/lambda/latest/dg/API_CreateFunction.html#API_CreateFunction_Errors
+var statusCodes = map[string]int{
+	lambda.ErrCodeCodeStorageExceededException:   http.StatusBadRequest,
+	lambda.ErrCodeInvalidParameterValueException: http.StatusBadRequest,
+	lambda.ErrCodeInvalidRequestContentException: http.StatusBadRequest,
+	lambda.ErrCodePolicyLengthExceededException:  http.StatusBadRequest,
+	lambda.ErrCodeResourceInUseException:         http.StatusBadRequest,
+	lambda.ErrCodeResourceNotFoundException:      http.StatusNotFound,
+	lambda.ErrCodeResourceConflictException:      http.StatusConflict,
+	lambda.ErrCodePreconditionFailedException:    http.StatusPreconditionFailed,
+	lambda.ErrCodeRequestTooLargeException:       http.StatusRequestEntityTooLarge,
+	lambda.ErrCodeUnsupportedMediaTypeException:  http.StatusUnsupportedMediaType,
+	lambda.ErrCodeTooManyRequestsException:       http.StatusTooManyRequests,
+	lambda.ErrCodeServiceException:               http.StatusInternalServerError,
+	lambda.ErrCodeInvalidRuntimeException:        http.StatusBadGateway,
+	lambda.ErrCodeInvalidZipFileException:        http.StatusBadGateway,
+	lambda.ErrCodeResourceNotReadyException:      http.StatusBadGateway,
+	errCodeUnknownOperation:                      http.StatusNotFound,
+	errCodeValidationException:                   http.StatusBadRequest,
+	errCodeConflictException:                     http.StatusConflict,
+}
+
+type errorResponse struct {
+	Type    string
+	Message string `json:"message"`
+}
+
+// writeError writes error as lambda REST API error response.
+// aws-sdk-go detects error code from X-Amzn-ErrorType header.
+func writeError(w http.ResponseWriter, err error) {
+	code, msg := lambda.ErrCodeServiceException, err.Error()
+	status := 0
+	switch e := err.(type) {
+	case request.ErrInvalidParams:
+		code, msg = lambda.ErrCodeInvalidParameterValueException, e.Message()
+	case awserr.Error:
+		code, msg = e.Code(), e.Message()
+		if orig := e.OrigErr(); orig != nil {
+			msg += ": " + orig.Error()
+		}
+		if rf, ok := e.(awserr.RequestFailure); ok {
+			status = rf.StatusCode()
+		}
+	}
+	if status == 0 {
+		s, ok := statusCodes[code]
+		if !ok {
+			s = http.StatusInternalServerError
+		}
+		status = s
+	}
+	typ := "User"
+	if status >= http.StatusInternalServerError {
+		typ = "Service"
+	}
+	w.Header().Set(errorTypeHeader, code)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Type: typ, Message: msg})
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+)
+
+const (
+	eventsTargetPrefix = "AWSEvents."
+	jsonContentType    = "application/x-amz-json-1.1"
+)
+
+// eventActions are EventBridge operations which server serves.
+var eventActions = map[string]bool{
+	"CreateEventBus":    true,
+	"DescribeEventBus":  true,
+	"DeleteEventBus":    true,
+	"ListEventBuses":    true,
+	"PutRule":           true,
+	"DescribeRule":      true,
+	"EnableRule":        true,
+	"DisableRule":       true,
+	"DeleteRule":        true,
+	"ListRules":         true,
+	"PutTargets":        true,
+	"RemoveTargets":     true,
+	"ListTargetsByRule": true,
+	"TestEventPattern":  true,
+	"PutEvents":         true,
+}
+
+// POST / with X-Amz-Target: AWSEvents.{Action}
+// EventBridge API uses json protocol, which dispatches operations by header instead of path.
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request, _ []string) {
+	target := r.Header.Get("X-Amz-Target")
+	action := strings.TrimPrefix(target, eventsTargetPrefix)
+	if !strings.HasPrefix(target, eventsTargetPrefix) || !eventActions[action] {
+		writeJSONError(w, awserr.New(errCodeUnknownOperation, "Unknown operation "+target, nil))
+		return
+	}
+
+	method := reflect.ValueOf(s.eventBuses).MethodByName(action)
+	input := reflect.New(method.Type().In(1).Elem())
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeJSONError(w, awserr.New(errCodeValidationException, "could not read request body", err))
+		return
+	}
+	if len(bytes.TrimSpace(b)) > 0 {
+		if err := jsonutil.UnmarshalJSON(input.Interface(), bytes.NewReader(b)); err != nil {
+			writeJSONError(w, awserr.New(errCodeValidationException, "could not parse request body into json", err))
+			return
+		}
+	}
+
+	res := method.Call([]reflect.Value{reflect.ValueOf(r.Context()), input})
+	if err, _ := res[1].Interface().(error); err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	body, err := jsonutil.BuildJSON(res[0].Interface())
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", jsonContentType)
+	w.Write(body)
+}
+
+// writeJSONError writes error in json protocol, where aws-sdk-go reads error code from __type.
+func writeJSONError(w http.ResponseWriter, err error) {
+	code, msg, status := eventbridge.ErrCodeInternalException, err.Error(), http.StatusInternalServerError
+	switch e := err.(type) {
+	case request.ErrInvalidParams:
+		code, msg, status = errCodeValidationException, e.Message(), http.StatusBadRequest
+	case awserr.Error:
+		code, msg, status = e.Code(), e.Message(), http.StatusBadRequest
+		if code == eventbridge.ErrCodeInternalException {
+			status = http.StatusInternalServerError
+		}
+	}
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"__type": code, "message": msg})
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := jsonutil.BuildJSON(v)
+	if err != nil {
+		writeError(w, awserr.New(lambda.ErrCodeServiceException, "failed to build response", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func readJSON(r *http.Request, v interface{}) error {
+	if err := jsonutil.UnmarshalJSON(v, r.Body); err != nil {
+		return awserr.New(lambda.ErrCodeInvalidRequestContentException, "could not parse request body into json", err)
+	}
+	return nil
+}
+
+// encodeZipFile returns zip file as base64 text.
+// ZipFile is decoded from base64 by jsonutil,
+// but LambdaService receives it as it is on the wire.
+func encodeZipFile(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return []byte(base64.StdEncoding.EncodeToString(b))
+}
+
+// POST /2015-03-31/functions
+func (s *Server) createFunction(w http.ResponseWriter, r *http.Request, _ []string) {
+	input := &lambda.CreateFunctionInput{}
+	if err := readJSON(r, input); err != nil {
+		writeError(w, err)
+		return
+	}
+	if input.Code != nil {
+		input.Code.ZipFile = encodeZipFile(input.Code.ZipFile)
+	}
+	lf, err := s.lambda.Create(r.Context(), input)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, lf.Configuration())
+}
+
+// pagination returns Marker and MaxItems from query.
+func pagination(r *http.Request) (marker *string, maxItems *int64, err error) {
+	q := r.URL.Query()
+	if v := q.Get("Marker"); v != "" {
+		marker = aws.String(v)
+	}
+	if v := q.Get("MaxItems"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, nil, awserr.New(lambda.ErrCodeInvalidParameterValueException, "MaxItems must be a number", err)
+		}
+		maxItems = aws.Int64(n)
+	}
+	return marker, maxItems, nil
+}
+
+// GET /2015-03-31/functions
+func (s *Server) listFunctions(w http.ResponseWriter, r *http.Request, _ []string) {
+	marker, maxItems, err := pagination(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	input := &lambda.ListFunctionsInput{
+		Marker:   marker,
+		MaxItems: maxItems,
+	}
+	if v := r.URL.Query().Get("FunctionVersion"); v != "" {
+		input.FunctionVersion = aws.String(v)
+	}
+	out, err := s.lambda.ListFunctions(r.Context(), input)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func qualifier(r *http.Request) *string {
+	if v := r.URL.Query().Get("Qualifier"); v != "" {
+		return aws.String(v)
+	}
+	return nil
+}
+
+// GET /2015-03-31/functions/{name}
+func (s *Server) getFunction(w http.ResponseWriter, r *http.Request, params []string) {
+	out, err := s.lambda.GetFunction(r.Context(), &lambda.GetFunctionInput{
+		FunctionName: aws.String(params[0]),
+		Qualifier:    qualifier(r),
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	loc := url.URL{
+		Scheme: "http",
+		Host:   r.Host,
+		Path:   "/2015-03-31/functions/" + *out.Configuration.FunctionName + "/code",
+	}
+	if q := aws.StringValue(out.Configuration.Version); q != "" {
+		loc.RawQuery = url.Values{"Qualifier": {q}}.Encode()
+	}
+	out.Code.Location = aws.String(loc.String())
+	writeJSON(w, http.StatusOK, out)
+}
+
+// PUT /2015-03-31/functions/{name}/code
+func (s *Server) updateFunctionCode(w http.ResponseWriter, r *http.Request, params []string) {
+	input := &lambda.UpdateFunctionCodeInput{}
+	if err := readJSON(r, input); err != nil {
+		writeError(w, err)
+		return
+	}
+	input.FunctionName = aws.String(params[0])
+	input.ZipFile = encodeZipFile(input.ZipFile)
+	lf, err := s.lambda.UpdateFunctionCode(r.Context(), input)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, lf.Configuration())
+}
+
+// DELETE /2015-03-31/functions/{name}
+func (s *Server) deleteFunction(w http.ResponseWriter, r *http.Request, params []string) {
+	err := s.lambda.DeleteFunction(r.Context(), &lambda.DeleteFunctionInput{
+		FunctionName: aws.String(params[0]),
+		Qualifier:    qualifier(r),
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /2015-03-31/functions/{name}/configuration
+func (s *Server) getFunctionConfiguration(w http.ResponseWriter, r *http.Request, params []string) {
+	out, err := s.lambda.GetFunctionConfiguration(r.Context(), &lambda.GetFunctionConfigurationInput{
+		FunctionName: aws.String(params[0]),
+		Qualifier:    qualifier(r),
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// PUT /2015-03-31/functions/{name}/configuration
+func (s *Server) updateFunctionConfiguration(w http.ResponseWriter, r *http.Request, params []string) {
+	input := &lambda.UpdateFunctionConfigurationInput{}
+	if err := readJSON(r, input); err != nil {
+		writeError(w, err)
+		return
+	}
+	input.FunctionName = aws.String(params[0])
+	lf, err := s.lambda.UpdateFunctionConfiguration(r.Context(), input)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, lf.Configuration())
+}
+
+// GET /2015-03-31/functions/{name}/code
+// This is not a lambda API, but the location GetFunction returns for downloading code.
+func (s *Server) getFunctionCode(w http.ResponseWriter, r *http.Request, params []string) {
+	buf := &bytes.Buffer{}
+	if err := s.lambda.WriteCode(r.Context(), params[0], qualifier(r), buf); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// POST /2015-03-31/functions/{name}/invocations
+func (s *Server) invoke(w http.ResponseWriter, r *http.Request, params []string) {
+	payload, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, awserr.New(lambda.ErrCodeInvalidRequestContentException, "failed to read payload", err))
+		return
+	}
+	input := &lambda.InvokeInput{
+		FunctionName: aws.String(params[0]),
+		Payload:      payload,
+	}
+	if v := r.Header.Get("X-Amz-Invocation-Type"); v != "" {
+		input.InvocationType = aws.String(v)
+	}
+	if v := r.Header.Get("X-Amz-Log-Type"); v != "" {
+		input.LogType = aws.String(v)
+	}
+	if v := r.Header.Get("X-Amz-Client-Context"); v != "" {
+		input.ClientContext = aws.String(v)
+	}
+	input.Qualifier = qualifier(r)
+	out, err := s.lambda.InvokeSync(r.Context(), input)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if out.FunctionError != nil {
+		w.Header().Set("X-Amz-Function-Error", *out.FunctionError)
+	}
+	if out.LogResult != nil {
+		w.Header().Set("X-Amz-Log-Result", *out.LogResult)
+	}
+	if out.ExecutedVersion != nil {
+		w.Header().Set("X-Amz-Executed-Version", *out.ExecutedVersion)
+	}
+	status := int(aws.Int64Value(out.StatusCode))
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out.Payload)
+}
+
+// POST /2014-11-13/functions/{name}/invoke-async
+func (s *Server) invokeAsync(w http.ResponseWriter, r *http.Request, params []string) {
+	args, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, awserr.New(lambda.ErrCodeInvalidRequestContentException, "failed to read payload", err))
+		return
+	}
+	out, err := s.lambda.InvokeAsync(r.Context(), &lambda.InvokeAsyncInput{
+		FunctionName: aws.String(params[0]),
+		InvokeArgs:   bytes.NewReader(args),
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	status := int(aws.Int64Value(out.Status))
+	if status == 0 {
+		status = http.StatusAccepted
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]int{"Status": status})
+}
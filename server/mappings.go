@@ -0,0 +1,203 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/taiyoh/wheelamb"
+)
+
+// mappingExtensions holds settings of event source mapping which lambda package of aws-sdk-go does not define yet.
+type mappingExtensions struct {
+	FunctionResponseTypes *[]string
+	FilterCriteria        *filterCriteria
+}
+
+type filterCriteria struct {
+	Filters []struct {
+		Pattern *string
+	}
+}
+
+// readMappingJSON reads request body into input, and returns options for settings which input does not define.
+func readMappingJSON(r *http.Request, input interface{}) ([]wheelamb.MappingOption, error) {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, awserr.New(lambda.ErrCodeInvalidRequestContentException, "could not read request body", err)
+	}
+	if err := jsonutil.UnmarshalJSON(input, bytes.NewReader(b)); err != nil {
+		return nil, awserr.New(lambda.ErrCodeInvalidRequestContentException, "could not parse request body into json", err)
+	}
+	var ext mappingExtensions
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &ext); err != nil {
+			return nil, awserr.New(lambda.ErrCodeInvalidRequestContentException, "could not parse request body into json", err)
+		}
+	}
+	var opts []wheelamb.MappingOption
+	if ext.FunctionResponseTypes != nil {
+		opts = append(opts, wheelamb.WithFunctionResponseTypes(*ext.FunctionResponseTypes))
+	}
+	if ext.FilterCriteria != nil {
+		patterns := make([]string, 0, len(ext.FilterCriteria.Filters))
+		for _, f := range ext.FilterCriteria.Filters {
+			if f.Pattern == nil {
+				return nil, awserr.New(lambda.ErrCodeInvalidParameterValueException, "Pattern of filter is required", nil)
+			}
+			patterns = append(patterns, *f.Pattern)
+		}
+		opts = append(opts, wheelamb.WithFilterCriteria(patterns))
+	}
+	return opts, nil
+}
+
+// mappingJSON builds mapping settings including FunctionResponseTypes and FilterCriteria.
+func (s *Server) mappingJSON(conf *lambda.EventSourceMappingConfiguration) (json.RawMessage, error) {
+	b, err := jsonutil.BuildJSON(conf)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	types := s.mappings.FunctionResponseTypes(aws.StringValue(conf.UUID))
+	if types == nil {
+		types = []string{}
+	}
+	if fields["FunctionResponseTypes"], err = json.Marshal(types); err != nil {
+		return nil, err
+	}
+	if patterns := s.mappings.FilterCriteria(aws.StringValue(conf.UUID)); len(patterns) > 0 {
+		var fc filterCriteria
+		for _, p := range patterns {
+			fc.Filters = append(fc.Filters, struct{ Pattern *string }{aws.String(p)})
+		}
+		if fields["FilterCriteria"], err = json.Marshal(fc); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(fields)
+}
+
+func (s *Server) writeMapping(w http.ResponseWriter, status int, conf *lambda.EventSourceMappingConfiguration) {
+	b, err := s.mappingJSON(conf)
+	if err != nil {
+		writeError(w, awserr.New(lambda.ErrCodeServiceException, "failed to build response", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// POST /2015-03-31/event-source-mappings
+func (s *Server) createEventSourceMapping(w http.ResponseWriter, r *http.Request, _ []string) {
+	input := &lambda.CreateEventSourceMappingInput{}
+	opts, err := readMappingJSON(r, input)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	conf, err := s.mappings.CreateEventSourceMapping(r.Context(), input, opts...)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeMapping(w, http.StatusAccepted, conf)
+}
+
+// GET /2015-03-31/event-source-mappings
+func (s *Server) listEventSourceMappings(w http.ResponseWriter, r *http.Request, _ []string) {
+	marker, maxItems, err := pagination(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	input := &lambda.ListEventSourceMappingsInput{
+		Marker:   marker,
+		MaxItems: maxItems,
+	}
+	q := r.URL.Query()
+	if v := q.Get("FunctionName"); v != "" {
+		input.FunctionName = aws.String(v)
+	}
+	if v := q.Get("EventSourceArn"); v != "" {
+		input.EventSourceArn = aws.String(v)
+	}
+	out, err := s.mappings.ListEventSourceMappings(r.Context(), input)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	res := struct {
+		EventSourceMappings []json.RawMessage
+		NextMarker          *string `json:",omitempty"`
+	}{
+		EventSourceMappings: make([]json.RawMessage, 0, len(out.EventSourceMappings)),
+		NextMarker:          out.NextMarker,
+	}
+	for _, conf := range out.EventSourceMappings {
+		b, err := s.mappingJSON(conf)
+		if err != nil {
+			writeError(w, awserr.New(lambda.ErrCodeServiceException, "failed to build response", err))
+			return
+		}
+		res.EventSourceMappings = append(res.EventSourceMappings, b)
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		writeError(w, awserr.New(lambda.ErrCodeServiceException, "failed to build response", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// GET /2015-03-31/event-source-mappings/{UUID}
+func (s *Server) getEventSourceMapping(w http.ResponseWriter, r *http.Request, params []string) {
+	conf, err := s.mappings.GetEventSourceMapping(r.Context(), &lambda.GetEventSourceMappingInput{
+		UUID: aws.String(params[0]),
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeMapping(w, http.StatusOK, conf)
+}
+
+// PUT /2015-03-31/event-source-mappings/{UUID}
+func (s *Server) updateEventSourceMapping(w http.ResponseWriter, r *http.Request, params []string) {
+	input := &lambda.UpdateEventSourceMappingInput{}
+	opts, err := readMappingJSON(r, input)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	input.UUID = aws.String(params[0])
+	conf, err := s.mappings.UpdateEventSourceMapping(r.Context(), input, opts...)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeMapping(w, http.StatusAccepted, conf)
+}
+
+// DELETE /2015-03-31/event-source-mappings/{UUID}
+func (s *Server) deleteEventSourceMapping(w http.ResponseWriter, r *http.Request, params []string) {
+	conf, err := s.mappings.DeleteEventSourceMapping(r.Context(), &lambda.DeleteEventSourceMappingInput{
+		UUID: aws.String(params[0]),
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeMapping(w, http.StatusAccepted, conf)
+}
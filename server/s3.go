@@ -0,0 +1,27 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/taiyoh/wheelamb"
+)
+
+// s3EventJSON is notification which S3 compatible stores such as MinIO send to webhook.
+type s3EventJSON struct {
+	Records []*wheelamb.S3EventRecord
+}
+
+// POST /_wheelamb/s3/events
+// It responds before functions are invoked, as S3 notifies asynchronously.
+func (s *Server) notifyBucketEvents(w http.ResponseWriter, r *http.Request, _ []string) {
+	var in s3EventJSON
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, awserr.New(lambda.ErrCodeInvalidRequestContentException, "could not parse request body into json", err))
+		return
+	}
+	s.buckets.Notify(in.Records)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/taiyoh/wheelamb"
+)
+
+// scheduleJSON is schedule of EventBridge Scheduler API, which aws-sdk-go does not define yet.
+type scheduleJSON struct {
+	Arn                        *string
+	Name                       *string
+	GroupName                  *string
+	ScheduleExpression         *string
+	ScheduleExpressionTimezone *string
+	Description                *string
+	State                      *string
+	StartDate                  *time.Time
+	EndDate                    *time.Time
+	CreationDate               *time.Time
+	LastModificationDate       *time.Time
+	Target                     *scheduleTargetJSON
+	FlexibleTimeWindow         *flexibleTimeWindowJSON
+}
+
+type scheduleTargetJSON struct {
+	Arn     *string
+	RoleArn *string
+	Input   *string
+}
+
+// flexibleTimeWindowJSON is accepted for compatibility, while schedules always fire on time.
+type flexibleTimeWindowJSON struct {
+	Mode                   *string
+	MaximumWindowInMinutes *int64
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
+
+func newScheduleJSON(sch *wheelamb.Schedule) *scheduleJSON {
+	return &scheduleJSON{
+		Arn:                        aws.String(sch.Arn),
+		Name:                       aws.String(sch.Name),
+		GroupName:                  aws.String(sch.GroupName),
+		ScheduleExpression:         aws.String(sch.ScheduleExpression),
+		ScheduleExpressionTimezone: aws.String(sch.ScheduleExpressionTimezone),
+		Description:                optionalString(sch.Description),
+		State:                      aws.String(sch.State),
+		StartDate:                  sch.StartDate,
+		EndDate:                    sch.EndDate,
+		CreationDate:               aws.Time(sch.CreationDate),
+		LastModificationDate:       aws.Time(sch.LastModificationDate),
+		Target: &scheduleTargetJSON{
+			Arn:     aws.String(sch.Target.Arn),
+			RoleArn: optionalString(sch.Target.RoleArn),
+			Input:   sch.Target.Input,
+		},
+		FlexibleTimeWindow: &flexibleTimeWindowJSON{Mode: aws.String("OFF")},
+	}
+}
+
+// POST /schedules/{Name}
+func (s *Server) createSchedule(w http.ResponseWriter, r *http.Request, params []string) {
+	var in scheduleJSON
+	if err := readJSON(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+	input := &wheelamb.ScheduleInput{
+		Name:                       params[0],
+		GroupName:                  aws.StringValue(in.GroupName),
+		ScheduleExpression:         aws.StringValue(in.ScheduleExpression),
+		ScheduleExpressionTimezone: aws.StringValue(in.ScheduleExpressionTimezone),
+		Description:                aws.StringValue(in.Description),
+		State:                      aws.StringValue(in.State),
+		StartDate:                  in.StartDate,
+		EndDate:                    in.EndDate,
+	}
+	if in.Target != nil {
+		input.Target = wheelamb.ScheduleTarget{
+			Arn:     aws.StringValue(in.Target.Arn),
+			RoleArn: aws.StringValue(in.Target.RoleArn),
+			Input:   in.Target.Input,
+		}
+	}
+	sch, err := s.scheduler.CreateSchedule(r.Context(), input)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, &struct{ ScheduleArn *string }{aws.String(sch.Arn)})
+}
+
+// GET /schedules/{Name}
+func (s *Server) getSchedule(w http.ResponseWriter, r *http.Request, params []string) {
+	sch, err := s.scheduler.GetSchedule(r.Context(), params[0], r.URL.Query().Get("groupName"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newScheduleJSON(sch))
+}
+
+// GET /schedules
+func (s *Server) listSchedules(w http.ResponseWriter, r *http.Request, _ []string) {
+	q := r.URL.Query()
+	max := 100
+	if v := q.Get("MaxResults"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			writeError(w, awserr.New(errCodeValidationException, "MaxResults must be between 1 and 100", nil))
+			return
+		}
+		max = n
+	}
+	out := struct {
+		Schedules []*scheduleJSON
+		NextToken *string
+	}{Schedules: []*scheduleJSON{}}
+	for _, sch := range s.scheduler.ListSchedules(r.Context()) {
+		if !strings.HasPrefix(sch.Name, q.Get("NamePrefix")) || sch.Name <= q.Get("NextToken") {
+			continue
+		}
+		if (q.Get("State") != "" && sch.State != q.Get("State")) || (q.Get("ScheduleGroup") != "" && sch.GroupName != q.Get("ScheduleGroup")) {
+			continue
+		}
+		if len(out.Schedules) == max {
+			out.NextToken = out.Schedules[max-1].Name
+			break
+		}
+		// summary of schedule has only arn of target.
+		summary := newScheduleJSON(sch)
+		summary.ScheduleExpression, summary.ScheduleExpressionTimezone, summary.Description = nil, nil, nil
+		summary.StartDate, summary.EndDate, summary.FlexibleTimeWindow = nil, nil, nil
+		summary.Target = &scheduleTargetJSON{Arn: summary.Target.Arn}
+		out.Schedules = append(out.Schedules, summary)
+	}
+	writeJSON(w, http.StatusOK, &out)
+}
+
+// DELETE /schedules/{Name}
+func (s *Server) deleteSchedule(w http.ResponseWriter, r *http.Request, params []string) {
+	if err := s.scheduler.DeleteSchedule(r.Context(), params[0], r.URL.Query().Get("groupName")); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, &struct{}{})
+}
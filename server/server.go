@@ -0,0 +1,156 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/google/uuid"
+	"github.com/taiyoh/wheelamb"
+)
+
+type handlerFunc func(http.ResponseWriter, *http.Request, []string)
+
+type route struct {
+	method  string
+	pattern *regexp.Regexp
+	handle  handlerFunc
+}
+
+// Server provides lambda compatible REST API over LambdaService.
+type Server struct {
+	lambda     *wheelamb.LambdaService
+	mappings   *wheelamb.SourceMappingService
+	scheduler  *wheelamb.Scheduler
+	eventBuses *wheelamb.EventBusService
+	buckets    *wheelamb.BucketNotificationService
+	clock      *wheelamb.VirtualClock
+	routes     []route
+}
+
+// Option configures Server.
+type Option func(*Server)
+
+// WithSourceMappingService enables event source mapping API.
+func WithSourceMappingService(msvc *wheelamb.SourceMappingService) Option {
+	return func(s *Server) {
+		s.mappings = msvc
+	}
+}
+
+// WithScheduler enables schedule API compatible with EventBridge Scheduler.
+func WithScheduler(sch *wheelamb.Scheduler) Option {
+	return func(s *Server) {
+		s.scheduler = sch
+	}
+}
+
+// WithEventBusService enables event bus API compatible with EventBridge.
+func WithEventBusService(ebs *wheelamb.EventBusService) Option {
+	return func(s *Server) {
+		s.eventBuses = ebs
+	}
+}
+
+// WithBucketNotificationService enables webhook which receives S3 event notifications of S3 compatible stores.
+func WithBucketNotificationService(bns *wheelamb.BucketNotificationService) Option {
+	return func(s *Server) {
+		s.buckets = bns
+	}
+}
+
+// WithVirtualClock enables admin API to read and advance given clock.
+func WithVirtualClock(c *wheelamb.VirtualClock) Option {
+	return func(s *Server) {
+		s.clock = c
+	}
+}
+
+// New returns Server object.
+func New(svc *wheelamb.LambdaService, opts ...Option) *Server {
+	s := &Server{
+		lambda: svc,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.handle(http.MethodPost, `/2015-03-31/functions/?`, s.createFunction)
+	s.handle(http.MethodGet, `/2015-03-31/functions/?`, s.listFunctions)
+	s.handle(http.MethodGet, `/2015-03-31/functions/([^/]+)/?`, s.getFunction)
+	s.handle(http.MethodDelete, `/2015-03-31/functions/([^/]+)/?`, s.deleteFunction)
+	s.handle(http.MethodGet, `/2015-03-31/functions/([^/]+)/configuration/?`, s.getFunctionConfiguration)
+	s.handle(http.MethodPut, `/2015-03-31/functions/([^/]+)/configuration/?`, s.updateFunctionConfiguration)
+	s.handle(http.MethodGet, `/2015-03-31/functions/([^/]+)/code/?`, s.getFunctionCode)
+	s.handle(http.MethodPut, `/2015-03-31/functions/([^/]+)/code/?`, s.updateFunctionCode)
+	s.handle(http.MethodPost, `/2015-03-31/functions/([^/]+)/versions/?`, s.publishVersion)
+	s.handle(http.MethodGet, `/2015-03-31/functions/([^/]+)/versions/?`, s.listVersionsByFunction)
+	s.handle(http.MethodPost, `/2015-03-31/functions/([^/]+)/aliases/?`, s.createAlias)
+	s.handle(http.MethodGet, `/2015-03-31/functions/([^/]+)/aliases/?`, s.listAliases)
+	s.handle(http.MethodGet, `/2015-03-31/functions/([^/]+)/aliases/([^/]+)/?`, s.getAlias)
+	s.handle(http.MethodPut, `/2015-03-31/functions/([^/]+)/aliases/([^/]+)/?`, s.updateAlias)
+	s.handle(http.MethodDelete, `/2015-03-31/functions/([^/]+)/aliases/([^/]+)/?`, s.deleteAlias)
+	s.handle(http.MethodPost, `/2021-10-31/functions/([^/]+)/url/?`, s.createFunctionURLConfig)
+	s.handle(http.MethodGet, `/2021-10-31/functions/([^/]+)/url/?`, s.getFunctionURLConfig)
+	s.handle(http.MethodDelete, `/2021-10-31/functions/([^/]+)/url/?`, s.deleteFunctionURLConfig)
+	s.handle(http.MethodPost, `/2015-03-31/functions/([^/]+)/invocations/?`, s.invoke)
+	s.handle(http.MethodPost, `/2014-11-13/functions/([^/]+)/invoke-async/?`, s.invokeAsync)
+	if s.mappings != nil {
+		s.handle(http.MethodPost, `/2015-03-31/event-source-mappings/?`, s.createEventSourceMapping)
+		s.handle(http.MethodGet, `/2015-03-31/event-source-mappings/?`, s.listEventSourceMappings)
+		s.handle(http.MethodGet, `/2015-03-31/event-source-mappings/([^/]+)/?`, s.getEventSourceMapping)
+		s.handle(http.MethodPut, `/2015-03-31/event-source-mappings/([^/]+)/?`, s.updateEventSourceMapping)
+		s.handle(http.MethodDelete, `/2015-03-31/event-source-mappings/([^/]+)/?`, s.deleteEventSourceMapping)
+	}
+	if s.scheduler != nil {
+		s.handle(http.MethodPost, `/schedules/([^/]+)/?`, s.createSchedule)
+		s.handle(http.MethodGet, `/schedules/?`, s.listSchedules)
+		s.handle(http.MethodGet, `/schedules/([^/]+)/?`, s.getSchedule)
+		s.handle(http.MethodDelete, `/schedules/([^/]+)/?`, s.deleteSchedule)
+	}
+	if s.eventBuses != nil {
+		s.handle(http.MethodPost, `/?`, s.serveEvents)
+	}
+	if s.buckets != nil {
+		s.handle(http.MethodPost, `/_wheelamb/s3/events/?`, s.notifyBucketEvents)
+	}
+	if s.clock != nil {
+		s.handle(http.MethodGet, `/_wheelamb/clock/?`, s.getClock)
+		s.handle(http.MethodPost, `/_wheelamb/clock/advance/?`, s.advanceClock)
+	}
+	return s
+}
+
+func (s *Server) handle(method, pattern string, fn handlerFunc) {
+	s.routes = append(s.routes, route{
+		method:  method,
+		pattern: regexp.MustCompile("^" + pattern + "$"),
+		handle:  fn,
+	})
+}
+
+// ServeHTTP dispatches request to the handler matched with method and path.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Amzn-RequestId", uuid.New().String())
+	path := r.URL.EscapedPath()
+	for _, rt := range s.routes {
+		if rt.method != r.Method {
+			continue
+		}
+		matches := rt.pattern.FindStringSubmatch(path)
+		if matches == nil {
+			continue
+		}
+		params := make([]string, 0, len(matches)-1)
+		for _, m := range matches[1:] {
+			p, err := url.PathUnescape(m)
+			if err != nil {
+				p = m
+			}
+			params = append(params, p)
+		}
+		rt.handle(w, r, params)
+		return
+	}
+	writeError(w, awserr.New(errCodeUnknownOperation, "unknown operation", nil))
+}
@@ -0,0 +1,594 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/taiyoh/wheelamb"
+	"github.com/taiyoh/wheelamb/docker"
+)
+
+type dockerGatewayMock struct {
+	addr string
+}
+
+func (m *dockerGatewayMock) RunImage(_ context.Context, conf docker.RunImageConfig) (*docker.ContainerInspect, error) {
+	return &docker.ContainerInspect{
+		ID:   conf.Name,
+		Addr: m.addr,
+	}, nil
+}
+
+func (m *dockerGatewayMock) KillMulti(context.Context, []string) error {
+	return nil
+}
+
+// newTestClient returns lambda client connected to wheelamb server backed by fake container.
+func newTestClient(t *testing.T) *lambda.Lambda {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	container := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/invocations") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) == `"fail"` {
+			w.Header().Set("X-Amz-Function-Error", "Unhandled")
+		}
+		w.Write([]byte(`{"echo":` + string(body) + `}`))
+	}))
+	t.Cleanup(container.Close)
+
+	svc := wheelamb.NewLambdaService(&dockerGatewayMock{
+		addr: strings.TrimPrefix(container.URL, "http://"),
+	}, dir, wheelamb.NewLambdaRegistry())
+	ts := httptest.NewServer(New(svc))
+	t.Cleanup(ts.Close)
+
+	sess := session.Must(session.NewSession(aws.NewConfig().
+		WithRegion("us-east-1").
+		WithEndpoint(ts.URL).
+		WithMaxRetries(0).
+		WithCredentials(credentials.NewStaticCredentials("dummy", "dummy", ""))))
+	return lambda.New(sess)
+}
+
+func TestServerCreateAndInvoke(t *testing.T) {
+	cli := newTestClient(t)
+	ctx := context.Background()
+	codeZipped, err := ioutil.ReadFile(filepath.Join("..", "testdata", "fake.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("function not found", func(t *testing.T) {
+		_, err := cli.InvokeWithContext(ctx, &lambda.InvokeInput{
+			FunctionName: aws.String("mytest"),
+			Payload:      []byte(`{}`),
+		})
+		e, ok := err.(awserr.RequestFailure)
+		if !ok {
+			t.Fatalf("unexpected error captured: %v", err)
+		}
+		if e.Code() != lambda.ErrCodeResourceNotFoundException {
+			t.Errorf("code: %s != %s", e.Code(), lambda.ErrCodeResourceNotFoundException)
+		}
+		if e.StatusCode() != http.StatusNotFound {
+			t.Errorf("status: %d != %d", e.StatusCode(), http.StatusNotFound)
+		}
+	})
+
+	t.Run("invalid zip file", func(t *testing.T) {
+		_, err := cli.CreateFunctionWithContext(ctx, &lambda.CreateFunctionInput{
+			Code:         &lambda.FunctionCode{ZipFile: []byte("aaaii")},
+			FunctionName: aws.String("broken"),
+			Handler:      aws.String("fake"),
+			Role:         aws.String("foobar"),
+			Runtime:      aws.String("go1.x"),
+		})
+		e, ok := err.(awserr.RequestFailure)
+		if !ok {
+			t.Fatalf("unexpected error captured: %v", err)
+		}
+		if e.Code() != lambda.ErrCodeInvalidZipFileException {
+			t.Errorf("code: %s != %s", e.Code(), lambda.ErrCodeInvalidZipFileException)
+		}
+		if e.StatusCode() != http.StatusBadGateway {
+			t.Errorf("status: %d != %d", e.StatusCode(), http.StatusBadGateway)
+		}
+	})
+
+	t.Run("create", func(t *testing.T) {
+		out, err := cli.CreateFunctionWithContext(ctx, &lambda.CreateFunctionInput{
+			Code:         &lambda.FunctionCode{ZipFile: codeZipped},
+			FunctionName: aws.String("mytest"),
+			Handler:      aws.String("fake"),
+			Role:         aws.String("foobar"),
+			Runtime:      aws.String("go1.x"),
+			Environment: &lambda.Environment{
+				Variables: map[string]*string{"hoge": aws.String("fuga")},
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error captured: %v", err)
+		}
+		if name := aws.StringValue(out.FunctionName); name != "mytest" {
+			t.Errorf("FunctionName: %s != mytest", name)
+		}
+		if v := aws.Int64Value(out.MemorySize); v != 128 {
+			t.Errorf("MemorySize: %d != 128", v)
+		}
+		if v := aws.Int64Value(out.CodeSize); v != int64(len(codeZipped)) {
+			t.Errorf("CodeSize: %d != %d", v, len(codeZipped))
+		}
+		if v := aws.StringValue(out.Environment.Variables["hoge"]); v != "fuga" {
+			t.Errorf("env hoge: %s != fuga", v)
+		}
+	})
+
+	t.Run("get function", func(t *testing.T) {
+		out, err := cli.GetFunctionWithContext(ctx, &lambda.GetFunctionInput{
+			FunctionName: aws.String("mytest"),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error captured: %v", err)
+		}
+		if name := aws.StringValue(out.Configuration.FunctionName); name != "mytest" {
+			t.Errorf("FunctionName: %s != mytest", name)
+		}
+		resp, err := http.Get(aws.StringValue(out.Code.Location))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("code location status: %d", resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/zip" {
+			t.Errorf("code location content-type: %s", ct)
+		}
+	})
+
+	t.Run("invoke", func(t *testing.T) {
+		out, err := cli.InvokeWithContext(ctx, &lambda.InvokeInput{
+			FunctionName: aws.String("mytest"),
+			Payload:      []byte(`"hello"`),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error captured: %v", err)
+		}
+		if p := string(out.Payload); p != `{"echo":"hello"}` {
+			t.Errorf("payload: %s", p)
+		}
+		if out.FunctionError != nil {
+			t.Errorf("unexpected function error: %s", *out.FunctionError)
+		}
+	})
+
+	t.Run("invoke published version", func(t *testing.T) {
+		v, err := cli.PublishVersionWithContext(ctx, &lambda.PublishVersionInput{
+			FunctionName: aws.String("mytest"),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error captured: %v", err)
+		}
+		out, err := cli.InvokeWithContext(ctx, &lambda.InvokeInput{
+			FunctionName: v.FunctionArn,
+			Payload:      []byte(`"hello"`),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error captured: %v", err)
+		}
+		if ver := aws.StringValue(out.ExecutedVersion); ver != "1" {
+			t.Errorf("ExecutedVersion: %s != 1", ver)
+		}
+	})
+
+	t.Run("invoke with function error", func(t *testing.T) {
+		out, err := cli.InvokeWithContext(ctx, &lambda.InvokeInput{
+			FunctionName: aws.String("mytest"),
+			Payload:      []byte(`"fail"`),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error captured: %v", err)
+		}
+		if v := aws.StringValue(out.FunctionError); v != "Unhandled" {
+			t.Errorf("FunctionError: %s != Unhandled", v)
+		}
+	})
+}
+
+func TestServerSchedules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	svc := wheelamb.NewLambdaService(&dockerGatewayMock{}, dir, wheelamb.NewLambdaRegistry())
+	sch := wheelamb.NewScheduler(svc)
+	t.Cleanup(func() { sch.Close() })
+	ts := httptest.NewServer(New(svc, WithScheduler(sch)))
+	t.Cleanup(ts.Close)
+
+	request := func(method, path, body string) (int, map[string]interface{}) {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		out := map[string]interface{}{}
+		json.NewDecoder(res.Body).Decode(&out)
+		if code := res.Header.Get("X-Amzn-ErrorType"); code != "" {
+			out["code"] = code
+		}
+		return res.StatusCode, out
+	}
+
+	t.Run("create", func(t *testing.T) {
+		status, out := request(http.MethodPost, "/schedules/nightly", `{
+			"ScheduleExpression": "cron(0 3 * * ? *)",
+			"ScheduleExpressionTimezone": "Asia/Tokyo",
+			"FlexibleTimeWindow": {"Mode": "OFF"},
+			"Target": {"Arn": "arn:aws:lambda:us-east-1:000000000000:function:myfunc", "RoleArn": "arn:aws:iam::000000000000:role/scheduler", "Input": "{}"}
+		}`)
+		if status != http.StatusOK || out["ScheduleArn"] != "arn:aws:scheduler:us-east-1:000000000000:schedule/default/nightly" {
+			t.Errorf("unexpected response: %d %v", status, out)
+		}
+		status, out = request(http.MethodPost, "/schedules/nightly", `{"ScheduleExpression": "rate(1 hour)", "Target": {"Arn": "myfunc"}}`)
+		if status != http.StatusConflict || out["code"] != "ConflictException" {
+			t.Errorf("unexpected response: %d %v", status, out)
+		}
+		status, out = request(http.MethodPost, "/schedules/broken", `{"ScheduleExpression": "cron(0 3 * * * *)", "Target": {"Arn": "myfunc"}}`)
+		if status != http.StatusBadRequest || out["code"] != "ValidationException" {
+			t.Errorf("unexpected response: %d %v", status, out)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		status, out := request(http.MethodGet, "/schedules/nightly", "")
+		if status != http.StatusOK || out["ScheduleExpressionTimezone"] != "Asia/Tokyo" || out["State"] != "ENABLED" || out["GroupName"] != "default" {
+			t.Errorf("unexpected response: %d %v", status, out)
+		}
+		if _, ok := out["CreationDate"].(float64); !ok {
+			t.Errorf("CreationDate should be epoch seconds: %v", out["CreationDate"])
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		request(http.MethodPost, "/schedules/hourly", `{"ScheduleExpression": "rate(1 hour)", "State": "DISABLED", "Target": {"Arn": "myfunc"}}`)
+		status, out := request(http.MethodGet, "/schedules?MaxResults=1", "")
+		list, _ := out["Schedules"].([]interface{})
+		if status != http.StatusOK || len(list) != 1 || list[0].(map[string]interface{})["Name"] != "hourly" || out["NextToken"] != "hourly" {
+			t.Fatalf("unexpected response: %d %v", status, out)
+		}
+		_, out = request(http.MethodGet, "/schedules?NextToken=hourly", "")
+		if list, _ := out["Schedules"].([]interface{}); len(list) != 1 || list[0].(map[string]interface{})["Name"] != "nightly" || out["NextToken"] != nil {
+			t.Errorf("unexpected response: %v", out)
+		}
+		_, out = request(http.MethodGet, "/schedules?State=DISABLED", "")
+		if list, _ := out["Schedules"].([]interface{}); len(list) != 1 {
+			t.Errorf("unexpected response: %v", out)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if status, out := request(http.MethodDelete, "/schedules/nightly", ""); status != http.StatusOK {
+			t.Errorf("unexpected response: %d %v", status, out)
+		}
+		if status, out := request(http.MethodGet, "/schedules/nightly", ""); status != http.StatusNotFound {
+			t.Errorf("unexpected response: %d %v", status, out)
+		}
+	})
+}
+
+func TestServerClock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	svc := wheelamb.NewLambdaService(&dockerGatewayMock{}, dir, wheelamb.NewLambdaRegistry())
+	clock := wheelamb.NewVirtualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	ts := httptest.NewServer(New(svc, WithVirtualClock(clock)))
+	t.Cleanup(ts.Close)
+
+	for _, tt := range []struct {
+		method   string
+		path     string
+		body     string
+		status   int
+		expected string
+	}{
+		{http.MethodGet, "/_wheelamb/clock", "", http.StatusOK, "2024-01-01T00:00:00Z"},
+		{http.MethodPost, "/_wheelamb/clock/advance", `{"Duration": "24h30m"}`, http.StatusOK, "2024-01-02T00:30:00Z"},
+		{http.MethodPost, "/_wheelamb/clock/advance", `{"Duration": "-1h"}`, http.StatusBadRequest, ""},
+		{http.MethodPost, "/_wheelamb/clock/advance", `{"Duration": "1 day"}`, http.StatusBadRequest, ""},
+		{http.MethodGet, "/_wheelamb/clock", "", http.StatusOK, "2024-01-02T00:30:00Z"},
+	} {
+		req, _ := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(tt.body))
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out struct{ Now string }
+		json.NewDecoder(res.Body).Decode(&out)
+		res.Body.Close()
+		if res.StatusCode != tt.status || out.Now != tt.expected {
+			t.Errorf("%s %s %s: unexpected response: %d %s", tt.method, tt.path, tt.body, res.StatusCode, out.Now)
+		}
+	}
+}
+
+func TestServerEventBus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	received := make(chan string, 10)
+	container := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- string(body)
+		w.Write([]byte(`null`))
+	}))
+	t.Cleanup(container.Close)
+	svc := wheelamb.NewLambdaService(&dockerGatewayMock{addr: strings.TrimPrefix(container.URL, "http://")}, dir, wheelamb.NewLambdaRegistry())
+	ebs := wheelamb.NewEventBusService(svc)
+	t.Cleanup(func() { ebs.Close() })
+	ts := httptest.NewServer(New(svc, WithEventBusService(ebs)))
+	t.Cleanup(ts.Close)
+	sess := session.Must(session.NewSession(aws.NewConfig().
+		WithRegion("us-east-1").
+		WithEndpoint(ts.URL).
+		WithMaxRetries(0).
+		WithCredentials(credentials.NewStaticCredentials("dummy", "dummy", ""))))
+	ctx := context.Background()
+
+	codeZipped, err := ioutil.ReadFile(filepath.Join("..", "testdata", "fake.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn, err := lambda.New(sess).CreateFunctionWithContext(ctx, &lambda.CreateFunctionInput{
+		Code:         &lambda.FunctionCode{ZipFile: codeZipped},
+		FunctionName: aws.String("myfunc"),
+		Handler:      aws.String("fake"),
+		Role:         aws.String("foobar"),
+		Runtime:      aws.String("go1.x"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %v", err)
+	}
+
+	cli := eventbridge.New(sess)
+	if _, err := cli.DescribeRuleWithContext(ctx, &eventbridge.DescribeRuleInput{Name: aws.String("unknown")}); err == nil || err.(awserr.Error).Code() != eventbridge.ErrCodeResourceNotFoundException {
+		t.Errorf("unexpected error captured: %v", err)
+	}
+	if _, err := cli.PutRuleWithContext(ctx, &eventbridge.PutRuleInput{Name: aws.String("r")}); err == nil || err.(awserr.Error).Code() != "ValidationException" {
+		t.Errorf("unexpected error captured: %v", err)
+	}
+	if _, err := cli.PutRuleWithContext(ctx, &eventbridge.PutRuleInput{
+		Name:         aws.String("signups"),
+		EventPattern: aws.String(`{"source":["users"],"detail-type":["Signed Up"]}`),
+	}); err != nil {
+		t.Fatalf("unexpected error captured: %v", err)
+	}
+	if out, err := cli.PutTargetsWithContext(ctx, &eventbridge.PutTargetsInput{
+		Rule: aws.String("signups"),
+		Targets: []*eventbridge.Target{{
+			Id:  aws.String("welcome"),
+			Arn: fn.FunctionArn,
+			InputTransformer: &eventbridge.InputTransformer{
+				InputPathsMap: map[string]*string{"user": aws.String("$.detail.user")},
+				InputTemplate: aws.String(`{"to": <user>}`),
+			},
+		}},
+	}); err != nil || *out.FailedEntryCount != 0 {
+		t.Fatalf("unexpected result: %v, %v", out, err)
+	}
+	out, err := cli.PutEventsWithContext(ctx, &eventbridge.PutEventsInput{Entries: []*eventbridge.PutEventsRequestEntry{
+		{Source: aws.String("users"), DetailType: aws.String("Signed Up"), Detail: aws.String(`{"user":"alice"}`)},
+		{Source: aws.String("users"), DetailType: aws.String("Signed Out"), Detail: aws.String(`{"user":"bob"}`)},
+	}})
+	if err != nil || *out.FailedEntryCount != 0 || len(out.Entries) != 2 {
+		t.Fatalf("unexpected result: %v, %v", out, err)
+	}
+	select {
+	case body := <-received:
+		if body != `{"to": "alice"}` {
+			t.Errorf("unexpected payload: %s", body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("function is not invoked")
+	}
+	ebs.Close()
+	if len(received) != 0 {
+		t.Errorf("unmatched event should not be delivered: %s", <-received)
+	}
+}
+
+func TestServerBucketNotifications(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	received := make(chan string, 10)
+	container := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- string(body)
+		w.Write([]byte(`null`))
+	}))
+	t.Cleanup(container.Close)
+	svc := wheelamb.NewLambdaService(&dockerGatewayMock{addr: strings.TrimPrefix(container.URL, "http://")}, dir, wheelamb.NewLambdaRegistry())
+	bns := wheelamb.NewBucketNotificationService(svc)
+	ts := httptest.NewServer(New(svc, WithBucketNotificationService(bns)))
+	t.Cleanup(ts.Close)
+	sess := session.Must(session.NewSession(aws.NewConfig().
+		WithRegion("us-east-1").
+		WithEndpoint(ts.URL).
+		WithMaxRetries(0).
+		WithCredentials(credentials.NewStaticCredentials("dummy", "dummy", ""))))
+	ctx := context.Background()
+
+	codeZipped, err := ioutil.ReadFile(filepath.Join("..", "testdata", "fake.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lambda.New(sess).CreateFunctionWithContext(ctx, &lambda.CreateFunctionInput{
+		Code:         &lambda.FunctionCode{ZipFile: codeZipped},
+		FunctionName: aws.String("resize"),
+		Handler:      aws.String("fake"),
+		Role:         aws.String("foobar"),
+		Runtime:      aws.String("go1.x"),
+	}); err != nil {
+		t.Fatalf("unexpected error captured: %v", err)
+	}
+	if _, err := bns.PutBucketNotificationConfiguration(ctx, &s3.PutBucketNotificationConfigurationInput{
+		Bucket: aws.String("images"),
+		NotificationConfiguration: &s3.NotificationConfiguration{LambdaFunctionConfigurations: []*s3.LambdaFunctionConfiguration{{
+			Id:                aws.String("thumbnails"),
+			LambdaFunctionArn: aws.String("resize"),
+			Events:            aws.StringSlice([]string{"s3:ObjectCreated:*"}),
+		}}},
+	}); err != nil {
+		t.Fatalf("unexpected error captured: %v", err)
+	}
+
+	// notification of MinIO webhook.
+	res, err := http.Post(ts.URL+"/_wheelamb/s3/events", "application/json", strings.NewReader(`{
+		"EventName": "s3:ObjectCreated:Put",
+		"Key": "images/cat.jpg",
+		"Records": [{
+			"eventVersion": "2.0",
+			"eventSource": "minio:s3",
+			"awsRegion": "",
+			"eventTime": "2024-01-01T00:00:00.000Z",
+			"eventName": "s3:ObjectCreated:Put",
+			"userIdentity": {"principalId": "minioadmin"},
+			"requestParameters": {"sourceIPAddress": "172.17.0.1"},
+			"responseElements": {"x-amz-request-id": "17A2B3C4D5E6F7A8"},
+			"s3": {
+				"s3SchemaVersion": "1.0",
+				"configurationId": "Config",
+				"bucket": {"name": "images", "ownerIdentity": {"principalId": "minioadmin"}, "arn": "arn:aws:s3:::images"},
+				"object": {"key": "cat.jpg", "size": 2048, "eTag": "d41d8cd98f00b204e9800998ecf8427e", "sequencer": "17A2B3C4D5E6F7A9"}
+			}
+		}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("unexpected status: %d", res.StatusCode)
+	}
+	select {
+	case body := <-received:
+		var ev struct{ Records []wheelamb.S3EventRecord }
+		if err := json.Unmarshal([]byte(body), &ev); err != nil {
+			t.Fatal(err)
+		}
+		if len(ev.Records) != 1 || ev.Records[0].EventName != "ObjectCreated:Put" || ev.Records[0].S3.ConfigurationID != "thumbnails" ||
+			ev.Records[0].S3.Object.Key != "cat.jpg" || *ev.Records[0].S3.Object.Size != 2048 {
+			t.Errorf("unexpected payload: %s", body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("function is not invoked")
+	}
+	bns.Close()
+
+	res, err = http.Post(ts.URL+"/_wheelamb/s3/events", "application/json", strings.NewReader(`{"Records":`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected status: %d", res.StatusCode)
+	}
+}
+
+func TestServerFunctionURLs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	svc := wheelamb.NewLambdaService(&dockerGatewayMock{}, dir, wheelamb.NewLambdaRegistry())
+	ts := httptest.NewServer(New(svc))
+	t.Cleanup(ts.Close)
+	codeZipped, err := ioutil.ReadFile(filepath.Join("..", "testdata", "fake.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Create(context.Background(), &lambda.CreateFunctionInput{
+		Code:         &lambda.FunctionCode{ZipFile: []byte(base64.StdEncoding.EncodeToString(codeZipped))},
+		FunctionName: aws.String("myfunc"),
+		Handler:      aws.String("fake"),
+		Role:         aws.String("foobar"),
+		Runtime:      aws.String("go1.x"),
+	}); err != nil {
+		t.Fatalf("unexpected error captured: %v", err)
+	}
+
+	request := func(method, path, body string) (int, map[string]interface{}) {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		out := map[string]interface{}{}
+		json.NewDecoder(res.Body).Decode(&out)
+		if code := res.Header.Get("X-Amzn-ErrorType"); code != "" {
+			out["code"] = code
+		}
+		return res.StatusCode, out
+	}
+
+	status, out := request(http.MethodPost, "/2021-10-31/functions/myfunc/url", `{"AuthType": "NONE", "Cors": {"AllowOrigins": ["https://example.com"], "MaxAge": 300}}`)
+	if status != http.StatusCreated || out["FunctionArn"] != "arn:aws:lambda:us-east-1:000000000000:function:myfunc" ||
+		!strings.HasSuffix(out["FunctionUrl"].(string), ".lambda-url.us-east-1.on.aws/") || out["LastModifiedTime"] != nil {
+		t.Errorf("unexpected response: %d %v", status, out)
+	}
+	if status, out := request(http.MethodPost, "/2021-10-31/functions/myfunc/url", `{"AuthType": "NONE"}`); status != http.StatusConflict {
+		t.Errorf("unexpected response: %d %v", status, out)
+	}
+	if status, out := request(http.MethodPost, "/2021-10-31/functions/myfunc/url?Qualifier=live", `{"AuthType": "NONE"}`); status != http.StatusNotFound {
+		t.Errorf("unexpected response: %d %v", status, out)
+	}
+	status, out = request(http.MethodGet, "/2021-10-31/functions/myfunc/url", "")
+	if cors, _ := out["Cors"].(map[string]interface{}); status != http.StatusOK || out["AuthType"] != "NONE" || cors["MaxAge"] != float64(300) {
+		t.Errorf("unexpected response: %d %v", status, out)
+	}
+	if status, out := request(http.MethodDelete, "/2021-10-31/functions/myfunc/url", ""); status != http.StatusNoContent {
+		t.Errorf("unexpected response: %d %v", status, out)
+	}
+	if status, out := request(http.MethodGet, "/2021-10-31/functions/myfunc/url", ""); status != http.StatusNotFound || out["code"] != lambda.ErrCodeResourceNotFoundException {
+		t.Errorf("unexpected response: %d %v", status, out)
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/taiyoh/wheelamb"
+)
+
+// urlTimeFormat is the timestamp layout of CreationTime and LastModifiedTime of function URL.
+const urlTimeFormat = "2006-01-02T15:04:05.000000Z"
+
+// functionURLConfigJSON is function URL of lambda API, which aws-sdk-go does not define yet.
+type functionURLConfigJSON struct {
+	FunctionUrl      *string
+	FunctionArn      *string
+	AuthType         *string
+	Cors             *corsJSON
+	CreationTime     *string
+	LastModifiedTime *string
+}
+
+type corsJSON struct {
+	AllowCredentials *bool
+	AllowHeaders     []*string
+	AllowMethods     []*string
+	AllowOrigins     []*string
+	ExposeHeaders    []*string
+	MaxAge           *int64
+}
+
+func newFunctionURLConfigJSON(c *wheelamb.FunctionURLConfig) *functionURLConfigJSON {
+	out := &functionURLConfigJSON{
+		FunctionUrl:      aws.String(c.FunctionURL()),
+		FunctionArn:      aws.String(c.FunctionArn()),
+		AuthType:         aws.String(c.AuthType),
+		CreationTime:     aws.String(c.CreationTime.Format(urlTimeFormat)),
+		LastModifiedTime: aws.String(c.LastModifiedTime.Format(urlTimeFormat)),
+	}
+	if cors := c.Cors; cors != nil {
+		out.Cors = &corsJSON{
+			AllowCredentials: aws.Bool(cors.AllowCredentials),
+			AllowHeaders:     aws.StringSlice(cors.AllowHeaders),
+			AllowMethods:     aws.StringSlice(cors.AllowMethods),
+			AllowOrigins:     aws.StringSlice(cors.AllowOrigins),
+			ExposeHeaders:    aws.StringSlice(cors.ExposeHeaders),
+			MaxAge:           aws.Int64(cors.MaxAge),
+		}
+	}
+	return out
+}
+
+// POST /2021-10-31/functions/{name}/url
+func (s *Server) createFunctionURLConfig(w http.ResponseWriter, r *http.Request, params []string) {
+	var in functionURLConfigJSON
+	if err := readJSON(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+	input := &wheelamb.FunctionURLConfigInput{
+		FunctionName: params[0],
+		Qualifier:    r.URL.Query().Get("Qualifier"),
+		AuthType:     aws.StringValue(in.AuthType),
+	}
+	if cors := in.Cors; cors != nil {
+		input.Cors = &wheelamb.FunctionURLCors{
+			AllowCredentials: aws.BoolValue(cors.AllowCredentials),
+			AllowHeaders:     aws.StringValueSlice(cors.AllowHeaders),
+			AllowMethods:     aws.StringValueSlice(cors.AllowMethods),
+			AllowOrigins:     aws.StringValueSlice(cors.AllowOrigins),
+			ExposeHeaders:    aws.StringValueSlice(cors.ExposeHeaders),
+			MaxAge:           aws.Int64Value(cors.MaxAge),
+		}
+	}
+	c, err := s.lambda.CreateFunctionURLConfig(r.Context(), input)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	out := newFunctionURLConfigJSON(c)
+	out.LastModifiedTime = nil
+	writeJSON(w, http.StatusCreated, out)
+}
+
+// GET /2021-10-31/functions/{name}/url
+func (s *Server) getFunctionURLConfig(w http.ResponseWriter, r *http.Request, params []string) {
+	c, err := s.lambda.GetFunctionURLConfig(r.Context(), params[0], r.URL.Query().Get("Qualifier"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newFunctionURLConfigJSON(c))
+}
+
+// DELETE /2021-10-31/functions/{name}/url
+func (s *Server) deleteFunctionURLConfig(w http.ResponseWriter, r *http.Request, params []string) {
+	if err := s.lambda.DeleteFunctionURLConfig(r.Context(), params[0], r.URL.Query().Get("Qualifier")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+// POST /2015-03-31/functions/{name}/versions
+func (s *Server) publishVersion(w http.ResponseWriter, r *http.Request, params []string) {
+	input := &lambda.PublishVersionInput{}
+	if err := readJSON(r, input); err != nil {
+		writeError(w, err)
+		return
+	}
+	input.FunctionName = aws.String(params[0])
+	lf, err := s.lambda.PublishVersion(r.Context(), input)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, lf.Configuration())
+}
+
+// GET /2015-03-31/functions/{name}/versions
+func (s *Server) listVersionsByFunction(w http.ResponseWriter, r *http.Request, params []string) {
+	marker, maxItems, err := pagination(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	out, err := s.lambda.ListVersionsByFunction(r.Context(), &lambda.ListVersionsByFunctionInput{
+		FunctionName: aws.String(params[0]),
+		Marker:       marker,
+		MaxItems:     maxItems,
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,67 @@
+package snsd
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/google/uuid"
+	"github.com/taiyoh/wheelamb/internal/query"
+)
+
+const xmlNamespace = "http://sns.amazonaws.com/doc/2010-03-31/"
+
+// actions are operations which handler serves.
+var actions = map[string]bool{
+	"CreateTopic":               true,
+	"DeleteTopic":               true,
+	"ListTopics":                true,
+	"GetTopicAttributes":        true,
+	"SetTopicAttributes":        true,
+	"Subscribe":                 true,
+	"Unsubscribe":               true,
+	"GetSubscriptionAttributes": true,
+	"SetSubscriptionAttributes": true,
+	"ListSubscriptions":         true,
+	"ListSubscriptionsByTopic":  true,
+	"Publish":                   true,
+}
+
+// handler serves Service over query protocol.
+type handler struct {
+	svc *Service
+}
+
+// NewHandler returns http.Handler which serves SNS API of svc.
+func NewHandler(svc *Service) http.Handler {
+	return &handler{svc: svc}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	w.Header().Set("x-amzn-RequestId", requestID)
+
+	if err := r.ParseForm(); err != nil {
+		query.WriteError(w, requestID, awserr.New(sns.ErrCodeInvalidParameterException, "could not parse request", err))
+		return
+	}
+	action := r.Form.Get("Action")
+	if !actions[action] {
+		query.WriteError(w, requestID, awserr.New(errCodeInvalidAction, "The action "+action+" is not valid for this endpoint.", nil))
+		return
+	}
+
+	method := reflect.ValueOf(h.svc).MethodByName(action + "WithContext")
+	input := reflect.New(method.Type().In(1).Elem())
+	if err := query.Decode(r.Form, input.Interface()); err != nil {
+		query.WriteError(w, requestID, awserr.New(sns.ErrCodeInvalidParameterException, err.Error(), nil))
+		return
+	}
+	res := method.Call([]reflect.Value{reflect.ValueOf(r.Context()), input})
+	if err, _ := res[1].Interface().(error); err != nil {
+		query.WriteError(w, requestID, err)
+		return
+	}
+	query.WriteResponse(w, xmlNamespace, action, requestID, res[0])
+}
@@ -0,0 +1,89 @@
+package snsd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+func TestHandler(t *testing.T) {
+	inv := &invokerMock{}
+	ts := httptest.NewServer(nil)
+	defer ts.Close()
+	svc := New("us-east-1", "000000000000", ts.URL, inv)
+	ts.Config.Handler = NewHandler(svc)
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(ts.URL),
+		Credentials: credentials.NewStaticCredentials("dummy", "dummy", ""),
+	}))
+	client := sns.New(sess)
+
+	created, err := client.CreateTopic(&sns.CreateTopicInput{
+		Name:       aws.String("mytopic"),
+		Attributes: aws.StringMap(map[string]string{"DisplayName": "<My Topic>"}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	attrs, err := client.GetTopicAttributes(&sns.GetTopicAttributesInput{TopicArn: created.TopicArn})
+	if err != nil || *attrs.Attributes["DisplayName"] != "<My Topic>" {
+		t.Errorf("unexpected attributes: %v, %v", attrs, err)
+	}
+	sub, err := client.Subscribe(&sns.SubscribeInput{
+		TopicArn:   created.TopicArn,
+		Protocol:   aws.String("lambda"),
+		Endpoint:   aws.String(functionPrefix + "myfunc"),
+		Attributes: aws.StringMap(map[string]string{"FilterPolicy": `{"kind":["order"]}`}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	subs, err := client.ListSubscriptions(&sns.ListSubscriptionsInput{})
+	if err != nil || len(subs.Subscriptions) != 1 || *subs.Subscriptions[0].SubscriptionArn != *sub.SubscriptionArn {
+		t.Errorf("unexpected subscriptions: %v, %v", subs, err)
+	}
+	subAttrs, err := client.GetSubscriptionAttributes(&sns.GetSubscriptionAttributesInput{SubscriptionArn: sub.SubscriptionArn})
+	if err != nil || *subAttrs.Attributes["FilterPolicy"] != `{"kind":["order"]}` || *subAttrs.Attributes["FilterPolicyScope"] != "MessageAttributes" {
+		t.Errorf("unexpected attributes: %v, %v", subAttrs, err)
+	}
+
+	for _, kind := range []string{"order", "refund"} {
+		if _, err := client.Publish(&sns.PublishInput{
+			TopicArn: created.TopicArn,
+			Message:  aws.String("hello " + kind),
+			MessageAttributes: map[string]*sns.MessageAttributeValue{
+				"kind": {DataType: aws.String("String"), StringValue: aws.String(kind)},
+			},
+		}); err != nil {
+			t.Fatalf("unexpected error captured: %#v", err)
+		}
+	}
+	svc.Close()
+	if records := inv.received(functionPrefix + "myfunc"); len(records) != 1 || records[0].Sns.Message != "hello order" ||
+		records[0].Sns.MessageAttributes["kind"] != (eventAttribute{"String", "order"}) {
+		t.Errorf("unexpected records: %v", records)
+	}
+
+	_, err = client.Publish(&sns.PublishInput{TopicArn: aws.String(*created.TopicArn + "2"), Message: aws.String("hi")})
+	if e, ok := err.(awserr.Error); !ok || e.Code() != sns.ErrCodeNotFoundException {
+		t.Errorf("unexpected error captured: %#v", err)
+	}
+
+	res, err := http.Post(ts.URL, "application/x-www-form-urlencoded", strings.NewReader("Action=ConfirmSubscription"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected status: %d", res.StatusCode)
+	}
+}
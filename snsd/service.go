@@ -0,0 +1,540 @@
+// Package snsd provides in-memory notification service compatible with subset of SNS API,
+// which can be served over HTTP or used in process as snsiface.SNSAPI.
+// Topics deliver messages to subscribed lambda functions only.
+package snsd
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/google/uuid"
+)
+
+// errCodeInvalidAction is the error code which sns package of aws-sdk-go does not define.
+const errCodeInvalidAction = "InvalidAction"
+
+const (
+	protocolLambda            = "lambda"
+	maxMessageSize            = 262144
+	maxSubjectLength          = 100
+	maxMessageAttributes      = 10
+	maxListTopics             = 100
+	maxListSubscriptions      = 100
+	messageStructureJSON      = "json"
+	defaultMessageKey         = "default"
+	topicAttributeFifoTopic   = "FifoTopic"
+	topicAttributeDisplayName = "DisplayName"
+)
+
+var (
+	topicNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,256}$`)
+	functionPattern  = regexp.MustCompile(`^arn:aws[a-z-]*:lambda:[a-z0-9-]+:\d{12}:function:[a-zA-Z0-9_-]+(:[a-zA-Z0-9_$-]+)?$`)
+	// topicAttributes are attributes which topics accept, and are kept without effects.
+	topicAttributes = map[string]bool{
+		topicAttributeDisplayName: true,
+		"Policy":                  true,
+		"DeliveryPolicy":          true,
+		"KmsMasterKeyId":          true,
+		"SignatureVersion":        true,
+		"TracingConfig":           true,
+	}
+)
+
+// Invoker invokes lambda function with waiting response, as LambdaService of wheelamb does.
+type Invoker interface {
+	InvokeSync(context.Context, *lambda.InvokeInput) (*lambda.InvokeOutput, error)
+}
+
+// Service is in-memory notification service.
+// Operations which are not implemented panic, as the embedded SNSAPI is nil.
+type Service struct {
+	snsiface.SNSAPI
+	region    string
+	accountID string
+	baseURL   string
+	lambda    Invoker
+	mu        sync.Mutex
+	topics    map[string]*topic
+	// subscriptions are indexed by their arn.
+	subscriptions map[string]*subscription
+	running       sync.WaitGroup
+}
+
+// New returns Service object, which invokes functions of subscriptions by inv.
+// Topic ARNs are built from region and accountID, and unsubscribe URLs in notifications start with baseURL.
+func New(region, accountID, baseURL string, inv Invoker) *Service {
+	return &Service{
+		region:        region,
+		accountID:     accountID,
+		baseURL:       strings.TrimSuffix(baseURL, "/"),
+		lambda:        inv,
+		topics:        map[string]*topic{},
+		subscriptions: map[string]*subscription{},
+	}
+}
+
+// Close waits for deliveries in progress.
+func (s *Service) Close() error {
+	s.running.Wait()
+	return nil
+}
+
+func invalidParameter(msg string) error {
+	return awserr.New(sns.ErrCodeInvalidParameterException, "Invalid parameter: "+msg, nil)
+}
+
+func (s *Service) getTopic(arn *string) (*topic, error) {
+	if arn == nil {
+		return nil, invalidParameter("TopicArn")
+	}
+	t := s.topics[*arn]
+	if t == nil {
+		return nil, awserr.New(sns.ErrCodeNotFoundException, "Topic does not exist", nil)
+	}
+	return t, nil
+}
+
+func (s *Service) getSubscription(arn *string) (*subscription, error) {
+	if arn == nil {
+		return nil, invalidParameter("SubscriptionArn")
+	}
+	sub := s.subscriptions[*arn]
+	if sub == nil {
+		return nil, awserr.New(sns.ErrCodeNotFoundException, "Subscription does not exist", nil)
+	}
+	return sub, nil
+}
+
+func validateTopicAttribute(name, value string) error {
+	if name == topicAttributeFifoTopic && value == "true" {
+		return invalidParameter("Attributes Reason: FIFO topics are not supported")
+	}
+	if !topicAttributes[name] && name != topicAttributeFifoTopic {
+		return invalidParameter("Attributes Reason: Unknown attribute " + name)
+	}
+	return nil
+}
+
+// CreateTopicWithContext creates topic, or returns arn of existing topic.
+func (s *Service) CreateTopicWithContext(_ aws.Context, input *sns.CreateTopicInput, _ ...request.Option) (*sns.CreateTopicOutput, error) {
+	name := aws.StringValue(input.Name)
+	if !topicNamePattern.MatchString(name) {
+		return nil, invalidParameter("Topic Name")
+	}
+	for k, v := range input.Attributes {
+		if err := validateTopicAttribute(k, aws.StringValue(v)); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	arn := "arn:aws:sns:" + s.region + ":" + s.accountID + ":" + name
+	if _, ok := s.topics[arn]; ok {
+		return &sns.CreateTopicOutput{TopicArn: aws.String(arn)}, nil
+	}
+	t := &topic{name: name, arn: arn, attributes: map[string]string{}}
+	for k, v := range input.Attributes {
+		if k != topicAttributeFifoTopic {
+			t.attributes[k] = aws.StringValue(v)
+		}
+	}
+	s.topics[arn] = t
+	return &sns.CreateTopicOutput{TopicArn: aws.String(arn)}, nil
+}
+
+// DeleteTopicWithContext deletes topic with its subscriptions. Deleting topic which does not exist succeeds.
+func (s *Service) DeleteTopicWithContext(_ aws.Context, input *sns.DeleteTopicInput, _ ...request.Option) (*sns.DeleteTopicOutput, error) {
+	if input.TopicArn == nil {
+		return nil, invalidParameter("TopicArn")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t := s.topics[*input.TopicArn]; t != nil {
+		for _, sub := range t.subscriptions {
+			delete(s.subscriptions, sub.arn)
+		}
+		delete(s.topics, t.arn)
+	}
+	return &sns.DeleteTopicOutput{}, nil
+}
+
+// ListTopicsWithContext returns arns of topics in order of name, 100 topics at most per page.
+func (s *Service) ListTopicsWithContext(_ aws.Context, input *sns.ListTopicsInput, _ ...request.Option) (*sns.ListTopicsOutput, error) {
+	s.mu.Lock()
+	arns := make([]string, 0, len(s.topics))
+	for arn := range s.topics {
+		arns = append(arns, arn)
+	}
+	s.mu.Unlock()
+	sort.Strings(arns)
+
+	start, end, err := page(input.NextToken, len(arns), maxListTopics)
+	if err != nil {
+		return nil, err
+	}
+	out := &sns.ListTopicsOutput{Topics: []*sns.Topic{}}
+	for _, arn := range arns[start:end] {
+		out.Topics = append(out.Topics, &sns.Topic{TopicArn: aws.String(arn)})
+	}
+	if end < len(arns) {
+		out.NextToken = aws.String(strconv.Itoa(end))
+	}
+	return out, nil
+}
+
+// page returns range of items in page of token, which is offset of the first item.
+func page(token *string, n, size int) (int, int, error) {
+	start := 0
+	if token != nil {
+		i, err := strconv.Atoi(*token)
+		if err != nil || i < 0 || i > n {
+			return 0, 0, invalidParameter("NextToken")
+		}
+		start = i
+	}
+	end := start + size
+	if end > n {
+		end = n
+	}
+	return start, end, nil
+}
+
+// GetTopicAttributesWithContext returns attributes of topic.
+func (s *Service) GetTopicAttributesWithContext(_ aws.Context, input *sns.GetTopicAttributesInput, _ ...request.Option) (*sns.GetTopicAttributesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.getTopic(input.TopicArn)
+	if err != nil {
+		return nil, err
+	}
+	attrs := map[string]string{
+		"TopicArn":                t.arn,
+		"Owner":                   s.accountID,
+		topicAttributeDisplayName: "",
+		"SubscriptionsConfirmed":  strconv.Itoa(len(t.subscriptions)),
+		"SubscriptionsPending":    "0",
+		"SubscriptionsDeleted":    "0",
+		topicAttributeFifoTopic:   "false",
+	}
+	for k, v := range t.attributes {
+		attrs[k] = v
+	}
+	return &sns.GetTopicAttributesOutput{Attributes: aws.StringMap(attrs)}, nil
+}
+
+// SetTopicAttributesWithContext sets attribute of topic.
+func (s *Service) SetTopicAttributesWithContext(_ aws.Context, input *sns.SetTopicAttributesInput, _ ...request.Option) (*sns.SetTopicAttributesOutput, error) {
+	name := aws.StringValue(input.AttributeName)
+	if name == topicAttributeFifoTopic {
+		return nil, invalidParameter("AttributeName")
+	}
+	if err := validateTopicAttribute(name, aws.StringValue(input.AttributeValue)); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.getTopic(input.TopicArn)
+	if err != nil {
+		return nil, err
+	}
+	t.attributes[name] = aws.StringValue(input.AttributeValue)
+	return &sns.SetTopicAttributesOutput{}, nil
+}
+
+// setSubscriptionAttribute sets attribute of subscription, which Subscribe and SetSubscriptionAttributes accept.
+func setSubscriptionAttribute(sub *subscription, name, value string) error {
+	switch name {
+	case "FilterPolicy":
+		if err := sub.setFilterPolicy(value); err != nil {
+			return invalidParameter("FilterPolicy: " + err.Error())
+		}
+	case "FilterPolicyScope":
+		if value != filterPolicyScopeAttributes && value != filterPolicyScopeBody {
+			return invalidParameter("FilterPolicyScope: Invalid value [" + value + "]. Please use either MessageBody or MessageAttributes")
+		}
+		sub.filterPolicyScope = value
+	case "RawMessageDelivery":
+		if value == "true" {
+			return invalidParameter("Delivery protocol [lambda] does not support raw message delivery.")
+		}
+	case "DeliveryPolicy", "RedrivePolicy":
+		// accepted for compatibility, though deliveries are not retried.
+	default:
+		return invalidParameter("AttributeName")
+	}
+	return nil
+}
+
+// SubscribeWithContext subscribes lambda function to topic. Subscriptions are confirmed immediately.
+// Subscribing the same function again returns arn of existing subscription.
+func (s *Service) SubscribeWithContext(_ aws.Context, input *sns.SubscribeInput, _ ...request.Option) (*sns.SubscribeOutput, error) {
+	if protocol := aws.StringValue(input.Protocol); protocol != protocolLambda {
+		return nil, invalidParameter("Invalid protocol type: " + protocol)
+	}
+	endpoint := aws.StringValue(input.Endpoint)
+	if !functionPattern.MatchString(endpoint) {
+		return nil, invalidParameter("Lambda endpoint ARN")
+	}
+	sub := &subscription{endpoint: endpoint, filterPolicyScope: filterPolicyScopeAttributes}
+	for k, v := range input.Attributes {
+		if err := setSubscriptionAttribute(sub, k, aws.StringValue(v)); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.getTopic(input.TopicArn)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range t.subscriptions {
+		if e.endpoint != endpoint {
+			continue
+		}
+		if input.Attributes != nil && (e.filterPolicy != sub.filterPolicy || e.filterPolicyScope != sub.filterPolicyScope) {
+			return nil, invalidParameter("Attributes Reason: Subscription already exists with different attributes")
+		}
+		return &sns.SubscribeOutput{SubscriptionArn: aws.String(e.arn)}, nil
+	}
+	sub.arn = t.arn + ":" + uuid.New().String()
+	sub.topicArn = t.arn
+	t.subscriptions = append(t.subscriptions, sub)
+	s.subscriptions[sub.arn] = sub
+	return &sns.SubscribeOutput{SubscriptionArn: aws.String(sub.arn)}, nil
+}
+
+// UnsubscribeWithContext deletes subscription.
+func (s *Service) UnsubscribeWithContext(_ aws.Context, input *sns.UnsubscribeInput, _ ...request.Option) (*sns.UnsubscribeOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, err := s.getSubscription(input.SubscriptionArn)
+	if err != nil {
+		return nil, err
+	}
+	delete(s.subscriptions, sub.arn)
+	if t := s.topics[sub.topicArn]; t != nil {
+		for i, e := range t.subscriptions {
+			if e == sub {
+				t.subscriptions = append(t.subscriptions[:i], t.subscriptions[i+1:]...)
+				break
+			}
+		}
+	}
+	return &sns.UnsubscribeOutput{}, nil
+}
+
+// GetSubscriptionAttributesWithContext returns attributes of subscription.
+func (s *Service) GetSubscriptionAttributesWithContext(_ aws.Context, input *sns.GetSubscriptionAttributesInput, _ ...request.Option) (*sns.GetSubscriptionAttributesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, err := s.getSubscription(input.SubscriptionArn)
+	if err != nil {
+		return nil, err
+	}
+	return &sns.GetSubscriptionAttributesOutput{Attributes: sub.attributes(s.accountID)}, nil
+}
+
+// SetSubscriptionAttributesWithContext sets attribute of subscription. Empty FilterPolicy removes the policy.
+func (s *Service) SetSubscriptionAttributesWithContext(_ aws.Context, input *sns.SetSubscriptionAttributesInput, _ ...request.Option) (*sns.SetSubscriptionAttributesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, err := s.getSubscription(input.SubscriptionArn)
+	if err != nil {
+		return nil, err
+	}
+	if err := setSubscriptionAttribute(sub, aws.StringValue(input.AttributeName), aws.StringValue(input.AttributeValue)); err != nil {
+		return nil, err
+	}
+	return &sns.SetSubscriptionAttributesOutput{}, nil
+}
+
+func (s *Service) listSubscriptions(subs []*subscription, token *string) ([]*sns.Subscription, *string, error) {
+	start, end, err := page(token, len(subs), maxListSubscriptions)
+	if err != nil {
+		return nil, nil, err
+	}
+	list := []*sns.Subscription{}
+	for _, sub := range subs[start:end] {
+		list = append(list, &sns.Subscription{
+			SubscriptionArn: aws.String(sub.arn),
+			TopicArn:        aws.String(sub.topicArn),
+			Protocol:        aws.String(protocolLambda),
+			Endpoint:        aws.String(sub.endpoint),
+			Owner:           aws.String(s.accountID),
+		})
+	}
+	if end < len(subs) {
+		return list, aws.String(strconv.Itoa(end)), nil
+	}
+	return list, nil, nil
+}
+
+// ListSubscriptionsWithContext returns subscriptions of all topics, 100 subscriptions at most per page.
+func (s *Service) ListSubscriptionsWithContext(_ aws.Context, input *sns.ListSubscriptionsInput, _ ...request.Option) (*sns.ListSubscriptionsOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	arns := make([]string, 0, len(s.topics))
+	for arn := range s.topics {
+		arns = append(arns, arn)
+	}
+	sort.Strings(arns)
+	var subs []*subscription
+	for _, arn := range arns {
+		subs = append(subs, s.topics[arn].subscriptions...)
+	}
+	list, next, err := s.listSubscriptions(subs, input.NextToken)
+	if err != nil {
+		return nil, err
+	}
+	return &sns.ListSubscriptionsOutput{Subscriptions: list, NextToken: next}, nil
+}
+
+// ListSubscriptionsByTopicWithContext returns subscriptions of topic in order of subscription, 100 subscriptions at most per page.
+func (s *Service) ListSubscriptionsByTopicWithContext(_ aws.Context, input *sns.ListSubscriptionsByTopicInput, _ ...request.Option) (*sns.ListSubscriptionsByTopicOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.getTopic(input.TopicArn)
+	if err != nil {
+		return nil, err
+	}
+	list, next, err := s.listSubscriptions(t.subscriptions, input.NextToken)
+	if err != nil {
+		return nil, err
+	}
+	return &sns.ListSubscriptionsByTopicOutput{Subscriptions: list, NextToken: next}, nil
+}
+
+func validateMessageAttributes(attrs map[string]*sns.MessageAttributeValue) error {
+	if len(attrs) > maxMessageAttributes {
+		return awserr.New(sns.ErrCodeInvalidParameterValueException, "Number of message attributes ["+strconv.Itoa(len(attrs))+"] exceeds the allowed maximum ["+strconv.Itoa(maxMessageAttributes)+"].", nil)
+	}
+	for name, attr := range attrs {
+		dataType := aws.StringValue(attr.DataType)
+		switch base := strings.SplitN(dataType, ".", 2)[0]; {
+		case dataType == "String.Array":
+			var arr []interface{}
+			if err := json.Unmarshal([]byte(aws.StringValue(attr.StringValue)), &arr); err != nil {
+				return awserr.New(sns.ErrCodeInvalidParameterValueException, "The message attribute '"+name+"' with type 'String.Array' has an invalid value.", nil)
+			}
+		case base == "String" || base == "Number":
+			if attr.StringValue == nil {
+				return awserr.New(sns.ErrCodeInvalidParameterValueException, "The message attribute '"+name+"' must contain non-empty message attribute value for message attribute type '"+base+"'.", nil)
+			}
+			if _, err := strconv.ParseFloat(*attr.StringValue, 64); base == "Number" && err != nil {
+				return awserr.New(sns.ErrCodeInvalidParameterValueException, "Could not cast message attribute '"+name+"' value to number.", nil)
+			}
+		case base == "Binary":
+			if attr.BinaryValue == nil {
+				return awserr.New(sns.ErrCodeInvalidParameterValueException, "The message attribute '"+name+"' must contain non-empty message attribute value for message attribute type 'Binary'.", nil)
+			}
+		default:
+			return awserr.New(sns.ErrCodeInvalidParameterValueException, "The message attribute '"+name+"' has an invalid message attribute type, the set of supported type prefixes is Binary, Number, and String.", nil)
+		}
+	}
+	return nil
+}
+
+// lambdaMessage returns message for lambda subscriptions.
+// Message of json structure is an object of messages per protocol, where default is used for protocols without their own.
+func lambdaMessage(input *sns.PublishInput) (string, error) {
+	message := aws.StringValue(input.Message)
+	if aws.StringValue(input.MessageStructure) != messageStructureJSON {
+		return message, nil
+	}
+	var messages map[string]interface{}
+	if err := json.Unmarshal([]byte(message), &messages); err != nil {
+		return "", invalidParameter("Message Structure - JSON message body failed to parse")
+	}
+	def, ok := messages[defaultMessageKey].(string)
+	if !ok {
+		return "", invalidParameter("Message Structure - No default entry in JSON message body")
+	}
+	if m, ok := messages[protocolLambda].(string); ok {
+		return m, nil
+	}
+	return def, nil
+}
+
+// PublishWithContext publishes message to topic, and invokes functions whose filter policies match it in background.
+func (s *Service) PublishWithContext(_ aws.Context, input *sns.PublishInput, _ ...request.Option) (*sns.PublishOutput, error) {
+	arn := input.TopicArn
+	if arn == nil {
+		arn = input.TargetArn
+	}
+	if input.PhoneNumber != nil {
+		return nil, invalidParameter("PhoneNumber Reason: SMS is not supported")
+	}
+	if aws.StringValue(input.Message) == "" {
+		return nil, invalidParameter("Empty message")
+	}
+	if len(*input.Message) > maxMessageSize {
+		return nil, invalidParameter("Message too long")
+	}
+	if input.Subject != nil && (*input.Subject == "" || len(*input.Subject) > maxSubjectLength) {
+		return nil, invalidParameter("Subject")
+	}
+	if err := validateMessageAttributes(input.MessageAttributes); err != nil {
+		return nil, err
+	}
+	message, err := lambdaMessage(input)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.getTopic(arn)
+	if err != nil {
+		return nil, err
+	}
+	id := uuid.New().String()
+	now := time.Now()
+	for _, sub := range t.subscriptions {
+		if !sub.matches(message, input.MessageAttributes) {
+			continue
+		}
+		payload := s.event(sub, id, input, message, now)
+		s.running.Add(1)
+		go func(sub *subscription) {
+			defer s.running.Done()
+			s.invoke(sub, id, payload)
+		}(sub)
+	}
+	return &sns.PublishOutput{MessageId: aws.String(id)}, nil
+}
+
+// invoke invokes function of subscription, as asynchronous invocation does.
+func (s *Service) invoke(sub *subscription, messageID string, payload []byte) {
+	out, err := s.lambda.InvokeSync(context.Background(), &lambda.InvokeInput{
+		FunctionName: aws.String(sub.endpoint),
+		Payload:      payload,
+	})
+	if err != nil {
+		log.Printf("message %s: failed to invoke %s: %v", messageID, sub.endpoint, err)
+		return
+	}
+	if out.FunctionError != nil {
+		log.Printf("message %s: %s returned %s: %s", messageID, sub.endpoint, *out.FunctionError, out.Payload)
+	}
+}
+
+// unsubscribeURL returns URL which unsubscribes subscription of arn.
+func (s *Service) unsubscribeURL(arn string) string {
+	return s.baseURL + "/?Action=Unsubscribe&SubscriptionArn=" + url.QueryEscape(arn)
+}
@@ -0,0 +1,269 @@
+package snsd
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+type invokerMock struct {
+	mu sync.Mutex
+	// payloads are keyed by function name.
+	payloads map[string][][]byte
+}
+
+func (m *invokerMock) InvokeSync(_ context.Context, input *lambda.InvokeInput) (*lambda.InvokeOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.payloads == nil {
+		m.payloads = map[string][][]byte{}
+	}
+	m.payloads[*input.FunctionName] = append(m.payloads[*input.FunctionName], input.Payload)
+	return &lambda.InvokeOutput{StatusCode: aws.Int64(200), Payload: []byte("null")}, nil
+}
+
+func (m *invokerMock) received(function string) []eventRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var records []eventRecord
+	for _, p := range m.payloads[function] {
+		var ev struct{ Records []eventRecord }
+		if err := json.Unmarshal(p, &ev); err != nil {
+			panic(err)
+		}
+		records = append(records, ev.Records...)
+	}
+	delete(m.payloads, function)
+	return records
+}
+
+const functionPrefix = "arn:aws:lambda:us-east-1:000000000000:function:"
+
+func subscribe(t *testing.T, s *Service, topicArn, function string, attrs map[string]string) string {
+	t.Helper()
+	out, err := s.SubscribeWithContext(context.Background(), &sns.SubscribeInput{
+		TopicArn:   aws.String(topicArn),
+		Protocol:   aws.String("lambda"),
+		Endpoint:   aws.String(functionPrefix + function),
+		Attributes: aws.StringMap(attrs),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	return *out.SubscriptionArn
+}
+
+func TestServiceTopic(t *testing.T) {
+	s := New("us-east-1", "000000000000", "http://localhost:9911", &invokerMock{})
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		label    string
+		input    *sns.CreateTopicInput
+		expected string
+	}{
+		{"invalid name", &sns.CreateTopicInput{Name: aws.String("my topic")}, sns.ErrCodeInvalidParameterException},
+		{"fifo topic", &sns.CreateTopicInput{Name: aws.String("mytopic.fifo"), Attributes: aws.StringMap(map[string]string{"FifoTopic": "true"})}, sns.ErrCodeInvalidParameterException},
+		{"unknown attribute", &sns.CreateTopicInput{Name: aws.String("mytopic"), Attributes: aws.StringMap(map[string]string{"Color": "red"})}, sns.ErrCodeInvalidParameterException},
+	} {
+		_, err := s.CreateTopicWithContext(ctx, tt.input)
+		if e, ok := err.(awserr.Error); !ok || e.Code() != tt.expected {
+			t.Errorf("%s: unexpected error captured: %#v", tt.label, err)
+		}
+	}
+
+	created, err := s.CreateTopicWithContext(ctx, &sns.CreateTopicInput{
+		Name:       aws.String("mytopic"),
+		Attributes: aws.StringMap(map[string]string{"DisplayName": "My Topic"}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	arn := *created.TopicArn
+	if arn != "arn:aws:sns:us-east-1:000000000000:mytopic" {
+		t.Errorf("unexpected arn: %s", arn)
+	}
+	again, err := s.CreateTopicWithContext(ctx, &sns.CreateTopicInput{Name: aws.String("mytopic")})
+	if err != nil || *again.TopicArn != arn {
+		t.Errorf("unexpected topic: %v, %v", again, err)
+	}
+
+	subArn := subscribe(t, s, arn, "myfunc", nil)
+	if again := subscribe(t, s, arn, "myfunc", nil); again != subArn {
+		t.Errorf("subscription should be reused: %s != %s", again, subArn)
+	}
+	for _, tt := range []struct {
+		label    string
+		input    *sns.SubscribeInput
+		expected string
+	}{
+		{"unknown topic", &sns.SubscribeInput{TopicArn: aws.String(arn + "2"), Protocol: aws.String("lambda"), Endpoint: aws.String(functionPrefix + "myfunc")}, sns.ErrCodeNotFoundException},
+		{"unsupported protocol", &sns.SubscribeInput{TopicArn: aws.String(arn), Protocol: aws.String("email"), Endpoint: aws.String("me@example.com")}, sns.ErrCodeInvalidParameterException},
+		{"invalid endpoint", &sns.SubscribeInput{TopicArn: aws.String(arn), Protocol: aws.String("lambda"), Endpoint: aws.String("myfunc")}, sns.ErrCodeInvalidParameterException},
+		{"invalid filter policy", &sns.SubscribeInput{TopicArn: aws.String(arn), Protocol: aws.String("lambda"), Endpoint: aws.String(functionPrefix + "other"),
+			Attributes: aws.StringMap(map[string]string{"FilterPolicy": `{"store":"example"}`})}, sns.ErrCodeInvalidParameterException},
+		{"invalid filter policy scope", &sns.SubscribeInput{TopicArn: aws.String(arn), Protocol: aws.String("lambda"), Endpoint: aws.String(functionPrefix + "other"),
+			Attributes: aws.StringMap(map[string]string{"FilterPolicyScope": "Body"})}, sns.ErrCodeInvalidParameterException},
+		{"different attributes", &sns.SubscribeInput{TopicArn: aws.String(arn), Protocol: aws.String("lambda"), Endpoint: aws.String(functionPrefix + "myfunc"),
+			Attributes: aws.StringMap(map[string]string{"FilterPolicy": `{"store":["example"]}`})}, sns.ErrCodeInvalidParameterException},
+	} {
+		_, err := s.SubscribeWithContext(ctx, tt.input)
+		if e, ok := err.(awserr.Error); !ok || e.Code() != tt.expected {
+			t.Errorf("%s: unexpected error captured: %#v", tt.label, err)
+		}
+	}
+
+	attrs, err := s.GetTopicAttributesWithContext(ctx, &sns.GetTopicAttributesInput{TopicArn: aws.String(arn)})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if *attrs.Attributes["DisplayName"] != "My Topic" || *attrs.Attributes["SubscriptionsConfirmed"] != "1" {
+		t.Errorf("unexpected attributes: %v", aws.StringValueMap(attrs.Attributes))
+	}
+	subs, err := s.ListSubscriptionsByTopicWithContext(ctx, &sns.ListSubscriptionsByTopicInput{TopicArn: aws.String(arn)})
+	if err != nil || len(subs.Subscriptions) != 1 || *subs.Subscriptions[0].Endpoint != functionPrefix+"myfunc" || *subs.Subscriptions[0].Protocol != "lambda" {
+		t.Errorf("unexpected subscriptions: %v, %v", subs, err)
+	}
+
+	if _, err := s.DeleteTopicWithContext(ctx, &sns.DeleteTopicInput{TopicArn: aws.String(arn)}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if _, err := s.GetSubscriptionAttributesWithContext(ctx, &sns.GetSubscriptionAttributesInput{SubscriptionArn: aws.String(subArn)}); err == nil || err.(awserr.Error).Code() != sns.ErrCodeNotFoundException {
+		t.Errorf("subscription should be deleted with topic: %#v", err)
+	}
+	if list, err := s.ListTopicsWithContext(ctx, &sns.ListTopicsInput{}); err != nil || len(list.Topics) != 0 {
+		t.Errorf("unexpected topics: %v, %v", list, err)
+	}
+}
+
+func TestServicePublish(t *testing.T) {
+	inv := &invokerMock{}
+	s := New("us-east-1", "000000000000", "http://localhost:9911", inv)
+	ctx := context.Background()
+
+	created, err := s.CreateTopicWithContext(ctx, &sns.CreateTopicInput{Name: aws.String("orders")})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	arn := *created.TopicArn
+	allArn := subscribe(t, s, arn, "all", nil)
+	subscribe(t, s, arn, "attrs", map[string]string{
+		"FilterPolicy": `{"store":["example_corp"],"price":[{"numeric":[">",100]}],"tags":["gift"]}`,
+	})
+	bodyArn := subscribe(t, s, arn, "body", map[string]string{
+		"FilterPolicy":      `{"order":{"status":["shipped"]}}`,
+		"FilterPolicyScope": "MessageBody",
+	})
+
+	for _, tt := range []struct {
+		label    string
+		input    *sns.PublishInput
+		expected string
+	}{
+		{"unknown topic", &sns.PublishInput{TopicArn: aws.String(arn + "2"), Message: aws.String("hi")}, sns.ErrCodeNotFoundException},
+		{"empty message", &sns.PublishInput{TopicArn: aws.String(arn), Message: aws.String("")}, sns.ErrCodeInvalidParameterException},
+		{"no default message", &sns.PublishInput{TopicArn: aws.String(arn), Message: aws.String(`{"lambda":"hi"}`), MessageStructure: aws.String("json")}, sns.ErrCodeInvalidParameterException},
+		{"invalid number", &sns.PublishInput{TopicArn: aws.String(arn), Message: aws.String("hi"),
+			MessageAttributes: map[string]*sns.MessageAttributeValue{"price": {DataType: aws.String("Number"), StringValue: aws.String("cheap")}}}, sns.ErrCodeInvalidParameterValueException},
+		{"invalid data type", &sns.PublishInput{TopicArn: aws.String(arn), Message: aws.String("hi"),
+			MessageAttributes: map[string]*sns.MessageAttributeValue{"price": {DataType: aws.String("Integer"), StringValue: aws.String("1")}}}, sns.ErrCodeInvalidParameterValueException},
+	} {
+		_, err := s.PublishWithContext(ctx, tt.input)
+		if e, ok := err.(awserr.Error); !ok || e.Code() != tt.expected {
+			t.Errorf("%s: unexpected error captured: %#v", tt.label, err)
+		}
+	}
+
+	for _, input := range []*sns.PublishInput{
+		{
+			TopicArn: aws.String(arn),
+			Subject:  aws.String("matched"),
+			Message:  aws.String(`{"order":{"status":"shipped"}}`),
+			MessageAttributes: map[string]*sns.MessageAttributeValue{
+				"store": {DataType: aws.String("String"), StringValue: aws.String("example_corp")},
+				"price": {DataType: aws.String("Number"), StringValue: aws.String("120.5")},
+				"tags":  {DataType: aws.String("String.Array"), StringValue: aws.String(`["gift","fragile"]`)},
+				"raw":   {DataType: aws.String("Binary"), BinaryValue: []byte{1, 2}},
+			},
+		},
+		{
+			TopicArn: aws.String(arn),
+			Message:  aws.String(`{"order":{"status":"pending"}}`),
+			MessageAttributes: map[string]*sns.MessageAttributeValue{
+				"store": {DataType: aws.String("String"), StringValue: aws.String("example_corp")},
+				"price": {DataType: aws.String("Number"), StringValue: aws.String("99")},
+				"tags":  {DataType: aws.String("String.Array"), StringValue: aws.String(`["gift"]`)},
+			},
+		},
+		{
+			TargetArn:        aws.String(arn),
+			Message:          aws.String(`{"default":"plain text","lambda":"{\"order\":{\"status\":\"shipped\"}}"}`),
+			MessageStructure: aws.String("json"),
+		},
+	} {
+		if _, err := s.PublishWithContext(ctx, input); err != nil {
+			t.Fatalf("unexpected error captured: %#v", err)
+		}
+	}
+	s.Close()
+
+	all := inv.received(functionPrefix + "all")
+	if len(all) != 3 {
+		t.Fatalf("unexpected records: %v", all)
+	}
+	var first eventRecord
+	for _, rec := range all {
+		if rec.Sns.Subject != nil {
+			first = rec
+		}
+	}
+	if first.EventSource != "aws:sns" || first.EventVersion != "1.0" || first.EventSubscriptionArn != allArn ||
+		first.Sns.Type != "Notification" || first.Sns.TopicArn != arn || *first.Sns.Subject != "matched" ||
+		first.Sns.MessageAttributes["price"] != (eventAttribute{"Number", "120.5"}) ||
+		first.Sns.MessageAttributes["raw"] != (eventAttribute{"Binary", "AQI="}) ||
+		first.Sns.UnsubscribeURL != "http://localhost:9911/?Action=Unsubscribe&SubscriptionArn="+url.QueryEscape(allArn) {
+		t.Errorf("unexpected record: %#v", first)
+	}
+
+	if attrs := inv.received(functionPrefix + "attrs"); len(attrs) != 1 || *attrs[0].Sns.Subject != "matched" {
+		t.Errorf("unexpected records of attributes policy: %v", attrs)
+	}
+	body := inv.received(functionPrefix + "body")
+	if len(body) != 2 || body[0].EventSubscriptionArn != bodyArn {
+		t.Fatalf("unexpected records of body policy: %v", body)
+	}
+	for _, rec := range body {
+		if rec.Sns.Message != `{"order":{"status":"shipped"}}` {
+			t.Errorf("unexpected message: %s", rec.Sns.Message)
+		}
+	}
+
+	// removing filter policy delivers every message.
+	if _, err := s.SetSubscriptionAttributesWithContext(ctx, &sns.SetSubscriptionAttributesInput{
+		SubscriptionArn: aws.String(bodyArn),
+		AttributeName:   aws.String("FilterPolicy"),
+		AttributeValue:  aws.String(""),
+	}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if _, err := s.UnsubscribeWithContext(ctx, &sns.UnsubscribeInput{SubscriptionArn: aws.String(allArn)}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if _, err := s.PublishWithContext(ctx, &sns.PublishInput{TopicArn: aws.String(arn), Message: aws.String("not json")}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	s.Close()
+	if body := inv.received(functionPrefix + "body"); len(body) != 1 || body[0].Sns.Message != "not json" || body[0].Sns.Subject != nil {
+		t.Errorf("unexpected records: %v", body)
+	}
+	if all := inv.received(functionPrefix + "all"); len(all) != 0 {
+		t.Errorf("unsubscribed function should not be invoked: %v", all)
+	}
+}
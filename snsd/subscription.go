@@ -0,0 +1,158 @@
+package snsd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/taiyoh/wheelamb/internal/pattern"
+)
+
+const (
+	filterPolicyScopeAttributes = "MessageAttributes"
+	filterPolicyScopeBody       = "MessageBody"
+)
+
+type topic struct {
+	name       string
+	arn        string
+	attributes map[string]string
+	// subscriptions are in order of subscription.
+	subscriptions []*subscription
+}
+
+type subscription struct {
+	arn      string
+	topicArn string
+	endpoint string
+	// filterPolicy and filterPolicyScope are kept as given, and policy is compiled from them.
+	filterPolicy      string
+	filterPolicyScope string
+	policy            *pattern.Pattern
+}
+
+// setFilterPolicy compiles policy, which an empty string removes.
+func (sub *subscription) setFilterPolicy(policy string) error {
+	if policy == "" {
+		sub.filterPolicy, sub.policy = "", nil
+		return nil
+	}
+	p, err := pattern.Compile(policy)
+	if err != nil {
+		return err
+	}
+	sub.filterPolicy, sub.policy = policy, p
+	return nil
+}
+
+func (sub *subscription) attributes(accountID string) map[string]*string {
+	attrs := map[string]string{
+		"SubscriptionArn":              sub.arn,
+		"TopicArn":                     sub.topicArn,
+		"Protocol":                     protocolLambda,
+		"Endpoint":                     sub.endpoint,
+		"Owner":                        accountID,
+		"ConfirmationWasAuthenticated": "true",
+		"PendingConfirmation":          "false",
+		"RawMessageDelivery":           "false",
+		"FilterPolicyScope":            sub.filterPolicyScope,
+	}
+	if sub.filterPolicy != "" {
+		attrs["FilterPolicy"] = sub.filterPolicy
+	}
+	return aws.StringMap(attrs)
+}
+
+// matches reports whether message passes filter policy of subscription.
+// Attributes policy matches String and Number values, and each element of String.Array values.
+// Binary attributes can not be filtered, as SNS does.
+func (sub *subscription) matches(message string, attrs map[string]*sns.MessageAttributeValue) bool {
+	if sub.policy == nil {
+		return true
+	}
+	if sub.filterPolicyScope == filterPolicyScopeBody {
+		var body map[string]interface{}
+		if err := json.Unmarshal([]byte(message), &body); err != nil {
+			return false
+		}
+		return sub.policy.Match(body)
+	}
+	subject := make(map[string]interface{}, len(attrs))
+	for name, attr := range attrs {
+		value := aws.StringValue(attr.StringValue)
+		switch aws.StringValue(attr.DataType) {
+		case "String":
+			subject[name] = value
+		case "Number":
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				subject[name] = f
+			}
+		case "String.Array":
+			var arr []interface{}
+			if err := json.Unmarshal([]byte(value), &arr); err == nil {
+				subject[name] = arr
+			}
+		}
+	}
+	return sub.policy.Match(subject)
+}
+
+// eventAttribute is message attribute in event of lambda function.
+type eventAttribute struct {
+	Type  string
+	Value string
+}
+
+// eventRecord is notification which lambda function receives.
+// via https://docs.aws.amazon.com/lambda/latest/dg/with-sns.html
+type eventRecord struct {
+	EventVersion         string
+	EventSubscriptionArn string
+	EventSource          string
+	Sns                  struct {
+		Type              string
+		MessageID         string `json:"MessageId"`
+		TopicArn          string
+		Subject           *string
+		Message           string
+		Timestamp         string
+		SignatureVersion  string
+		Signature         string
+		SigningCertURL    string `json:"SigningCertUrl"`
+		UnsubscribeURL    string `json:"UnsubscribeUrl"`
+		MessageAttributes map[string]eventAttribute
+	}
+}
+
+// event builds payload of lambda function for message delivered to subscription.
+// Messages are not signed, so that Signature and SigningCertUrl are placeholders.
+func (s *Service) event(sub *subscription, messageID string, input *sns.PublishInput, message string, now time.Time) []byte {
+	rec := eventRecord{
+		EventVersion:         "1.0",
+		EventSubscriptionArn: sub.arn,
+		EventSource:          "aws:sns",
+	}
+	rec.Sns.Type = "Notification"
+	rec.Sns.MessageID = messageID
+	rec.Sns.TopicArn = sub.topicArn
+	rec.Sns.Subject = input.Subject
+	rec.Sns.Message = message
+	rec.Sns.Timestamp = now.UTC().Format("2006-01-02T15:04:05.000Z")
+	rec.Sns.SignatureVersion = "1"
+	rec.Sns.Signature = "EXAMPLE"
+	rec.Sns.SigningCertURL = "EXAMPLE"
+	rec.Sns.UnsubscribeURL = s.unsubscribeURL(sub.arn)
+	rec.Sns.MessageAttributes = make(map[string]eventAttribute, len(input.MessageAttributes))
+	for name, attr := range input.MessageAttributes {
+		a := eventAttribute{Type: aws.StringValue(attr.DataType), Value: aws.StringValue(attr.StringValue)}
+		if a.Type == "Binary" {
+			a.Value = base64.StdEncoding.EncodeToString(attr.BinaryValue)
+		}
+		rec.Sns.MessageAttributes[name] = a
+	}
+	b, _ := json.Marshal(struct{ Records []eventRecord }{[]eventRecord{rec}})
+	return b
+}
@@ -0,0 +1,160 @@
+package wheelamb
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+// dynamodbRecord describes record in dynamodb event.
+// via https://docs.aws.amazon.com/lambda/latest/dg/with-ddb.html
+type dynamodbRecord struct {
+	EventID        string          `json:"eventID"`
+	EventName      string          `json:"eventName"`
+	EventVersion   string          `json:"eventVersion"`
+	EventSource    string          `json:"eventSource"`
+	AWSRegion      string          `json:"awsRegion"`
+	Dynamodb       json.RawMessage `json:"dynamodb"`
+	UserIdentity   json.RawMessage `json:"userIdentity,omitempty"`
+	EventSourceARN string          `json:"eventSourceARN"`
+}
+
+// dynamodbReader reads records from dynamodb stream.
+type dynamodbReader struct {
+	client    dynamodbstreamsiface.DynamoDBStreamsAPI
+	streamArn string
+}
+
+func newDynamoDBReader(client dynamodbstreamsiface.DynamoDBStreamsAPI, streamArn string) (*dynamodbReader, error) {
+	// arn:aws:dynamodb:region:account:table/name/stream/label
+	if !strings.Contains(arnResource(streamArn), "/stream/") {
+		return nil, awserr.New(lambda.ErrCodeInvalidParameterValueException, "invalid stream arn: "+streamArn, nil)
+	}
+	return &dynamodbReader{client: client, streamArn: streamArn}, nil
+}
+
+func (r *dynamodbReader) shards(ctx context.Context) ([]streamShard, error) {
+	var shards []streamShard
+	input := &dynamodbstreams.DescribeStreamInput{StreamArn: aws.String(r.streamArn)}
+	for {
+		out, err := r.client.DescribeStreamWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, sh := range out.StreamDescription.Shards {
+			shard := streamShard{id: *sh.ShardId}
+			if sh.ParentShardId != nil {
+				shard.parents = []string{*sh.ParentShardId}
+			}
+			shards = append(shards, shard)
+		}
+		if out.StreamDescription.LastEvaluatedShardId == nil {
+			return shards, nil
+		}
+		input.ExclusiveStartShardId = out.StreamDescription.LastEvaluatedShardId
+	}
+}
+
+func (r *dynamodbReader) iterator(ctx context.Context, shardID string, pos streamPosition) (*string, error) {
+	input := &dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         aws.String(r.streamArn),
+		ShardId:           aws.String(shardID),
+		ShardIteratorType: aws.String(pos.iteratorType),
+	}
+	if pos.sequenceNumber != "" {
+		input.SequenceNumber = aws.String(pos.sequenceNumber)
+	}
+	out, err := r.client.GetShardIteratorWithContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return out.ShardIterator, nil
+}
+
+func (r *dynamodbReader) records(ctx context.Context, shardID string, iterator *string, limit int64) ([]streamRecord, *string, error) {
+	// GetRecords of dynamodb streams returns 1000 records at most.
+	if limit > 1000 {
+		limit = 1000
+	}
+	out, err := r.client.GetRecordsWithContext(ctx, &dynamodbstreams.GetRecordsInput{
+		ShardIterator: iterator,
+		Limit:         aws.Int64(limit),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	records := make([]streamRecord, 0, len(out.Records))
+	for _, rec := range out.Records {
+		if rec.Dynamodb == nil {
+			continue
+		}
+		// AttributeValue is built in the same shape as lambda event, such as {"S":"foo"}.
+		image, err := jsonutil.BuildJSON(rec.Dynamodb)
+		if err != nil {
+			return nil, nil, err
+		}
+		ev := &dynamodbRecord{
+			EventID:        aws.StringValue(rec.EventID),
+			EventName:      aws.StringValue(rec.EventName),
+			EventVersion:   aws.StringValue(rec.EventVersion),
+			EventSource:    aws.StringValue(rec.EventSource),
+			AWSRegion:      aws.StringValue(rec.AwsRegion),
+			Dynamodb:       image,
+			EventSourceARN: r.streamArn,
+		}
+		if ev.EventSource == "" {
+			ev.EventSource = "aws:dynamodb"
+		}
+		if ev.AWSRegion == "" {
+			ev.AWSRegion = Region()
+		}
+		if rec.UserIdentity != nil {
+			if ev.UserIdentity, err = jsonutil.BuildJSON(rec.UserIdentity); err != nil {
+				return nil, nil, err
+			}
+		}
+		keys, err := jsonutil.BuildJSON(&dynamodbstreams.StreamRecord{Keys: rec.Dynamodb.Keys})
+		if err != nil {
+			return nil, nil, err
+		}
+		records = append(records, streamRecord{
+			sequenceNumber: aws.StringValue(rec.Dynamodb.SequenceNumber),
+			partitionKey:   string(keys),
+			arrival:        aws.TimeValue(rec.Dynamodb.ApproximateCreationDateTime),
+			event:          ev,
+			subject:        func() interface{} { return filterSubject(ev, "dynamodb", ev.Dynamodb) },
+		})
+	}
+	return records, out.NextShardIterator, nil
+}
+
+func (r *dynamodbReader) batchInfoKey() string {
+	return dynamodbBatchInfoKey
+}
+
+// dynamodbPoller validates stream arn and starting position, and returns poller of dynamodb stream.
+func (s *SourceMappingService) dynamodbPoller(ctx context.Context, conf *lambda.EventSourceMappingConfiguration, position *string, timestamp *time.Time) (pollerFunc, func(), error) {
+	if aws.StringValue(position) == iteratorAtTimestamp {
+		return nil, nil, awserr.New(lambda.ErrCodeInvalidParameterValueException, "AT_TIMESTAMP is not supported for dynamodb stream", nil)
+	}
+	start, err := startingPosition(position, timestamp)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := newDynamoDBReader(s.dynamodb, *conf.EventSourceArn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := r.shards(ctx); err != nil {
+		return nil, nil, awserr.New(lambda.ErrCodeInvalidParameterValueException, "stream not found: "+*conf.EventSourceArn, err)
+	}
+	return s.streamPoller(conf, r, start)
+}
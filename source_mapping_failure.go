@@ -0,0 +1,216 @@
+package wheelamb
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/google/uuid"
+)
+
+// FunctionResponseTypeReportBatchItemFailures lets function report failed items in batch with
+// {"batchItemFailures":[{"itemIdentifier":"..."}]} response.
+const FunctionResponseTypeReportBatchItemFailures = "ReportBatchItemFailures"
+
+// error codes of invocation recorded in LastProcessingResult.
+const (
+	errCodeFunctionError        = "FunctionError"
+	errCodeInvalidBatchResponse = "InvalidBatchResponse"
+	errCodeBatchItemFailure     = "BatchItemFailure"
+)
+
+const (
+	maxRetryAttempts    = 10000
+	minMaximumRecordAge = 60
+	maxMaximumRecordAge = 604800
+)
+
+// MappingOption sets event source mapping settings which lambda package of aws-sdk-go does not define yet.
+type MappingOption func(*eventSourceMapping)
+
+// WithFunctionResponseTypes sets FunctionResponseTypes of mapping.
+func WithFunctionResponseTypes(types []string) MappingOption {
+	return func(m *eventSourceMapping) {
+		m.responseTypes = append([]string{}, types...)
+	}
+}
+
+// validateResponseTypes checks FunctionResponseTypes of mapping.
+func validateResponseTypes(types []string) error {
+	for _, t := range types {
+		if t != FunctionResponseTypeReportBatchItemFailures {
+			return awserr.New(lambda.ErrCodeInvalidParameterValueException, "invalid FunctionResponseTypes: "+t, nil)
+		}
+	}
+	return nil
+}
+
+// batchItemFailures returns identifiers of failed items from response of function.
+// ok is false when response is invalid, which means the whole batch failed.
+func batchItemFailures(payload []byte) (ids []string, ok bool) {
+	if len(payload) == 0 {
+		return nil, true
+	}
+	var res struct {
+		BatchItemFailures []struct {
+			ItemIdentifier *string `json:"itemIdentifier"`
+		} `json:"batchItemFailures"`
+	}
+	if err := json.Unmarshal(payload, &res); err != nil {
+		return nil, false
+	}
+	for _, f := range res.BatchItemFailures {
+		if aws.StringValue(f.ItemIdentifier) == "" {
+			return nil, false
+		}
+		ids = append(ids, *f.ItemIdentifier)
+	}
+	return ids, true
+}
+
+// validateFailureSettings fills default settings for failed records of stream and validates them.
+func validateFailureSettings(conf *lambda.EventSourceMappingConfiguration) error {
+	if conf.MaximumRetryAttempts == nil {
+		conf.MaximumRetryAttempts = aws.Int64(-1)
+	}
+	if conf.MaximumRecordAgeInSeconds == nil {
+		conf.MaximumRecordAgeInSeconds = aws.Int64(-1)
+	}
+	if conf.BisectBatchOnFunctionError == nil {
+		conf.BisectBatchOnFunctionError = aws.Bool(false)
+	}
+	if n := *conf.MaximumRetryAttempts; n < -1 || n > maxRetryAttempts {
+		return awserr.New(lambda.ErrCodeInvalidParameterValueException, "MaximumRetryAttempts must be between -1 and "+strconv.Itoa(maxRetryAttempts), nil)
+	}
+	if n := *conf.MaximumRecordAgeInSeconds; n != -1 && (n < minMaximumRecordAge || n > maxMaximumRecordAge) {
+		return awserr.New(lambda.ErrCodeInvalidParameterValueException, "MaximumRecordAgeInSeconds must be -1 or between 60 and "+strconv.Itoa(maxMaximumRecordAge), nil)
+	}
+	if dest := onFailureDestination(conf); dest != "" {
+		if service := arnService(dest); service != "sqs" && service != "sns" {
+			return awserr.New(lambda.ErrCodeInvalidParameterValueException, "OnFailure destination must be sqs queue or sns topic: "+dest, nil)
+		}
+	}
+	return nil
+}
+
+// onFailureDestination returns arn of OnFailure destination of mapping.
+func onFailureDestination(conf *lambda.EventSourceMappingConfiguration) string {
+	if conf.DestinationConfig == nil || conf.DestinationConfig.OnFailure == nil {
+		return ""
+	}
+	return aws.StringValue(conf.DestinationConfig.OnFailure.Destination)
+}
+
+// keys of batch info in records sent to OnFailure destination.
+const (
+	kinesisBatchInfoKey  = "KinesisBatchInfo"
+	dynamodbBatchInfoKey = "DDBStreamBatchInfo"
+)
+
+// conditions of records sent to OnFailure destination.
+const (
+	failureRetryAttemptsExhausted = "RetryAttemptsExhausted"
+	failureRecordAgeExceeded      = "RecordAgeExceeded"
+)
+
+// failureTimestampFormat is the timestamp layout of records sent to destination.
+const failureTimestampFormat = "2006-01-02T15:04:05.000Z"
+
+// streamFailure describes invocation record of discarded batch sent to OnFailure destination.
+// via https://docs.aws.amazon.com/lambda/latest/dg/invocation-async.html#invocation-async-destinations
+type streamFailure struct {
+	RequestContext struct {
+		RequestID              string `json:"requestId"`
+		FunctionArn            string `json:"functionArn"`
+		Condition              string `json:"condition"`
+		ApproximateInvokeCount int64  `json:"approximateInvokeCount"`
+	} `json:"requestContext"`
+	ResponseContext struct {
+		StatusCode      int64  `json:"statusCode"`
+		ExecutedVersion string `json:"executedVersion"`
+		FunctionError   string `json:"functionError"`
+	} `json:"responseContext"`
+	Version            string           `json:"version"`
+	Timestamp          string           `json:"timestamp"`
+	KinesisBatchInfo   *streamBatchInfo `json:"KinesisBatchInfo,omitempty"`
+	DDBStreamBatchInfo *streamBatchInfo `json:"DDBStreamBatchInfo,omitempty"`
+}
+
+// streamBatchInfo describes discarded records of stream.
+type streamBatchInfo struct {
+	ShardID                         string `json:"shardId"`
+	StartSequenceNumber             string `json:"startSequenceNumber"`
+	EndSequenceNumber               string `json:"endSequenceNumber"`
+	ApproximateArrivalOfFirstRecord string `json:"approximateArrivalOfFirstRecord"`
+	ApproximateArrivalOfLastRecord  string `json:"approximateArrivalOfLastRecord"`
+	BatchSize                       int    `json:"batchSize"`
+	StreamArn                       string `json:"streamArn"`
+}
+
+// sendStreamFailure sends discarded records of stream to OnFailure destination of mapping.
+// Records are only dropped when destination is not configured.
+func (s *SourceMappingService) sendStreamFailure(ctx context.Context, conf *lambda.EventSourceMappingConfiguration, infoKey, shardID string, records []streamRecord, condition string, invokeCount int64, out *lambda.InvokeOutput) error {
+	dest := onFailureDestination(conf)
+	if dest == "" || len(records) == 0 {
+		return nil
+	}
+	f := &streamFailure{Version: "1.0", Timestamp: s.clock.Now().UTC().Format(failureTimestampFormat)}
+	f.RequestContext.RequestID = uuid.New().String()
+	f.RequestContext.FunctionArn = *conf.FunctionArn
+	f.RequestContext.Condition = condition
+	f.RequestContext.ApproximateInvokeCount = invokeCount
+	if out != nil {
+		f.ResponseContext.StatusCode = aws.Int64Value(out.StatusCode)
+		f.ResponseContext.ExecutedVersion = aws.StringValue(out.ExecutedVersion)
+		f.ResponseContext.FunctionError = aws.StringValue(out.FunctionError)
+	}
+	first, last := records[0], records[len(records)-1]
+	info := &streamBatchInfo{
+		ShardID:                         shardID,
+		StartSequenceNumber:             first.sequenceNumber,
+		EndSequenceNumber:               last.sequenceNumber,
+		ApproximateArrivalOfFirstRecord: first.arrival.UTC().Format(failureTimestampFormat),
+		ApproximateArrivalOfLastRecord:  last.arrival.UTC().Format(failureTimestampFormat),
+		BatchSize:                       len(records),
+		StreamArn:                       *conf.EventSourceArn,
+	}
+	if infoKey == dynamodbBatchInfoKey {
+		f.DDBStreamBatchInfo = info
+	} else {
+		f.KinesisBatchInfo = info
+	}
+	msg, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	return s.sendToDestination(ctx, dest, string(msg))
+}
+
+// sendToDestination sends message to sqs queue or sns topic.
+func (s *SourceMappingService) sendToDestination(ctx context.Context, dest, msg string) error {
+	switch arnService(dest) {
+	case "sqs":
+		out, err := s.sqs.GetQueueUrlWithContext(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(arnResource(dest))})
+		if err != nil {
+			return err
+		}
+		_, err = s.sqs.SendMessageWithContext(ctx, &sqs.SendMessageInput{
+			QueueUrl:    out.QueueUrl,
+			MessageBody: aws.String(msg),
+		})
+		return err
+	case "sns":
+		_, err := s.sns.PublishWithContext(ctx, &sns.PublishInput{
+			TopicArn: aws.String(dest),
+			Message:  aws.String(msg),
+		})
+		return err
+	default:
+		return awserr.New(lambda.ErrCodeInvalidParameterValueException, "unsupported destination: "+dest, nil)
+	}
+}
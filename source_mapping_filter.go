@@ -0,0 +1,103 @@
+package wheelamb
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/taiyoh/wheelamb/internal/pattern"
+)
+
+// maxFilters is the maximum number of filters in FilterCriteria of mapping.
+const maxFilters = 5
+
+// WithFilterCriteria sets patterns of FilterCriteria of mapping.
+// Records which match none of patterns are not delivered to function.
+func WithFilterCriteria(patterns []string) MappingOption {
+	return func(m *eventSourceMapping) {
+		m.filterPatterns = append([]string{}, patterns...)
+	}
+}
+
+// compileFilters parses patterns of FilterCriteria.
+func compileFilters(patterns []string) ([]*pattern.Pattern, error) {
+	if len(patterns) > maxFilters {
+		return nil, awserr.New(lambda.ErrCodeInvalidParameterValueException, "FilterCriteria must have "+strconv.Itoa(maxFilters)+" filters at most", nil)
+	}
+	filters := make([]*pattern.Pattern, 0, len(patterns))
+	for _, p := range patterns {
+		f, err := pattern.Compile(p)
+		if err != nil {
+			return nil, awserr.New(lambda.ErrCodeInvalidParameterValueException, "invalid filter pattern: "+p, err)
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// matchFilters reports whether subject matches any of filters. Everything matches without filters.
+func matchFilters(filters []*pattern.Pattern, subject func() interface{}) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	v := subject()
+	for _, f := range filters {
+		if f.Match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterSubject converts record of lambda event into the value which filters match.
+// field of record, such as body of sqs message, is matched as JSON when it holds valid JSON.
+func filterSubject(record interface{}, field string, data []byte) interface{} {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return nil
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil
+	}
+	var parsed interface{}
+	if json.Unmarshal(data, &parsed) == nil {
+		v[field] = parsed
+	}
+	return v
+}
+
+// filterSQS splits messages into ones matching filters of mapping and the others.
+func (m *eventSourceMapping) filterSQS(queueArn string, msgs []*sqs.Message) (matched, dropped []*sqs.Message) {
+	filters := m.filterCriteria()
+	if len(filters) == 0 {
+		return msgs, nil
+	}
+	for _, msg := range msgs {
+		msg := msg
+		rec := newSQSEvent(queueArn, []*sqs.Message{msg}).Records[0]
+		if matchFilters(filters, func() interface{} { return filterSubject(rec, "body", []byte(rec.Body)) }) {
+			matched = append(matched, msg)
+		} else {
+			dropped = append(dropped, msg)
+		}
+	}
+	return matched, dropped
+}
+
+// filterRecords returns records of stream matching filters of mapping.
+func (m *eventSourceMapping) filterRecords(records []streamRecord) []streamRecord {
+	filters := m.filterCriteria()
+	if len(filters) == 0 {
+		return records
+	}
+	matched := make([]streamRecord, 0, len(records))
+	for _, rec := range records {
+		if matchFilters(filters, rec.subject) {
+			matched = append(matched, rec)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,140 @@
+package wheelamb
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+// kinesisRecord describes record in kinesis event.
+// via https://docs.aws.amazon.com/lambda/latest/dg/with-kinesis.html
+type kinesisRecord struct {
+	Kinesis struct {
+		KinesisSchemaVersion        string  `json:"kinesisSchemaVersion"`
+		PartitionKey                string  `json:"partitionKey"`
+		SequenceNumber              string  `json:"sequenceNumber"`
+		Data                        []byte  `json:"data"`
+		ApproximateArrivalTimestamp float64 `json:"approximateArrivalTimestamp"`
+	} `json:"kinesis"`
+	EventSource    string `json:"eventSource"`
+	EventVersion   string `json:"eventVersion"`
+	EventID        string `json:"eventID"`
+	EventName      string `json:"eventName"`
+	AWSRegion      string `json:"awsRegion"`
+	EventSourceARN string `json:"eventSourceARN"`
+}
+
+// kinesisReader reads records from kinesis stream.
+type kinesisReader struct {
+	client    kinesisiface.KinesisAPI
+	streamArn string
+	name      string
+}
+
+func newKinesisReader(client kinesisiface.KinesisAPI, streamArn string) (*kinesisReader, error) {
+	// arn:aws:kinesis:region:account:stream/name
+	name := strings.TrimPrefix(arnResource(streamArn), "stream/")
+	if name == "" || name == arnResource(streamArn) {
+		return nil, awserr.New(lambda.ErrCodeInvalidParameterValueException, "invalid stream arn: "+streamArn, nil)
+	}
+	return &kinesisReader{client: client, streamArn: streamArn, name: name}, nil
+}
+
+func (r *kinesisReader) shards(ctx context.Context) ([]streamShard, error) {
+	var shards []streamShard
+	input := &kinesis.DescribeStreamInput{StreamName: aws.String(r.name)}
+	err := r.client.DescribeStreamPagesWithContext(ctx, input, func(out *kinesis.DescribeStreamOutput, _ bool) bool {
+		for _, sh := range out.StreamDescription.Shards {
+			shard := streamShard{id: *sh.ShardId}
+			for _, p := range []*string{sh.ParentShardId, sh.AdjacentParentShardId} {
+				if p != nil {
+					shard.parents = append(shard.parents, *p)
+				}
+			}
+			shards = append(shards, shard)
+		}
+		return true
+	})
+	return shards, err
+}
+
+func (r *kinesisReader) iterator(ctx context.Context, shardID string, pos streamPosition) (*string, error) {
+	input := &kinesis.GetShardIteratorInput{
+		StreamName:        aws.String(r.name),
+		ShardId:           aws.String(shardID),
+		ShardIteratorType: aws.String(pos.iteratorType),
+		Timestamp:         pos.timestamp,
+	}
+	if pos.sequenceNumber != "" {
+		input.StartingSequenceNumber = aws.String(pos.sequenceNumber)
+	}
+	out, err := r.client.GetShardIteratorWithContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return out.ShardIterator, nil
+}
+
+func (r *kinesisReader) records(ctx context.Context, shardID string, iterator *string, limit int64) ([]streamRecord, *string, error) {
+	out, err := r.client.GetRecordsWithContext(ctx, &kinesis.GetRecordsInput{
+		ShardIterator: iterator,
+		Limit:         aws.Int64(limit),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	records := make([]streamRecord, 0, len(out.Records))
+	for _, rec := range out.Records {
+		ev := &kinesisRecord{
+			EventSource:    "aws:kinesis",
+			EventVersion:   "1.0",
+			EventID:        shardID + ":" + *rec.SequenceNumber,
+			EventName:      "aws:kinesis:record",
+			AWSRegion:      Region(),
+			EventSourceARN: r.streamArn,
+		}
+		ev.Kinesis.KinesisSchemaVersion = "1.0"
+		ev.Kinesis.PartitionKey = aws.StringValue(rec.PartitionKey)
+		ev.Kinesis.SequenceNumber = *rec.SequenceNumber
+		ev.Kinesis.Data = rec.Data
+		var arrival time.Time
+		if t := rec.ApproximateArrivalTimestamp; t != nil {
+			arrival = *t
+			ev.Kinesis.ApproximateArrivalTimestamp = float64(t.UnixNano()) / float64(time.Second)
+		}
+		records = append(records, streamRecord{
+			sequenceNumber: *rec.SequenceNumber,
+			partitionKey:   ev.Kinesis.PartitionKey,
+			arrival:        arrival,
+			event:          ev,
+			subject:        func() interface{} { return filterSubject(&ev.Kinesis, "data", ev.Kinesis.Data) },
+		})
+	}
+	return records, out.NextShardIterator, nil
+}
+
+func (r *kinesisReader) batchInfoKey() string {
+	return kinesisBatchInfoKey
+}
+
+// kinesisPoller validates stream arn and starting position, and returns poller of kinesis stream.
+func (s *SourceMappingService) kinesisPoller(ctx context.Context, conf *lambda.EventSourceMappingConfiguration, position *string, timestamp *time.Time) (pollerFunc, func(), error) {
+	start, err := startingPosition(position, timestamp)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := newKinesisReader(s.kinesis, *conf.EventSourceArn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := r.shards(ctx); err != nil {
+		return nil, nil, awserr.New(lambda.ErrCodeInvalidParameterValueException, "stream not found: "+*conf.EventSourceArn, err)
+	}
+	return s.streamPoller(conf, r, start)
+}
@@ -2,18 +2,615 @@ package wheelamb
 
 import (
 	"context"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
 	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/google/uuid"
+	"github.com/taiyoh/wheelamb/internal/pattern"
 )
 
+// invoker invokes lambda function with waiting response.
+type invoker interface {
+	InvokeSync(context.Context, *lambda.InvokeInput) (*lambda.InvokeOutput, error)
+}
+
+// invokeAsync invokes function of arn with payload, as asynchronous invocation does.
+// Failures are only logged with what describes the origin of invocation.
+func invokeAsync(inv invoker, what, arn string, payload []byte) {
+	out, err := inv.InvokeSync(context.Background(), &lambda.InvokeInput{
+		FunctionName: aws.String(arn),
+		Payload:      payload,
+	})
+	if err != nil {
+		log.Printf("%s: failed to invoke %s: %v", what, arn, err)
+		return
+	}
+	if out.FunctionError != nil {
+		log.Printf("%s: %s returned %s: %s", what, arn, *out.FunctionError, out.Payload)
+	}
+}
+
+// states of event source mapping.
+// Creating, Enabling, Disabling, Updating and Deleting are in transition,
+// and the mapping cannot be changed until it finishes.
+const (
+	mappingStateCreating  = "Creating"
+	mappingStateEnabling  = "Enabling"
+	mappingStateEnabled   = "Enabled"
+	mappingStateDisabling = "Disabling"
+	mappingStateDisabled  = "Disabled"
+	mappingStateUpdating  = "Updating"
+	mappingStateDeleting  = "Deleting"
+)
+
+// pollerFunc polls event source and invokes function of the mapping.
+type pollerFunc func(context.Context, *eventSourceMapping)
+
+// eventSourceMapping holds mapping settings and the poller of event source.
+type eventSourceMapping struct {
+	mu     sync.Mutex
+	conf   *lambda.EventSourceMappingConfiguration
+	poller pollerFunc
+	// responseTypes is FunctionResponseTypes of mapping.
+	responseTypes []string
+	// filterPatterns are patterns of FilterCriteria, and filters are compiled ones.
+	filterPatterns []string
+	filters        []*pattern.Pattern
+	// cleanup removes state of poller such as checkpoints when mapping is deleted.
+	cleanup func()
+	// runMu guards cancel and done of running poller.
+	runMu  sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// configuration returns copy of mapping settings.
+func (m *eventSourceMapping) configuration() *lambda.EventSourceMappingConfiguration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conf := *m.conf
+	return &conf
+}
+
+// setResult records result of the last processing.
+func (m *eventSourceMapping) setResult(result string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.conf.LastProcessingResult = aws.String(result)
+}
+
+// reportBatchItemFailures returns whether function reports failed items in batch.
+func (m *eventSourceMapping) reportBatchItemFailures() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range m.responseTypes {
+		if t == FunctionResponseTypeReportBatchItemFailures {
+			return true
+		}
+	}
+	return false
+}
+
+// filterCriteria returns compiled filters of mapping.
+func (m *eventSourceMapping) filterCriteria() []*pattern.Pattern {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.filters
+}
+
+// setState changes state of mapping.
+func (m *eventSourceMapping) setState(state string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.conf.State = aws.String(state)
+}
+
+// modify applies fn to copy of mapping settings and replaces them.
+// fn returns the state in transition, and mapping already in transition is rejected.
+func (m *eventSourceMapping) modify(fn func(*lambda.EventSourceMappingConfiguration) (string, error)) (*lambda.EventSourceMappingConfiguration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch state := aws.StringValue(m.conf.State); state {
+	case mappingStateEnabled, mappingStateDisabled:
+	default:
+		return nil, awserr.New(lambda.ErrCodeResourceInUseException, "mapping is in state "+state, nil)
+	}
+	conf := *m.conf
+	state, err := fn(&conf)
+	if err != nil {
+		return nil, err
+	}
+	conf.State = aws.String(state)
+	conf.StateTransitionReason = aws.String("USER_INITIATED")
+	conf.LastModified = aws.Time(time.Now().UTC())
+	m.conf = &conf
+	c := conf
+	return &c, nil
+}
+
+// start runs poller until stop is called.
+func (m *eventSourceMapping) start() {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+	if m.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.done = make(chan struct{})
+	go func(done chan struct{}) {
+		defer close(done)
+		m.poller(ctx, m)
+	}(m.done)
+}
+
+// stop cancels poller and waits for it.
+func (m *eventSourceMapping) stop() {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+	if m.cancel == nil {
+		return
+	}
+	m.cancel()
+	<-m.done
+	m.cancel = nil
+}
+
+// remove stops poller and cleans up its state.
+func (m *eventSourceMapping) remove() {
+	m.stop()
+	if m.cleanup != nil {
+		m.cleanup()
+	}
+}
+
 // SourceMappingService provides interfaces for operating EventSourceMapping for lambda.
 type SourceMappingService struct {
 	registry *LambdaRegistry
 	session  *session.Session
+	lambda   invoker
+	sqs      sqsiface.SQSAPI
+	kinesis  kinesisiface.KinesisAPI
+	dynamodb dynamodbstreamsiface.DynamoDBStreamsAPI
+	// sns sends failed records to OnFailure destination.
+	sns snsiface.SNSAPI
+	// clock drives retries and age of records.
+	clock Clock
+	// dir stores checkpoints of streams.
+	dir         string
+	mu          sync.Mutex
+	mappings    map[string]*eventSourceMapping
+	transitions sync.WaitGroup
+}
+
+// SourceMappingServiceOption configures SourceMappingService.
+type SourceMappingServiceOption func(*SourceMappingService)
+
+// WithSQS makes SourceMappingService use given client instead of the one for sqs endpoint,
+// such as queue service embedded in process.
+func WithSQS(api sqsiface.SQSAPI) SourceMappingServiceOption {
+	return func(s *SourceMappingService) {
+		s.sqs = api
+	}
+}
+
+// WithKinesis makes SourceMappingService use given client instead of the one for kinesis endpoint,
+// such as stream service embedded in process.
+func WithKinesis(api kinesisiface.KinesisAPI) SourceMappingServiceOption {
+	return func(s *SourceMappingService) {
+		s.kinesis = api
+	}
+}
+
+// WithSNS makes SourceMappingService send failed records to OnFailure destination by given client
+// instead of the one for sns endpoint, such as topic service embedded in process.
+func WithSNS(api snsiface.SNSAPI) SourceMappingServiceOption {
+	return func(s *SourceMappingService) {
+		s.sns = api
+	}
+}
+
+// WithClock makes SourceMappingService retry invocations and expire records by given clock instead of wall clock.
+// Polling intervals of event sources are not affected.
+func WithClock(c Clock) SourceMappingServiceOption {
+	return func(s *SourceMappingService) {
+		s.clock = c
+	}
+}
+
+// NewSourceMappingService returns SourceMappingService object.
+// Mappings are removed when their function is unregistered from registry of given LambdaService.
+func NewSourceMappingService(svc *LambdaService, opts ...SourceMappingServiceOption) *SourceMappingService {
+	sess := session.Must(session.NewSession(awsConf))
+	// DynamoDB Local serves streams on the same endpoint as tables.
+	streamsConf := serviceConfig("dynamodbstreams")
+	if _, ok := endpoints["dynamodbstreams"]; !ok {
+		streamsConf = serviceConfig("dynamodb")
+	}
+	s := &SourceMappingService{
+		registry: svc.registry,
+		session:  sess,
+		lambda:   svc,
+		sqs:      sqs.New(sess, serviceConfig("sqs")),
+		kinesis:  kinesis.New(sess, serviceConfig("kinesis")),
+		dynamodb: dynamodbstreams.New(sess, streamsConf),
+		sns:      sns.New(sess, serviceConfig("sns")),
+		clock:    systemClock{},
+		dir:      filepath.Join(svc.dir, ".checkpoints"),
+		mappings: make(map[string]*eventSourceMapping),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	svc.registry.OnUnregister(s.removeMappingsFor)
+	return s
 }
 
-// CreateEventSourceMapping creates mappings for lambda invokation from sqs or kinesis streams.
-func (s *SourceMappingService) CreateEventSourceMapping(ctx context.Context, input *lambda.CreateEventSourceMappingInput) error {
+// Close waits for state transitions and stops all pollers.
+func (s *SourceMappingService) Close() error {
+	s.transitions.Wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.mappings {
+		m.stop()
+	}
 	return nil
 }
+
+// transit runs fn in background, and changes state of mapping after that.
+// Empty state keeps the state as it is.
+func (s *SourceMappingService) transit(m *eventSourceMapping, state string, fn func()) {
+	s.transitions.Add(1)
+	go func() {
+		defer s.transitions.Done()
+		if fn != nil {
+			fn()
+		}
+		if state != "" {
+			m.setState(state)
+		}
+	}()
+}
+
+// targetARN returns arn of function or its version which mapping invokes.
+func (s *SourceMappingService) targetARN(name string) (string, error) {
+	n, q := resolveName(name, nil)
+	if s.registry.GetVersion(n, q) == nil {
+		return "", awserr.New(lambda.ErrCodeResourceNotFoundException, "function not found", nil)
+	}
+	arn := functionARN(n)
+	if q != "" {
+		arn += ":" + q
+	}
+	return arn, nil
+}
+
+// validateMapping fills default settings of mapping and validates them for its event source.
+func validateMapping(conf *lambda.EventSourceMappingConfiguration) error {
+	switch service := arnService(*conf.EventSourceArn); service {
+	case "sqs":
+		return validateSQSMapping(conf)
+	case "kinesis", "dynamodb":
+		if err := validateStreamMapping(conf); err != nil {
+			return err
+		}
+		return validateFailureSettings(conf)
+	default:
+		return awserr.New(lambda.ErrCodeInvalidParameterValueException, "unsupported event source: "+service, nil)
+	}
+}
+
+// newPoller returns poller for event source of mapping and cleanup function of its state.
+func (s *SourceMappingService) newPoller(ctx context.Context, input *lambda.CreateEventSourceMappingInput, conf *lambda.EventSourceMappingConfiguration) (pollerFunc, func(), error) {
+	switch service := arnService(*conf.EventSourceArn); service {
+	case "sqs":
+		poller, err := s.sqsPoller(ctx, conf)
+		return poller, nil, err
+	case "kinesis":
+		return s.kinesisPoller(ctx, conf, input.StartingPosition, input.StartingPositionTimestamp)
+	case "dynamodb":
+		return s.dynamodbPoller(ctx, conf, input.StartingPosition, input.StartingPositionTimestamp)
+	default:
+		return nil, nil, awserr.New(lambda.ErrCodeInvalidParameterValueException, "unsupported event source: "+service, nil)
+	}
+}
+
+// CreateEventSourceMapping creates mappings for lambda invokation from sqs, kinesis or dynamodb streams.
+// Mapping is created in Creating state, and becomes Enabled or Disabled in background.
+func (s *SourceMappingService) CreateEventSourceMapping(ctx context.Context, input *lambda.CreateEventSourceMappingInput, opts ...MappingOption) (*lambda.EventSourceMappingConfiguration, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	functionArn, err := s.targetARN(*input.FunctionName)
+	if err != nil {
+		return nil, err
+	}
+	conf := &lambda.EventSourceMappingConfiguration{
+		UUID:                           aws.String(uuid.New().String()),
+		BatchSize:                      input.BatchSize,
+		BisectBatchOnFunctionError:     input.BisectBatchOnFunctionError,
+		DestinationConfig:              input.DestinationConfig,
+		EventSourceArn:                 input.EventSourceArn,
+		FunctionArn:                    aws.String(functionArn),
+		LastModified:                   aws.Time(time.Now().UTC()),
+		LastProcessingResult:           aws.String("No records processed"),
+		MaximumBatchingWindowInSeconds: input.MaximumBatchingWindowInSeconds,
+		MaximumRecordAgeInSeconds:      input.MaximumRecordAgeInSeconds,
+		MaximumRetryAttempts:           input.MaximumRetryAttempts,
+		ParallelizationFactor:          input.ParallelizationFactor,
+		State:                          aws.String(mappingStateCreating),
+		StateTransitionReason:          aws.String("USER_INITIATED"),
+	}
+	if err := validateMapping(conf); err != nil {
+		return nil, err
+	}
+	m := &eventSourceMapping{conf: conf}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if err := validateResponseTypes(m.responseTypes); err != nil {
+		return nil, err
+	}
+	if m.filters, err = compileFilters(m.filterPatterns); err != nil {
+		return nil, err
+	}
+	if m.poller, m.cleanup, err = s.newPoller(ctx, input, conf); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.mappings[*conf.UUID] = m
+	s.mu.Unlock()
+	if input.Enabled == nil || *input.Enabled {
+		s.transit(m, mappingStateEnabled, m.start)
+	} else {
+		s.transit(m, mappingStateDisabled, nil)
+	}
+	return m.configuration(), nil
+}
+
+// getMapping returns mapping from given uuid.
+func (s *SourceMappingService) getMapping(id string) (*eventSourceMapping, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.mappings[id]
+	if !ok {
+		return nil, awserr.New(lambda.ErrCodeResourceNotFoundException, "event source mapping not found: "+id, nil)
+	}
+	return m, nil
+}
+
+// GetEventSourceMapping returns mapping settings from given uuid.
+func (s *SourceMappingService) GetEventSourceMapping(ctx context.Context, input *lambda.GetEventSourceMappingInput) (*lambda.EventSourceMappingConfiguration, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	m, err := s.getMapping(*input.UUID)
+	if err != nil {
+		return nil, err
+	}
+	return m.configuration(), nil
+}
+
+// ListEventSourceMappings returns mappings sorted by uuid, filtered by function and event source.
+// Marker is the uuid of the first mapping in the next page.
+func (s *SourceMappingService) ListEventSourceMappings(ctx context.Context, input *lambda.ListEventSourceMappingsInput) (*lambda.ListEventSourceMappingsOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	var functionArn string
+	if input.FunctionName != nil {
+		name, qualifier := resolveName(*input.FunctionName, nil)
+		functionArn = functionARN(name)
+		if qualifier != "" {
+			functionArn += ":" + qualifier
+		}
+	}
+	s.mu.Lock()
+	list := make([]*lambda.EventSourceMappingConfiguration, 0, len(s.mappings))
+	for _, m := range s.mappings {
+		list = append(list, m.configuration())
+	}
+	s.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		return *list[i].UUID < *list[j].UUID
+	})
+
+	limit := maxItems(input.MaxItems)
+	marker := aws.StringValue(input.Marker)
+	out := &lambda.ListEventSourceMappingsOutput{
+		EventSourceMappings: []*lambda.EventSourceMappingConfiguration{},
+	}
+	for _, conf := range list {
+		if *conf.UUID < marker ||
+			(functionArn != "" && *conf.FunctionArn != functionArn) ||
+			(input.EventSourceArn != nil && *conf.EventSourceArn != *input.EventSourceArn) {
+			continue
+		}
+		if int64(len(out.EventSourceMappings)) == limit {
+			out.NextMarker = conf.UUID
+			break
+		}
+		out.EventSourceMappings = append(out.EventSourceMappings, conf)
+	}
+	return out, nil
+}
+
+// UpdateEventSourceMapping changes target function, batching settings and enables or disables mapping.
+// Mapping moves to Enabling, Disabling or Updating state, and the change completes in background.
+func (s *SourceMappingService) UpdateEventSourceMapping(ctx context.Context, input *lambda.UpdateEventSourceMappingInput, opts ...MappingOption) (*lambda.EventSourceMappingConfiguration, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	m, err := s.getMapping(*input.UUID)
+	if err != nil {
+		return nil, err
+	}
+	var functionArn string
+	if input.FunctionName != nil {
+		if functionArn, err = s.targetARN(*input.FunctionName); err != nil {
+			return nil, err
+		}
+	}
+	updated := &eventSourceMapping{}
+	for _, opt := range opts {
+		opt(updated)
+	}
+	if err := validateResponseTypes(updated.responseTypes); err != nil {
+		return nil, err
+	}
+	filters, err := compileFilters(updated.filterPatterns)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		next string
+		run  func()
+	)
+	conf, err := m.modify(func(conf *lambda.EventSourceMappingConfiguration) (string, error) {
+		if functionArn != "" {
+			conf.FunctionArn = aws.String(functionArn)
+		}
+		if input.BatchSize != nil {
+			conf.BatchSize = input.BatchSize
+		}
+		if input.MaximumBatchingWindowInSeconds != nil {
+			conf.MaximumBatchingWindowInSeconds = input.MaximumBatchingWindowInSeconds
+		}
+		if input.ParallelizationFactor != nil {
+			conf.ParallelizationFactor = input.ParallelizationFactor
+		}
+		if input.BisectBatchOnFunctionError != nil {
+			conf.BisectBatchOnFunctionError = input.BisectBatchOnFunctionError
+		}
+		if input.MaximumRecordAgeInSeconds != nil {
+			conf.MaximumRecordAgeInSeconds = input.MaximumRecordAgeInSeconds
+		}
+		if input.MaximumRetryAttempts != nil {
+			conf.MaximumRetryAttempts = input.MaximumRetryAttempts
+		}
+		if input.DestinationConfig != nil {
+			conf.DestinationConfig = input.DestinationConfig
+		}
+		if err := validateMapping(conf); err != nil {
+			return "", err
+		}
+		if updated.responseTypes != nil {
+			m.responseTypes = updated.responseTypes
+		}
+		if updated.filterPatterns != nil {
+			m.filterPatterns, m.filters = updated.filterPatterns, filters
+		}
+		enabled := *conf.State == mappingStateEnabled
+		switch {
+		case input.Enabled != nil && *input.Enabled && !enabled:
+			next, run = mappingStateEnabled, m.start
+			return mappingStateEnabling, nil
+		case input.Enabled != nil && !*input.Enabled && enabled:
+			next, run = mappingStateDisabled, m.stop
+			return mappingStateDisabling, nil
+		default:
+			next = *conf.State
+			return mappingStateUpdating, nil
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.transit(m, next, run)
+	return conf, nil
+}
+
+// FunctionResponseTypes returns FunctionResponseTypes of mapping from given uuid.
+func (s *SourceMappingService) FunctionResponseTypes(id string) []string {
+	m, err := s.getMapping(id)
+	if err != nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string{}, m.responseTypes...)
+}
+
+// FilterCriteria returns patterns of FilterCriteria of mapping from given uuid.
+func (s *SourceMappingService) FilterCriteria(id string) []string {
+	m, err := s.getMapping(id)
+	if err != nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string{}, m.filterPatterns...)
+}
+
+// DeleteEventSourceMapping stops poller and removes mapping.
+// Mapping is in Deleting state until its poller stops, and checkpoints of stream are removed.
+func (s *SourceMappingService) DeleteEventSourceMapping(ctx context.Context, input *lambda.DeleteEventSourceMappingInput) (*lambda.EventSourceMappingConfiguration, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	m, err := s.getMapping(*input.UUID)
+	if err != nil {
+		return nil, err
+	}
+	conf, err := m.modify(func(*lambda.EventSourceMappingConfiguration) (string, error) {
+		return mappingStateDeleting, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.transit(m, "", func() {
+		m.remove()
+		s.mu.Lock()
+		delete(s.mappings, *conf.UUID)
+		s.mu.Unlock()
+	})
+	return conf, nil
+}
+
+// arnService returns service name of given arn.
+func arnService(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[2]
+}
+
+// arnResource returns resource part of given arn.
+func arnResource(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 {
+		return ""
+	}
+	return parts[5]
+}
+
+// removeMappingsFor removes mappings targeting given function.
+// Unqualified function also removes mappings for its versions.
+func (s *SourceMappingService) removeMappingsFor(lf *LambdaFunction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, m := range s.mappings {
+		if arn := aws.StringValue(m.configuration().FunctionArn); arn == lf.FunctionArn || strings.HasPrefix(arn, lf.FunctionArn+":") {
+			m.remove()
+			delete(s.mappings, id)
+		}
+	}
+}
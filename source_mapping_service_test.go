@@ -0,0 +1,959 @@
+package wheelamb
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/taiyoh/wheelamb/kinesisd"
+	"github.com/taiyoh/wheelamb/sqsd"
+)
+
+type sqsMock struct {
+	sqsiface.SQSAPI
+	mu       sync.Mutex
+	queue    []*sqs.Message
+	deleted  []string
+	sent     []string
+	received chan struct{}
+}
+
+func (m *sqsMock) GetQueueUrlWithContext(_ aws.Context, input *sqs.GetQueueUrlInput, _ ...request.Option) (*sqs.GetQueueUrlOutput, error) {
+	if *input.QueueName != "myqueue" {
+		return nil, awserr.New(sqs.ErrCodeQueueDoesNotExist, "queue not found", nil)
+	}
+	return &sqs.GetQueueUrlOutput{QueueUrl: aws.String("http://localhost:9324/000000000000/myqueue")}, nil
+}
+
+func (m *sqsMock) ReceiveMessageWithContext(ctx aws.Context, input *sqs.ReceiveMessageInput, _ ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	m.mu.Lock()
+	msgs := m.queue
+	m.queue = nil
+	m.mu.Unlock()
+	if len(msgs) == 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	defer func() { m.received <- struct{}{} }()
+	return &sqs.ReceiveMessageOutput{Messages: msgs}, nil
+}
+
+func (m *sqsMock) DeleteMessageBatchWithContext(_ aws.Context, input *sqs.DeleteMessageBatchInput, _ ...request.Option) (*sqs.DeleteMessageBatchOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range input.Entries {
+		m.deleted = append(m.deleted, *e.ReceiptHandle)
+	}
+	return &sqs.DeleteMessageBatchOutput{}, nil
+}
+
+func (m *sqsMock) SendMessageWithContext(_ aws.Context, input *sqs.SendMessageInput, _ ...request.Option) (*sqs.SendMessageOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, *input.MessageBody)
+	return &sqs.SendMessageOutput{MessageId: aws.String("sent")}, nil
+}
+
+type invokerMock struct {
+	mu       sync.Mutex
+	payloads [][]byte
+	fail     bool
+	// failures is the number of invocations failing before success.
+	failures int
+	// responses are returned as payload in order, and then null is returned.
+	responses [][]byte
+}
+
+func (m *invokerMock) InvokeSync(_ context.Context, input *lambda.InvokeInput) (*lambda.InvokeOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.payloads = append(m.payloads, input.Payload)
+	out := &lambda.InvokeOutput{StatusCode: aws.Int64(200), Payload: []byte(`null`)}
+	if len(m.responses) > 0 {
+		out.Payload, m.responses = m.responses[0], m.responses[1:]
+	}
+	if m.fail || m.failures > 0 {
+		m.failures--
+		out.FunctionError = aws.String("Unhandled")
+	}
+	return out, nil
+}
+
+func newTestSourceMappingService(t *testing.T) (*SourceMappingService, *sqsMock, *invokerMock) {
+	reg := NewLambdaRegistry()
+	reg.Register(&LambdaFunction{FunctionName: "myfunc", FunctionArn: functionARN("myfunc"), Version: latestVersion})
+	q := &sqsMock{received: make(chan struct{}, 1)}
+	inv := &invokerMock{}
+	s := &SourceMappingService{
+		registry: reg,
+		lambda:   inv,
+		sqs:      q,
+		clock:    systemClock{},
+		mappings: make(map[string]*eventSourceMapping),
+	}
+	reg.OnUnregister(s.removeMappingsFor)
+	t.Cleanup(func() { s.Close() })
+	return s, q, inv
+}
+
+func TestSourceMappingSQS(t *testing.T) {
+	queueArn := "arn:aws:sqs:" + Region() + ":" + AccountID() + ":myqueue"
+	for _, tt := range []struct {
+		label    string
+		input    *lambda.CreateEventSourceMappingInput
+		expected string
+	}{
+		{
+			label:    "function not found",
+			input:    &lambda.CreateEventSourceMappingInput{FunctionName: aws.String("unknown"), EventSourceArn: aws.String(queueArn)},
+			expected: lambda.ErrCodeResourceNotFoundException,
+		},
+		{
+			label:    "queue not found",
+			input:    &lambda.CreateEventSourceMappingInput{FunctionName: aws.String("myfunc"), EventSourceArn: aws.String(queueArn + "2")},
+			expected: lambda.ErrCodeInvalidParameterValueException,
+		},
+		{
+			label:    "batch size without window",
+			input:    &lambda.CreateEventSourceMappingInput{FunctionName: aws.String("myfunc"), EventSourceArn: aws.String(queueArn), BatchSize: aws.Int64(100)},
+			expected: lambda.ErrCodeInvalidParameterValueException,
+		},
+	} {
+		t.Run(tt.label, func(t *testing.T) {
+			s, _, _ := newTestSourceMappingService(t)
+			_, err := s.CreateEventSourceMapping(context.Background(), tt.input)
+			if e, ok := err.(awserr.Error); !ok || e.Code() != tt.expected {
+				t.Errorf("unexpected error captured: %#v", err)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		label   string
+		fail    bool
+		deleted int
+	}{
+		{"success", false, 2},
+		{"function error", true, 0},
+	} {
+		t.Run(tt.label, func(t *testing.T) {
+			s, q, inv := newTestSourceMappingService(t)
+			inv.fail = tt.fail
+			q.queue = []*sqs.Message{
+				{MessageId: aws.String("m1"), ReceiptHandle: aws.String("r1"), Body: aws.String("hello")},
+				{MessageId: aws.String("m2"), ReceiptHandle: aws.String("r2"), Body: aws.String("world"),
+					MessageAttributes: map[string]*sqs.MessageAttributeValue{
+						"foo": {DataType: aws.String("String"), StringValue: aws.String("bar")},
+					}},
+			}
+			conf, err := s.CreateEventSourceMapping(context.Background(), &lambda.CreateEventSourceMappingInput{
+				FunctionName:   aws.String("myfunc"),
+				EventSourceArn: aws.String(queueArn),
+			})
+			if err != nil {
+				t.Fatalf("unexpected error captured: %#v", err)
+			}
+			if aws.StringValue(conf.UUID) == "" || aws.Int64Value(conf.BatchSize) != 10 || aws.StringValue(conf.State) != "Creating" {
+				t.Errorf("unexpected mapping: %s", conf)
+			}
+			select {
+			case <-q.received:
+			case <-time.After(time.Second):
+				t.Fatal("messages are not received")
+			}
+			s.Close()
+
+			if len(inv.payloads) != 1 {
+				t.Fatalf("function should be invoked once: %d", len(inv.payloads))
+			}
+			var ev sqsEvent
+			if err := json.Unmarshal(inv.payloads[0], &ev); err != nil {
+				t.Fatal(err)
+			}
+			if len(ev.Records) != 2 || ev.Records[1].Body != "world" || ev.Records[1].EventSource != "aws:sqs" || ev.Records[1].EventSourceARN != queueArn {
+				t.Errorf("unexpected event: %s", inv.payloads[0])
+			}
+			if v := ev.Records[1].MessageAttributes["foo"]; aws.StringValue(v.StringValue) != "bar" || v.DataType != "String" {
+				t.Errorf("unexpected message attributes: %s", inv.payloads[0])
+			}
+			if len(q.deleted) != tt.deleted {
+				t.Errorf("deleted messages: %v", q.deleted)
+			}
+		})
+	}
+
+	t.Run("removed with function", func(t *testing.T) {
+		s, _, _ := newTestSourceMappingService(t)
+		if _, err := s.CreateEventSourceMapping(context.Background(), &lambda.CreateEventSourceMappingInput{
+			FunctionName:   aws.String(functionARN("myfunc")),
+			EventSourceArn: aws.String(queueArn),
+			Enabled:        aws.Bool(false),
+		}); err != nil {
+			t.Fatalf("unexpected error captured: %#v", err)
+		}
+		s.registry.Unregister("myfunc")
+		if len(s.mappings) > 0 {
+			t.Error("mappings should be removed")
+		}
+	})
+}
+
+func TestSourceMappingLifecycle(t *testing.T) {
+	queueArn := "arn:aws:sqs:" + Region() + ":" + AccountID() + ":myqueue"
+	s, _, _ := newTestSourceMappingService(t)
+	s.registry.registerVersion(&LambdaFunction{FunctionName: "myfunc", FunctionArn: functionARN("myfunc"), Version: "1"})
+	ctx := context.Background()
+
+	created := make([]*lambda.EventSourceMappingConfiguration, 0, 2)
+	for _, name := range []string{"myfunc", "myfunc:1"} {
+		conf, err := s.CreateEventSourceMapping(ctx, &lambda.CreateEventSourceMappingInput{
+			FunctionName:   aws.String(functionARN(name)),
+			EventSourceArn: aws.String(queueArn),
+			Enabled:        aws.Bool(false),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error captured: %#v", err)
+		}
+		created = append(created, conf)
+	}
+	id := created[0].UUID
+	s.transitions.Wait()
+	s.mappings[*id].setState("Creating")
+	if _, err := s.UpdateEventSourceMapping(ctx, &lambda.UpdateEventSourceMappingInput{UUID: id, Enabled: aws.Bool(true)}); err == nil {
+		t.Error("error should exists for updating mapping in transition")
+	}
+	s.mappings[*id].setState("Disabled")
+
+	conf, err := s.GetEventSourceMapping(ctx, &lambda.GetEventSourceMappingInput{UUID: id})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if aws.StringValue(conf.State) != "Disabled" {
+		t.Errorf("unexpected state: %s", aws.StringValue(conf.State))
+	}
+
+	for _, tt := range []struct {
+		label    string
+		input    *lambda.ListEventSourceMappingsInput
+		expected int
+	}{
+		{"all", &lambda.ListEventSourceMappingsInput{}, 2},
+		{"function", &lambda.ListEventSourceMappingsInput{FunctionName: aws.String("myfunc")}, 1},
+		{"version", &lambda.ListEventSourceMappingsInput{FunctionName: aws.String(functionARN("myfunc:1"))}, 1},
+		{"event source", &lambda.ListEventSourceMappingsInput{EventSourceArn: aws.String(queueArn + "2")}, 0},
+	} {
+		out, err := s.ListEventSourceMappings(ctx, tt.input)
+		if err != nil {
+			t.Fatalf("unexpected error captured: %#v", err)
+		}
+		if len(out.EventSourceMappings) != tt.expected {
+			t.Errorf("%s: %d != %d", tt.label, len(out.EventSourceMappings), tt.expected)
+		}
+	}
+	out, _ := s.ListEventSourceMappings(ctx, &lambda.ListEventSourceMappingsInput{MaxItems: aws.Int64(1)})
+	if len(out.EventSourceMappings) != 1 || out.NextMarker == nil {
+		t.Fatalf("unexpected page: %s", out)
+	}
+	next, _ := s.ListEventSourceMappings(ctx, &lambda.ListEventSourceMappingsInput{Marker: out.NextMarker})
+	if len(next.EventSourceMappings) != 1 || *next.EventSourceMappings[0].UUID != *out.NextMarker {
+		t.Errorf("unexpected next page: %s", next)
+	}
+
+	if _, err := s.UpdateEventSourceMapping(ctx, &lambda.UpdateEventSourceMappingInput{UUID: id, BatchSize: aws.Int64(100)}); err == nil {
+		t.Error("error should exists for batch size without batching window")
+	}
+	conf, err = s.UpdateEventSourceMapping(ctx, &lambda.UpdateEventSourceMappingInput{UUID: id, Enabled: aws.Bool(true), BatchSize: aws.Int64(5)})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if aws.StringValue(conf.State) != "Enabling" || aws.Int64Value(conf.BatchSize) != 5 {
+		t.Errorf("unexpected mapping: %s", conf)
+	}
+	s.transitions.Wait()
+	if conf, _ := s.GetEventSourceMapping(ctx, &lambda.GetEventSourceMappingInput{UUID: id}); aws.StringValue(conf.State) != "Enabled" {
+		t.Errorf("unexpected state: %s", aws.StringValue(conf.State))
+	}
+	conf, err = s.UpdateEventSourceMapping(ctx, &lambda.UpdateEventSourceMappingInput{UUID: id, MaximumBatchingWindowInSeconds: aws.Int64(1)})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if aws.StringValue(conf.State) != "Updating" {
+		t.Errorf("unexpected state: %s", aws.StringValue(conf.State))
+	}
+	s.transitions.Wait()
+
+	conf, err = s.DeleteEventSourceMapping(ctx, &lambda.DeleteEventSourceMappingInput{UUID: id})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if aws.StringValue(conf.State) != "Deleting" {
+		t.Errorf("unexpected state: %s", aws.StringValue(conf.State))
+	}
+	s.transitions.Wait()
+	_, err = s.GetEventSourceMapping(ctx, &lambda.GetEventSourceMappingInput{UUID: id})
+	if e, ok := err.(awserr.Error); !ok || e.Code() != lambda.ErrCodeResourceNotFoundException {
+		t.Errorf("unexpected error captured: %#v", err)
+	}
+}
+
+type kinesisMock struct {
+	kinesisiface.KinesisAPI
+	mu        sync.Mutex
+	records   []*kinesis.Record
+	iterators []string
+}
+
+func (m *kinesisMock) DescribeStreamPagesWithContext(_ aws.Context, input *kinesis.DescribeStreamInput, fn func(*kinesis.DescribeStreamOutput, bool) bool, _ ...request.Option) error {
+	if *input.StreamName != "mystream" {
+		return awserr.New(kinesis.ErrCodeResourceNotFoundException, "stream not found", nil)
+	}
+	fn(&kinesis.DescribeStreamOutput{StreamDescription: &kinesis.StreamDescription{
+		Shards: []*kinesis.Shard{{ShardId: aws.String("shardId-000000000000")}},
+	}}, true)
+	return nil
+}
+
+// GetShardIteratorWithContext returns the sequence number which reading starts after as iterator.
+func (m *kinesisMock) GetShardIteratorWithContext(_ aws.Context, input *kinesis.GetShardIteratorInput, _ ...request.Option) (*kinesis.GetShardIteratorOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.iterators = append(m.iterators, *input.ShardIteratorType)
+	return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String(aws.StringValue(input.StartingSequenceNumber))}, nil
+}
+
+// GetRecordsWithContext returns records after iterator, and closes shard when all records are read.
+func (m *kinesisMock) GetRecordsWithContext(_ aws.Context, input *kinesis.GetRecordsInput, _ ...request.Option) (*kinesis.GetRecordsOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := &kinesis.GetRecordsOutput{}
+	for _, rec := range m.records {
+		if *rec.SequenceNumber > *input.ShardIterator && int64(len(out.Records)) < *input.Limit {
+			out.Records = append(out.Records, rec)
+		}
+	}
+	if len(out.Records) > 0 && *out.Records[len(out.Records)-1].SequenceNumber != *m.records[len(m.records)-1].SequenceNumber {
+		out.NextShardIterator = out.Records[len(out.Records)-1].SequenceNumber
+	}
+	return out, nil
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestSourceMappingKinesis(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	streamArn := "arn:aws:kinesis:" + Region() + ":" + AccountID() + ":stream/mystream"
+	k := &kinesisMock{}
+	for _, seq := range []string{"1", "2", "3"} {
+		k.records = append(k.records, &kinesis.Record{SequenceNumber: aws.String(seq), PartitionKey: aws.String("pk"), Data: []byte("hello")})
+	}
+	newService := func() (*SourceMappingService, *invokerMock) {
+		s, _, inv := newTestSourceMappingService(t)
+		s.kinesis = k
+		s.dir = dir
+		return s, inv
+	}
+	input := &lambda.CreateEventSourceMappingInput{
+		FunctionName:     aws.String("myfunc"),
+		EventSourceArn:   aws.String(streamArn),
+		BatchSize:        aws.Int64(2),
+		StartingPosition: aws.String("TRIM_HORIZON"),
+	}
+
+	s, inv := newService()
+	if _, err := s.CreateEventSourceMapping(context.Background(), &lambda.CreateEventSourceMappingInput{
+		FunctionName:   aws.String("myfunc"),
+		EventSourceArn: aws.String(streamArn),
+	}); err == nil {
+		t.Error("error should exists without StartingPosition")
+	}
+	if _, err := s.CreateEventSourceMapping(context.Background(), input); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	waitFor(t, func() bool {
+		inv.mu.Lock()
+		defer inv.mu.Unlock()
+		return len(inv.payloads) == 2
+	})
+	s.Close()
+	var ev struct {
+		Records []kinesisRecord
+	}
+	if err := json.Unmarshal(inv.payloads[0], &ev); err != nil {
+		t.Fatal(err)
+	}
+	if len(ev.Records) != 2 || string(ev.Records[0].Kinesis.Data) != "hello" || ev.Records[1].EventID != "shardId-000000000000:2" || ev.Records[0].EventSourceARN != streamArn {
+		t.Errorf("unexpected event: %s", inv.payloads[0])
+	}
+	if !strings.Contains(string(inv.payloads[0]), `"data":"aGVsbG8="`) {
+		t.Errorf("data should be encoded as base64: %s", inv.payloads[0])
+	}
+
+	// restart resumes from checkpoint.
+	k.records = append(k.records, &kinesis.Record{SequenceNumber: aws.String("4"), PartitionKey: aws.String("pk"), Data: []byte("world")})
+	k.iterators = nil
+	s, inv = newService()
+	conf, err := s.CreateEventSourceMapping(context.Background(), input)
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	waitFor(t, func() bool {
+		inv.mu.Lock()
+		defer inv.mu.Unlock()
+		return len(inv.payloads) == 1
+	})
+	if err := json.Unmarshal(inv.payloads[0], &ev); err != nil {
+		t.Fatal(err)
+	}
+	if len(ev.Records) != 1 || ev.Records[0].Kinesis.SequenceNumber != "4" {
+		t.Errorf("unexpected event: %s", inv.payloads[0])
+	}
+	if k.iterators[0] != "AFTER_SEQUENCE_NUMBER" {
+		t.Errorf("unexpected iterator type: %v", k.iterators)
+	}
+
+	s.transitions.Wait()
+	if _, err := s.DeleteEventSourceMapping(context.Background(), &lambda.DeleteEventSourceMappingInput{UUID: conf.UUID}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	s.transitions.Wait()
+	if files, _ := ioutil.ReadDir(dir); len(files) > 0 {
+		t.Errorf("checkpoints should be removed: %d files", len(files))
+	}
+}
+
+type dynamodbStreamsMock struct {
+	dynamodbstreamsiface.DynamoDBStreamsAPI
+	records []*dynamodbstreams.Record
+}
+
+func (m *dynamodbStreamsMock) DescribeStreamWithContext(aws.Context, *dynamodbstreams.DescribeStreamInput, ...request.Option) (*dynamodbstreams.DescribeStreamOutput, error) {
+	return &dynamodbstreams.DescribeStreamOutput{StreamDescription: &dynamodbstreams.StreamDescription{
+		Shards: []*dynamodbstreams.Shard{{ShardId: aws.String("shardId-00000001")}},
+	}}, nil
+}
+
+func (m *dynamodbStreamsMock) GetShardIteratorWithContext(aws.Context, *dynamodbstreams.GetShardIteratorInput, ...request.Option) (*dynamodbstreams.GetShardIteratorOutput, error) {
+	return &dynamodbstreams.GetShardIteratorOutput{ShardIterator: aws.String("iterator")}, nil
+}
+
+// GetRecordsWithContext returns all records and closes shard.
+func (m *dynamodbStreamsMock) GetRecordsWithContext(aws.Context, *dynamodbstreams.GetRecordsInput, ...request.Option) (*dynamodbstreams.GetRecordsOutput, error) {
+	return &dynamodbstreams.GetRecordsOutput{Records: m.records}, nil
+}
+
+func TestSourceMappingDynamoDB(t *testing.T) {
+	streamArn := "arn:aws:dynamodb:" + Region() + ":" + AccountID() + ":table/mytable/stream/2020-01-01T00:00:00.000"
+	s, _, inv := newTestSourceMappingService(t)
+	inv.failures = 1
+	s.dynamodb = &dynamodbStreamsMock{records: []*dynamodbstreams.Record{{
+		EventID:   aws.String("e1"),
+		EventName: aws.String("MODIFY"),
+		Dynamodb: &dynamodbstreams.StreamRecord{
+			Keys:           map[string]*dynamodb.AttributeValue{"id": {S: aws.String("foo")}},
+			NewImage:       map[string]*dynamodb.AttributeValue{"id": {S: aws.String("foo")}, "n": {N: aws.String("2")}},
+			OldImage:       map[string]*dynamodb.AttributeValue{"id": {S: aws.String("foo")}, "n": {N: aws.String("1")}},
+			SequenceNumber: aws.String("100000000000000000001"),
+			StreamViewType: aws.String("NEW_AND_OLD_IMAGES"),
+		},
+	}}}
+
+	if _, err := s.CreateEventSourceMapping(context.Background(), &lambda.CreateEventSourceMappingInput{
+		FunctionName:              aws.String("myfunc"),
+		EventSourceArn:            aws.String(streamArn),
+		StartingPosition:          aws.String("AT_TIMESTAMP"),
+		StartingPositionTimestamp: aws.Time(time.Now()),
+	}); err == nil {
+		t.Error("error should exists for AT_TIMESTAMP")
+	}
+	if _, err := s.CreateEventSourceMapping(context.Background(), &lambda.CreateEventSourceMappingInput{
+		FunctionName:     aws.String("myfunc"),
+		EventSourceArn:   aws.String(streamArn),
+		StartingPosition: aws.String("TRIM_HORIZON"),
+	}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	// failed batch is retried.
+	waitFor(t, func() bool {
+		inv.mu.Lock()
+		defer inv.mu.Unlock()
+		return len(inv.payloads) == 2
+	})
+	s.Close()
+	if string(inv.payloads[0]) != string(inv.payloads[1]) {
+		t.Errorf("the same batch should be retried: %s, %s", inv.payloads[0], inv.payloads[1])
+	}
+	var ev struct {
+		Records []struct {
+			EventName      string `json:"eventName"`
+			EventSource    string `json:"eventSource"`
+			EventSourceARN string `json:"eventSourceARN"`
+			Dynamodb       struct {
+				Keys           map[string]map[string]string
+				NewImage       map[string]map[string]string
+				OldImage       map[string]map[string]string
+				StreamViewType string
+			} `json:"dynamodb"`
+		}
+	}
+	if err := json.Unmarshal(inv.payloads[0], &ev); err != nil {
+		t.Fatal(err)
+	}
+	if len(ev.Records) != 1 {
+		t.Fatalf("unexpected event: %s", inv.payloads[0])
+	}
+	rec := ev.Records[0]
+	if rec.EventName != "MODIFY" || rec.EventSource != "aws:dynamodb" || rec.EventSourceARN != streamArn ||
+		rec.Dynamodb.Keys["id"]["S"] != "foo" || rec.Dynamodb.NewImage["n"]["N"] != "2" || rec.Dynamodb.OldImage["n"]["N"] != "1" ||
+		rec.Dynamodb.StreamViewType != "NEW_AND_OLD_IMAGES" {
+		t.Errorf("unexpected event: %s", inv.payloads[0])
+	}
+}
+
+func TestSourceMappingPartialBatch(t *testing.T) {
+	queueArn := "arn:aws:sqs:" + Region() + ":" + AccountID() + ":myqueue"
+	streamArn := "arn:aws:kinesis:" + Region() + ":" + AccountID() + ":stream/mystream"
+	newKinesis := func(seqs ...string) *kinesisMock {
+		k := &kinesisMock{}
+		for _, seq := range seqs {
+			k.records = append(k.records, &kinesis.Record{SequenceNumber: aws.String(seq), PartitionKey: aws.String("pk"), Data: []byte(seq)})
+		}
+		return k
+	}
+	sequences := func(t *testing.T, payload []byte) string {
+		t.Helper()
+		var ev struct {
+			Records []kinesisRecord
+		}
+		if err := json.Unmarshal(payload, &ev); err != nil {
+			t.Fatal(err)
+		}
+		seqs := make([]string, 0, len(ev.Records))
+		for _, rec := range ev.Records {
+			seqs = append(seqs, rec.Kinesis.SequenceNumber)
+		}
+		return strings.Join(seqs, ",")
+	}
+
+	t.Run("validation", func(t *testing.T) {
+		s, _, _ := newTestSourceMappingService(t)
+		s.kinesis = newKinesis("1")
+		for _, tt := range []struct {
+			label string
+			input *lambda.CreateEventSourceMappingInput
+			opts  []MappingOption
+		}{
+			{"retry settings for sqs", &lambda.CreateEventSourceMappingInput{
+				FunctionName: aws.String("myfunc"), EventSourceArn: aws.String(queueArn), MaximumRetryAttempts: aws.Int64(1),
+			}, nil},
+			{"unknown response type", &lambda.CreateEventSourceMappingInput{
+				FunctionName: aws.String("myfunc"), EventSourceArn: aws.String(queueArn),
+			}, []MappingOption{WithFunctionResponseTypes([]string{"Unknown"})}},
+			{"record age", &lambda.CreateEventSourceMappingInput{
+				FunctionName: aws.String("myfunc"), EventSourceArn: aws.String(streamArn), StartingPosition: aws.String("LATEST"),
+				MaximumRecordAgeInSeconds: aws.Int64(maxMaximumRecordAge + 1),
+			}, nil},
+			{"destination", &lambda.CreateEventSourceMappingInput{
+				FunctionName: aws.String("myfunc"), EventSourceArn: aws.String(streamArn), StartingPosition: aws.String("LATEST"),
+				DestinationConfig: &lambda.DestinationConfig{OnFailure: &lambda.OnFailure{Destination: aws.String(functionARN("myfunc"))}},
+			}, nil},
+		} {
+			_, err := s.CreateEventSourceMapping(context.Background(), tt.input, tt.opts...)
+			if e, ok := err.(awserr.Error); !ok || e.Code() != lambda.ErrCodeInvalidParameterValueException {
+				t.Errorf("%s: unexpected error captured: %#v", tt.label, err)
+			}
+		}
+	})
+
+	t.Run("sqs", func(t *testing.T) {
+		s, q, inv := newTestSourceMappingService(t)
+		inv.responses = [][]byte{[]byte(`{"batchItemFailures":[{"itemIdentifier":"m1"}]}`)}
+		q.queue = []*sqs.Message{
+			{MessageId: aws.String("m1"), ReceiptHandle: aws.String("r1"), Body: aws.String("hello")},
+			{MessageId: aws.String("m2"), ReceiptHandle: aws.String("r2"), Body: aws.String("world")},
+		}
+		conf, err := s.CreateEventSourceMapping(context.Background(), &lambda.CreateEventSourceMappingInput{
+			FunctionName:   aws.String("myfunc"),
+			EventSourceArn: aws.String(queueArn),
+		}, WithFunctionResponseTypes([]string{FunctionResponseTypeReportBatchItemFailures}))
+		if err != nil {
+			t.Fatalf("unexpected error captured: %#v", err)
+		}
+		if types := s.FunctionResponseTypes(*conf.UUID); len(types) != 1 || types[0] != FunctionResponseTypeReportBatchItemFailures {
+			t.Errorf("unexpected response types: %v", types)
+		}
+		select {
+		case <-q.received:
+		case <-time.After(time.Second):
+			t.Fatal("messages are not received")
+		}
+		s.Close()
+		if len(q.deleted) != 1 || q.deleted[0] != "r2" {
+			t.Errorf("only succeeded messages should be deleted: %v", q.deleted)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		s, _, inv := newTestSourceMappingService(t)
+		s.dir = tempDir(t)
+		s.kinesis = newKinesis("1", "2", "3")
+		inv.responses = [][]byte{[]byte(`{"batchItemFailures":[{"itemIdentifier":"2"}]}`)}
+		if _, err := s.CreateEventSourceMapping(context.Background(), &lambda.CreateEventSourceMappingInput{
+			FunctionName:     aws.String("myfunc"),
+			EventSourceArn:   aws.String(streamArn),
+			StartingPosition: aws.String("TRIM_HORIZON"),
+		}, WithFunctionResponseTypes([]string{FunctionResponseTypeReportBatchItemFailures})); err != nil {
+			t.Fatalf("unexpected error captured: %#v", err)
+		}
+		waitFor(t, func() bool {
+			inv.mu.Lock()
+			defer inv.mu.Unlock()
+			return len(inv.payloads) == 2
+		})
+		s.Close()
+		if seqs := sequences(t, inv.payloads[1]); seqs != "2,3" {
+			t.Errorf("records should be retried from the failed item: %s", seqs)
+		}
+	})
+
+	t.Run("bisect and destination", func(t *testing.T) {
+		s, q, inv := newTestSourceMappingService(t)
+		s.dir = tempDir(t)
+		s.kinesis = newKinesis("1", "2")
+		inv.fail = true
+		if _, err := s.CreateEventSourceMapping(context.Background(), &lambda.CreateEventSourceMappingInput{
+			FunctionName:               aws.String("myfunc"),
+			EventSourceArn:             aws.String(streamArn),
+			StartingPosition:           aws.String("TRIM_HORIZON"),
+			BisectBatchOnFunctionError: aws.Bool(true),
+			MaximumRetryAttempts:       aws.Int64(0),
+			DestinationConfig:          &lambda.DestinationConfig{OnFailure: &lambda.OnFailure{Destination: aws.String(queueArn)}},
+		}); err != nil {
+			t.Fatalf("unexpected error captured: %#v", err)
+		}
+		waitFor(t, func() bool {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			return len(q.sent) == 2
+		})
+		s.Close()
+		var got []string
+		for _, p := range inv.payloads {
+			got = append(got, sequences(t, p))
+		}
+		if strings.Join(got, "|") != "1,2|1|2" {
+			t.Errorf("batch should be split on error: %v", got)
+		}
+		var f streamFailure
+		if err := json.Unmarshal([]byte(q.sent[0]), &f); err != nil {
+			t.Fatal(err)
+		}
+		if f.RequestContext.Condition != failureRetryAttemptsExhausted || f.KinesisBatchInfo == nil ||
+			f.KinesisBatchInfo.StartSequenceNumber != "1" || f.KinesisBatchInfo.BatchSize != 1 || f.ResponseContext.FunctionError != "Unhandled" {
+			t.Errorf("unexpected failure record: %s", q.sent[0])
+		}
+	})
+
+	t.Run("record age by virtual clock", func(t *testing.T) {
+		s, q, inv := newTestSourceMappingService(t)
+		s.dir = tempDir(t)
+		start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		clock := NewVirtualClock(start)
+		s.clock = clock
+		// arrival is stamped by wall clock, which is translated into virtual clock when record is read.
+		s.kinesis = &kinesisMock{records: []*kinesis.Record{
+			{SequenceNumber: aws.String("1"), PartitionKey: aws.String("pk"), Data: []byte("1"), ApproximateArrivalTimestamp: aws.Time(time.Now())},
+		}}
+		inv.fail = true
+		if _, err := s.CreateEventSourceMapping(context.Background(), &lambda.CreateEventSourceMappingInput{
+			FunctionName:              aws.String("myfunc"),
+			EventSourceArn:            aws.String(streamArn),
+			StartingPosition:          aws.String("TRIM_HORIZON"),
+			MaximumRecordAgeInSeconds: aws.Int64(60),
+			DestinationConfig:         &lambda.DestinationConfig{OnFailure: &lambda.OnFailure{Destination: aws.String(queueArn)}},
+		}); err != nil {
+			t.Fatalf("unexpected error captured: %#v", err)
+		}
+		// retries wait for virtual clock, so that record expires without waiting a minute.
+		waitFor(t, func() bool {
+			clock.Advance(30 * time.Second)
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			return len(q.sent) == 1
+		})
+		s.Close()
+		var f streamFailure
+		if err := json.Unmarshal([]byte(q.sent[0]), &f); err != nil {
+			t.Fatal(err)
+		}
+		ts, err := time.Parse(failureTimestampFormat, f.Timestamp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.RequestContext.Condition != failureRecordAgeExceeded || ts.Sub(start) <= time.Minute {
+			t.Errorf("unexpected failure record: %s", q.sent[0])
+		}
+	})
+
+	t.Run("expired record from TRIM_HORIZON", func(t *testing.T) {
+		for label, clock := range map[string]Clock{
+			"wall clock": systemClock{},
+			// virtual clock is unrelated to wall clock which stamps arrival of records.
+			"virtual clock": NewVirtualClock(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)),
+		} {
+			t.Run(label, func(t *testing.T) {
+				s, q, inv := newTestSourceMappingService(t)
+				s.dir = tempDir(t)
+				s.clock = clock
+				s.kinesis = &kinesisMock{records: []*kinesis.Record{
+					{SequenceNumber: aws.String("1"), PartitionKey: aws.String("pk"), Data: []byte("1"), ApproximateArrivalTimestamp: aws.Time(time.Now().Add(-time.Hour))},
+				}}
+				if _, err := s.CreateEventSourceMapping(context.Background(), &lambda.CreateEventSourceMappingInput{
+					FunctionName:              aws.String("myfunc"),
+					EventSourceArn:            aws.String(streamArn),
+					StartingPosition:          aws.String("TRIM_HORIZON"),
+					MaximumRecordAgeInSeconds: aws.Int64(60),
+					DestinationConfig:         &lambda.DestinationConfig{OnFailure: &lambda.OnFailure{Destination: aws.String(queueArn)}},
+				}); err != nil {
+					t.Fatalf("unexpected error captured: %#v", err)
+				}
+				waitFor(t, func() bool {
+					q.mu.Lock()
+					defer q.mu.Unlock()
+					return len(q.sent) == 1
+				})
+				s.Close()
+				if len(inv.payloads) > 0 {
+					t.Errorf("expired record should not be invoked: %s", inv.payloads[0])
+				}
+				var f streamFailure
+				if err := json.Unmarshal([]byte(q.sent[0]), &f); err != nil {
+					t.Fatal(err)
+				}
+				if f.RequestContext.Condition != failureRecordAgeExceeded || f.RequestContext.ApproximateInvokeCount != 0 {
+					t.Errorf("unexpected failure record: %s", q.sent[0])
+				}
+			})
+		}
+	})
+}
+
+func TestSourceMappingFilterCriteria(t *testing.T) {
+	queueArn := "arn:aws:sqs:" + Region() + ":" + AccountID() + ":myqueue"
+	streamArn := "arn:aws:kinesis:" + Region() + ":" + AccountID() + ":stream/mystream"
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		s, _, _ := newTestSourceMappingService(t)
+		_, err := s.CreateEventSourceMapping(context.Background(), &lambda.CreateEventSourceMappingInput{
+			FunctionName:   aws.String("myfunc"),
+			EventSourceArn: aws.String(queueArn),
+		}, WithFilterCriteria([]string{`{"body": "foo"}`}))
+		if e, ok := err.(awserr.Error); !ok || e.Code() != lambda.ErrCodeInvalidParameterValueException {
+			t.Errorf("unexpected error captured: %#v", err)
+		}
+	})
+
+	t.Run("sqs", func(t *testing.T) {
+		s, q, inv := newTestSourceMappingService(t)
+		q.queue = []*sqs.Message{
+			{MessageId: aws.String("m1"), ReceiptHandle: aws.String("r1"), Body: aws.String(`{"kind":"order","price":10}`)},
+			{MessageId: aws.String("m2"), ReceiptHandle: aws.String("r2"), Body: aws.String(`{"kind":"order","price":1}`)},
+			{MessageId: aws.String("m3"), ReceiptHandle: aws.String("r3"), Body: aws.String("plain text")},
+		}
+		conf, err := s.CreateEventSourceMapping(context.Background(), &lambda.CreateEventSourceMappingInput{
+			FunctionName:   aws.String("myfunc"),
+			EventSourceArn: aws.String(queueArn),
+		}, WithFilterCriteria([]string{`{"body": {"kind": ["order"], "price": [{"numeric": [">", 5]}]}}`}))
+		if err != nil {
+			t.Fatalf("unexpected error captured: %#v", err)
+		}
+		if patterns := s.FilterCriteria(*conf.UUID); len(patterns) != 1 {
+			t.Errorf("unexpected filter criteria: %v", patterns)
+		}
+		select {
+		case <-q.received:
+		case <-time.After(time.Second):
+			t.Fatal("messages are not received")
+		}
+		s.Close()
+		if len(inv.payloads) != 1 {
+			t.Fatalf("function should be invoked once: %d", len(inv.payloads))
+		}
+		var ev sqsEvent
+		if err := json.Unmarshal(inv.payloads[0], &ev); err != nil {
+			t.Fatal(err)
+		}
+		if len(ev.Records) != 1 || ev.Records[0].MessageID != "m1" {
+			t.Errorf("unexpected event: %s", inv.payloads[0])
+		}
+		if len(q.deleted) != 3 {
+			t.Errorf("filtered messages should be deleted: %v", q.deleted)
+		}
+	})
+
+	t.Run("kinesis", func(t *testing.T) {
+		s, _, inv := newTestSourceMappingService(t)
+		s.dir = tempDir(t)
+		k := &kinesisMock{}
+		for i, data := range []string{`{"city":"Tokyo"}`, `{"city":"Osaka"}`, `{"city":"Tokyo"}`} {
+			seq := strconv.Itoa(i + 1)
+			k.records = append(k.records, &kinesis.Record{SequenceNumber: aws.String(seq), PartitionKey: aws.String("pk" + seq), Data: []byte(data)})
+		}
+		s.kinesis = k
+		conf, err := s.CreateEventSourceMapping(context.Background(), &lambda.CreateEventSourceMappingInput{
+			FunctionName:     aws.String("myfunc"),
+			EventSourceArn:   aws.String(streamArn),
+			StartingPosition: aws.String("TRIM_HORIZON"),
+		}, WithFilterCriteria([]string{`{"data": {"city": ["Tokyo"]}}`, `{"partitionKey": ["pk2"], "data": {"city": ["Kyoto"]}}`}))
+		if err != nil {
+			t.Fatalf("unexpected error captured: %#v", err)
+		}
+		waitFor(t, func() bool {
+			inv.mu.Lock()
+			defer inv.mu.Unlock()
+			return len(inv.payloads) == 1
+		})
+		var ev struct {
+			Records []kinesisRecord
+		}
+		if err := json.Unmarshal(inv.payloads[0], &ev); err != nil {
+			t.Fatal(err)
+		}
+		if len(ev.Records) != 2 || ev.Records[0].Kinesis.SequenceNumber != "1" || ev.Records[1].Kinesis.SequenceNumber != "3" {
+			t.Errorf("unexpected event: %s", inv.payloads[0])
+		}
+
+		// removing filters delivers all records.
+		s.transitions.Wait()
+		if _, err := s.UpdateEventSourceMapping(context.Background(), &lambda.UpdateEventSourceMappingInput{UUID: conf.UUID}, WithFilterCriteria(nil)); err != nil {
+			t.Fatalf("unexpected error captured: %#v", err)
+		}
+		if patterns := s.FilterCriteria(*conf.UUID); len(patterns) != 0 {
+			t.Errorf("filter criteria should be removed: %v", patterns)
+		}
+	})
+}
+
+func TestSourceMappingEmbeddedSQS(t *testing.T) {
+	s, _, inv := newTestSourceMappingService(t)
+	q := sqsd.New(Region(), AccountID(), "http://localhost:9324")
+	s.sqs = q
+	ctx := context.Background()
+	created, err := q.CreateQueueWithContext(ctx, &sqs.CreateQueueInput{QueueName: aws.String("myqueue")})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if _, err := q.SendMessageWithContext(ctx, &sqs.SendMessageInput{QueueUrl: created.QueueUrl, MessageBody: aws.String("hello")}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if _, err := s.CreateEventSourceMapping(ctx, &lambda.CreateEventSourceMappingInput{
+		FunctionName:   aws.String("myfunc"),
+		EventSourceArn: aws.String("arn:aws:sqs:" + Region() + ":" + AccountID() + ":myqueue"),
+	}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	waitFor(t, func() bool {
+		out, _ := q.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{
+			QueueUrl:       created.QueueUrl,
+			AttributeNames: aws.StringSlice([]string{"All"}),
+		})
+		return aws.StringValue(out.Attributes["ApproximateNumberOfMessages"]) == "0" &&
+			aws.StringValue(out.Attributes["ApproximateNumberOfMessagesNotVisible"]) == "0"
+	})
+	s.Close()
+	var ev sqsEvent
+	if err := json.Unmarshal(inv.payloads[0], &ev); err != nil {
+		t.Fatal(err)
+	}
+	if len(ev.Records) != 1 || ev.Records[0].Body != "hello" || ev.Records[0].Attributes["ApproximateReceiveCount"] != "1" {
+		t.Errorf("unexpected event: %s", inv.payloads[0])
+	}
+}
+
+func TestSourceMappingEmbeddedKinesis(t *testing.T) {
+	s, _, inv := newTestSourceMappingService(t)
+	k := kinesisd.New(Region(), AccountID())
+	s.kinesis = k
+	s.dir = tempDir(t)
+	ctx := context.Background()
+	if _, err := k.CreateStreamWithContext(ctx, &kinesis.CreateStreamInput{StreamName: aws.String("mystream"), ShardCount: aws.Int64(2)}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	shards := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		out, err := k.PutRecordWithContext(ctx, &kinesis.PutRecordInput{
+			StreamName:   aws.String("mystream"),
+			PartitionKey: aws.String("key" + strconv.Itoa(i)),
+			Data:         []byte(`{"n":` + strconv.Itoa(i) + `}`),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error captured: %#v", err)
+		}
+		shards[*out.ShardId] = true
+	}
+	if len(shards) != 2 {
+		t.Errorf("records should be distributed across shards: %v", shards)
+	}
+	if _, err := s.CreateEventSourceMapping(ctx, &lambda.CreateEventSourceMappingInput{
+		FunctionName:     aws.String("myfunc"),
+		EventSourceArn:   aws.String("arn:aws:kinesis:" + Region() + ":" + AccountID() + ":stream/mystream"),
+		StartingPosition: aws.String("TRIM_HORIZON"),
+	}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	received := func() map[string]bool {
+		inv.mu.Lock()
+		defer inv.mu.Unlock()
+		keys := map[string]bool{}
+		for _, p := range inv.payloads {
+			var ev struct {
+				Records []kinesisRecord
+			}
+			json.Unmarshal(p, &ev)
+			for _, r := range ev.Records {
+				keys[r.Kinesis.PartitionKey] = true
+			}
+		}
+		return keys
+	}
+	waitFor(t, func() bool { return len(received()) == 10 })
+}
@@ -0,0 +1,288 @@
+package wheelamb
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+const (
+	defaultSQSBatchSize = 10
+	maxSQSBatchSize     = 10000
+	maxBatchingWindow   = 300
+	// sqsReceiveLimit is the maximum number of messages which one ReceiveMessage returns.
+	sqsReceiveLimit = 10
+	// sqsWaitTimeSeconds is the maximum wait time for long polling.
+	sqsWaitTimeSeconds = 20
+	// pollRetryInterval is the interval before polling again after failure or empty response.
+	pollRetryInterval = time.Second
+)
+
+// sqsMessageAttribute describes message attribute in sqs event.
+type sqsMessageAttribute struct {
+	StringValue      *string   `json:"stringValue,omitempty"`
+	BinaryValue      []byte    `json:"binaryValue,omitempty"`
+	StringListValues []*string `json:"stringListValues"`
+	BinaryListValues [][]byte  `json:"binaryListValues"`
+	DataType         string    `json:"dataType"`
+}
+
+// sqsRecord describes message in sqs event.
+// via https://docs.aws.amazon.com/lambda/latest/dg/with-sqs.html
+type sqsRecord struct {
+	MessageID         string                         `json:"messageId"`
+	ReceiptHandle     string                         `json:"receiptHandle"`
+	Body              string                         `json:"body"`
+	Attributes        map[string]string              `json:"attributes"`
+	MessageAttributes map[string]sqsMessageAttribute `json:"messageAttributes"`
+	MD5OfBody         string                         `json:"md5OfBody"`
+	EventSource       string                         `json:"eventSource"`
+	EventSourceARN    string                         `json:"eventSourceARN"`
+	AWSRegion         string                         `json:"awsRegion"`
+}
+
+type sqsEvent struct {
+	Records []sqsRecord `json:"Records"`
+}
+
+// newSQSEvent builds lambda event from received messages.
+func newSQSEvent(queueArn string, msgs []*sqs.Message) *sqsEvent {
+	ev := &sqsEvent{Records: make([]sqsRecord, 0, len(msgs))}
+	for _, msg := range msgs {
+		attrs := make(map[string]sqsMessageAttribute, len(msg.MessageAttributes))
+		for k, v := range msg.MessageAttributes {
+			attrs[k] = sqsMessageAttribute{
+				StringValue:      v.StringValue,
+				BinaryValue:      v.BinaryValue,
+				StringListValues: append([]*string{}, v.StringListValues...),
+				BinaryListValues: append([][]byte{}, v.BinaryListValues...),
+				DataType:         aws.StringValue(v.DataType),
+			}
+		}
+		ev.Records = append(ev.Records, sqsRecord{
+			MessageID:         aws.StringValue(msg.MessageId),
+			ReceiptHandle:     aws.StringValue(msg.ReceiptHandle),
+			Body:              aws.StringValue(msg.Body),
+			Attributes:        aws.StringValueMap(msg.Attributes),
+			MessageAttributes: attrs,
+			MD5OfBody:         aws.StringValue(msg.MD5OfBody),
+			EventSource:       "aws:sqs",
+			EventSourceARN:    queueArn,
+			AWSRegion:         Region(),
+		})
+	}
+	return ev
+}
+
+// validateSQSMapping fills default settings of mapping for sqs queue and validates them.
+func validateSQSMapping(conf *lambda.EventSourceMappingConfiguration) error {
+	if conf.BatchSize == nil {
+		conf.BatchSize = aws.Int64(defaultSQSBatchSize)
+	}
+	if conf.MaximumBatchingWindowInSeconds == nil {
+		conf.MaximumBatchingWindowInSeconds = aws.Int64(0)
+	}
+	size, window := *conf.BatchSize, *conf.MaximumBatchingWindowInSeconds
+	if size < 1 || size > maxSQSBatchSize {
+		return awserr.New(lambda.ErrCodeInvalidParameterValueException, "BatchSize must be between 1 and "+strconv.Itoa(maxSQSBatchSize), nil)
+	}
+	if window < 0 || window > maxBatchingWindow {
+		return awserr.New(lambda.ErrCodeInvalidParameterValueException, "MaximumBatchingWindowInSeconds must be between 0 and "+strconv.Itoa(maxBatchingWindow), nil)
+	}
+	if conf.ParallelizationFactor != nil {
+		return awserr.New(lambda.ErrCodeInvalidParameterValueException, "ParallelizationFactor is not supported for sqs", nil)
+	}
+	if conf.BisectBatchOnFunctionError != nil || conf.MaximumRecordAgeInSeconds != nil || conf.MaximumRetryAttempts != nil || onFailureDestination(conf) != "" {
+		return awserr.New(lambda.ErrCodeInvalidParameterValueException, "retry settings and destination are not supported for sqs, use redrive policy of queue instead", nil)
+	}
+	if size > sqsReceiveLimit && window < 1 {
+		return awserr.New(lambda.ErrCodeInvalidParameterValueException, "MaximumBatchingWindowInSeconds must be set when BatchSize is greater than 10", nil)
+	}
+	return nil
+}
+
+// sqsPoller resolves url of sqs queue and returns its poller.
+func (s *SourceMappingService) sqsPoller(ctx context.Context, conf *lambda.EventSourceMappingConfiguration) (pollerFunc, error) {
+	queueArn := *conf.EventSourceArn
+	name := arnResource(queueArn)
+	if name == "" {
+		return nil, awserr.New(lambda.ErrCodeInvalidParameterValueException, "invalid queue arn: "+queueArn, nil)
+	}
+	out, err := s.sqs.GetQueueUrlWithContext(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(name)})
+	if err != nil {
+		return nil, awserr.New(lambda.ErrCodeInvalidParameterValueException, "queue not found: "+queueArn, err)
+	}
+	queueURL := *out.QueueUrl
+	return func(ctx context.Context, m *eventSourceMapping) {
+		s.pollSQS(ctx, m, queueURL)
+	}, nil
+}
+
+// pollSQS receives messages from queue and invokes function with them until ctx is done.
+// Messages are deleted only when function succeeds, otherwise they are redelivered after visibility timeout.
+// With ReportBatchItemFailures, only failed items reported by function are redelivered.
+func (s *SourceMappingService) pollSQS(ctx context.Context, m *eventSourceMapping, queueURL string) {
+	for ctx.Err() == nil {
+		conf := m.configuration()
+		msgs, err := s.receiveSQS(ctx, queueURL, *conf.BatchSize, time.Duration(*conf.MaximumBatchingWindowInSeconds)*time.Second)
+		if err != nil && ctx.Err() == nil {
+			m.setResult("PROBLEM: " + err.Error())
+		}
+		if len(msgs) == 0 {
+			if err != nil {
+				sleepContext(ctx, systemClock{}, pollRetryInterval)
+			}
+			continue
+		}
+		// messages which do not match filters are deleted without invocation.
+		msgs, dropped := m.filterSQS(*conf.EventSourceArn, msgs)
+		if len(dropped) > 0 {
+			if err := s.deleteSQS(ctx, queueURL, dropped); err != nil {
+				m.setResult("PROBLEM: " + err.Error())
+			}
+		}
+		if len(msgs) == 0 {
+			continue
+		}
+		processed, err := s.invokeSQS(ctx, m, conf, msgs)
+		if err != nil && ctx.Err() == nil {
+			m.setResult("PROBLEM: " + err.Error())
+		}
+		if len(processed) > 0 {
+			if err := s.deleteSQS(ctx, queueURL, processed); err != nil {
+				m.setResult("PROBLEM: " + err.Error())
+				continue
+			}
+		}
+		if err == nil {
+			m.setResult("OK")
+		}
+	}
+}
+
+// receiveSQS receives messages up to batch size until batching window passes.
+// Without batching window, it returns messages of the first non-empty response.
+func (s *SourceMappingService) receiveSQS(ctx context.Context, queueURL string, size int64, window time.Duration) ([]*sqs.Message, error) {
+	deadline := time.Now().Add(window)
+	var msgs []*sqs.Message
+	for int64(len(msgs)) < size {
+		wait := int64(sqsWaitTimeSeconds)
+		if window > 0 {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				break
+			}
+			if sec := int64((remaining + time.Second - 1) / time.Second); sec < wait {
+				wait = sec
+			}
+		}
+		n := size - int64(len(msgs))
+		if n > sqsReceiveLimit {
+			n = sqsReceiveLimit
+		}
+		out, err := s.sqs.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(queueURL),
+			MaxNumberOfMessages:   aws.Int64(n),
+			WaitTimeSeconds:       aws.Int64(wait),
+			AttributeNames:        aws.StringSlice([]string{sqs.QueueAttributeNameAll}),
+			MessageAttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameAll}),
+		})
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, out.Messages...)
+		if window == 0 && len(msgs) > 0 {
+			break
+		}
+	}
+	return msgs, nil
+}
+
+// invokeSQS invokes function of the mapping with messages, and returns processed messages which can be deleted.
+// With ReportBatchItemFailures, messages except failed items reported by function are processed.
+func (s *SourceMappingService) invokeSQS(ctx context.Context, m *eventSourceMapping, conf *lambda.EventSourceMappingConfiguration, msgs []*sqs.Message) ([]*sqs.Message, error) {
+	out, err := s.invokeEvent(ctx, conf, newSQSEvent(*conf.EventSourceArn, msgs))
+	if err != nil {
+		return nil, err
+	}
+	if !m.reportBatchItemFailures() {
+		return msgs, nil
+	}
+	ids, ok := batchItemFailures(out.Payload)
+	if !ok {
+		return nil, awserr.New(errCodeInvalidBatchResponse, "invalid batchItemFailures response: "+string(out.Payload), nil)
+	}
+	failed := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		failed[id] = true
+	}
+	processed := make([]*sqs.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		if failed[*msg.MessageId] {
+			delete(failed, *msg.MessageId)
+			continue
+		}
+		processed = append(processed, msg)
+	}
+	for id := range failed {
+		return nil, awserr.New(errCodeInvalidBatchResponse, "unknown itemIdentifier: "+id, nil)
+	}
+	if len(processed) < len(msgs) {
+		return processed, awserr.New(errCodeBatchItemFailure, "function reported failure of "+strconv.Itoa(len(msgs)-len(processed))+" messages", nil)
+	}
+	return processed, nil
+}
+
+// invokeEvent invokes function of the mapping with given event.
+// Error is returned also when function fails.
+func (s *SourceMappingService) invokeEvent(ctx context.Context, conf *lambda.EventSourceMappingConfiguration, ev interface{}) (*lambda.InvokeOutput, error) {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+	out, err := s.lambda.InvokeSync(ctx, &lambda.InvokeInput{
+		FunctionName: conf.FunctionArn,
+		Payload:      payload,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out.FunctionError != nil {
+		return out, awserr.New(errCodeFunctionError, aws.StringValue(out.FunctionError)+": "+string(out.Payload), nil)
+	}
+	return out, nil
+}
+
+// deleteSQS deletes processed messages from queue.
+func (s *SourceMappingService) deleteSQS(ctx context.Context, queueURL string, msgs []*sqs.Message) error {
+	for i := 0; i < len(msgs); i += sqsReceiveLimit {
+		end := i + sqsReceiveLimit
+		if end > len(msgs) {
+			end = len(msgs)
+		}
+		entries := make([]*sqs.DeleteMessageBatchRequestEntry, 0, end-i)
+		for j, msg := range msgs[i:end] {
+			entries = append(entries, &sqs.DeleteMessageBatchRequestEntry{
+				Id:            aws.String(strconv.Itoa(i + j)),
+				ReceiptHandle: msg.ReceiptHandle,
+			})
+		}
+		out, err := s.sqs.DeleteMessageBatchWithContext(ctx, &sqs.DeleteMessageBatchInput{
+			QueueUrl: aws.String(queueURL),
+			Entries:  entries,
+		})
+		if err != nil {
+			return err
+		}
+		if len(out.Failed) > 0 {
+			return awserr.New(aws.StringValue(out.Failed[0].Code), aws.StringValue(out.Failed[0].Message), nil)
+		}
+	}
+	return nil
+}
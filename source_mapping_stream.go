@@ -0,0 +1,509 @@
+package wheelamb
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+const (
+	defaultStreamBatchSize       = 100
+	maxStreamBatchSize           = 10000
+	maxParallelizationFactor     = 10
+	defaultParallelizationFactor = 1
+	// streamPollInterval is the interval of GetRecords for each shard.
+	streamPollInterval = time.Second
+	// shardRefreshInterval is the interval of discovering new shards after resharding.
+	shardRefreshInterval = 10 * time.Second
+)
+
+// shard iterator types shared by kinesis and dynamodb streams.
+const (
+	iteratorTrimHorizon         = "TRIM_HORIZON"
+	iteratorLatest              = "LATEST"
+	iteratorAtTimestamp         = "AT_TIMESTAMP"
+	iteratorAfterSequenceNumber = "AFTER_SEQUENCE_NUMBER"
+)
+
+// streamShard describes shard of stream.
+type streamShard struct {
+	id string
+	// parents are shards which must be processed before this shard.
+	parents []string
+}
+
+// streamRecord is record read from shard.
+type streamRecord struct {
+	sequenceNumber string
+	// partitionKey decides the order of records with ParallelizationFactor.
+	partitionKey string
+	// arrival is the time when record was added into stream.
+	arrival time.Time
+	// skew is offset of clock of SourceMappingService from wall clock when record was read,
+	// which translates arrival into the clock.
+	skew time.Duration
+	// event is the record in lambda event.
+	event interface{}
+	// subject returns the value which filters of mapping match.
+	subject func() interface{}
+}
+
+type streamEvent struct {
+	Records []interface{} `json:"Records"`
+}
+
+// streamPosition describes where shard iterator starts.
+type streamPosition struct {
+	iteratorType   string
+	sequenceNumber string
+	timestamp      *time.Time
+}
+
+// streamReader reads records from shards of kinesis or dynamodb stream.
+type streamReader interface {
+	shards(ctx context.Context) ([]streamShard, error)
+	iterator(ctx context.Context, shardID string, pos streamPosition) (*string, error)
+	// records returns records and next iterator, which is nil when shard is closed.
+	records(ctx context.Context, shardID string, iterator *string, limit int64) ([]streamRecord, *string, error)
+	// batchInfoKey returns key of batch info in records sent to OnFailure destination.
+	batchInfoKey() string
+}
+
+// validateStreamMapping fills default settings of mapping for stream and validates them.
+func validateStreamMapping(conf *lambda.EventSourceMappingConfiguration) error {
+	if conf.BatchSize == nil {
+		conf.BatchSize = aws.Int64(defaultStreamBatchSize)
+	}
+	if conf.MaximumBatchingWindowInSeconds == nil {
+		conf.MaximumBatchingWindowInSeconds = aws.Int64(0)
+	}
+	if conf.ParallelizationFactor == nil {
+		conf.ParallelizationFactor = aws.Int64(defaultParallelizationFactor)
+	}
+	if size := *conf.BatchSize; size < 1 || size > maxStreamBatchSize {
+		return awserr.New(lambda.ErrCodeInvalidParameterValueException, "BatchSize must be between 1 and "+strconv.Itoa(maxStreamBatchSize), nil)
+	}
+	if window := *conf.MaximumBatchingWindowInSeconds; window < 0 || window > maxBatchingWindow {
+		return awserr.New(lambda.ErrCodeInvalidParameterValueException, "MaximumBatchingWindowInSeconds must be between 0 and "+strconv.Itoa(maxBatchingWindow), nil)
+	}
+	if f := *conf.ParallelizationFactor; f < 1 || f > maxParallelizationFactor {
+		return awserr.New(lambda.ErrCodeInvalidParameterValueException, "ParallelizationFactor must be between 1 and "+strconv.Itoa(maxParallelizationFactor), nil)
+	}
+	return nil
+}
+
+// startingPosition validates StartingPosition of mapping for stream.
+func startingPosition(position *string, timestamp *time.Time) (streamPosition, error) {
+	switch p := aws.StringValue(position); p {
+	case iteratorTrimHorizon, iteratorLatest:
+		return streamPosition{iteratorType: p}, nil
+	case iteratorAtTimestamp:
+		if timestamp == nil {
+			return streamPosition{}, awserr.New(lambda.ErrCodeInvalidParameterValueException, "StartingPositionTimestamp is required for AT_TIMESTAMP", nil)
+		}
+		return streamPosition{iteratorType: p, timestamp: timestamp}, nil
+	case "":
+		return streamPosition{}, awserr.New(lambda.ErrCodeInvalidParameterValueException, "StartingPosition is required for stream", nil)
+	default:
+		return streamPosition{}, awserr.New(lambda.ErrCodeInvalidParameterValueException, "invalid StartingPosition: "+p, nil)
+	}
+}
+
+// checkpoints persists the last processed sequence number of each shard,
+// so that stream is resumed from there after restart.
+type checkpoints struct {
+	mu   sync.Mutex
+	path string
+	seqs map[string]string
+}
+
+// loadCheckpoints reads checkpoints of mapping between given event source and function.
+// Empty dir keeps checkpoints only in memory.
+func loadCheckpoints(dir, eventSourceArn, functionArn string) (*checkpoints, error) {
+	c := &checkpoints{seqs: map[string]string{}}
+	if dir == "" {
+		return c, nil
+	}
+	sum := sha1.Sum([]byte(eventSourceArn + "\n" + functionArn))
+	c.path = filepath.Join(dir, hex.EncodeToString(sum[:])+".json")
+	b, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &c.seqs); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *checkpoints) get(shardID string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.seqs[shardID]
+}
+
+// set records sequence number of shard and writes all checkpoints into file.
+func (c *checkpoints) set(shardID, seq string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seqs[shardID] = seq
+	if c.path == "" {
+		return nil
+	}
+	b, err := json.Marshal(c.seqs)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(c.path), ".checkpoint")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), c.path)
+}
+
+// remove deletes checkpoints file.
+func (c *checkpoints) remove() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.path != "" {
+		os.Remove(c.path)
+	}
+}
+
+// streamPoller returns poller of stream and cleanup function removing its checkpoints.
+func (s *SourceMappingService) streamPoller(conf *lambda.EventSourceMappingConfiguration, r streamReader, start streamPosition) (pollerFunc, func(), error) {
+	cp, err := loadCheckpoints(s.dir, *conf.EventSourceArn, *conf.FunctionArn)
+	if err != nil {
+		return nil, nil, awserr.New(lambda.ErrCodeServiceException, "failed to load checkpoints", err)
+	}
+	return func(ctx context.Context, m *eventSourceMapping) {
+		s.pollStream(ctx, m, r, start, cp)
+	}, cp.remove, nil
+}
+
+// pollStream processes shards of stream until ctx is done.
+// Child shards are processed after their parents are finished.
+func (s *SourceMappingService) pollStream(ctx context.Context, m *eventSourceMapping, r streamReader, start streamPosition, cp *checkpoints) {
+	var (
+		wg       sync.WaitGroup
+		initial  map[string]bool
+		running  = map[string]bool{}
+		finished = map[string]bool{}
+		done     = make(chan string)
+	)
+	defer wg.Wait()
+	for {
+		shards, err := r.shards(ctx)
+		if err != nil && ctx.Err() == nil {
+			m.setResult("PROBLEM: " + err.Error())
+		}
+		listed := make(map[string]bool, len(shards))
+		for _, sh := range shards {
+			listed[sh.id] = true
+		}
+		if err == nil && initial == nil {
+			initial = listed
+		}
+	SHARDS:
+		for _, sh := range shards {
+			if running[sh.id] || finished[sh.id] {
+				continue
+			}
+			for _, p := range sh.parents {
+				if listed[p] && !finished[p] {
+					continue SHARDS
+				}
+			}
+			// shards created after the mapping starts are read from the beginning.
+			pos := start
+			if !initial[sh.id] {
+				pos = streamPosition{iteratorType: iteratorTrimHorizon}
+			}
+			if seq := cp.get(sh.id); seq != "" {
+				pos = streamPosition{iteratorType: iteratorAfterSequenceNumber, sequenceNumber: seq}
+			}
+			running[sh.id] = true
+			wg.Add(1)
+			go func(id string, pos streamPosition) {
+				defer wg.Done()
+				s.pollShard(ctx, m, r, id, pos, cp)
+				select {
+				case done <- id:
+				case <-ctx.Done():
+				}
+			}(sh.id, pos)
+		}
+
+		t := time.NewTimer(shardRefreshInterval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case id := <-done:
+			delete(running, id)
+			finished[id] = true
+		case <-t.C:
+		}
+		t.Stop()
+	}
+}
+
+// pollShard reads records of shard in order and invokes function with them until shard is closed.
+// Failed batch is retried until it succeeds, and checkpoint is saved after each success.
+func (s *SourceMappingService) pollShard(ctx context.Context, m *eventSourceMapping, r streamReader, shardID string, pos streamPosition, cp *checkpoints) {
+	var (
+		iterator *string
+		pending  []streamRecord
+		since    time.Time
+		lastRead string
+		closed   bool
+	)
+	for ctx.Err() == nil {
+		conf := m.configuration()
+		size := *conf.BatchSize
+		window := time.Duration(*conf.MaximumBatchingWindowInSeconds) * time.Second
+		if !closed && int64(len(pending)) < size {
+			if iterator == nil {
+				p := pos
+				if lastRead != "" {
+					p = streamPosition{iteratorType: iteratorAfterSequenceNumber, sequenceNumber: lastRead}
+				}
+				it, err := r.iterator(ctx, shardID, p)
+				if err != nil {
+					if ctx.Err() == nil {
+						m.setResult("PROBLEM: " + err.Error())
+					}
+					sleepContext(ctx, systemClock{}, pollRetryInterval)
+					continue
+				}
+				iterator = it
+			}
+			recs, next, err := r.records(ctx, shardID, iterator, size-int64(len(pending)))
+			if err != nil {
+				if ctx.Err() == nil {
+					m.setResult("PROBLEM: " + err.Error())
+				}
+				// iterator may be expired, so that it is acquired again from the last record.
+				iterator = nil
+				sleepContext(ctx, systemClock{}, pollRetryInterval)
+				continue
+			}
+			if len(pending) == 0 {
+				since = time.Now()
+			}
+			if len(recs) > 0 {
+				lastRead = recs[len(recs)-1].sequenceNumber
+				skew := s.clock.Now().Sub(time.Now())
+				for i := range recs {
+					recs[i].skew = skew
+				}
+				pending = append(pending, m.filterRecords(recs)...)
+				// records are all filtered out, so that checkpoint moves forward without invocation.
+				if len(pending) == 0 {
+					if err := cp.set(shardID, lastRead); err != nil {
+						m.setResult("PROBLEM: failed to save checkpoint: " + err.Error())
+					}
+				}
+			}
+			iterator = next
+			closed = next == nil
+		}
+		if len(pending) == 0 {
+			if closed {
+				return
+			}
+			sleepContext(ctx, systemClock{}, streamPollInterval)
+			continue
+		}
+		if int64(len(pending)) < size && !closed && time.Since(since) < window {
+			sleepContext(ctx, systemClock{}, streamPollInterval)
+			continue
+		}
+
+		n := len(pending)
+		if int64(n) > size {
+			n = int(size)
+		}
+		if !s.deliverStream(ctx, m, r, shardID, pending[:n]) {
+			continue
+		}
+		if err := cp.set(shardID, pending[n-1].sequenceNumber); err != nil {
+			m.setResult("PROBLEM: failed to save checkpoint: " + err.Error())
+		}
+		pending = pending[n:]
+		since = time.Now()
+	}
+}
+
+// deliverStream delivers records to function until all of them are processed or discarded,
+// and returns false when ctx is done before that.
+// Records are split by partition key into ParallelizationFactor batches which are delivered concurrently,
+// so that records with the same key are delivered in order.
+func (s *SourceMappingService) deliverStream(ctx context.Context, m *eventSourceMapping, r streamReader, shardID string, records []streamRecord) bool {
+	factor := aws.Int64Value(m.configuration().ParallelizationFactor)
+	if factor < 1 {
+		factor = 1
+	}
+	batches := make([][]streamRecord, factor)
+	for _, rec := range records {
+		h := fnv.New32a()
+		h.Write([]byte(rec.partitionKey))
+		i := int64(h.Sum32()) % factor
+		batches[i] = append(batches[i], rec)
+	}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+		ok = true
+	)
+	for _, batch := range batches {
+		if len(batch) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(batch []streamRecord) {
+			defer wg.Done()
+			if !s.deliverRecords(ctx, m, r, shardID, batch) {
+				mu.Lock()
+				ok = false
+				mu.Unlock()
+			}
+		}(batch)
+	}
+	wg.Wait()
+	return ok
+}
+
+// deliverRecords invokes function with records and retries failed ones in order.
+// Failed batch is split in half with BisectBatchOnFunctionError, and records are discarded to OnFailure destination
+// when retries are exhausted or they are older than MaximumRecordAgeInSeconds.
+func (s *SourceMappingService) deliverRecords(ctx context.Context, m *eventSourceMapping, r streamReader, shardID string, records []streamRecord) bool {
+	type attempt struct {
+		records []streamRecord
+		retries int64
+	}
+	discard := func(conf *lambda.EventSourceMappingConfiguration, a attempt, condition string, out *lambda.InvokeOutput) {
+		if err := s.sendStreamFailure(ctx, conf, r.batchInfoKey(), shardID, a.records, condition, a.retries, out); err != nil {
+			m.setResult("PROBLEM: failed to send records to OnFailure destination: " + err.Error())
+		}
+	}
+	queue := []attempt{{records: records}}
+	for len(queue) > 0 {
+		if ctx.Err() != nil {
+			return false
+		}
+		conf := m.configuration()
+		a := queue[0]
+		if age := aws.Int64Value(conf.MaximumRecordAgeInSeconds); age > 0 {
+			oldest := s.clock.Now().Add(-time.Duration(age) * time.Second)
+			var expired, fresh []streamRecord
+			for _, rec := range a.records {
+				if !rec.arrival.IsZero() && rec.arrival.Add(rec.skew).Before(oldest) {
+					expired = append(expired, rec)
+				} else {
+					fresh = append(fresh, rec)
+				}
+			}
+			if len(expired) > 0 {
+				discard(conf, attempt{expired, a.retries}, failureRecordAgeExceeded, nil)
+				a.records = fresh
+			}
+			if len(a.records) == 0 {
+				queue = queue[1:]
+				continue
+			}
+		}
+
+		from, out, err := s.invokeRecords(ctx, m, conf, a.records)
+		if from == len(a.records) {
+			m.setResult("OK")
+			queue = queue[1:]
+			continue
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		m.setResult("PROBLEM: " + err.Error())
+		// records before the first failed item are already processed.
+		a.records = a.records[from:]
+		if aws.BoolValue(conf.BisectBatchOnFunctionError) && from == 0 && len(a.records) > 1 {
+			half := len(a.records) / 2
+			queue = append([]attempt{{a.records[:half], a.retries}, {a.records[half:], a.retries}}, queue[1:]...)
+			continue
+		}
+		a.retries++
+		if max := aws.Int64Value(conf.MaximumRetryAttempts); max >= 0 && a.retries > max {
+			discard(conf, a, failureRetryAttemptsExhausted, out)
+			queue = queue[1:]
+			continue
+		}
+		queue[0] = a
+		sleepContext(ctx, s.clock, pollRetryInterval)
+	}
+	return true
+}
+
+// invokeRecords invokes function with records, and returns index of the first failed record.
+// With ReportBatchItemFailures, records before the first failed item reported by function are processed.
+func (s *SourceMappingService) invokeRecords(ctx context.Context, m *eventSourceMapping, conf *lambda.EventSourceMappingConfiguration, records []streamRecord) (int, *lambda.InvokeOutput, error) {
+	events := make([]interface{}, 0, len(records))
+	for _, rec := range records {
+		events = append(events, rec.event)
+	}
+	out, err := s.invokeEvent(ctx, conf, &streamEvent{Records: events})
+	if err != nil {
+		return 0, out, err
+	}
+	if !m.reportBatchItemFailures() {
+		return len(records), out, nil
+	}
+	ids, ok := batchItemFailures(out.Payload)
+	if !ok {
+		return 0, out, awserr.New(errCodeInvalidBatchResponse, "invalid batchItemFailures response: "+string(out.Payload), nil)
+	}
+	from := len(records)
+	for _, id := range ids {
+		i := 0
+		for i < len(records) && records[i].sequenceNumber != id {
+			i++
+		}
+		if i == len(records) {
+			return 0, out, awserr.New(errCodeInvalidBatchResponse, "unknown itemIdentifier: "+id, nil)
+		}
+		if i < from {
+			from = i
+		}
+	}
+	if from < len(records) {
+		err = awserr.New(errCodeBatchItemFailure, "function reported failure from "+records[from].sequenceNumber, nil)
+	}
+	return from, out, err
+}
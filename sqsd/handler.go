@@ -0,0 +1,119 @@
+package sqsd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/google/uuid"
+	"github.com/taiyoh/wheelamb/internal/query"
+)
+
+const (
+	jsonTargetPrefix = "AmazonSQS."
+	xmlNamespace     = "http://queue.amazonaws.com/doc/2012-11-05/"
+)
+
+// actions are operations which handler serves.
+var actions = map[string]bool{
+	"CreateQueue":             true,
+	"DeleteQueue":             true,
+	"GetQueueUrl":             true,
+	"ListQueues":              true,
+	"GetQueueAttributes":      true,
+	"SetQueueAttributes":      true,
+	"PurgeQueue":              true,
+	"SendMessage":             true,
+	"SendMessageBatch":        true,
+	"ReceiveMessage":          true,
+	"DeleteMessage":           true,
+	"DeleteMessageBatch":      true,
+	"ChangeMessageVisibility": true,
+}
+
+// handler serves Service over query protocol, or json protocol when X-Amz-Target header is given.
+type handler struct {
+	svc *Service
+}
+
+// NewHandler returns http.Handler which serves SQS API of svc.
+func NewHandler(svc *Service) http.Handler {
+	return &handler{svc: svc}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	w.Header().Set("x-amzn-RequestId", requestID)
+
+	target := r.Header.Get("X-Amz-Target")
+	useJSON := strings.HasPrefix(target, jsonTargetPrefix)
+	action := strings.TrimPrefix(target, jsonTargetPrefix)
+	if !useJSON {
+		if err := r.ParseForm(); err != nil {
+			query.WriteError(w, requestID, awserr.New(errCodeInvalidParameterValue, "could not parse request", err))
+			return
+		}
+		action = r.Form.Get("Action")
+	}
+	writeError := func(err error) {
+		if useJSON {
+			writeJSONError(w, err)
+		} else {
+			query.WriteError(w, requestID, err)
+		}
+	}
+	if !actions[action] {
+		writeError(awserr.New(errCodeInvalidAction, "The action "+action+" is not valid for this endpoint.", nil))
+		return
+	}
+
+	method := reflect.ValueOf(h.svc).MethodByName(action + "WithContext")
+	input := reflect.New(method.Type().In(1).Elem())
+	if useJSON {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(awserr.New(errCodeInvalidParameterValue, "could not read request body", err))
+			return
+		}
+		if len(b) > 0 {
+			if err := json.Unmarshal(b, input.Interface()); err != nil {
+				writeError(awserr.New(errCodeInvalidParameterValue, "could not parse request body into json", err))
+				return
+			}
+		}
+	} else {
+		if err := query.Decode(r.Form, input.Interface()); err != nil {
+			writeError(awserr.New(errCodeInvalidParameterValue, err.Error(), nil))
+			return
+		}
+	}
+	// operations on queue can be requested to queue url without QueueUrl parameter.
+	if f := input.Elem().FieldByName("QueueUrl"); f.IsValid() && f.IsNil() && strings.Count(r.URL.Path, "/") > 1 {
+		u := r.URL.Path
+		f.Set(reflect.ValueOf(&u))
+	}
+
+	res := method.Call([]reflect.Value{reflect.ValueOf(r.Context()), input})
+	if err, _ := res[1].Interface().(error); err != nil {
+		writeError(err)
+		return
+	}
+	if useJSON {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		json.NewEncoder(w).Encode(query.JSONValue(res[0]))
+		return
+	}
+	query.WriteResponse(w, xmlNamespace, action, requestID, res[0])
+}
+
+func writeJSONError(w http.ResponseWriter, err error) {
+	code, msg, status := query.ErrorStatus(err)
+	// clients of json protocol read error code of query protocol from this header.
+	w.Header().Set("x-amzn-query-error", code+";"+query.ErrorType(status))
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"__type": code, "message": msg})
+}
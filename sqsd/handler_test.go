@@ -0,0 +1,128 @@
+package sqsd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+func TestHandler(t *testing.T) {
+	ts := httptest.NewServer(nil)
+	defer ts.Close()
+	ts.Config.Handler = NewHandler(New("us-east-1", "000000000000", ts.URL))
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(ts.URL),
+		Credentials: credentials.NewStaticCredentials("dummy", "dummy", ""),
+	}))
+	client := sqs.New(sess)
+
+	created, err := client.CreateQueue(&sqs.CreateQueueInput{
+		QueueName:  aws.String("myqueue"),
+		Attributes: aws.StringMap(map[string]string{"VisibilityTimeout": "60"}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if *created.QueueUrl != ts.URL+"/000000000000/myqueue" {
+		t.Errorf("unexpected url: %s", *created.QueueUrl)
+	}
+	_, err = client.GetQueueUrl(&sqs.GetQueueUrlInput{QueueName: aws.String("unknown")})
+	if e, ok := err.(awserr.Error); !ok || e.Code() != sqs.ErrCodeQueueDoesNotExist {
+		t.Errorf("unexpected error captured: %#v", err)
+	}
+
+	if _, err := client.SendMessage(&sqs.SendMessageInput{
+		QueueUrl:    created.QueueUrl,
+		MessageBody: aws.String("hello <world>"),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			"str": {DataType: aws.String("String"), StringValue: aws.String("bar")},
+			"bin": {DataType: aws.String("Binary"), BinaryValue: []byte{0, 1, 2}},
+		},
+	}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	batch, err := client.SendMessageBatch(&sqs.SendMessageBatchInput{
+		QueueUrl: created.QueueUrl,
+		Entries: []*sqs.SendMessageBatchRequestEntry{
+			{Id: aws.String("a"), MessageBody: aws.String("second")},
+			{Id: aws.String("b"), MessageBody: aws.String("")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if len(batch.Successful) != 1 || len(batch.Failed) != 1 || *batch.Failed[0].Code != errCodeMissingParameter {
+		t.Errorf("unexpected result: %s", batch)
+	}
+
+	received, err := client.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:              created.QueueUrl,
+		MaxNumberOfMessages:   aws.Int64(10),
+		AttributeNames:        aws.StringSlice([]string{"All"}),
+		MessageAttributeNames: aws.StringSlice([]string{"All"}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if len(received.Messages) != 2 {
+		t.Fatalf("unexpected messages: %s", received)
+	}
+	msg := received.Messages[0]
+	if *msg.Body != "hello <world>" || *msg.MessageAttributes["str"].StringValue != "bar" || string(msg.MessageAttributes["bin"].BinaryValue) != "\x00\x01\x02" ||
+		*msg.Attributes["ApproximateReceiveCount"] != "1" || msg.MD5OfMessageAttributes == nil {
+		t.Errorf("unexpected message: %s", msg)
+	}
+
+	deleted, err := client.DeleteMessageBatch(&sqs.DeleteMessageBatchInput{
+		QueueUrl: created.QueueUrl,
+		Entries: []*sqs.DeleteMessageBatchRequestEntry{
+			{Id: aws.String("a"), ReceiptHandle: received.Messages[0].ReceiptHandle},
+			{Id: aws.String("b"), ReceiptHandle: received.Messages[1].ReceiptHandle},
+		},
+	})
+	if err != nil || len(deleted.Successful) != 2 {
+		t.Fatalf("unexpected result: %s, %v", deleted, err)
+	}
+	attrs, err := client.GetQueueAttributes(&sqs.GetQueueAttributesInput{QueueUrl: created.QueueUrl, AttributeNames: aws.StringSlice([]string{"All"})})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if *attrs.Attributes["ApproximateNumberOfMessagesNotVisible"] != "0" || *attrs.Attributes["VisibilityTimeout"] != "60" {
+		t.Errorf("unexpected attributes: %s", attrs)
+	}
+
+	// json protocol
+	req, _ := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(`{"QueueUrl":"`+*created.QueueUrl+`","MessageBody":"json"}`))
+	req.Header.Set("X-Amz-Target", "AmazonSQS.SendMessage")
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sent map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&sent)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || sent["MessageId"] == nil || sent["SequenceNumber"] != nil {
+		t.Errorf("unexpected response: %d %v", res.StatusCode, sent)
+	}
+	req, _ = http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(`{"QueueName":"unknown"}`))
+	req.Header.Set("X-Amz-Target", "AmazonSQS.GetQueueUrl")
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest || !strings.HasPrefix(res.Header.Get("x-amzn-query-error"), sqs.ErrCodeQueueDoesNotExist+";") {
+		t.Errorf("unexpected response: %d %v", res.StatusCode, res.Header)
+	}
+}
@@ -0,0 +1,466 @@
+package sqsd
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/google/uuid"
+)
+
+// dedupInterval is the interval in which messages with the same deduplication id are not delivered again.
+const dedupInterval = 5 * time.Minute
+
+// queue attributes which can be set, and their defaults.
+var defaultAttributes = map[string]string{
+	sqs.QueueAttributeNameDelaySeconds:                  "0",
+	sqs.QueueAttributeNameMaximumMessageSize:            "262144",
+	sqs.QueueAttributeNameMessageRetentionPeriod:        "345600",
+	sqs.QueueAttributeNameReceiveMessageWaitTimeSeconds: "0",
+	sqs.QueueAttributeNameVisibilityTimeout:             "30",
+	sqs.QueueAttributeNameRedrivePolicy:                 "",
+	sqs.QueueAttributeNameFifoQueue:                     "",
+	sqs.QueueAttributeNameContentBasedDeduplication:     "",
+}
+
+// attributeRanges are valid ranges of numeric queue attributes.
+var attributeRanges = map[string][2]int64{
+	sqs.QueueAttributeNameDelaySeconds:                  {0, 900},
+	sqs.QueueAttributeNameMaximumMessageSize:            {1024, 262144},
+	sqs.QueueAttributeNameMessageRetentionPeriod:        {60, 1209600},
+	sqs.QueueAttributeNameReceiveMessageWaitTimeSeconds: {0, 20},
+	sqs.QueueAttributeNameVisibilityTimeout:             {0, 43200},
+}
+
+type message struct {
+	id         string
+	body       string
+	md5OfBody  string
+	md5OfAttrs string
+	attributes map[string]*sqs.MessageAttributeValue
+	sent       time.Time
+	// visibleAt is the time when message can be received, which is after delay or visibility timeout.
+	visibleAt     time.Time
+	receiptHandle string
+	receiveCount  int64
+	firstReceive  time.Time
+	// groupID, dedupID and sequence are set for message in FIFO queue.
+	groupID  string
+	dedupID  string
+	sequence string
+}
+
+// systemAttributes returns attributes of message which ReceiveMessage returns.
+func (m *message) systemAttributes() map[string]string {
+	attrs := map[string]string{
+		sqs.MessageSystemAttributeNameSenderId:                         "AIDAIT2UOQQY3AUEKVGXU",
+		sqs.MessageSystemAttributeNameSentTimestamp:                    strconv.FormatInt(unixMilli(m.sent), 10),
+		sqs.MessageSystemAttributeNameApproximateReceiveCount:          strconv.FormatInt(m.receiveCount, 10),
+		sqs.MessageSystemAttributeNameApproximateFirstReceiveTimestamp: strconv.FormatInt(unixMilli(m.firstReceive), 10),
+	}
+	if m.groupID != "" {
+		attrs[sqs.MessageSystemAttributeNameMessageGroupId] = m.groupID
+		attrs[sqs.MessageSystemAttributeNameMessageDeduplicationId] = m.dedupID
+		attrs[sqs.MessageSystemAttributeNameSequenceNumber] = m.sequence
+	}
+	return attrs
+}
+
+type dedupEntry struct {
+	messageID string
+	sequence  string
+	expires   time.Time
+}
+
+type queue struct {
+	name       string
+	arn        string
+	url        string
+	attributes map[string]string
+	created    time.Time
+	modified   time.Time
+	messages   []*message
+	// dedup holds sent messages by deduplication id in FIFO queue.
+	dedup    map[string]dedupEntry
+	sequence int64
+	// notify is closed when messages are sent to queue, so that long polling receivers wake up.
+	notify chan struct{}
+}
+
+func newQueue(name, arn, url string, now time.Time) *queue {
+	q := &queue{
+		name:       name,
+		arn:        arn,
+		url:        url,
+		attributes: make(map[string]string, len(defaultAttributes)),
+		created:    now,
+		modified:   now,
+		dedup:      map[string]dedupEntry{},
+		notify:     make(chan struct{}),
+	}
+	for k, v := range defaultAttributes {
+		q.attributes[k] = v
+	}
+	return q
+}
+
+func (q *queue) fifo() bool {
+	return q.attributes[sqs.QueueAttributeNameFifoQueue] == "true"
+}
+
+func (q *queue) intAttribute(name string) int64 {
+	n, _ := strconv.ParseInt(q.attributes[name], 10, 64)
+	return n
+}
+
+// wake notifies long polling receivers.
+func (q *queue) wake() {
+	close(q.notify)
+	q.notify = make(chan struct{})
+}
+
+// redrivePolicy describes RedrivePolicy attribute of queue.
+type redrivePolicy struct {
+	DeadLetterTargetArn string      `json:"deadLetterTargetArn"`
+	MaxReceiveCount     json.Number `json:"maxReceiveCount"`
+}
+
+func (q *queue) redrivePolicy() (string, int64) {
+	var p redrivePolicy
+	if err := json.Unmarshal([]byte(q.attributes[sqs.QueueAttributeNameRedrivePolicy]), &p); err != nil {
+		return "", 0
+	}
+	n, _ := p.MaxReceiveCount.Int64()
+	return p.DeadLetterTargetArn, n
+}
+
+// validateAttributes checks attributes given to CreateQueue or SetQueueAttributes.
+// queues is used to resolve dead letter queue of RedrivePolicy.
+func (q *queue) validateAttributes(attrs map[string]*string, queues map[string]*queue) error {
+	for k, v := range attrs {
+		if _, ok := defaultAttributes[k]; !ok {
+			return awserr.New(sqs.ErrCodeInvalidAttributeName, "Unknown Attribute "+k+".", nil)
+		}
+		value := aws.StringValue(v)
+		if r, ok := attributeRanges[k]; ok {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < r[0] || n > r[1] {
+				return awserr.New(errCodeInvalidAttributeValue, "Invalid value for the parameter "+k+".", nil)
+			}
+		}
+		switch k {
+		case sqs.QueueAttributeNameFifoQueue, sqs.QueueAttributeNameContentBasedDeduplication:
+			if value != "true" && value != "false" {
+				return awserr.New(errCodeInvalidAttributeValue, "Invalid value for the parameter "+k+".", nil)
+			}
+		case sqs.QueueAttributeNameRedrivePolicy:
+			if value == "" {
+				continue
+			}
+			var p redrivePolicy
+			if err := json.Unmarshal([]byte(value), &p); err != nil {
+				return awserr.New(errCodeInvalidAttributeValue, "Invalid value for the parameter RedrivePolicy.", err)
+			}
+			n, err := p.MaxReceiveCount.Int64()
+			if err != nil || n < 1 || n > 1000 {
+				return awserr.New(errCodeInvalidAttributeValue, "Value for parameter maxReceiveCount is invalid.", nil)
+			}
+			dlq := queues[arnName(p.DeadLetterTargetArn)]
+			if dlq == nil || dlq.arn != p.DeadLetterTargetArn {
+				return awserr.New(errCodeInvalidAttributeValue, "Dead-letter target does not exist: "+p.DeadLetterTargetArn, nil)
+			}
+			if dlq.fifo() != q.fifo() {
+				return awserr.New(errCodeInvalidAttributeValue, "Dead-letter queue must be the same type of queue.", nil)
+			}
+		}
+	}
+	return nil
+}
+
+// send enqueues message. Message with the same deduplication id as recent one is not enqueued again in FIFO queue.
+func (q *queue) send(input *sqs.SendMessageInput, now time.Time) (*sqs.SendMessageOutput, error) {
+	body := aws.StringValue(input.MessageBody)
+	if body == "" {
+		return nil, awserr.New(errCodeMissingParameter, "The request must contain the parameter MessageBody.", nil)
+	}
+	size := len(body)
+	for k, v := range input.MessageAttributes {
+		size += len(k) + len(aws.StringValue(v.DataType)) + len(aws.StringValue(v.StringValue)) + len(v.BinaryValue)
+	}
+	if int64(size) > q.intAttribute(sqs.QueueAttributeNameMaximumMessageSize) {
+		return nil, awserr.New(errCodeInvalidParameterValue, "One or more parameters are invalid. Reason: Message must be shorter than "+q.attributes[sqs.QueueAttributeNameMaximumMessageSize]+" bytes.", nil)
+	}
+	md5OfAttrs, err := md5OfMessageAttributes(input.MessageAttributes)
+	if err != nil {
+		return nil, err
+	}
+	m := &message{
+		id:         uuid.New().String(),
+		body:       body,
+		md5OfBody:  md5Hex([]byte(body)),
+		md5OfAttrs: md5OfAttrs,
+		attributes: input.MessageAttributes,
+		sent:       now,
+		visibleAt:  now,
+	}
+	delay := q.intAttribute(sqs.QueueAttributeNameDelaySeconds)
+	if input.DelaySeconds != nil {
+		delay = *input.DelaySeconds
+	}
+
+	if q.fifo() {
+		if input.DelaySeconds != nil {
+			return nil, awserr.New(errCodeInvalidParameterValue, "Value "+strconv.FormatInt(delay, 10)+" for parameter DelaySeconds is invalid. Reason: The request include parameter that is not valid for this queue type.", nil)
+		}
+		if aws.StringValue(input.MessageGroupId) == "" {
+			return nil, awserr.New(errCodeMissingParameter, "The request must contain the parameter MessageGroupId.", nil)
+		}
+		m.groupID = *input.MessageGroupId
+		m.dedupID = aws.StringValue(input.MessageDeduplicationId)
+		if m.dedupID == "" {
+			if q.attributes[sqs.QueueAttributeNameContentBasedDeduplication] != "true" {
+				return nil, awserr.New(errCodeInvalidParameterValue, "The queue should either have ContentBasedDeduplication enabled or MessageDeduplicationId provided explicitly", nil)
+			}
+			sum := sha256.Sum256([]byte(body))
+			m.dedupID = hex.EncodeToString(sum[:])
+		}
+		if e, ok := q.dedup[m.dedupID]; ok && now.Before(e.expires) {
+			return &sqs.SendMessageOutput{
+				MessageId:              aws.String(e.messageID),
+				MD5OfMessageBody:       aws.String(m.md5OfBody),
+				MD5OfMessageAttributes: optionalString(m.md5OfAttrs),
+				SequenceNumber:         aws.String(e.sequence),
+			}, nil
+		}
+		q.sequence++
+		m.sequence = strconv.FormatInt(q.sequence, 10)
+		q.dedup[m.dedupID] = dedupEntry{messageID: m.id, sequence: m.sequence, expires: now.Add(dedupInterval)}
+	} else if input.MessageGroupId != nil || input.MessageDeduplicationId != nil {
+		return nil, awserr.New(errCodeInvalidParameterValue, "The request include parameter that is not valid for this queue type.", nil)
+	}
+	if delay < 0 || delay > 900 {
+		return nil, awserr.New(errCodeInvalidParameterValue, "Value "+strconv.FormatInt(delay, 10)+" for parameter DelaySeconds is invalid. Reason: Must be >= 0 and <= 900.", nil)
+	}
+	m.visibleAt = now.Add(time.Duration(delay) * time.Second)
+
+	q.messages = append(q.messages, m)
+	q.wake()
+	out := &sqs.SendMessageOutput{
+		MessageId:              aws.String(m.id),
+		MD5OfMessageBody:       aws.String(m.md5OfBody),
+		MD5OfMessageAttributes: optionalString(m.md5OfAttrs),
+	}
+	if m.sequence != "" {
+		out.SequenceNumber = aws.String(m.sequence)
+	}
+	return out, nil
+}
+
+// expire removes messages older than retention period and deduplication ids out of interval.
+func (q *queue) expire(now time.Time) {
+	retention := time.Duration(q.intAttribute(sqs.QueueAttributeNameMessageRetentionPeriod)) * time.Second
+	kept := q.messages[:0]
+	for _, m := range q.messages {
+		if now.Sub(m.sent) < retention {
+			kept = append(kept, m)
+		}
+	}
+	q.messages = kept
+	for id, e := range q.dedup {
+		if !now.Before(e.expires) {
+			delete(q.dedup, id)
+		}
+	}
+}
+
+// receive makes up to max visible messages invisible for visibility timeout and returns them.
+// Messages received more than maxReceiveCount of RedrivePolicy are moved to dead letter queue instead.
+// In FIFO queue, messages of the group which has in-flight messages are not returned, so that they are processed in order.
+func (q *queue) receive(max int64, visibility time.Duration, now time.Time, dlq *queue) []*message {
+	q.expire(now)
+	_, maxReceive := q.redrivePolicy()
+	var (
+		received []*message
+		moved    bool
+		// blocked holds groups which have in-flight or skipped messages.
+		blocked = map[string]bool{}
+	)
+	kept := q.messages[:0]
+	for _, m := range q.messages {
+		if int64(len(received)) >= max || now.Before(m.visibleAt) || blocked[m.groupID] {
+			if m.groupID != "" {
+				blocked[m.groupID] = true
+			}
+			kept = append(kept, m)
+			continue
+		}
+		if dlq != nil && maxReceive > 0 && m.receiveCount >= maxReceive {
+			m.visibleAt = now
+			m.receiptHandle = ""
+			dlq.messages = append(dlq.messages, m)
+			moved = true
+			continue
+		}
+		m.receiveCount++
+		if m.firstReceive.IsZero() {
+			m.firstReceive = now
+		}
+		m.visibleAt = now.Add(visibility)
+		m.receiptHandle = uuid.New().String()
+		received = append(received, m)
+		kept = append(kept, m)
+	}
+	q.messages = kept
+	if moved {
+		dlq.wake()
+	}
+	return received
+}
+
+// find returns message which has the receipt handle.
+func (q *queue) find(receiptHandle string) (int, *message) {
+	for i, m := range q.messages {
+		if m.receiptHandle != "" && m.receiptHandle == receiptHandle {
+			return i, m
+		}
+	}
+	return -1, nil
+}
+
+// delete removes message received with the receipt handle.
+// Deleting message which is already deleted succeeds as SQS does.
+func (q *queue) delete(receiptHandle string) error {
+	if receiptHandle == "" {
+		return awserr.New(sqs.ErrCodeReceiptHandleIsInvalid, "The input receipt handle is invalid.", nil)
+	}
+	if i, _ := q.find(receiptHandle); i >= 0 {
+		q.messages = append(q.messages[:i], q.messages[i+1:]...)
+		q.wake()
+	}
+	return nil
+}
+
+// changeVisibility changes visibility timeout of in-flight message.
+func (q *queue) changeVisibility(receiptHandle string, timeout int64, now time.Time) error {
+	if timeout < 0 || timeout > 43200 {
+		return awserr.New(errCodeInvalidParameterValue, "Value "+strconv.FormatInt(timeout, 10)+" for parameter VisibilityTimeout is invalid. Reason: Must be >= 0 and <= 43200.", nil)
+	}
+	_, m := q.find(receiptHandle)
+	if m == nil {
+		return awserr.New(sqs.ErrCodeReceiptHandleIsInvalid, "The input receipt handle is invalid.", nil)
+	}
+	if !now.Before(m.visibleAt) {
+		return awserr.New(sqs.ErrCodeMessageNotInflight, "Message is not in flight.", nil)
+	}
+	m.visibleAt = now.Add(time.Duration(timeout) * time.Second)
+	if timeout == 0 {
+		q.wake()
+	}
+	return nil
+}
+
+// nextVisible returns the earliest time when invisible message becomes visible.
+func (q *queue) nextVisible(now time.Time) (time.Time, bool) {
+	var next time.Time
+	for _, m := range q.messages {
+		if now.Before(m.visibleAt) && (next.IsZero() || m.visibleAt.Before(next)) {
+			next = m.visibleAt
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// getAttributes returns attributes of queue including statistics.
+func (q *queue) getAttributes(now time.Time) map[string]string {
+	attrs := make(map[string]string, len(q.attributes)+6)
+	for k, v := range q.attributes {
+		if v != "" {
+			attrs[k] = v
+		}
+	}
+	var visible, inflight, delayed int
+	for _, m := range q.messages {
+		switch {
+		case !now.Before(m.visibleAt):
+			visible++
+		case m.receiptHandle != "":
+			inflight++
+		default:
+			delayed++
+		}
+	}
+	attrs[sqs.QueueAttributeNameApproximateNumberOfMessages] = strconv.Itoa(visible)
+	attrs[sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible] = strconv.Itoa(inflight)
+	attrs[sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed] = strconv.Itoa(delayed)
+	attrs[sqs.QueueAttributeNameCreatedTimestamp] = strconv.FormatInt(q.created.Unix(), 10)
+	attrs[sqs.QueueAttributeNameLastModifiedTimestamp] = strconv.FormatInt(q.modified.Unix(), 10)
+	attrs[sqs.QueueAttributeNameQueueArn] = q.arn
+	return attrs
+}
+
+func md5Hex(b []byte) string {
+	sum := md5.Sum(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// md5OfMessageAttributes calculates digest of message attributes, which clients verify.
+// via https://docs.aws.amazon.com/AWSSimpleQueueService/latest/SQSDeveloperGuide/sqs-message-metadata.html#sqs-attributes-md5-message-digest-calculation
+func md5OfMessageAttributes(attrs map[string]*sqs.MessageAttributeValue) (string, error) {
+	if len(attrs) == 0 {
+		return "", nil
+	}
+	names := make([]string, 0, len(attrs))
+	for k := range attrs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var buf []byte
+	put := func(b []byte) {
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], uint32(len(b)))
+		buf = append(buf, n[:]...)
+		buf = append(buf, b...)
+	}
+	for _, name := range names {
+		v := attrs[name]
+		dataType := aws.StringValue(v.DataType)
+		if dataType == "" {
+			return "", awserr.New(errCodeInvalidParameterValue, "The message attribute '"+name+"' must contain non-empty message attribute type.", nil)
+		}
+		put([]byte(name))
+		put([]byte(dataType))
+		switch {
+		case v.StringValue != nil:
+			buf = append(buf, 1)
+			put([]byte(*v.StringValue))
+		case v.BinaryValue != nil:
+			buf = append(buf, 2)
+			put(v.BinaryValue)
+		default:
+			return "", awserr.New(errCodeInvalidParameterValue, "The message attribute '"+name+"' must contain non-empty message attribute value.", nil)
+		}
+	}
+	return md5Hex(buf), nil
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
+
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
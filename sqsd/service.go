@@ -0,0 +1,474 @@
+// Package sqsd provides in-memory message queue service compatible with subset of SQS API,
+// which can be served over HTTP or used in process as sqsiface.SQSAPI.
+package sqsd
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+// error codes which sqs package of aws-sdk-go does not define.
+const (
+	errCodeInvalidParameterValue = "InvalidParameterValue"
+	errCodeInvalidAttributeValue = "InvalidAttributeValue"
+	errCodeMissingParameter      = "MissingParameter"
+	errCodeInvalidAction         = "InvalidAction"
+)
+
+const (
+	maxBatchEntries     = 10
+	maxReceiveMessages  = 10
+	maxWaitTimeSeconds  = 20
+	maxQueueNameLength  = 80
+	fifoQueueNameSuffix = ".fifo"
+)
+
+var (
+	queueNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	batchIDPattern   = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,80}$`)
+)
+
+// Service is in-memory message queue service.
+// Operations which are not implemented panic, as the embedded SQSAPI is nil.
+type Service struct {
+	sqsiface.SQSAPI
+	region    string
+	accountID string
+	baseURL   string
+	mu        sync.Mutex
+	queues    map[string]*queue
+}
+
+// New returns Service object. Queue URLs start with baseURL, such as http://localhost:9324.
+func New(region, accountID, baseURL string) *Service {
+	return &Service{
+		region:    region,
+		accountID: accountID,
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		queues:    map[string]*queue{},
+	}
+}
+
+// arnName returns queue name from arn.
+func arnName(arn string) string {
+	if i := strings.LastIndex(arn, ":"); i >= 0 {
+		return arn[i+1:]
+	}
+	return ""
+}
+
+// getQueue returns queue from url. Only the last segment of url is used, so that host of url does not matter.
+func (s *Service) getQueue(queueURL *string) (*queue, error) {
+	u := aws.StringValue(queueURL)
+	if u == "" {
+		return nil, awserr.New(errCodeMissingParameter, "The request must contain the parameter QueueUrl.", nil)
+	}
+	if p, err := url.Parse(u); err == nil {
+		u = p.Path
+	}
+	q := s.queues[u[strings.LastIndex(u, "/")+1:]]
+	if q == nil {
+		return nil, awserr.New(sqs.ErrCodeQueueDoesNotExist, "The specified queue does not exist for this wsdl version.", nil)
+	}
+	return q, nil
+}
+
+// deadLetterQueue returns dead letter queue of RedrivePolicy.
+func (s *Service) deadLetterQueue(q *queue) *queue {
+	arn, _ := q.redrivePolicy()
+	if arn == "" {
+		return nil
+	}
+	return s.queues[arnName(arn)]
+}
+
+// CreateQueueWithContext creates queue, or returns url of existing queue with the same attributes.
+func (s *Service) CreateQueueWithContext(_ aws.Context, input *sqs.CreateQueueInput, _ ...request.Option) (*sqs.CreateQueueOutput, error) {
+	name := aws.StringValue(input.QueueName)
+	fifo := aws.StringValue(input.Attributes[sqs.QueueAttributeNameFifoQueue]) == "true"
+	base := strings.TrimSuffix(name, fifoQueueNameSuffix)
+	if name == "" || len(name) > maxQueueNameLength || !queueNamePattern.MatchString(base) || fifo != strings.HasSuffix(name, fifoQueueNameSuffix) {
+		return nil, awserr.New(errCodeInvalidParameterValue, "Can only include alphanumeric characters, hyphens, or underscores. 1 to 80 in length. FIFO queue name must end with .fifo suffix.", nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if q, ok := s.queues[name]; ok {
+		for k, v := range input.Attributes {
+			if q.attributes[k] != aws.StringValue(v) {
+				return nil, awserr.New(sqs.ErrCodeQueueNameExists, "A queue already exists with the same name and a different value for attribute "+k, nil)
+			}
+		}
+		return &sqs.CreateQueueOutput{QueueUrl: aws.String(q.url)}, nil
+	}
+	now := time.Now()
+	q := newQueue(name, "arn:aws:sqs:"+s.region+":"+s.accountID+":"+name, s.baseURL+"/"+s.accountID+"/"+name, now)
+	if fifo {
+		q.attributes[sqs.QueueAttributeNameFifoQueue] = "true"
+		q.attributes[sqs.QueueAttributeNameContentBasedDeduplication] = "false"
+	}
+	if err := q.validateAttributes(input.Attributes, s.queues); err != nil {
+		return nil, err
+	}
+	if !fifo && input.Attributes[sqs.QueueAttributeNameContentBasedDeduplication] != nil {
+		return nil, awserr.New(sqs.ErrCodeInvalidAttributeName, "Unknown Attribute ContentBasedDeduplication.", nil)
+	}
+	for k, v := range input.Attributes {
+		q.attributes[k] = aws.StringValue(v)
+	}
+	s.queues[name] = q
+	return &sqs.CreateQueueOutput{QueueUrl: aws.String(q.url)}, nil
+}
+
+// DeleteQueueWithContext deletes queue and its messages.
+func (s *Service) DeleteQueueWithContext(_ aws.Context, input *sqs.DeleteQueueInput, _ ...request.Option) (*sqs.DeleteQueueOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.getQueue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	delete(s.queues, q.name)
+	q.wake()
+	return &sqs.DeleteQueueOutput{}, nil
+}
+
+// GetQueueUrlWithContext returns url of queue.
+func (s *Service) GetQueueUrlWithContext(_ aws.Context, input *sqs.GetQueueUrlInput, _ ...request.Option) (*sqs.GetQueueUrlOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queues[aws.StringValue(input.QueueName)]
+	if q == nil {
+		return nil, awserr.New(sqs.ErrCodeQueueDoesNotExist, "The specified queue does not exist for this wsdl version.", nil)
+	}
+	return &sqs.GetQueueUrlOutput{QueueUrl: aws.String(q.url)}, nil
+}
+
+// ListQueuesWithContext returns urls of queues which name starts with QueueNamePrefix.
+func (s *Service) ListQueuesWithContext(_ aws.Context, input *sqs.ListQueuesInput, _ ...request.Option) (*sqs.ListQueuesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	urls := make([]string, 0, len(s.queues))
+	for name, q := range s.queues {
+		if strings.HasPrefix(name, aws.StringValue(input.QueueNamePrefix)) {
+			urls = append(urls, q.url)
+		}
+	}
+	sort.Strings(urls)
+	return &sqs.ListQueuesOutput{QueueUrls: aws.StringSlice(urls)}, nil
+}
+
+// GetQueueAttributesWithContext returns attributes of queue.
+func (s *Service) GetQueueAttributesWithContext(_ aws.Context, input *sqs.GetQueueAttributesInput, _ ...request.Option) (*sqs.GetQueueAttributesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.getQueue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	attrs := q.getAttributes(time.Now())
+	all := false
+	names := map[string]bool{}
+	for _, n := range aws.StringValueSlice(input.AttributeNames) {
+		if n == sqs.QueueAttributeNameAll {
+			all = true
+		}
+		names[n] = true
+	}
+	out := &sqs.GetQueueAttributesOutput{Attributes: map[string]*string{}}
+	for k, v := range attrs {
+		if all || names[k] {
+			out.Attributes[k] = aws.String(v)
+		}
+	}
+	return out, nil
+}
+
+// SetQueueAttributesWithContext changes attributes of queue.
+func (s *Service) SetQueueAttributesWithContext(_ aws.Context, input *sqs.SetQueueAttributesInput, _ ...request.Option) (*sqs.SetQueueAttributesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.getQueue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	if v := input.Attributes[sqs.QueueAttributeNameFifoQueue]; v != nil && aws.StringValue(v) != q.attributes[sqs.QueueAttributeNameFifoQueue] {
+		return nil, awserr.New(errCodeInvalidAttributeValue, "Invalid value for the parameter FifoQueue. Reason: Modifying queue type is not supported.", nil)
+	}
+	if err := q.validateAttributes(input.Attributes, s.queues); err != nil {
+		return nil, err
+	}
+	for k, v := range input.Attributes {
+		q.attributes[k] = aws.StringValue(v)
+	}
+	q.modified = time.Now()
+	return &sqs.SetQueueAttributesOutput{}, nil
+}
+
+// PurgeQueueWithContext deletes all messages in queue.
+func (s *Service) PurgeQueueWithContext(_ aws.Context, input *sqs.PurgeQueueInput, _ ...request.Option) (*sqs.PurgeQueueOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.getQueue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	q.messages = nil
+	return &sqs.PurgeQueueOutput{}, nil
+}
+
+// SendMessageWithContext sends message to queue.
+func (s *Service) SendMessageWithContext(_ aws.Context, input *sqs.SendMessageInput, _ ...request.Option) (*sqs.SendMessageOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.getQueue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	return q.send(input, time.Now())
+}
+
+// validateBatchIDs checks ids of entries in batch request.
+func validateBatchIDs(ids []*string) error {
+	if len(ids) == 0 {
+		return awserr.New(sqs.ErrCodeEmptyBatchRequest, "There should be at least one entry in the request.", nil)
+	}
+	if len(ids) > maxBatchEntries {
+		return awserr.New(sqs.ErrCodeTooManyEntriesInBatchRequest, "Maximum number of entries per request are "+strconv.Itoa(maxBatchEntries)+".", nil)
+	}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if !batchIDPattern.MatchString(aws.StringValue(id)) {
+			return awserr.New(sqs.ErrCodeInvalidBatchEntryId, "A batch entry id can only contain alphanumeric characters, hyphens and underscores. It can be at most 80 letters long.", nil)
+		}
+		if seen[*id] {
+			return awserr.New(sqs.ErrCodeBatchEntryIdsNotDistinct, "Id "+*id+" repeated.", nil)
+		}
+		seen[*id] = true
+	}
+	return nil
+}
+
+// batchError returns entry of failed request in batch.
+func batchError(id *string, err error) *sqs.BatchResultErrorEntry {
+	e := &sqs.BatchResultErrorEntry{Id: id, Code: aws.String(errCodeInvalidParameterValue), Message: aws.String(err.Error()), SenderFault: aws.Bool(true)}
+	if ae, ok := err.(awserr.Error); ok {
+		e.Code, e.Message = aws.String(ae.Code()), aws.String(ae.Message())
+	}
+	return e
+}
+
+// SendMessageBatchWithContext sends up to 10 messages to queue.
+func (s *Service) SendMessageBatchWithContext(_ aws.Context, input *sqs.SendMessageBatchInput, _ ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+	ids := make([]*string, 0, len(input.Entries))
+	for _, e := range input.Entries {
+		ids = append(ids, e.Id)
+	}
+	if err := validateBatchIDs(ids); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.getQueue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	out := &sqs.SendMessageBatchOutput{Successful: []*sqs.SendMessageBatchResultEntry{}, Failed: []*sqs.BatchResultErrorEntry{}}
+	for _, e := range input.Entries {
+		res, err := q.send(&sqs.SendMessageInput{
+			DelaySeconds:           e.DelaySeconds,
+			MessageAttributes:      e.MessageAttributes,
+			MessageBody:            e.MessageBody,
+			MessageDeduplicationId: e.MessageDeduplicationId,
+			MessageGroupId:         e.MessageGroupId,
+		}, now)
+		if err != nil {
+			out.Failed = append(out.Failed, batchError(e.Id, err))
+			continue
+		}
+		out.Successful = append(out.Successful, &sqs.SendMessageBatchResultEntry{
+			Id:                     e.Id,
+			MessageId:              res.MessageId,
+			MD5OfMessageBody:       res.MD5OfMessageBody,
+			MD5OfMessageAttributes: res.MD5OfMessageAttributes,
+			SequenceNumber:         res.SequenceNumber,
+		})
+	}
+	return out, nil
+}
+
+// ReceiveMessageWithContext receives messages from queue.
+// It waits for messages until WaitTimeSeconds passes, or ReceiveMessageWaitTimeSeconds of queue when it is not given.
+func (s *Service) ReceiveMessageWithContext(ctx aws.Context, input *sqs.ReceiveMessageInput, _ ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	max := aws.Int64Value(input.MaxNumberOfMessages)
+	if input.MaxNumberOfMessages == nil {
+		max = 1
+	}
+	if max < 1 || max > maxReceiveMessages {
+		return nil, awserr.New(errCodeInvalidParameterValue, "Value "+strconv.FormatInt(max, 10)+" for parameter MaxNumberOfMessages is invalid. Reason: Must be between 1 and 10, if provided.", nil)
+	}
+	if w := aws.Int64Value(input.WaitTimeSeconds); w < 0 || w > maxWaitTimeSeconds {
+		return nil, awserr.New(errCodeInvalidParameterValue, "Value "+strconv.FormatInt(w, 10)+" for parameter WaitTimeSeconds is invalid. Reason: Must be >= 0 and <= 20, if provided.", nil)
+	}
+
+	s.mu.Lock()
+	q, err := s.getQueue(input.QueueUrl)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	wait := q.intAttribute(sqs.QueueAttributeNameReceiveMessageWaitTimeSeconds)
+	if input.WaitTimeSeconds != nil {
+		wait = *input.WaitTimeSeconds
+	}
+	visibility := q.intAttribute(sqs.QueueAttributeNameVisibilityTimeout)
+	if input.VisibilityTimeout != nil {
+		visibility = *input.VisibilityTimeout
+	}
+	deadline := time.Now().Add(time.Duration(wait) * time.Second)
+	for {
+		now := time.Now()
+		msgs := q.receive(max, time.Duration(visibility)*time.Second, now, s.deadLetterQueue(q))
+		if len(msgs) > 0 || !now.Before(deadline) || s.queues[q.name] != q {
+			out := &sqs.ReceiveMessageOutput{Messages: receivedMessages(msgs, input)}
+			s.mu.Unlock()
+			return out, nil
+		}
+		wake := deadline
+		if next, ok := q.nextVisible(now); ok && next.Before(wake) {
+			wake = next
+		}
+		notify := q.notify
+		s.mu.Unlock()
+
+		t := time.NewTimer(wake.Sub(now))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-notify:
+		case <-t.C:
+		}
+		t.Stop()
+		s.mu.Lock()
+	}
+}
+
+// receivedMessages builds messages in response with attributes which are requested.
+func receivedMessages(msgs []*message, input *sqs.ReceiveMessageInput) []*sqs.Message {
+	attrNames := map[string]bool{}
+	for _, n := range aws.StringValueSlice(input.AttributeNames) {
+		attrNames[n] = true
+	}
+	msgAttrNames := aws.StringValueSlice(input.MessageAttributeNames)
+	res := make([]*sqs.Message, 0, len(msgs))
+	for _, m := range msgs {
+		msg := &sqs.Message{
+			MessageId:     aws.String(m.id),
+			ReceiptHandle: aws.String(m.receiptHandle),
+			Body:          aws.String(m.body),
+			MD5OfBody:     aws.String(m.md5OfBody),
+		}
+		for k, v := range m.systemAttributes() {
+			if attrNames[sqs.QueueAttributeNameAll] || attrNames[k] {
+				if msg.Attributes == nil {
+					msg.Attributes = map[string]*string{}
+				}
+				msg.Attributes[k] = aws.String(v)
+			}
+		}
+		for k, v := range m.attributes {
+			if matchAttributeName(k, msgAttrNames) {
+				if msg.MessageAttributes == nil {
+					msg.MessageAttributes = map[string]*sqs.MessageAttributeValue{}
+				}
+				msg.MessageAttributes[k] = v
+			}
+		}
+		if len(msg.MessageAttributes) > 0 {
+			md5, _ := md5OfMessageAttributes(msg.MessageAttributes)
+			msg.MD5OfMessageAttributes = aws.String(md5)
+		}
+		res = append(res, msg)
+	}
+	return res
+}
+
+// matchAttributeName reports whether message attribute is requested by names, which can be "All", ".*" or prefix such as "foo.*".
+func matchAttributeName(name string, names []string) bool {
+	for _, n := range names {
+		switch {
+		case n == sqs.QueueAttributeNameAll || n == ".*" || n == name:
+			return true
+		case strings.HasSuffix(n, ".*") && strings.HasPrefix(name, strings.TrimSuffix(n, "*")):
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteMessageWithContext deletes received message.
+func (s *Service) DeleteMessageWithContext(_ aws.Context, input *sqs.DeleteMessageInput, _ ...request.Option) (*sqs.DeleteMessageOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.getQueue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.delete(aws.StringValue(input.ReceiptHandle)); err != nil {
+		return nil, err
+	}
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+// DeleteMessageBatchWithContext deletes up to 10 received messages.
+func (s *Service) DeleteMessageBatchWithContext(_ aws.Context, input *sqs.DeleteMessageBatchInput, _ ...request.Option) (*sqs.DeleteMessageBatchOutput, error) {
+	ids := make([]*string, 0, len(input.Entries))
+	for _, e := range input.Entries {
+		ids = append(ids, e.Id)
+	}
+	if err := validateBatchIDs(ids); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.getQueue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	out := &sqs.DeleteMessageBatchOutput{Successful: []*sqs.DeleteMessageBatchResultEntry{}, Failed: []*sqs.BatchResultErrorEntry{}}
+	for _, e := range input.Entries {
+		if err := q.delete(aws.StringValue(e.ReceiptHandle)); err != nil {
+			out.Failed = append(out.Failed, batchError(e.Id, err))
+			continue
+		}
+		out.Successful = append(out.Successful, &sqs.DeleteMessageBatchResultEntry{Id: e.Id})
+	}
+	return out, nil
+}
+
+// ChangeMessageVisibilityWithContext changes visibility timeout of received message.
+func (s *Service) ChangeMessageVisibilityWithContext(_ aws.Context, input *sqs.ChangeMessageVisibilityInput, _ ...request.Option) (*sqs.ChangeMessageVisibilityOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.getQueue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.changeVisibility(aws.StringValue(input.ReceiptHandle), aws.Int64Value(input.VisibilityTimeout), time.Now()); err != nil {
+		return nil, err
+	}
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
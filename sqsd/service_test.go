@@ -0,0 +1,197 @@
+package sqsd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+func createQueue(t *testing.T, s *Service, name string, attrs map[string]string) string {
+	t.Helper()
+	out, err := s.CreateQueueWithContext(context.Background(), &sqs.CreateQueueInput{
+		QueueName:  aws.String(name),
+		Attributes: aws.StringMap(attrs),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	return *out.QueueUrl
+}
+
+func receive(t *testing.T, s *Service, url string, max int64) []*sqs.Message {
+	t.Helper()
+	out, err := s.ReceiveMessageWithContext(context.Background(), &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(url),
+		MaxNumberOfMessages: aws.Int64(max),
+		AttributeNames:      aws.StringSlice([]string{sqs.QueueAttributeNameAll}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	return out.Messages
+}
+
+func TestServiceQueue(t *testing.T) {
+	s := New("us-east-1", "000000000000", "http://localhost:9324")
+	ctx := context.Background()
+	url := createQueue(t, s, "myqueue", map[string]string{"VisibilityTimeout": "1"})
+	if url != "http://localhost:9324/000000000000/myqueue" {
+		t.Errorf("unexpected url: %s", url)
+	}
+	if again := createQueue(t, s, "myqueue", map[string]string{"VisibilityTimeout": "1"}); again != url {
+		t.Errorf("url of the same queue should be returned: %s", again)
+	}
+	for _, tt := range []struct {
+		label    string
+		input    *sqs.CreateQueueInput
+		expected string
+	}{
+		{"different attributes", &sqs.CreateQueueInput{QueueName: aws.String("myqueue"), Attributes: aws.StringMap(map[string]string{"VisibilityTimeout": "2"})}, sqs.ErrCodeQueueNameExists},
+		{"invalid name", &sqs.CreateQueueInput{QueueName: aws.String("my queue")}, errCodeInvalidParameterValue},
+		{"fifo without suffix", &sqs.CreateQueueInput{QueueName: aws.String("q"), Attributes: aws.StringMap(map[string]string{"FifoQueue": "true"})}, errCodeInvalidParameterValue},
+		{"unknown attribute", &sqs.CreateQueueInput{QueueName: aws.String("q"), Attributes: aws.StringMap(map[string]string{"Foo": "1"})}, sqs.ErrCodeInvalidAttributeName},
+		{"out of range", &sqs.CreateQueueInput{QueueName: aws.String("q"), Attributes: aws.StringMap(map[string]string{"DelaySeconds": "901"})}, errCodeInvalidAttributeValue},
+		{"missing dead letter queue", &sqs.CreateQueueInput{QueueName: aws.String("q"), Attributes: aws.StringMap(map[string]string{
+			"RedrivePolicy": `{"deadLetterTargetArn":"arn:aws:sqs:us-east-1:000000000000:dlq","maxReceiveCount":"1"}`,
+		})}, errCodeInvalidAttributeValue},
+	} {
+		_, err := s.CreateQueueWithContext(ctx, tt.input)
+		if e, ok := err.(awserr.Error); !ok || e.Code() != tt.expected {
+			t.Errorf("%s: unexpected error captured: %#v", tt.label, err)
+		}
+	}
+
+	sent, err := s.SendMessageWithContext(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(url),
+		MessageBody: aws.String("hello"),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			"foo": {DataType: aws.String("String"), StringValue: aws.String("bar")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if *sent.MD5OfMessageBody != "5d41402abc4b2a76b9719d911017c592" || sent.MD5OfMessageAttributes == nil {
+		t.Errorf("unexpected digests: %s", sent)
+	}
+	if _, err := s.SendMessageWithContext(ctx, &sqs.SendMessageInput{QueueUrl: aws.String(url), MessageBody: aws.String("delayed"), DelaySeconds: aws.Int64(10)}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+
+	msgs := receive(t, s, url, 10)
+	if len(msgs) != 1 || *msgs[0].Body != "hello" || *msgs[0].MessageId != *sent.MessageId || *msgs[0].Attributes["ApproximateReceiveCount"] != "1" {
+		t.Fatalf("unexpected messages: %s", msgs)
+	}
+	if len(receive(t, s, url, 10)) != 0 {
+		t.Error("message in flight should not be received")
+	}
+	attrs, _ := s.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{QueueUrl: aws.String(url), AttributeNames: aws.StringSlice([]string{"All"})})
+	for k, v := range map[string]string{"ApproximateNumberOfMessages": "0", "ApproximateNumberOfMessagesNotVisible": "1", "ApproximateNumberOfMessagesDelayed": "1", "VisibilityTimeout": "1"} {
+		if aws.StringValue(attrs.Attributes[k]) != v {
+			t.Errorf("%s: %s != %s", k, aws.StringValue(attrs.Attributes[k]), v)
+		}
+	}
+
+	// long polling waits for visibility timeout.
+	start := time.Now()
+	out, err := s.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{QueueUrl: aws.String(url), WaitTimeSeconds: aws.Int64(2)})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if len(out.Messages) != 1 || *out.Messages[0].Body != "hello" || time.Since(start) > 2*time.Second {
+		t.Fatalf("message should be received again after visibility timeout: %s", out)
+	}
+	if _, err := s.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{QueueUrl: aws.String(url), ReceiptHandle: msgs[0].ReceiptHandle}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if _, err := s.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{QueueUrl: aws.String(url), ReceiptHandle: out.Messages[0].ReceiptHandle}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	attrs, _ = s.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{QueueUrl: aws.String(url), AttributeNames: aws.StringSlice([]string{"ApproximateNumberOfMessagesNotVisible"})})
+	if len(attrs.Attributes) != 1 || *attrs.Attributes["ApproximateNumberOfMessagesNotVisible"] != "0" {
+		t.Errorf("message should be deleted: %s", attrs)
+	}
+
+	// long polling wakes up on new message.
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		s.SendMessageWithContext(ctx, &sqs.SendMessageInput{QueueUrl: aws.String(url), MessageBody: aws.String("world")})
+	}()
+	out, err = s.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{QueueUrl: aws.String(url), WaitTimeSeconds: aws.Int64(5)})
+	if err != nil || len(out.Messages) != 1 || *out.Messages[0].Body != "world" {
+		t.Errorf("unexpected result: %s, %v", out, err)
+	}
+}
+
+func TestServiceFIFO(t *testing.T) {
+	s := New("us-east-1", "000000000000", "http://localhost:9324")
+	ctx := context.Background()
+	url := createQueue(t, s, "myqueue.fifo", map[string]string{"FifoQueue": "true", "ContentBasedDeduplication": "true"})
+
+	if _, err := s.SendMessageWithContext(ctx, &sqs.SendMessageInput{QueueUrl: aws.String(url), MessageBody: aws.String("a1")}); err == nil {
+		t.Error("error should exists without MessageGroupId")
+	}
+	out, err := s.SendMessageBatchWithContext(ctx, &sqs.SendMessageBatchInput{
+		QueueUrl: aws.String(url),
+		Entries: []*sqs.SendMessageBatchRequestEntry{
+			{Id: aws.String("1"), MessageBody: aws.String("a1"), MessageGroupId: aws.String("a")},
+			{Id: aws.String("2"), MessageBody: aws.String("b1"), MessageGroupId: aws.String("b")},
+			{Id: aws.String("3"), MessageBody: aws.String("a2"), MessageGroupId: aws.String("a")},
+			{Id: aws.String("4"), MessageBody: aws.String("a1"), MessageGroupId: aws.String("a")},
+			{Id: aws.String("5"), MessageBody: aws.String("delayed"), MessageGroupId: aws.String("a"), DelaySeconds: aws.Int64(1)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	if len(out.Successful) != 4 || len(out.Failed) != 1 || *out.Failed[0].Id != "5" {
+		t.Fatalf("unexpected result: %s", out)
+	}
+	if *out.Successful[3].MessageId != *out.Successful[0].MessageId {
+		t.Error("duplicated message should have the same id")
+	}
+
+	msgs := receive(t, s, url, 1)
+	if len(msgs) != 1 || *msgs[0].Body != "a1" || *msgs[0].Attributes["MessageGroupId"] != "a" {
+		t.Fatalf("unexpected messages: %s", msgs)
+	}
+	// group a is blocked until a1 is deleted.
+	next := receive(t, s, url, 10)
+	if len(next) != 1 || *next[0].Body != "b1" {
+		t.Fatalf("unexpected messages: %s", next)
+	}
+	s.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{QueueUrl: aws.String(url), ReceiptHandle: msgs[0].ReceiptHandle})
+	next = receive(t, s, url, 10)
+	if len(next) != 1 || *next[0].Body != "a2" {
+		t.Fatalf("unexpected messages: %s", next)
+	}
+}
+
+func TestServiceRedrive(t *testing.T) {
+	s := New("us-east-1", "000000000000", "http://localhost:9324")
+	ctx := context.Background()
+	dlq := createQueue(t, s, "dlq", nil)
+	url := createQueue(t, s, "myqueue", map[string]string{
+		"VisibilityTimeout": "0",
+		"RedrivePolicy":     `{"deadLetterTargetArn":"arn:aws:sqs:us-east-1:000000000000:dlq","maxReceiveCount":2}`,
+	})
+	if _, err := s.SendMessageWithContext(ctx, &sqs.SendMessageInput{QueueUrl: aws.String(url), MessageBody: aws.String("poison")}); err != nil {
+		t.Fatalf("unexpected error captured: %#v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if msgs := receive(t, s, url, 1); len(msgs) != 1 {
+			t.Fatalf("message should be received: %d", i)
+		}
+	}
+	if msgs := receive(t, s, url, 1); len(msgs) != 0 {
+		t.Fatalf("message should be moved to dead letter queue: %s", msgs)
+	}
+	msgs := receive(t, s, dlq, 1)
+	if len(msgs) != 1 || *msgs[0].Body != "poison" {
+		t.Fatalf("unexpected messages in dead letter queue: %s", msgs)
+	}
+}